@@ -1,8 +1,12 @@
 package commands
 
 import (
-	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"fmt"
 	"sync"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
 )
 
 type buildsHelper struct {
@@ -17,7 +21,8 @@ func (b *buildsHelper) acquire(runner *common.RunnerConfig) bool {
 
 	// Check number of builds
 	count, _ := b.counts[runner.Token]
-	if runner.Limit > 0 && count >= runner.Limit {
+	limit := runner.GetLimit(time.Now())
+	if limit > 0 && count >= limit {
 		// Too many builds
 		return false
 	}
@@ -91,3 +96,15 @@ func (b *buildsHelper) removeBuild(deleteBuild *common.Build) bool {
 	}
 	return false
 }
+
+// notifyBuilds writes the warning to the traces of all running builds
+func (b *buildsHelper) notifyBuilds(message string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for _, build := range b.builds {
+		if build.Trace != nil {
+			fmt.Fprintln(build.Trace, helpers.ANSI_BOLD_YELLOW+"WARNING: "+message+helpers.ANSI_RESET)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package commands
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors/docker"
+	docker_helpers "gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/docker"
+)
+
+type CacheVolumesCleanupCommand struct {
+	configOptions
+	Name string `toml:"name" json:"name" short:"n" long:"name" description:"Name of the runner whose cache volumes are removed"`
+}
+
+func (c *CacheVolumesCleanupCommand) cleanup(runner *common.RunnerConfig) {
+	client, err := docker_helpers.New(runner.Docker.DockerCredentials, docker.DockerAPIVersion)
+	if err != nil {
+		runner.Log().Errorln("Failed to connect to Docker:", err)
+		return
+	}
+	defer docker_helpers.Close(client)
+
+	removed, err := docker.CleanupCacheVolumes(client, &runner.RunnerCredentials)
+	for _, name := range removed {
+		runner.Log().Println("Removed cache volume", name)
+	}
+	if err != nil {
+		runner.Log().Errorln("Failed to remove cache volumes:", err)
+	}
+}
+
+func (c *CacheVolumesCleanupCommand) Execute(context *cli.Context) {
+	err := c.loadConfig()
+	if err != nil {
+		log.Fatalln(err)
+		return
+	}
+
+	runners := c.config.Runners
+	if len(c.Name) > 0 {
+		runnerConfig, err := c.RunnerByName(c.Name)
+		if err != nil {
+			log.Fatalln(err)
+			return
+		}
+		runners = []*common.RunnerConfig{runnerConfig}
+	}
+
+	for _, runner := range runners {
+		if (runner.Executor != "docker" && runner.Executor != "docker-ssh") || runner.Docker == nil {
+			continue
+		}
+		c.cleanup(runner)
+	}
+}
+
+func init() {
+	common.RegisterCommand2("cache-volumes-cleanup", "remove the cache volumes of the Docker runners", &CacheVolumesCleanupCommand{})
+}
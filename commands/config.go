@@ -36,18 +36,32 @@ func (c *configOptions) loadConfig() error {
 	return nil
 }
 
-func (c *configOptions) touchConfig() error {
-	// try to load existing config
-	err := c.loadConfig()
+// updateConfig applies the change to the config file read again while holding its lock,
+// so the concurrent commands, eg. register, don't lose each other's changes.
+// The config is saved only if update returns true.
+func (c *configOptions) updateConfig(update func(config *common.Config) bool) error {
+	lock, err := common.LockConfigFile(c.ConfigFile)
 	if err != nil {
 		return err
 	}
+	defer lock.Unlock()
 
-	// save config for the first time
-	if !c.config.Loaded {
-		return c.saveConfig()
+	err = c.loadConfig()
+	if err != nil {
+		return err
 	}
-	return nil
+
+	if !update(c.config) {
+		return nil
+	}
+	return c.saveConfig()
+}
+
+func (c *configOptions) touchConfig() error {
+	// save config for the first time
+	return c.updateConfig(func(config *common.Config) bool {
+		return !config.Loaded
+	})
 }
 
 func (c *configOptions) RunnerByName(name string) (*common.RunnerConfig, error) {
@@ -0,0 +1,64 @@
+package commands
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+type ControlCommand struct {
+	ControlSocket string `long:"control-socket" env:"CONTROL_SOCKET" description:"Path to the control socket of running multi-runner"`
+}
+
+func (c *ControlCommand) Execute(context *cli.Context) {
+	if c.ControlSocket == "" {
+		log.Fatalln("Please specify the --control-socket")
+	}
+
+	command := strings.Join(context.Args(), " ")
+	if command == "" {
+		log.Fatalln("Please specify the command: status, reload, drain, undrain, pause <runner> or resume <runner>")
+	}
+
+	response, err := sendControlCommand(c.ControlSocket, command)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	fmt.Println(response)
+}
+
+// sendControlCommand sends the command to the control socket and returns the response
+func sendControlCommand(controlSocket, command string) (string, error) {
+	conn, err := net.Dial("unix", controlSocket)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	_, err = fmt.Fprintln(conn, command)
+	if err != nil {
+		return "", err
+	}
+
+	response, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	response = strings.TrimSpace(response)
+	if strings.HasPrefix(response, "ERROR:") {
+		return "", errors.New(strings.TrimSpace(strings.TrimPrefix(response, "ERROR:")))
+	}
+	return response, nil
+}
+
+func init() {
+	common.RegisterCommand2("control", "send a command to running multi-runner (status, reload, drain, undrain, pause, resume)", &ControlCommand{})
+}
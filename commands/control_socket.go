@@ -0,0 +1,241 @@
+package commands
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+
+	log "github.com/Sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+type controlRunnerStatus struct {
+	Name   string `json:"name"`
+	Token  string `json:"token"`
+	Paused bool   `json:"paused"`
+	Builds int    `json:"builds"`
+}
+
+type controlStatus struct {
+	PID         int                   `json:"pid"`
+	Draining    bool                  `json:"draining"`
+	Maintenance string                `json:"maintenance,omitempty"`
+	Builds      int                   `json:"builds"`
+	Runners     []controlRunnerStatus `json:"runners"`
+}
+
+// controlHelper holds the state changed with the control socket
+type controlHelper struct {
+	draining    bool
+	maintenance *common.MaintenanceWindow
+	paused      map[string]bool
+	lock        sync.Mutex
+}
+
+func (c *controlHelper) isPaused(runner *common.RunnerConfig) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.draining || c.maintenance != nil || c.paused[runner.UniqueID()]
+}
+
+func (c *controlHelper) setDraining(draining bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.draining = draining
+}
+
+// setMaintenance returns true when the runner enters or leaves the maintenance window
+func (c *controlHelper) setMaintenance(window *common.MaintenanceWindow) bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	changed := (c.maintenance == nil) != (window == nil)
+	c.maintenance = window
+	return changed
+}
+
+func (c *controlHelper) setPaused(runner *common.RunnerConfig, paused bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.paused == nil {
+		c.paused = make(map[string]bool)
+	}
+	if paused {
+		c.paused[runner.UniqueID()] = true
+	} else {
+		delete(c.paused, runner.UniqueID())
+	}
+}
+
+func (mr *RunCommand) findRunner(name string) (*common.RunnerConfig, error) {
+	for _, runner := range mr.getConfig().Runners {
+		if runner.Name == name || runner.ShortDescription() == name {
+			return runner, nil
+		}
+	}
+	return nil, fmt.Errorf("Could not find a runner with the name or token '%s'", name)
+}
+
+func (mr *RunCommand) controlStatus() *controlStatus {
+	status := &controlStatus{
+		PID: os.Getpid(),
+	}
+
+	mr.buildsHelper.lock.Lock()
+	status.Builds = len(mr.buildsHelper.builds)
+	counts := make(map[string]int)
+	for token, count := range mr.buildsHelper.counts {
+		counts[token] = count
+	}
+	mr.buildsHelper.lock.Unlock()
+
+	config := mr.getConfig()
+
+	mr.controlHelper.lock.Lock()
+	status.Draining = mr.controlHelper.draining
+	if mr.controlHelper.maintenance != nil {
+		status.Maintenance = mr.controlHelper.maintenance.String()
+	}
+	for _, runner := range config.Runners {
+		status.Runners = append(status.Runners, controlRunnerStatus{
+			Name:   runner.Name,
+			Token:  runner.ShortDescription(),
+			Paused: mr.controlHelper.paused[runner.UniqueID()],
+			Builds: counts[runner.Token],
+		})
+	}
+	mr.controlHelper.lock.Unlock()
+	return status
+}
+
+func (mr *RunCommand) executeControlCommand(line string) (interface{}, error) {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return nil, errors.New("empty command")
+	}
+
+	switch args[0] {
+	case "status":
+		return mr.controlStatus(), nil
+
+	case "reload":
+		select {
+		case mr.reloadSignal <- syscall.SIGHUP:
+		default:
+		}
+		return "config reload requested", nil
+
+	case "drain":
+		mr.controlHelper.setDraining(true)
+		mr.log().Warningln("Draining: no new builds will be requested")
+		return "draining", nil
+
+	case "undrain":
+		mr.controlHelper.setDraining(false)
+		mr.log().Println("Draining finished: builds will be requested")
+		return "not draining", nil
+
+	case "pause", "resume":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("usage: %s <runner-name-or-token>", args[0])
+		}
+		runner, err := mr.findRunner(args[1])
+		if err != nil {
+			return nil, err
+		}
+		paused := args[0] == "pause"
+		mr.controlHelper.setPaused(runner, paused)
+		runner.Log().WithField("paused", paused).Println("Runner state changed")
+		return runner.ShortDescription() + " " + args[0] + "d", nil
+
+	default:
+		return nil, fmt.Errorf("unknown command: %s", args[0])
+	}
+}
+
+func (mr *RunCommand) handleControlConnection(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if strings.TrimSpace(line) != "" {
+			if writeErr := mr.writeControlResponse(conn, line); writeErr != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (mr *RunCommand) writeControlResponse(w io.Writer, line string) error {
+	result, err := mr.executeControlCommand(line)
+	if err != nil {
+		_, err = fmt.Fprintln(w, "ERROR:", err)
+		return err
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
+
+func (mr *RunCommand) serveControlSocket() error {
+	if mr.ControlSocket == "" {
+		return nil
+	}
+	if runtime.GOOS == "windows" {
+		return errors.New("The control socket is not supported on Windows")
+	}
+
+	// remove the socket left by previous instance,
+	// the lock on config file makes sure that it's not used
+	os.Remove(mr.ControlSocket)
+
+	listener, err := net.Listen("unix", mr.ControlSocket)
+	if err != nil {
+		return fmt.Errorf("Failed to listen on control socket %s: %v", mr.ControlSocket, err)
+	}
+	os.Chmod(mr.ControlSocket, 0600)
+	mr.controlListener = listener
+
+	mr.log().Println("Listening for control commands on", mr.ControlSocket)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if mr.stopSignal == nil {
+					log.WithError(err).Errorln("Control socket failure")
+				}
+				return
+			}
+			go mr.handleControlConnection(conn)
+		}
+	}()
+	return nil
+}
+
+func (mr *RunCommand) closeControlSocket() {
+	if mr.controlListener != nil {
+		mr.controlListener.Close()
+		mr.controlListener = nil
+	}
+}
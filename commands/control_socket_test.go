@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const controlTestConfig = `
+[[runners]]
+  name = "docker-runner"
+  url = "https://gitlab.example.com/ci"
+  token = "abcdef1234567890"
+  executor = "docker"
+`
+
+func TestControlStatusWhileConfigIsReloaded(t *testing.T) {
+	file, err := ioutil.TempFile("", "config")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(controlTestConfig)
+	require.NoError(t, err)
+	file.Close()
+
+	mr := &RunCommand{configOptions: configOptions{ConfigFile: file.Name()}}
+	require.NoError(t, mr.loadConfig())
+
+	reloaded := make(chan bool)
+	go func() {
+		defer close(reloaded)
+		for i := 0; i < 10; i++ {
+			assert.NoError(t, mr.loadConfig())
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		status := mr.controlStatus()
+		if assert.Len(t, status.Runners, 1) {
+			assert.Equal(t, "docker-runner", status.Runners[0].Name)
+		}
+	}
+	<-reloaded
+
+	result, err := mr.executeControlCommand("pause docker-runner")
+	assert.NoError(t, err)
+	assert.Equal(t, "abcdef12 paused", result)
+}
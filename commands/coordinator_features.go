@@ -0,0 +1,31 @@
+package commands
+
+import (
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/network"
+)
+
+// detectCoordinatorFeatures detects the features of the coordinator used by the helpers of the build.
+// They're cached by the runner and passed to the helpers, so every helper process doesn't probe them again
+func detectCoordinatorFeatures(n common.Network, runner *common.RunnerConfig, build *common.Build) {
+	if _, ok := build.Options["artifacts"]; !ok {
+		return
+	}
+
+	signatures, err := network.PresignArtifactsUpload(runner.RunnerCredentials, build.ID, "artifacts.zip", "", time.Now(), helpers.RequestSignatureValidity)
+	if err != nil {
+		build.Log().WithError(err).Warningln("Failed to sign the detection of the artifacts direct upload")
+		return
+	}
+
+	build.SkipArtifactsDirectUpload = !n.IsArtifactsDirectUploadSupported(common.BuildCredentials{
+		ID:                build.ID,
+		Token:             build.Token,
+		URL:               runner.URL,
+		TLSCAFile:         runner.TLSCAFile,
+		RequestSignatures: signatures,
+	})
+}
@@ -25,7 +25,8 @@ import (
 type ExecCommand struct {
 	common.RunnerSettings
 	Job     string
-	Timeout int `long:"timeout" description:"Job execution timeout (in seconds)"`
+	Timeout int  `long:"timeout" description:"Job execution timeout (in seconds)"`
+	DryRun  bool `long:"dry-run" description:"Print the generated scripts and variables without executing them"`
 }
 
 func (c *ExecCommand) runCommand(name string, arg ...string) (string, error) {
@@ -230,6 +231,7 @@ func (c *ExecCommand) createBuild(repoURL string, abortSignal chan os.Signal) (b
 			RunnerSettings: c.RunnerSettings,
 		},
 		SystemInterrupt: abortSignal,
+		DryRun:          c.DryRun,
 	}
 	return
 }
@@ -9,6 +9,7 @@ import (
 	"github.com/codegangsta/cli"
 
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/archives"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/formatter"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/network"
@@ -17,11 +18,41 @@ import (
 type ArtifactsDownloaderCommand struct {
 	common.BuildCredentials
 	retryHelper
+	progressHelper
 	network common.Network
+
+	Paths     []string `long:"path" description:"Extract only the paths matching the pattern, eg. dist/**"`
+	Directory string   `long:"directory" description:"Extract artifacts into a different directory"`
+
+	TrustedMetadata bool `long:"trusted-metadata" description:"Restore the setuid, setgid and sticky bits of the extracted files"`
+
+	Project       string `long:"project" description:"Download the artifacts of the job from other project with the private token"`
+	TokenVariable string `long:"token-variable" description:"The environment variable with the private token of other project"`
+	Ref           string `long:"ref" description:"The ref of the latest successful job from other project"`
+	Job           string `long:"job" description:"The name of the job from other project"`
+}
+
+func (c *ArtifactsDownloaderCommand) downloadState(file string) common.DownloadState {
+	if c.Project == "" {
+		credentials := c.BuildCredentials
+		credentials.ProgressInterval = c.progressHelper.ProgressInterval
+		return c.network.DownloadArtifacts(credentials, file)
+	}
+
+	return c.network.DownloadProjectArtifacts(common.ProjectArtifactsCredentials{
+		URL:               c.URL,
+		Token:             os.Getenv(c.TokenVariable),
+		TLSCAFile:         c.TLSCAFile,
+		RequestSignatures: c.RequestSignatures,
+		Project:           c.Project,
+		Ref:               c.Ref,
+		Job:               c.Job,
+		ProgressInterval:  c.progressHelper.ProgressInterval,
+	}, file)
 }
 
 func (c *ArtifactsDownloaderCommand) download(file string) (bool, error) {
-	switch c.network.DownloadArtifacts(c.BuildCredentials, file) {
+	switch c.downloadState(file) {
 	case common.DownloadSucceeded:
 		return false, nil
 	case common.DownloadNotFound:
@@ -37,11 +68,19 @@ func (c *ArtifactsDownloaderCommand) download(file string) (bool, error) {
 
 func (c *ArtifactsDownloaderCommand) Execute(context *cli.Context) {
 	formatter.SetRunnerFormatter()
+	archives.TrustedMetadata = c.TrustedMetadata
 
 	if len(c.URL) == 0 || len(c.Token) == 0 {
 		logrus.Fatalln("Missing runner credentials")
 	}
-	if c.ID <= 0 {
+	if c.Project != "" {
+		if c.Ref == "" || c.Job == "" {
+			logrus.Fatalln("Missing ref or job of the project")
+		}
+		if c.TokenVariable == "" || os.Getenv(c.TokenVariable) == "" {
+			logrus.Fatalln("Missing private token of the project")
+		}
+	} else if c.ID <= 0 {
 		logrus.Fatalln("Missing build ID")
 	}
 
@@ -61,13 +100,31 @@ func (c *ArtifactsDownloaderCommand) Execute(context *cli.Context) {
 		logrus.Fatalln(err)
 	}
 
-	// Extract artifacts file
-	err = archives.ExtractZipFile(file.Name())
+	err = c.extract(file.Name())
 	if err != nil {
 		logrus.Fatalln(err)
 	}
 }
 
+func (c *ArtifactsDownloaderCommand) extract(fileName string) error {
+	if c.Directory != "" {
+		err := os.MkdirAll(c.Directory, 0777)
+		if err != nil {
+			return err
+		}
+
+		err = os.Chdir(c.Directory)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(c.Paths) > 0 {
+		return archives.ExtractZipFileMatching(fileName, c.Paths)
+	}
+	return archives.ExtractZipFile(fileName)
+}
+
 func init() {
 	common.RegisterCommand2("artifacts-downloader", "download and extract build artifacts (internal)", &ArtifactsDownloaderCommand{
 		network: &network.GitLabClient{},
@@ -75,5 +132,8 @@ func init() {
 			Retry:     2,
 			RetryTime: time.Second,
 		},
+		progressHelper: progressHelper{
+			ProgressInterval: helpers.ProgressReportInterval,
+		},
 	})
 }
@@ -1,7 +1,10 @@
 package helpers
 
 import (
+	"io/ioutil"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -93,3 +96,63 @@ func TestArtifactsDownloaderSucceeded(t *testing.T) {
 	fi, _ = os.Stat(artifactsTestArchivedFile)
 	assert.NotNil(t, fi)
 }
+
+func TestArtifactsDownloaderProgressInterval(t *testing.T) {
+	network := &testNetwork{
+		downloadState: common.DownloadSucceeded,
+	}
+	cmd := ArtifactsDownloaderCommand{
+		BuildCredentials: downloaderCredentials,
+		network:          network,
+		progressHelper: progressHelper{
+			ProgressInterval: time.Second,
+		},
+	}
+
+	defer os.Remove(artifactsTestArchivedFile)
+	cmd.Execute(nil)
+	assert.Equal(t, time.Second, network.downloadConfig.ProgressInterval)
+}
+
+func TestArtifactsDownloaderPathsNotMatching(t *testing.T) {
+	network := &testNetwork{
+		downloadState: common.DownloadSucceeded,
+	}
+	cmd := ArtifactsDownloaderCommand{
+		BuildCredentials: downloaderCredentials,
+		network:          network,
+		Paths:            []string{"dist/**"},
+	}
+
+	os.Remove(artifactsTestArchivedFile)
+	cmd.Execute(nil)
+	assert.Equal(t, 1, network.downloadCalled)
+	fi, _ := os.Stat(artifactsTestArchivedFile)
+	assert.Nil(t, fi)
+}
+
+func TestArtifactsDownloaderDirectory(t *testing.T) {
+	network := &testNetwork{
+		downloadState: common.DownloadSucceeded,
+	}
+
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	defer os.Chdir(wd)
+
+	dir, err := ioutil.TempDir("", "artifacts")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cmd := ArtifactsDownloaderCommand{
+		BuildCredentials: downloaderCredentials,
+		network:          network,
+		Paths:            []string{artifactsTestArchivedFile},
+		Directory:        filepath.Join(dir, "dependencies"),
+	}
+
+	cmd.Execute(nil)
+	assert.Equal(t, 1, network.downloadCalled)
+	fi, _ := os.Stat(filepath.Join(dir, "dependencies", artifactsTestArchivedFile))
+	assert.NotNil(t, fi)
+}
@@ -17,12 +17,16 @@ type testNetwork struct {
 	common.MockNetwork
 	downloadState  common.DownloadState
 	downloadCalled int
+	downloadConfig common.BuildCredentials
 	uploadState    common.UploadState
 	uploadCalled   int
+	directUpload   bool
+	directSize     int64
 }
 
 func (m *testNetwork) DownloadArtifacts(config common.BuildCredentials, artifactsFile string) common.DownloadState {
 	m.downloadCalled++
+	m.downloadConfig = config
 
 	if m.downloadState == common.DownloadSucceeded {
 		file, err := os.Create(artifactsFile)
@@ -39,6 +43,21 @@ func (m *testNetwork) DownloadArtifacts(config common.BuildCredentials, artifact
 	return m.downloadState
 }
 
+func (m *testNetwork) AuthorizeArtifacts(config common.BuildCredentials, baseName string) *common.ArtifactsUploadAuthorization {
+	if !m.directUpload {
+		return nil
+	}
+	return &common.ArtifactsUploadAuthorization{
+		RemoteURL:    "https://storage/artifacts.zip",
+		RemoteObject: "object-id",
+	}
+}
+
+func (m *testNetwork) UploadDirectArtifacts(config common.BuildCredentials, authorization *common.ArtifactsUploadAuthorization, reader io.Reader, size int64, baseName string, expireIn string) common.UploadState {
+	m.directSize = size
+	return m.UploadRawArtifacts(config, reader, baseName, expireIn)
+}
+
 func (m *testNetwork) UploadRawArtifacts(config common.BuildCredentials, reader io.Reader, baseName string, expireIn string) common.UploadState {
 	m.uploadCalled++
 
@@ -3,6 +3,7 @@ package helpers
 import (
 	"errors"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"time"
@@ -11,6 +12,7 @@ import (
 	"github.com/codegangsta/cli"
 
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/archives"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/formatter"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/network"
@@ -20,26 +22,16 @@ type ArtifactsUploaderCommand struct {
 	common.BuildCredentials
 	fileArchiver
 	retryHelper
+	progressHelper
 	network common.Network
 
-	Name     string `long:"name" description:"The name of the archive"`
-	ExpireIn string `long:"expire-in" description:"When to expire artifacts"`
+	Name           string `long:"name" description:"The name of the archive"`
+	ExpireIn       string `long:"expire-in" description:"When to expire artifacts"`
+	NoDirectUpload bool   `long:"no-direct-upload" description:"Don't ask for the direct upload, the runner detected that GitLab doesn't offer it"`
 }
 
-func (c *ArtifactsUploaderCommand) createAndUpload() (bool, error) {
-	pr, pw := io.Pipe()
-	defer pr.Close()
-
-	// Create the archive
-	go func() {
-		err := archives.CreateZipArchive(pw, c.sortedFiles())
-		pw.CloseWithError(err)
-	}()
-
-	artifactsName := path.Base(c.Name) + ".zip"
-
-	// Upload the data
-	switch c.network.UploadRawArtifacts(c.BuildCredentials, pr, artifactsName, c.ExpireIn) {
+func uploadStateToError(state common.UploadState) (bool, error) {
+	switch state {
 	case common.UploadSucceeded:
 		return false, nil
 	case common.UploadForbidden:
@@ -53,6 +45,70 @@ func (c *ArtifactsUploaderCommand) createAndUpload() (bool, error) {
 	}
 }
 
+func (c *ArtifactsUploaderCommand) createAndUploadDirect(authorization *common.ArtifactsUploadAuthorization, artifactsName string) (bool, error) {
+	// The object storage requires the size of the archive upfront
+	file, err := ioutil.TempFile("", "artifacts")
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	defer os.Remove(file.Name())
+
+	err = archives.CreateZipArchiveWithOptions(file, c.sortedFiles(), c.archiveOptions())
+	if err != nil {
+		return false, err
+	}
+
+	size, err := file.Seek(0, os.SEEK_CUR)
+	if err != nil {
+		return false, err
+	}
+	_, err = file.Seek(0, os.SEEK_SET)
+	if err != nil {
+		return false, err
+	}
+
+	progress := c.newProgressReader(file, size, "Uploading "+artifactsName)
+	return c.uploaded(artifactsName, progress, c.network.UploadDirectArtifacts(c.BuildCredentials, authorization, progress, size, artifactsName, c.ExpireIn))
+}
+
+func (c *ArtifactsUploaderCommand) createAndUpload() (bool, error) {
+	artifactsName := path.Base(c.Name) + ".zip"
+
+	// Store the archive directly in object storage, if the coordinator offers it
+	if !c.NoDirectUpload {
+		if authorization := c.network.AuthorizeArtifacts(c.BuildCredentials, artifactsName); authorization != nil {
+			return c.createAndUploadDirect(authorization, artifactsName)
+		}
+	}
+
+	pr, pw := io.Pipe()
+	defer pr.Close()
+
+	// Create the archive
+	go func() {
+		err := archives.CreateZipArchiveWithOptions(pw, c.sortedFiles(), c.archiveOptions())
+		pw.CloseWithError(err)
+	}()
+
+	// Upload the data, the size of the archive is not known upfront
+	progress := c.newProgressReader(pr, 0, "Uploading "+artifactsName)
+	return c.uploaded(artifactsName, progress, c.network.UploadRawArtifacts(c.BuildCredentials, progress, artifactsName, c.ExpireIn))
+}
+
+// uploaded reports the size of the stored archive, it's included in the build summary
+func (c *ArtifactsUploaderCommand) uploaded(artifactsName string, progress *helpers.ProgressReader, state common.UploadState) (bool, error) {
+	if state == common.UploadSucceeded {
+		logrus.Infof("Uploaded %s: %d bytes", artifactsName, progress.BytesRead())
+		common.WriteBuildEvent(os.Stderr, common.BuildEvent{
+			Type: common.BuildEventArtifactsUploaded,
+			Name: artifactsName,
+			Size: progress.BytesRead(),
+		})
+	}
+	return uploadStateToError(state)
+}
+
 func (c *ArtifactsUploaderCommand) Execute(*cli.Context) {
 	formatter.SetRunnerFormatter()
 
@@ -83,6 +139,9 @@ func init() {
 			Retry:     2,
 			RetryTime: time.Second,
 		},
+		progressHelper: progressHelper{
+			ProgressInterval: helpers.ProgressReportInterval,
+		},
 		Name: "artifacts",
 	})
 }
@@ -97,3 +97,46 @@ func TestArtifactsUploaderSucceeded(t *testing.T) {
 	fi, _ := os.Stat(artifactsTestArchivedFile)
 	assert.NotNil(t, fi)
 }
+
+func TestArtifactsUploaderDirectUpload(t *testing.T) {
+	network := &testNetwork{
+		uploadState:  common.UploadSucceeded,
+		directUpload: true,
+	}
+	cmd := ArtifactsUploaderCommand{
+		BuildCredentials: UploaderCredentials,
+		network:          network,
+		fileArchiver: fileArchiver{
+			Paths: []string{artifactsTestArchivedFile},
+		},
+	}
+
+	ioutil.WriteFile(artifactsTestArchivedFile, nil, 0600)
+	defer os.Remove(artifactsTestArchivedFile)
+
+	cmd.Execute(nil)
+	assert.Equal(t, 1, network.uploadCalled)
+	assert.True(t, network.directSize > 0, "the size of archive should be known for direct upload")
+}
+
+func TestArtifactsUploaderWithoutDirectUpload(t *testing.T) {
+	network := &testNetwork{
+		uploadState:  common.UploadSucceeded,
+		directUpload: true,
+	}
+	cmd := ArtifactsUploaderCommand{
+		BuildCredentials: UploaderCredentials,
+		network:          network,
+		fileArchiver: fileArchiver{
+			Paths: []string{artifactsTestArchivedFile},
+		},
+		NoDirectUpload: true,
+	}
+
+	ioutil.WriteFile(artifactsTestArchivedFile, nil, 0600)
+	defer os.Remove(artifactsTestArchivedFile)
+
+	cmd.Execute(nil)
+	assert.Equal(t, 1, network.uploadCalled)
+	assert.Equal(t, int64(0), network.directSize, "the direct upload isn't asked for")
+}
@@ -0,0 +1,74 @@
+package helpers
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/archives"
+)
+
+// isTarGzFile checks the gzip signature, so the cache can be extracted
+// even if the cache format of the runner was changed since it was created
+func isTarGzFile(fileName string) (bool, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	signature, err := bufio.NewReader(file).Peek(2)
+	if err == io.EOF {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return signature[0] == 0x1f && signature[1] == 0x8b, nil
+}
+
+func createCacheArchive(format common.CacheFormat, fileName string, fileNames []string, options *archives.ArchiveOptions) error {
+	if format == common.CacheFormatTarGz {
+		return archives.CreateTarGzFileWithOptions(fileName, fileNames, options)
+	}
+	return archives.CreateZipFileWithOptions(fileName, fileNames, options)
+}
+
+func extractCacheArchive(fileName string, filter func(name string) bool) error {
+	tarGz, err := isTarGzFile(fileName)
+	if err != nil {
+		return err
+	}
+
+	if tarGz {
+		return archives.ExtractTarGzFileFiltered(fileName, filter)
+	}
+	return archives.ExtractZipFileFiltered(fileName, filter)
+}
+
+// readTarGzEntry reads the entry stored at the beginning of the archive
+func readTarGzEntry(fileName, name string) ([]byte, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	compressed, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer compressed.Close()
+
+	archive := tar.NewReader(compressed)
+	th, err := archive.Next()
+	if err == io.EOF || err == nil && th.Name != name {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(archive)
+}
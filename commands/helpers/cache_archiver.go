@@ -1,6 +1,7 @@
 package helpers
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
@@ -11,15 +12,24 @@ import (
 	"github.com/codegangsta/cli"
 
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
-	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/archives"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/url"
 )
 
+// The builds archiving the same cache wait for each other, the archive is skipped when
+// the other build doesn't finish in time
+var cacheArchiveLockTimeout = 10 * time.Minute
+
 type CacheArchiverCommand struct {
 	fileArchiver
 	retryHelper
-	File string `long:"file" description:"The path to file"`
-	URL  string `long:"url" description:"Download artifacts instead of uploading them"`
+	progressHelper
+	cacheClient
+	File   string `long:"file" description:"The path to file"`
+	URL    string `long:"url" description:"Download artifacts instead of uploading them"`
+	Key    string `long:"key" description:"The cache key stored in metadata"`
+	Runner string `long:"runner" description:"The runner stored in metadata"`
+	Format string `long:"format" description:"The format of the archive: zip or tar.gz"`
 }
 
 func (c *CacheArchiverCommand) upload() (bool, error) {
@@ -36,7 +46,8 @@ func (c *CacheArchiverCommand) upload() (bool, error) {
 		return false, err
 	}
 
-	req, err := http.NewRequest("PUT", c.URL, file)
+	progress := c.newProgressReader(file, fi.Size(), "Uploading "+filepath.Base(c.File))
+	req, err := c.newRequest("PUT", c.URL, progress, c.Headers)
 	if err != nil {
 		return true, err
 	}
@@ -44,7 +55,12 @@ func (c *CacheArchiverCommand) upload() (bool, error) {
 	req.Header.Set("Last-Modified", fi.ModTime().Format(http.TimeFormat))
 	req.ContentLength = fi.Size()
 
-	resp, err := http.DefaultClient.Do(req)
+	client, err := c.httpClient()
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
 		return true, err
 	}
@@ -64,20 +80,46 @@ func (c *CacheArchiverCommand) Execute(*cli.Context) {
 		logrus.Fatalln("Missing --file")
 	}
 
+	format, err := common.CacheFormat(c.Format).Get()
+	if err != nil {
+		logrus.Fatalln(err)
+	}
+
 	// Enumerate files
-	err := c.enumerate()
+	err = c.enumerate()
 	if err != nil {
 		logrus.Fatalln(err)
 	}
 
+	// Serialize the builds archiving the same cache on this host, so the archive isn't uploaded
+	// while it's replaced by the other build
+	os.MkdirAll(filepath.Dir(c.File), 0700)
+	lock, err := helpers.WaitForLockFile(c.File+".lock", cacheArchiveLockTimeout)
+	if err == helpers.ErrFileLocked {
+		logrus.Warningln(filepath.Base(c.File), "is archived by other build, skipping")
+		return
+	} else if err != nil {
+		logrus.Fatalln(err)
+	}
+	defer lock.Unlock()
+
 	// Check if list of files changed
 	if !c.isFileChanged(c.File) {
 		logrus.Infoln("Archive is up to date!")
 		return
 	}
 
+	metadata, err := json.Marshal(newCacheMetadata(c.Key, c.Runner, c.Reproducible))
+	if err != nil {
+		logrus.Fatalln(err)
+	}
+
 	// Create archive
-	err = archives.CreateZipFile(c.File, c.sortedFiles())
+	options := c.archiveOptions()
+	options.Entries = map[string][]byte{
+		cacheMetadataFile: metadata,
+	}
+	err = createCacheArchive(format, c.File, c.sortedFiles(), options)
 	if err != nil {
 		logrus.Fatalln(err)
 	}
@@ -97,5 +139,8 @@ func init() {
 			Retry:     2,
 			RetryTime: time.Second,
 		},
+		progressHelper: progressHelper{
+			ProgressInterval: helpers.ProgressReportInterval,
+		},
 	})
 }
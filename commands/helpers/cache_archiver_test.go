@@ -20,6 +20,7 @@ func TestCacheArchiverIsUpToDate(t *testing.T) {
 	defer os.Remove(cacheArchiverTestArchivedFile)
 
 	defer os.Remove(cacheArchiverArchive)
+	defer os.Remove(cacheArchiverArchive + ".lock")
 	cmd := CacheArchiverCommand{
 		File: cacheArchiverArchive,
 		fileArchiver: fileArchiver{
@@ -68,6 +69,7 @@ func TestCacheArchiverRemoteServerNotFound(t *testing.T) {
 
 	helpers.MakeFatalToPanic()
 	os.Remove(cacheExtractorArchive)
+	defer os.Remove(cacheExtractorArchive + ".lock")
 	cmd := CacheArchiverCommand{
 		File: cacheExtractorArchive,
 		URL:  ts.URL + "/invalid-file.zip",
@@ -83,6 +85,7 @@ func TestCacheArchiverRemoteServe(t *testing.T) {
 
 	helpers.MakeFatalToPanic()
 	os.Remove(cacheExtractorArchive)
+	defer os.Remove(cacheExtractorArchive + ".lock")
 	cmd := CacheArchiverCommand{
 		File: cacheExtractorArchive,
 		URL:  ts.URL + "/cache.zip",
@@ -95,6 +98,7 @@ func TestCacheArchiverRemoteServe(t *testing.T) {
 func TestCacheArchiverRemoteServerDoesntFailOnInvalidServer(t *testing.T) {
 	helpers.MakeFatalToPanic()
 	os.Remove(cacheExtractorArchive)
+	defer os.Remove(cacheExtractorArchive + ".lock")
 	cmd := CacheArchiverCommand{
 		File: cacheExtractorArchive,
 		URL:  "http://localhost:65333/cache.zip",
@@ -106,3 +110,190 @@ func TestCacheArchiverRemoteServerDoesntFailOnInvalidServer(t *testing.T) {
 	_, err := os.Stat(cacheExtractorTestArchivedFile)
 	assert.Error(t, err)
 }
+
+func TestCacheArchiverStoresMetadata(t *testing.T) {
+	ioutil.WriteFile(cacheArchiverTestArchivedFile, nil, 0600)
+	defer os.Remove(cacheArchiverTestArchivedFile)
+
+	os.Setenv("CI_BUILD_REF", "1234567890abcdef")
+	defer os.Unsetenv("CI_BUILD_REF")
+
+	os.Remove(cacheArchiverArchive)
+	defer os.Remove(cacheArchiverArchive)
+	defer os.Remove(cacheArchiverArchive + ".lock")
+	cmd := CacheArchiverCommand{
+		File:   cacheArchiverArchive,
+		Key:    "build/master",
+		Runner: "abcdef12",
+		fileArchiver: fileArchiver{
+			Paths: []string{
+				cacheArchiverTestArchivedFile,
+			},
+		},
+	}
+	cmd.Execute(nil)
+
+	metadata, err := readCacheMetadata(cacheArchiverArchive)
+	assert.NoError(t, err)
+	if assert.NotNil(t, metadata) {
+		assert.Equal(t, "build/master", metadata.Key)
+		assert.Equal(t, "abcdef12", metadata.Runner)
+		assert.Equal(t, "1234567890abcdef", metadata.Sha)
+		assert.WithinDuration(t, time.Now(), metadata.CreatedAt, time.Minute)
+	}
+
+	os.Remove(cacheArchiverTestArchivedFile)
+	extractor := CacheExtractorCommand{
+		File: cacheArchiverArchive,
+	}
+	extractor.Execute(nil)
+
+	_, err = os.Stat(cacheArchiverTestArchivedFile)
+	assert.NoError(t, err)
+	_, err = os.Stat(cacheMetadataFile)
+	assert.True(t, os.IsNotExist(err), "metadata should not be extracted")
+}
+
+func TestCacheArchiverReproducibleMetadata(t *testing.T) {
+	ioutil.WriteFile(cacheArchiverTestArchivedFile, nil, 0600)
+	defer os.Remove(cacheArchiverTestArchivedFile)
+
+	os.Remove(cacheArchiverArchive)
+	defer os.Remove(cacheArchiverArchive)
+	defer os.Remove(cacheArchiverArchive + ".lock")
+	cmd := CacheArchiverCommand{
+		File: cacheArchiverArchive,
+		Key:  "build/master",
+		fileArchiver: fileArchiver{
+			Paths: []string{
+				cacheArchiverTestArchivedFile,
+			},
+			Reproducible: true,
+		},
+	}
+	cmd.Execute(nil)
+
+	metadata, err := readCacheMetadata(cacheArchiverArchive)
+	assert.NoError(t, err)
+	if assert.NotNil(t, metadata) {
+		assert.True(t, metadata.CreatedAt.IsZero(), "the creation time isn't stored")
+		assert.Contains(t, metadata.String(), "created at unknown time")
+	}
+}
+
+func TestCacheArchiverReproducibleArchivesAreIdentical(t *testing.T) {
+	ioutil.WriteFile(cacheArchiverTestArchivedFile, []byte("content"), 0600)
+	defer os.Remove(cacheArchiverTestArchivedFile)
+
+	defer os.Unsetenv("CI_BUILD_ID")
+	defer os.Unsetenv("CI_BUILD_REF_NAME")
+	defer os.Unsetenv("CI_BUILD_REF")
+
+	var archives [][]byte
+	for _, build := range []struct{ id, refName, sha, runner string }{
+		{"1", "master", "1234567890abcdef", "abcdef12"},
+		{"2", "feature", "fedcba0987654321", "12abcdef"},
+	} {
+		os.Setenv("CI_BUILD_ID", build.id)
+		os.Setenv("CI_BUILD_REF_NAME", build.refName)
+		os.Setenv("CI_BUILD_REF", build.sha)
+
+		os.Remove(cacheArchiverArchive)
+		cmd := CacheArchiverCommand{
+			File:   cacheArchiverArchive,
+			Key:    "build/master",
+			Runner: build.runner,
+			fileArchiver: fileArchiver{
+				Paths: []string{
+					cacheArchiverTestArchivedFile,
+				},
+				Reproducible: true,
+			},
+		}
+		cmd.Execute(nil)
+
+		archive, err := ioutil.ReadFile(cacheArchiverArchive)
+		assert.NoError(t, err)
+		archives = append(archives, archive)
+	}
+	os.Remove(cacheArchiverArchive)
+	os.Remove(cacheArchiverArchive + ".lock")
+
+	assert.NotEmpty(t, archives[0])
+	assert.Equal(t, archives[0], archives[1], "the builds create the byte-identical archives")
+}
+
+func TestCacheArchiverTarGzFormat(t *testing.T) {
+	ioutil.WriteFile(cacheArchiverTestArchivedFile, []byte("content"), 0640)
+	defer os.Remove(cacheArchiverTestArchivedFile)
+
+	const tarGzArchive = "archive.tar.gz"
+	os.Remove(tarGzArchive)
+	defer os.Remove(tarGzArchive)
+	defer os.Remove(tarGzArchive + ".lock")
+	cmd := CacheArchiverCommand{
+		File:   tarGzArchive,
+		Key:    "build/master",
+		Format: "tar.gz",
+		fileArchiver: fileArchiver{
+			Paths: []string{
+				cacheArchiverTestArchivedFile,
+			},
+		},
+	}
+	cmd.Execute(nil)
+
+	tarGz, err := isTarGzFile(tarGzArchive)
+	assert.NoError(t, err)
+	assert.True(t, tarGz)
+
+	metadata, err := readCacheMetadata(tarGzArchive)
+	assert.NoError(t, err)
+	if assert.NotNil(t, metadata) {
+		assert.Equal(t, "build/master", metadata.Key)
+	}
+
+	os.Remove(cacheArchiverTestArchivedFile)
+	extractor := CacheExtractorCommand{
+		File: tarGzArchive,
+	}
+	extractor.Execute(nil)
+
+	fi, err := os.Stat(cacheArchiverTestArchivedFile)
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0640), fi.Mode().Perm())
+	}
+	_, err = os.Stat(cacheMetadataFile)
+	assert.True(t, os.IsNotExist(err), "metadata should not be extracted")
+}
+
+func TestCacheArchiverSkipsCacheLockedByOtherBuild(t *testing.T) {
+	ioutil.WriteFile(cacheArchiverTestArchivedFile, nil, 0600)
+	defer os.Remove(cacheArchiverTestArchivedFile)
+
+	os.Remove(cacheArchiverArchive)
+	defer os.Remove(cacheArchiverArchive + ".lock")
+	lock, err := helpers.NewLockFile(cacheArchiverArchive + ".lock")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer lock.Unlock()
+
+	defer func(timeout time.Duration) {
+		cacheArchiveLockTimeout = timeout
+	}(cacheArchiveLockTimeout)
+	cacheArchiveLockTimeout = 10 * time.Millisecond
+
+	cmd := CacheArchiverCommand{
+		File: cacheArchiverArchive,
+		fileArchiver: fileArchiver{
+			Paths: []string{
+				cacheArchiverTestArchivedFile,
+			},
+		},
+	}
+	cmd.Execute(nil)
+
+	_, err = os.Stat(cacheArchiverArchive)
+	assert.True(t, os.IsNotExist(err), "the archive is created by the other build")
+}
@@ -0,0 +1,78 @@
+package helpers
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
+)
+
+// The dual stack dialer connects to the cache servers on the IPv6-only hosts too
+var cacheDialer = &net.Dialer{
+	Timeout:   30 * time.Second,
+	KeepAlive: 30 * time.Second,
+	DualStack: true,
+}
+
+// cacheClient is used to access the cache server,
+// that can use the certificate signed by a custom CA
+type cacheClient struct {
+	TLSCAFile     string   `long:"tls-ca-file" env:"CI_CACHE_TLS_CA_FILE" description:"File containing the certificates to verify the cache server"`
+	TLSSkipVerify bool     `long:"tls-skip-verify" description:"Don't verify the TLS certificate of the cache server"`
+	Headers       []string `long:"header" description:"The header of the cache request pre-signed by the runner, as Name: value"`
+}
+
+// newRequest creates the request to the cache server with the headers passed by the runner
+func (c *cacheClient) newRequest(method, url string, body io.Reader, headers []string) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	extraHeaders, err := helpers.ParseRequestHeaders(headers)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range extraHeaders {
+		req.Header[name] = values
+	}
+	return req, nil
+}
+
+func (c *cacheClient) httpClient() (*http.Client, error) {
+	if c.TLSCAFile == "" && !c.TLSSkipVerify {
+		return http.DefaultClient, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS10,
+		InsecureSkipVerify: c.TLSSkipVerify,
+	}
+
+	if c.TLSCAFile != "" && !c.TLSSkipVerify {
+		data, err := ioutil.ReadFile(c.TLSCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool, ok := helpers.NewCertPool(data)
+		if !ok {
+			return nil, fmt.Errorf("Failed to parse PEM in %s", c.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			Dial:                cacheDialer.Dial,
+			TLSHandshakeTimeout: 10 * time.Second,
+			TLSClientConfig:     tlsConfig,
+		},
+	}, nil
+}
@@ -0,0 +1,69 @@
+package helpers
+
+import (
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
+)
+
+func TestCacheClientWithCustomCA(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	caFile, err := ioutil.TempFile("", "cache-ca")
+	require.NoError(t, err)
+	defer os.Remove(caFile.Name())
+
+	pem.Encode(caFile, &pem.Block{Type: "CERTIFICATE", Bytes: ts.TLS.Certificates[0].Certificate[0]})
+	caFile.Close()
+
+	client, err := (&cacheClient{}).httpClient()
+	require.NoError(t, err)
+	_, err = client.Get(ts.URL)
+	assert.Error(t, err, "the certificate is not trusted by default")
+
+	client, err = (&cacheClient{TLSCAFile: caFile.Name()}).httpClient()
+	require.NoError(t, err)
+	resp, err := client.Get(ts.URL)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+	}
+
+	client, err = (&cacheClient{TLSSkipVerify: true}).httpClient()
+	require.NoError(t, err)
+	resp, err = client.Get(ts.URL)
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+	}
+}
+
+func TestCacheClientWithInvalidCA(t *testing.T) {
+	_, err := (&cacheClient{TLSCAFile: "not-existing-file"}).httpClient()
+	assert.Error(t, err)
+}
+
+func TestCacheClientRequestHeaders(t *testing.T) {
+	client := &cacheClient{}
+
+	req, err := client.newRequest("PUT", "https://minio.example.com/bucket/cache.zip", strings.NewReader("archive"), []string{
+		helpers.RequestSignatureHeader + ": signature",
+		helpers.RequestExpiresHeader + ": 1500003600",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "signature", req.Header.Get(helpers.RequestSignatureHeader), "the request is pre-signed by the runner")
+	assert.Equal(t, "1500003600", req.Header.Get(helpers.RequestExpiresHeader))
+
+	_, err = client.newRequest("GET", "https://minio.example.com/bucket/cache.zip", nil, []string{"invalid"})
+	assert.Error(t, err)
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/codegangsta/cli"
 
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/archives"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/formatter"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/url"
@@ -20,21 +21,39 @@ import (
 
 type CacheExtractorCommand struct {
 	retryHelper
-	File string `long:"file" description:"The file containing your cache artifacts"`
-	URL  string `long:"url" description:"Download artifacts instead of uploading them"`
+	progressHelper
+	cacheClient
+	File         string `long:"file" description:"The file containing your cache artifacts"`
+	URL          string `long:"url" description:"Download artifacts instead of uploading them"`
+	FallbackFile string `long:"fallback-file" description:"The file containing the cache used when the file is missing"`
+	FallbackURL  string `long:"fallback-url" description:"Download the fallback cache from this address"`
+
+	FallbackHeaders []string `long:"fallback-header" description:"The header of the fallback cache request pre-signed by the runner, as Name: value"`
+
+	TrustedMetadata bool `long:"trusted-metadata" description:"Restore the setuid, setgid and sticky bits of the extracted files and the owners of the tar.gz entries"`
 }
 
-func (c *CacheExtractorCommand) download() (bool, error) {
-	os.MkdirAll(filepath.Dir(c.File), 0600)
+func (c *CacheExtractorCommand) download(fileName, downloadURL string, headers []string) (bool, error) {
+	os.MkdirAll(filepath.Dir(fileName), 0600)
 
-	file, err := ioutil.TempFile(filepath.Dir(c.File), "cache")
+	file, err := ioutil.TempFile(filepath.Dir(fileName), "cache")
 	if err != nil {
 		return false, err
 	}
 	defer file.Close()
 	defer os.Remove(file.Name())
 
-	resp, err := http.Get(c.URL)
+	client, err := c.httpClient()
+	if err != nil {
+		return false, err
+	}
+
+	req, err := c.newRequest("GET", downloadURL, nil, headers)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
 		return true, err
 	}
@@ -48,44 +67,71 @@ func (c *CacheExtractorCommand) download() (bool, error) {
 		return retry, fmt.Errorf("Received: %s", resp.Status)
 	}
 
-	fi, _ := os.Lstat(c.File)
+	fi, _ := os.Lstat(fileName)
 	date, _ := time.Parse(http.TimeFormat, resp.Header.Get("Last-Modified"))
 	if fi != nil && !date.After(fi.ModTime()) {
-		logrus.Infoln(filepath.Base(c.File), "is up to date")
+		logrus.Infoln(filepath.Base(fileName), "is up to date")
 		return false, nil
 	}
 
-	logrus.Infoln("Downloading", filepath.Base(c.File), "from", url_helpers.CleanURL(c.URL))
-	_, err = io.Copy(file, resp.Body)
+	logrus.Infoln("Downloading", filepath.Base(fileName), "from", url_helpers.CleanURL(downloadURL))
+	progress := c.newProgressReader(resp.Body, resp.ContentLength, "Downloading "+filepath.Base(fileName))
+	_, err = io.Copy(file, progress)
 	if err != nil {
 		return true, err
 	}
 	os.Chtimes(file.Name(), time.Now(), date)
 
-	err = os.Rename(file.Name(), c.File)
+	err = os.Rename(file.Name(), fileName)
 	if err != nil {
 		return false, err
 	}
 	return false, nil
 }
 
+// fetch downloads the file if needed and checks if it exists
+func (c *CacheExtractorCommand) fetch(fileName, downloadURL string, headers []string) bool {
+	if downloadURL != "" {
+		err := c.doRetry(func() (bool, error) {
+			return c.download(fileName, downloadURL, headers)
+		})
+		if err != nil && !os.IsNotExist(err) {
+			logrus.Warningln(err)
+		}
+	}
+
+	if _, err := os.Stat(fileName); err != nil {
+		return false
+	}
+	printCacheMetadata(fileName)
+	return true
+}
+
 func (c *CacheExtractorCommand) Execute(context *cli.Context) {
 	formatter.SetRunnerFormatter()
+	archives.TrustedMetadata = c.TrustedMetadata
 
 	if len(c.File) == 0 {
 		logrus.Fatalln("Missing cache file")
 	}
 
-	if c.URL != "" {
-		err := c.doRetry(c.download)
-		if err != nil && !os.IsNotExist(err) {
-			logrus.Warningln(err)
-		}
+	fileName := c.File
+	if !c.fetch(c.File, c.URL, c.Headers) && c.FallbackFile != "" {
+		logrus.Infoln("Cache not found, using the cache of the default branch")
+		fileName = c.FallbackFile
+		c.fetch(c.FallbackFile, c.FallbackURL, c.FallbackHeaders)
 	}
 
-	err := archives.ExtractZipFile(c.File)
-	if err != nil && !os.IsNotExist(err) {
+	err := extractCacheArchive(fileName, func(name string) bool {
+		return name != cacheMetadataFile
+	})
+	if os.IsNotExist(err) {
+		common.WriteBuildEvent(os.Stderr, common.BuildEvent{Type: common.BuildEventCacheMissed})
+	} else if err != nil {
 		logrus.Fatalln(err)
+	} else {
+		logrus.Infoln("Successfully extracted cache")
+		common.WriteBuildEvent(os.Stderr, common.BuildEvent{Type: common.BuildEventCacheRestored})
 	}
 }
 
@@ -95,5 +141,8 @@ func init() {
 			Retry:     2,
 			RetryTime: time.Second,
 		},
+		progressHelper: progressHelper{
+			ProgressInterval: helpers.ProgressReportInterval,
+		},
 	})
 }
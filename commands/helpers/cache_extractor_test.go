@@ -132,6 +132,39 @@ func TestCacheExtractorRemoteServer(t *testing.T) {
 	}, "archive is up to date")
 }
 
+func TestCacheExtractorRequestHeaders(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "secret" {
+			http.Error(w, "403 Forbidden", 403)
+			return
+		}
+		testServeCache(w, r)
+	}))
+	defer ts.Close()
+
+	defer os.Remove(cacheExtractorArchive)
+	defer os.Remove(cacheExtractorTestArchivedFile)
+	os.Remove(cacheExtractorArchive)
+	os.Remove(cacheExtractorTestArchivedFile)
+
+	helpers.MakeFatalToPanic()
+	cmd := CacheExtractorCommand{
+		File:            "missing.zip",
+		URL:             ts.URL + "/cache.zip",
+		FallbackFile:    cacheExtractorArchive,
+		FallbackURL:     ts.URL + "/cache.zip",
+		FallbackHeaders: []string{"X-Api-Key: secret"},
+	}
+	assert.NotPanics(t, func() {
+		cmd.Execute(nil)
+	})
+
+	_, err := os.Stat("missing.zip")
+	assert.True(t, os.IsNotExist(err), "the cache isn't downloaded without the header")
+	_, err = os.Stat(cacheExtractorTestArchivedFile)
+	assert.NoError(t, err, "the fallback cache is downloaded with its header")
+}
+
 func TestCacheExtractorRemoteServerDoesntFailOnInvalidServer(t *testing.T) {
 	helpers.MakeFatalToPanic()
 	os.Remove(cacheExtractorArchive)
@@ -146,3 +179,29 @@ func TestCacheExtractorRemoteServerDoesntFailOnInvalidServer(t *testing.T) {
 	_, err := os.Stat(cacheExtractorTestArchivedFile)
 	assert.Error(t, err)
 }
+
+func TestCacheExtractorFallbackRemoteServer(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(testServeCache))
+	defer ts.Close()
+
+	defer os.Remove(cacheExtractorArchive)
+	defer os.Remove(cacheExtractorTestArchivedFile)
+	os.Remove(cacheExtractorArchive)
+	os.Remove(cacheExtractorTestArchivedFile)
+
+	helpers.MakeFatalToPanic()
+	cmd := CacheExtractorCommand{
+		File:         "non-existing-test.zip",
+		URL:          ts.URL + "/invalid-file.zip",
+		FallbackFile: cacheExtractorArchive,
+		FallbackURL:  ts.URL + "/cache.zip",
+	}
+	assert.NotPanics(t, func() {
+		cmd.Execute(nil)
+	})
+
+	_, err := os.Stat(cacheExtractorTestArchivedFile)
+	assert.NoError(t, err)
+	_, err = os.Stat("non-existing-test.zip")
+	assert.Error(t, err)
+}
@@ -0,0 +1,128 @@
+package helpers
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// cacheMetadataFile is stored in the cache archive, but it's never extracted
+const cacheMetadataFile = ".gitlab-runner-cache.json"
+
+type cacheMetadata struct {
+	CreatedAt time.Time `json:"created_at"`
+	Key       string    `json:"key,omitempty"`
+	Runner    string    `json:"runner,omitempty"`
+	BuildID   string    `json:"build_id,omitempty"`
+	RefName   string    `json:"ref_name,omitempty"`
+	Sha       string    `json:"sha,omitempty"`
+}
+
+func newCacheMetadata(key, runner string, reproducible bool) *cacheMetadata {
+	// The reproducible archives store only the key, so the identical content
+	// gives the identical archive whatever build, runner and time it's created by
+	if reproducible {
+		return &cacheMetadata{Key: key}
+	}
+
+	return &cacheMetadata{
+		CreatedAt: time.Now().UTC(),
+		Key:       key,
+		Runner:    runner,
+		BuildID:   os.Getenv("CI_BUILD_ID"),
+		RefName:   os.Getenv("CI_BUILD_REF_NAME"),
+		Sha:       os.Getenv("CI_BUILD_REF"),
+	}
+}
+
+func (m *cacheMetadata) String() string {
+	description := "created at unknown time"
+	if !m.CreatedAt.IsZero() {
+		age := time.Since(m.CreatedAt)
+		if age < 0 {
+			age = 0
+		}
+
+		description = fmt.Sprintf("created at %s (%s ago)",
+			m.CreatedAt.Local().Format(time.RFC1123), age-age%time.Second)
+	}
+	if m.Key != "" {
+		description += fmt.Sprintf(" with key %q", m.Key)
+	}
+	if m.Runner != "" {
+		description += " by runner " + m.Runner
+	}
+	if m.BuildID != "" {
+		description += " in build " + m.BuildID
+	}
+	if m.RefName != "" {
+		description += " for " + m.RefName
+	}
+	if m.Sha != "" {
+		description += " at " + m.Sha
+	}
+	return description
+}
+
+func parseCacheMetadata(data []byte) (*cacheMetadata, error) {
+	metadata := &cacheMetadata{}
+	err := json.Unmarshal(data, metadata)
+	if err != nil {
+		return nil, err
+	}
+	return metadata, nil
+}
+
+func readCacheMetadata(fileName string) (*cacheMetadata, error) {
+	if tarGz, err := isTarGzFile(fileName); err != nil {
+		return nil, err
+	} else if tarGz {
+		data, err := readTarGzEntry(fileName, cacheMetadataFile)
+		if err != nil || data == nil {
+			return nil, err
+		}
+		return parseCacheMetadata(data)
+	}
+
+	archive, err := zip.OpenReader(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+
+	for _, file := range archive.File {
+		if file.Name != cacheMetadataFile {
+			continue
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+
+		data, err := ioutil.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		return parseCacheMetadata(data)
+	}
+	return nil, nil
+}
+
+func printCacheMetadata(fileName string) {
+	metadata, err := readCacheMetadata(fileName)
+	if err != nil {
+		logrus.Warningln("Failed to read cache metadata:", err)
+	} else if metadata != nil {
+		logrus.Infoln("Cache", metadata)
+	} else {
+		logrus.Infoln("Cache metadata is not available")
+	}
+}
@@ -14,15 +14,22 @@ import (
 	"time"
 
 	"github.com/Sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/archives"
 )
 
 type fileArchiver struct {
 	Paths     []string `long:"path" description:"Add paths to archive"`
+	Exclude   []string `long:"exclude" description:"Exclude paths from archive using .gitignore patterns"`
 	Untracked bool     `long:"untracked" description:"Add git untracked files"`
 	Verbose   bool     `long:"verbose" description:"Detailed information"`
 
-	wd    string
-	files map[string]os.FileInfo
+	Reproducible     bool   `long:"reproducible" description:"Create identical archive for identical content"`
+	CompressionLevel string `long:"compression-level" description:"The compression level of the archive: fastest, fast, default, slow or slowest"`
+
+	wd       string
+	files    map[string]os.FileInfo
+	excluded int
 }
 
 func (c *fileArchiver) isChanged(modTime time.Time) bool {
@@ -65,9 +72,22 @@ func (c *fileArchiver) add(path string) (err error) {
 
 	// Check if file exist
 	info, err := os.Lstat(path)
-	if err == nil {
-		c.files[path] = info
+	if err != nil {
+		return
 	}
+
+	if archives.IsExcludedPath(c.Exclude, path, info.IsDir()) {
+		if c.Verbose {
+			logrus.Infoln("Excluding", path)
+		}
+		c.excluded++
+		return
+	}
+
+	if c.Verbose {
+		logrus.Infoln("Adding", path)
+	}
+	c.files[path] = info
 	return
 }
 
@@ -168,7 +188,20 @@ func (c *fileArchiver) processUntracked() {
 	}
 }
 
+// archiveOptions returns the options of creating the archive with the files
+func (c *fileArchiver) archiveOptions() *archives.ArchiveOptions {
+	return &archives.ArchiveOptions{
+		Reproducible:     c.Reproducible,
+		CompressionLevel: archives.CompressionLevel(c.CompressionLevel),
+	}
+}
+
 func (c *fileArchiver) enumerate() error {
+	// Fail before looking for the files, the archive can't be created anyway
+	if _, err := archives.CompressionLevel(c.CompressionLevel).Get(); err != nil {
+		return err
+	}
+
 	wd, err := os.Getwd()
 	if err != nil {
 		return fmt.Errorf("Failed to get current working directory: %v", err)
@@ -177,7 +210,13 @@ func (c *fileArchiver) enumerate() error {
 	c.wd = wd
 	c.files = make(map[string]os.FileInfo)
 
+	c.excluded = 0
+
 	c.processPaths()
 	c.processUntracked()
+
+	if c.excluded > 0 {
+		logrus.Infof("excluded %d files", c.excluded)
+	}
 	return nil
 }
@@ -7,6 +7,8 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"time"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/archives"
 )
 
 const fileArchiverUntrackedFile = "untracked_test_file.txt"
@@ -90,3 +92,38 @@ func TestFileArchiverChanged(t *testing.T) {
 	assert.True(t, f.isFileChanged(fileArchiverOtherFile), "should return true if file was modified")
 	assert.True(t, f.isFileChanged(fileArchiverNotExistingFile), "should return true if file doesn't exist")
 }
+
+func TestFileArchiverExcludingFiles(t *testing.T) {
+	os.MkdirAll("exclude_test_dir/tmp", 0700)
+	defer os.RemoveAll("exclude_test_dir")
+	ioutil.WriteFile("exclude_test_dir/app", nil, 0600)
+	ioutil.WriteFile("exclude_test_dir/tmp/object", nil, 0600)
+
+	f := fileArchiver{
+		Paths:   []string{"exclude_test_dir"},
+		Exclude: []string{"exclude_test_dir/tmp/**"},
+	}
+	err := f.enumerate()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"exclude_test_dir", "exclude_test_dir/app", "exclude_test_dir/tmp"}, f.sortedFiles(),
+		"only the contents of the directory are excluded")
+}
+
+func TestFileArchiverInvalidCompressionLevel(t *testing.T) {
+	f := fileArchiver{
+		Paths:            []string{fileArchiverUntrackedFile},
+		CompressionLevel: "best",
+	}
+	err := f.enumerate()
+	assert.Error(t, err)
+}
+
+func TestFileArchiverArchiveOptions(t *testing.T) {
+	f := fileArchiver{
+		Reproducible:     true,
+		CompressionLevel: "fastest",
+	}
+	options := f.archiveOptions()
+	assert.True(t, options.Reproducible)
+	assert.Equal(t, archives.CompressionFastest, options.CompressionLevel)
+}
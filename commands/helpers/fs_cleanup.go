@@ -0,0 +1,39 @@
+package helpers
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/formatter"
+)
+
+type FsCleanupCommand struct {
+	Path string `long:"path" description:"The directory to remove"`
+}
+
+func (c *FsCleanupCommand) cleanup() error {
+	path := filepath.Clean(c.Path)
+	if c.Path == "" || path == "/" || path == "." {
+		return os.ErrInvalid
+	}
+
+	logrus.Infoln("Removing", path)
+	return os.RemoveAll(path)
+}
+
+func (c *FsCleanupCommand) Execute(context *cli.Context) {
+	formatter.SetRunnerFormatter()
+
+	err := c.cleanup()
+	if err != nil {
+		logrus.Fatalln(err)
+	}
+}
+
+func init() {
+	common.RegisterCommand2("fs-cleanup", "remove the build directory (internal)", &FsCleanupCommand{})
+}
@@ -0,0 +1,37 @@
+package helpers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFsCleanup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fs-cleanup")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	projectDir := filepath.Join(dir, "group", "project")
+	require.NoError(t, os.MkdirAll(filepath.Join(projectDir, ".git"), 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(projectDir, "file"), []byte("data"), 0400))
+
+	cmd := FsCleanupCommand{Path: projectDir}
+	assert.NoError(t, cmd.cleanup())
+
+	_, err = os.Stat(projectDir)
+	assert.True(t, os.IsNotExist(err))
+
+	_, err = os.Stat(filepath.Join(dir, "group"))
+	assert.NoError(t, err)
+}
+
+func TestFsCleanupRequiresPath(t *testing.T) {
+	for _, path := range []string{"", "/", "."} {
+		cmd := FsCleanupCommand{Path: path}
+		assert.Equal(t, os.ErrInvalid, cmd.cleanup(), path)
+	}
+}
@@ -0,0 +1,122 @@
+package helpers
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+type HealthCheckCommand struct {
+	DialTimeout time.Duration `long:"dial-timeout" description:"How long to wait for a single connection"`
+	RetryTime   time.Duration `long:"retry-time" description:"How long to wait between connection attempts"`
+	Host        string        `long:"host" description:"The host of the service, used together with --port"`
+	Port        int           `long:"port" description:"The port of the service, instead of the first one exposed by the link"`
+	Path        string        `long:"path" description:"The HTTP path that has to respond without an error status"`
+}
+
+// serviceAddress is discovered from the *_TCP_ADDR and *_TCP_PORT variables
+// that docker defines for the linked containers
+func serviceAddress(environ []string) (string, error) {
+	hosts := make(map[string]string)
+	ports := make(map[string]string)
+	for _, variable := range environ {
+		parts := strings.SplitN(variable, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if strings.HasSuffix(parts[0], "_TCP_ADDR") {
+			hosts[strings.TrimSuffix(parts[0], "_ADDR")] = parts[1]
+		} else if strings.HasSuffix(parts[0], "_TCP_PORT") {
+			ports[strings.TrimSuffix(parts[0], "_PORT")] = parts[1]
+		}
+	}
+
+	var prefixes []string
+	for prefix := range hosts {
+		if ports[prefix] != "" && hosts[prefix] != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	if len(prefixes) == 0 {
+		return "", fmt.Errorf("No HOST or PORT")
+	}
+
+	sort.Strings(prefixes)
+	return net.JoinHostPort(hosts[prefixes[0]], ports[prefixes[0]]), nil
+}
+
+func (c *HealthCheckCommand) address() (string, error) {
+	if c.Port != 0 {
+		return net.JoinHostPort(c.Host, strconv.Itoa(c.Port)), nil
+	}
+	return serviceAddress(os.Environ())
+}
+
+func (c *HealthCheckCommand) checkService(address string) error {
+	if c.Path == "" {
+		conn, err := net.DialTimeout("tcp", address, c.DialTimeout)
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+
+	path := c.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	client := http.Client{Timeout: c.DialTimeout}
+	resp, err := client.Get("http://" + address + path)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("status %s", resp.Status)
+	}
+	return nil
+}
+
+func (c *HealthCheckCommand) waitForService(address string) {
+	for {
+		if c.checkService(address) == nil {
+			return
+		}
+		fmt.Print(".")
+		time.Sleep(c.RetryTime)
+	}
+}
+
+func (c *HealthCheckCommand) Execute(context *cli.Context) {
+	address, err := c.address()
+	if err != nil {
+		logrus.Fatalln(err)
+	}
+
+	if c.Path != "" {
+		fmt.Printf("waiting for HTTP response from %s%s...", address, c.Path)
+	} else {
+		fmt.Printf("waiting for TCP connection to %s...", address)
+	}
+	c.waitForService(address)
+	fmt.Println("ok")
+}
+
+func init() {
+	common.RegisterCommand2("health-check", "check health for a specific address (internal)", &HealthCheckCommand{
+		DialTimeout: time.Second,
+		RetryTime:   time.Second,
+	})
+}
@@ -0,0 +1,83 @@
+package helpers
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceAddress(t *testing.T) {
+	address, err := serviceAddress([]string{
+		"PATH=/bin",
+		"REDIS_PORT_6379_TCP_PORT=6379",
+		"POSTGRES_PORT_5432_TCP_ADDR=172.17.0.3",
+		"POSTGRES_PORT_5432_TCP_PORT=5432",
+		"REDIS_PORT_6379_TCP_ADDR=172.17.0.2",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "172.17.0.3:5432", address)
+}
+
+func TestServiceAddressMissing(t *testing.T) {
+	_, err := serviceAddress([]string{
+		"PATH=/bin",
+		"POSTGRES_PORT_5432_TCP_ADDR=172.17.0.3",
+	})
+	assert.Error(t, err)
+}
+
+func TestHealthCheckWaitsForService(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	cmd := &HealthCheckCommand{
+		DialTimeout: time.Second,
+		RetryTime:   10 * time.Millisecond,
+	}
+
+	done := make(chan struct{})
+	go func() {
+		cmd.waitForService(listener.Addr().String())
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("health check didn't finish")
+	}
+}
+
+func TestHealthCheckAddress(t *testing.T) {
+	cmd := &HealthCheckCommand{Host: "db", Port: 5432}
+	address, err := cmd.address()
+	assert.NoError(t, err)
+	assert.Equal(t, "db:5432", address)
+}
+
+func TestHealthCheckHTTPPath(t *testing.T) {
+	ready := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ready || r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	cmd := &HealthCheckCommand{
+		DialTimeout: time.Second,
+		Path:        "health",
+	}
+	address := strings.TrimPrefix(server.URL, "http://")
+	assert.Error(t, cmd.checkService(address), "the service isn't ready yet")
+
+	ready = true
+	assert.NoError(t, cmd.checkService(address))
+}
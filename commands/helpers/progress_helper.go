@@ -0,0 +1,18 @@
+package helpers
+
+import (
+	"io"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
+)
+
+type progressHelper struct {
+	ProgressInterval time.Duration `long:"progress-interval" description:"How often to report the progress of the transfer, with 0 it's reported only at every 10%"`
+}
+
+func (p *progressHelper) newProgressReader(reader io.Reader, total int64, prefix string) *helpers.ProgressReader {
+	progress := helpers.NewProgressReader(reader, total, prefix)
+	progress.Interval = p.ProgressInterval
+	return progress
+}
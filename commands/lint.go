@@ -0,0 +1,195 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"gopkg.in/yaml.v1"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/shells"
+)
+
+var lintGlobalKeys = map[string]bool{
+	"image":         true,
+	"services":      true,
+	"stages":        true,
+	"types":         true,
+	"before_script": true,
+	"after_script":  true,
+	"variables":     true,
+	"cache":         true,
+}
+
+var lintJobKeys = map[string]bool{
+	"script":        true,
+	"image":         true,
+	"services":      true,
+	"stage":         true,
+	"type":          true,
+	"variables":     true,
+	"only":          true,
+	"except":        true,
+	"tags":          true,
+	"allow_failure": true,
+	"when":          true,
+	"dependencies":  true,
+	"cache":         true,
+	"artifacts":     true,
+	"before_script": true,
+	"after_script":  true,
+	"environment":   true,
+	"coverage":      true,
+}
+
+type LintCommand struct {
+	exec     ExecCommand
+	problems []string
+}
+
+func (c *LintCommand) report(name string, err error) {
+	c.problems = append(c.problems, fmt.Sprintf("%s: %v", name, err))
+}
+
+// lintImages verifies the image and services using the structure of the Docker executor
+func (c *LintCommand) lintImages(name string, options common.BuildOptions) {
+	var images struct {
+		Image    common.Image    `json:"image"`
+		Services common.Services `json:"services"`
+	}
+	if err := options.Decode(&images); err != nil {
+		c.report(name, err)
+	}
+	if unknown := options.UnknownKeys(&images.Image, "image"); len(unknown) > 0 {
+		c.report(name, fmt.Errorf("image: unknown keys: %s", strings.Join(unknown, ", ")))
+	}
+	if unknown := options.UnknownKeys(&images.Services, "services"); len(unknown) > 0 {
+		c.report(name, fmt.Errorf("services: unknown keys: %s", strings.Join(unknown, ", ")))
+	}
+}
+
+func (c *LintCommand) lintShellOptions(name string, options common.BuildOptions) {
+	for _, err := range shells.LintOptions(options) {
+		c.report(name, err)
+	}
+}
+
+func (c *LintCommand) lintGlobal(config common.BuildOptions) {
+	if _, err := c.exec.getCommands(config["before_script"]); err != nil {
+		c.report("before_script", err)
+	}
+	if _, err := c.exec.buildVariables(config["variables"]); err != nil {
+		c.report("variables", err)
+	}
+
+	global := make(common.BuildOptions)
+	for key, value := range config {
+		if lintGlobalKeys[key] {
+			global[key] = value
+		}
+	}
+	c.lintImages("global", global)
+	c.lintShellOptions("global", global)
+}
+
+func (c *LintCommand) lintJob(name string, value interface{}) {
+	jobConfig, ok := value.(map[string]interface{})
+	if !ok {
+		c.report(name, errors.New("job has to be a map"))
+		return
+	}
+
+	var unknown []string
+	for key := range jobConfig {
+		if !lintJobKeys[key] {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		c.report(name, fmt.Errorf("unknown keys: %s", strings.Join(unknown, ", ")))
+	}
+
+	if _, err := c.exec.buildCommands(nil, jobConfig["script"]); err != nil {
+		c.report(name, err)
+	}
+	if _, err := c.exec.getCommands(jobConfig["before_script"]); err != nil {
+		c.report(name, fmt.Errorf("before_script: %v", err))
+	}
+	if _, err := c.exec.buildVariables(jobConfig["variables"]); err != nil {
+		c.report(name, fmt.Errorf("variables: %v", err))
+	}
+
+	c.lintImages(name, jobConfig)
+	c.lintShellOptions(name, jobConfig)
+}
+
+func (c *LintCommand) lint(data []byte) error {
+	config := make(common.BuildOptions)
+	err := yaml.Unmarshal(data, config)
+	if err != nil {
+		return err
+	}
+
+	err = config.Sanitize()
+	if err != nil {
+		return err
+	}
+
+	c.lintGlobal(config)
+
+	var jobs []string
+	for key := range config {
+		// The keys starting with dot are hidden and can be used as templates
+		if !lintGlobalKeys[key] && !strings.HasPrefix(key, ".") {
+			jobs = append(jobs, key)
+		}
+	}
+	sort.Strings(jobs)
+
+	for _, name := range jobs {
+		c.lintJob(name, config[name])
+	}
+	return nil
+}
+
+func (c *LintCommand) Execute(context *cli.Context) {
+	fileName := ".gitlab-ci.yml"
+	switch len(context.Args()) {
+	case 0:
+	case 1:
+		fileName = context.Args().Get(0)
+	default:
+		cli.ShowSubcommandHelp(context)
+		os.Exit(1)
+		return
+	}
+
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	err = c.lint(data)
+	if err != nil {
+		log.Fatalln(fileName, "is invalid:", err)
+	}
+
+	for _, problem := range c.problems {
+		log.Errorln(problem)
+	}
+	if len(c.problems) > 0 {
+		log.Fatalln(fileName, "is invalid, found", len(c.problems), "problems")
+	}
+	log.Println(fileName, "is valid")
+}
+
+func init() {
+	common.RegisterCommand2("lint", "verify the .gitlab-ci.yml file", &LintCommand{})
+}
@@ -3,9 +3,11 @@ package commands
 import (
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"os/signal"
 	"runtime"
+	"sync"
 	"syscall"
 	"time"
 
@@ -18,23 +20,37 @@ import (
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/sentry"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/service"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/sinks"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/systemd"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/network"
 )
 
 type RunCommand struct {
 	configOptions
+	// configLock protects the config replaced on reload, when it's read outside of the main loop
+	configLock sync.RWMutex
+
 	network common.Network
 	healthHelper
+	controlHelper controlHelper
 
-	buildsHelper buildsHelper
+	buildsHelper  buildsHelper
+	runOnceHelper runOnceHelper
 
 	ServiceName      string `short:"n" long:"service" description:"Use different names for different services"`
 	WorkingDirectory string `short:"d" long:"working-directory" description:"Specify custom working directory"`
 	User             string `short:"u" long:"user" description:"Use specific user to execute shell scripts"`
 	Syslog           bool   `long:"syslog" description:"Log to syslog"`
+	ControlSocket    string `long:"control-socket" env:"CONTROL_SOCKET" description:"Listen for control commands on the unix socket"`
+	Once             bool   `long:"once" description:"Process a single build of each runner and exit, with non-zero code when any build failed"`
 
 	sentryLogHook sentry.LogHook
 
+	// lockFile prevents starting two instances using the same config file
+	lockFile *helpers.LockFile
+
+	controlListener net.Listener
+
 	// abortBuilds is used to abort running builds
 	abortBuilds chan os.Signal
 
@@ -51,8 +67,18 @@ type RunCommand struct {
 	// In case this is SIGQUIT it makes to finish all buids
 	stopSignal os.Signal
 
+	// gracefulStopTimeout limits the graceful shutdown requested with the service manager,
+	// the builds are aborted when they don't finish in time
+	gracefulStopTimeout time.Duration
+
 	// runFinished is used to notify that Run() did finish
 	runFinished chan bool
+
+	// watchdogInterval is set when the process is monitored by systemd watchdog
+	watchdogInterval time.Duration
+
+	// watchdogStop is closed to stop feeding the watchdog
+	watchdogStop chan bool
 }
 
 func (mr *RunCommand) log() *log.Entry {
@@ -64,13 +90,43 @@ func (mr *RunCommand) feedRunner(runner *common.RunnerConfig, runners chan *comm
 		return
 	}
 
+	if mr.controlHelper.isPaused(runner) {
+		return
+	}
+
+	if mr.runOnceHelper.isDone(runner) {
+		return
+	}
+
+	// Don't request the build which can't be started by the executor
+	if provider := common.GetExecutor(runner.Executor); provider != nil && provider.GetCapacity(runner) == 0 {
+		mr.log().WithField("runner", runner.ShortDescription()).Debugln("Executor has no free capacity, skipping")
+		return
+	}
+
 	runners <- runner
 }
 
+func (mr *RunCommand) checkMaintenance() {
+	window := mr.config.GetMaintenanceWindow(time.Now())
+	if !mr.controlHelper.setMaintenance(window) {
+		return
+	}
+
+	if window == nil {
+		mr.log().Println("Maintenance window finished: builds will be requested")
+		return
+	}
+
+	mr.log().WithField("window", window.String()).Warningln("Maintenance window started: no new builds will be requested")
+	mr.buildsHelper.notifyBuilds(fmt.Sprintf("The runner entered the maintenance window %s. "+
+		"This build will finish, but no new builds will be taken until the window ends.", window))
+}
+
 func (mr *RunCommand) feedRunners(runners chan *common.RunnerConfig) {
 	for mr.stopSignal == nil {
 		mr.log().Debugln("Feeding runners to channel")
-		config := mr.config
+		config := mr.getConfig()
 
 		// If no runners wait full interval to test again
 		if len(config.Runners) == 0 {
@@ -82,6 +138,7 @@ func (mr *RunCommand) feedRunners(runners chan *common.RunnerConfig) {
 
 		// Feed runner with waiting exact amount of time
 		for _, runner := range config.Runners {
+			mr.checkMaintenance()
 			mr.feedRunner(runner, runners)
 			time.Sleep(interval)
 		}
@@ -107,19 +164,25 @@ func (mr *RunCommand) processRunner(id int, runner *common.RunnerConfig, runners
 	}
 	defer mr.buildsHelper.release(runner)
 
+	if !mr.runOnceHelper.acquire(runner) {
+		return
+	}
+
 	// Receive a new build
 	buildData, healthy := mr.network.GetBuild(*runner)
 	mr.makeHealthy(runner.UniqueID(), healthy)
 	if buildData == nil {
+		mr.runOnceHelper.release(runner, false, nil)
 		return
 	}
+	defer mr.finishRunOnce(runner, &err)
 
 	// Make sure to always close output
 	buildCredentials := &common.BuildCredentials{
 		ID:    buildData.ID,
 		Token: buildData.Token,
 	}
-	trace := mr.network.ProcessBuild(*runner, buildCredentials)
+	trace := sinks.NewBuildTrace(mr.network.ProcessBuild(*runner, buildCredentials), runner, buildData)
 	defer trace.Fail(err)
 
 	// Create a new build
@@ -129,6 +192,7 @@ func (mr *RunCommand) processRunner(id int, runner *common.RunnerConfig, runners
 		ExecutorData:     context,
 		SystemInterrupt:  mr.abortBuilds,
 	}
+	detectCoordinatorFeatures(mr.network, runner, build)
 
 	// Add build to list of builds to assign numbers
 	mr.buildsHelper.addBuild(build)
@@ -148,6 +212,19 @@ func (mr *RunCommand) processRunner(id int, runner *common.RunnerConfig, runners
 	return build.Run(mr.config, trace)
 }
 
+// finishRunOnce stops the runner when all runners processed their single build
+func (mr *RunCommand) finishRunOnce(runner *common.RunnerConfig, err *error) {
+	mr.runOnceHelper.release(runner, true, *err)
+	if !mr.runOnceHelper.finish(mr.config.Runners) {
+		return
+	}
+
+	mr.log().Println("All runners processed their build, stopping")
+	go func() {
+		mr.stopSignals <- syscall.SIGQUIT
+	}()
+}
+
 func (mr *RunCommand) processRunners(id int, stopWorker chan bool, runners chan *common.RunnerConfig) {
 	mr.log().WithField("worker", id).Debugln("Starting worker")
 	for mr.stopSignal == nil {
@@ -173,15 +250,47 @@ func (mr *RunCommand) startWorkers(startWorker chan int, stopWorker chan bool, r
 	}
 }
 
+func (mr *RunCommand) getConfig() *common.Config {
+	mr.configLock.RLock()
+	defer mr.configLock.RUnlock()
+
+	return mr.config
+}
+
 func (mr *RunCommand) loadConfig() error {
-	err := mr.configOptions.loadConfig()
+	config := common.NewConfig()
+	err := config.LoadConfig(mr.ConfigFile)
 	if err != nil {
 		return err
 	}
 
 	// pass user to execute scripts as specific user
 	if mr.User != "" {
-		mr.config.User = mr.User
+		config.User = mr.User
+	}
+
+	mr.configLock.Lock()
+	mr.config = config
+	mr.configLock.Unlock()
+
+	for _, window := range mr.config.MaintenanceWindows {
+		if err := window.Verify(); err != nil {
+			mr.log().WithError(err).Warningln("Invalid maintenance window, it will be ignored")
+		}
+	}
+
+	for _, schedule := range mr.config.ConcurrentSchedules {
+		if err := schedule.Verify(); err != nil {
+			mr.log().WithError(err).Warningln("Invalid concurrent schedule, it will be ignored")
+		}
+	}
+	for _, runner := range mr.config.Runners {
+		for _, schedule := range runner.LimitSchedules {
+			if err := schedule.Verify(); err != nil {
+				mr.log().WithField("runner", runner.ShortDescription()).WithError(err).
+					Warningln("Invalid limit schedule, it will be ignored")
+			}
+		}
 	}
 
 	mr.healthy = nil
@@ -202,6 +311,92 @@ func (mr *RunCommand) loadConfig() error {
 	return nil
 }
 
+func (mr *RunCommand) lockConfig() (err error) {
+	lockPath := mr.ConfigFile + ".lock"
+
+	mr.lockFile, err = helpers.NewLockFile(lockPath)
+	if err == helpers.ErrFileLocked {
+		return fmt.Errorf("Another instance of runner is already using %s (see %s)", mr.ConfigFile, lockPath)
+	} else if err != nil {
+		return fmt.Errorf("Failed to lock %s: %v", lockPath, err)
+	}
+	return nil
+}
+
+// refreshRunnerNames renders again the templated names of the runners,
+// eg. when the runner is started on a new instance created from an image
+func (mr *RunCommand) refreshRunnerNames() {
+	names := map[string]string{}
+	for _, runner := range mr.config.Runners {
+		changed, err := runner.RefreshName()
+		if err != nil {
+			mr.log().WithField("runner", runner.ShortDescription()).WithError(err).Warningln("Failed to render the runner name")
+		} else if changed {
+			mr.log().WithField("runner", runner.ShortDescription()).Infoln("Runner name updated to", runner.Name)
+			names[runner.Token] = runner.Name
+			mr.updateRunnerDescription(runner)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	// the loaded config isn't replaced, the file is reloaded later as usual
+	options := configOptions{ConfigFile: mr.ConfigFile}
+	err := options.updateConfig(func(config *common.Config) bool {
+		for _, runner := range config.Runners {
+			if name, ok := names[runner.Token]; ok {
+				runner.Name = name
+			}
+		}
+		return true
+	})
+	if err != nil {
+		mr.log().WithError(err).Warningln("Failed to save the runner names")
+	}
+}
+
+// updateRunnerDescription changes the description shown by GitLab, the runner
+// registered without the API token keeps the description it was registered with
+func (mr *RunCommand) updateRunnerDescription(runner *common.RunnerConfig) {
+	if runner.APIToken == "" || runner.RunnerID == 0 {
+		mr.log().WithField("runner", runner.ShortDescription()).Debugln("The description in GitLab isn't updated without the api_token and runner_id")
+		return
+	}
+
+	mr.network.UpdateRunnerDescription(runner.RunnerCredentials, runner.RunnerID, runner.APIToken, runner.Name)
+}
+
+func (mr *RunCommand) notifySystemd(state string) {
+	_, err := systemd_helpers.Notify(state)
+	if err != nil {
+		mr.log().WithError(err).Warningln("Failed to notify systemd")
+	}
+}
+
+// runWatchdog feeds the watchdog independently of the workers,
+// so the runner isn't killed when the main loop waits for the busy workers
+func (mr *RunCommand) runWatchdog(stop chan bool) {
+	if mr.watchdogInterval == 0 {
+		return
+	}
+
+	// systemd should receive the keep-alive twice per interval
+	ticker := time.NewTicker(mr.watchdogInterval / 2)
+	defer ticker.Stop()
+
+	mr.notifySystemd("WATCHDOG=1")
+	for {
+		select {
+		case <-ticker.C:
+			mr.notifySystemd("WATCHDOG=1")
+
+		case <-stop:
+			return
+		}
+	}
+}
+
 func (mr *RunCommand) checkConfig() (err error) {
 	info, err := os.Stat(mr.ConfigFile)
 	if err != nil {
@@ -239,19 +434,43 @@ func (mr *RunCommand) Start(s service.Service) error {
 		}
 	}
 
-	err := mr.loadConfig()
+	err := mr.lockConfig()
+	if err != nil {
+		return err
+	}
+
+	err = mr.loadConfig()
 	if err != nil {
 		return err
 	}
+	mr.refreshRunnerNames()
+
+	err = mr.serveControlSocket()
+	if err != nil {
+		return err
+	}
+
+	mr.watchdogInterval, err = systemd_helpers.WatchdogInterval()
+	if err != nil {
+		mr.log().WithError(err).Warningln("Failed to read systemd watchdog interval")
+	}
+
+	mr.watchdogStop = make(chan bool)
+	go mr.runWatchdog(mr.watchdogStop)
 
 	// Start should not block. Do the actual work async.
 	go mr.Run()
 
+	mr.notifySystemd("READY=1")
 	return nil
 }
 
 func (mr *RunCommand) updateWorkers(currentWorkers, workerIndex *int, startWorker chan int, stopWorker chan bool) os.Signal {
-	buildLimit := mr.config.Concurrent
+	buildLimit := mr.config.GetConcurrent(time.Now())
+	if *currentWorkers > 0 && *currentWorkers != buildLimit {
+		mr.log().WithField("workers", *currentWorkers).WithField("concurrent", buildLimit).
+			Infoln("Updating the number of concurrent builds")
+	}
 
 	for *currentWorkers > buildLimit {
 		select {
@@ -333,10 +552,31 @@ func (mr *RunCommand) Run() {
 		stopWorker <- true
 		currentWorkers--
 	}
+	mr.shutdownProviders()
+	if !sinks.Wait() {
+		mr.log().Warningln("Timed out sending the build traces to the log sinks")
+	}
 	mr.log().Println("All workers stopped. Can exit now")
 	mr.runFinished <- true
 }
 
+// shutdownProviders lets the executor providers clean up after the runners, eg. remove the machines.
+// The clean up can take longer than the ShutdownTimeout of the other signals, so it's done only
+// on the graceful shutdown, which waits for it
+func (mr *RunCommand) shutdownProviders() {
+	if mr.stopSignal != syscall.SIGQUIT {
+		mr.log().Debugln("Skipping the shutdown of the executor providers for", mr.stopSignal)
+		return
+	}
+
+	for _, runner := range mr.config.Runners {
+		provider := common.GetExecutor(runner.Executor)
+		if provider != nil {
+			provider.Shutdown(runner)
+		}
+	}
+}
+
 func (mr *RunCommand) interruptRun() {
 	// Pump interrupt signal
 	for {
@@ -352,6 +592,11 @@ func (mr *RunCommand) abortAllBuilds() {
 }
 
 func (mr *RunCommand) handleGracefulShutdown() error {
+	var timeout <-chan time.Time
+	if mr.gracefulStopTimeout > 0 {
+		timeout = time.After(mr.gracefulStopTimeout)
+	}
+
 	// We wait till we have a SIGQUIT
 	for mr.stopSignal == syscall.SIGQUIT {
 		mr.log().Warningln("Requested quit, waiting for builds to finish")
@@ -361,6 +606,10 @@ func (mr *RunCommand) handleGracefulShutdown() error {
 		case mr.stopSignal = <-mr.stopSignals:
 		// We received a new signal
 
+		case <-timeout:
+			mr.log().Warningln("The builds didn't finish in", mr.gracefulStopTimeout, "aborting them")
+			mr.stopSignal = syscall.SIGTERM
+
 		case <-mr.runFinished:
 			// Everything finished we can exit now
 			return nil
@@ -392,6 +641,21 @@ func (mr *RunCommand) handleShutdown() error {
 }
 
 func (mr *RunCommand) Stop(s service.Service) (err error) {
+	mr.notifySystemd("STOPPING=1")
+	if mr.watchdogStop != nil {
+		defer close(mr.watchdogStop)
+	}
+	defer mr.lockFile.Unlock()
+	defer mr.closeControlSocket()
+
+	// The service manager stops the runner without the signal, eg. on Windows
+	if mr.stopSignal == nil {
+		if timeout, ok := readGracefulStopRequest(mr.ConfigFile); ok {
+			mr.stopSignal = syscall.SIGQUIT
+			mr.gracefulStopTimeout = timeout
+		}
+	}
+
 	go mr.interruptRun()
 	err = mr.handleGracefulShutdown()
 	if err == nil {
@@ -418,7 +682,9 @@ func (mr *RunCommand) Execute(context *cli.Context) {
 	}
 
 	if mr.Syslog {
-		log.SetFormatter(new(log.TextFormatter))
+		log.SetFormatter(&log.TextFormatter{
+			DisableColors: helpers.NoColor(),
+		})
 		logger, err := service.SystemLogger(nil)
 		if err == nil {
 			log.AddHook(&ServiceLogHook{logger, log.InfoLevel})
@@ -429,10 +695,16 @@ func (mr *RunCommand) Execute(context *cli.Context) {
 
 	log.AddHook(&mr.sentryLogHook)
 
+	mr.runOnceHelper.enabled = mr.Once
+
 	err = service.Run()
 	if err != nil {
 		log.Fatalln(err)
 	}
+
+	if exitCode := mr.runOnceHelper.getExitCode(); exitCode != 0 {
+		os.Exit(exitCode)
+	}
 }
 
 func init() {
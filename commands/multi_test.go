@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func TestShutdownProvidersOnlyOnGracefulShutdown(t *testing.T) {
+	p := &common.MockExecutorProvider{}
+	defer p.AssertExpectations(t)
+	common.RegisterExecutor("shutdown-providers-test", p)
+
+	runner := &common.RunnerConfig{
+		RunnerSettings: common.RunnerSettings{
+			Executor: "shutdown-providers-test",
+		},
+	}
+	mr := &RunCommand{}
+	mr.config = &common.Config{Runners: []*common.RunnerConfig{runner}}
+
+	for _, signal := range []os.Signal{syscall.SIGTERM, os.Interrupt} {
+		mr.stopSignal = signal
+		mr.shutdownProviders()
+	}
+
+	p.On("Shutdown", runner).Return().Once()
+	mr.stopSignal = syscall.SIGQUIT
+	mr.shutdownProviders()
+}
+
+func TestGracefulStopRequestIsReadOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "graceful-stop")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "config.toml")
+	_, ok := readGracefulStopRequest(configFile)
+	assert.False(t, ok)
+
+	require.NoError(t, writeGracefulStopRequest(configFile, time.Hour))
+	timeout, ok := readGracefulStopRequest(configFile)
+	assert.True(t, ok)
+	assert.Equal(t, time.Hour, timeout)
+
+	_, ok = readGracefulStopRequest(configFile)
+	assert.False(t, ok, "the request is removed")
+}
+
+func TestGracefulShutdownAbortsBuildsAfterTimeout(t *testing.T) {
+	mr := &RunCommand{
+		stopSignal:          syscall.SIGQUIT,
+		stopSignals:         make(chan os.Signal),
+		runFinished:         make(chan bool),
+		gracefulStopTimeout: 10 * time.Millisecond,
+	}
+
+	assert.Error(t, mr.handleGracefulShutdown())
+	assert.Equal(t, syscall.SIGTERM, mr.stopSignal)
+}
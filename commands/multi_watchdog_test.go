@@ -0,0 +1,70 @@
+// +build !windows
+
+package commands
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func TestWatchdogIsFedWhileWorkerIsBusy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "systemd-watchdog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	socketAddr := &net.UnixAddr{
+		Name: filepath.Join(dir, "notify.sock"),
+		Net:  "unixgram",
+	}
+	conn, err := net.ListenUnixgram(socketAddr.Net, socketAddr)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	os.Setenv("NOTIFY_SOCKET", socketAddr.Name)
+	defer os.Unsetenv("NOTIFY_SOCKET")
+
+	mr := &RunCommand{
+		runSignal:        make(chan os.Signal, 1),
+		watchdogInterval: 20 * time.Millisecond,
+	}
+	mr.config = &common.Config{Concurrent: 0}
+
+	// The worker is busy with the build, so it doesn't receive the stop request
+	// and the main loop blocks in updateWorkers
+	currentWorkers, workerIndex := 1, 1
+	updated := make(chan os.Signal)
+	go func() {
+		updated <- mr.updateWorkers(&currentWorkers, &workerIndex, make(chan int), make(chan bool))
+	}()
+
+	stop := make(chan bool)
+	defer close(stop)
+	go mr.runWatchdog(stop)
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 64)
+	for i := 0; i < 3; i++ {
+		n, err := conn.Read(buf)
+		require.NoError(t, err, "the watchdog is fed while the worker is busy")
+		assert.Equal(t, "WATCHDOG=1", string(buf[:n]))
+	}
+
+	select {
+	case <-updated:
+		t.Fatal("the main loop should wait for the busy worker")
+	default:
+	}
+
+	mr.runSignal <- syscall.SIGTERM
+	assert.Equal(t, syscall.SIGTERM, <-updated)
+}
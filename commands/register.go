@@ -19,9 +19,9 @@ type RegisterCommand struct {
 	network    common.Network
 	reader     *bufio.Reader
 	registered bool
+	verified   bool
 
 	configOptions
-	TagList           string `long:"tag-list" env:"RUNNER_TAG_LIST" description:"Tag list"`
 	NonInteractive    bool   `short:"n" long:"non-interactive" env:"REGISTER_NON_INTERACTIVE" description:"Run registration unattended"`
 	LeaveRunner       bool   `long:"leave-runner" env:"REGISTER_LEAVE_RUNNER" description:"Don't remove runner if registration fails"`
 	RegistrationToken string `short:"r" long:"registration-token" env:"REGISTRATION_TOKEN" description:"Runner's registration token"`
@@ -124,8 +124,11 @@ func (s *RegisterCommand) askSSHLogin() {
 	s.SSH.IdentityFile = s.ask("ssh-identity-file", "Please enter path to SSH identity file (eg. /home/user/.ssh/id_rsa):", true)
 }
 
-func (s *RegisterCommand) addRunner(runner *common.RunnerConfig) {
-	s.config.Runners = append(s.config.Runners, runner)
+func (s *RegisterCommand) addRunner(runner *common.RunnerConfig) error {
+	return s.updateConfig(func(config *common.Config) bool {
+		config.Runners = append(config.Runners, runner)
+		return true
+	})
 }
 
 func (s *RegisterCommand) askRunner() {
@@ -137,20 +140,45 @@ func (s *RegisterCommand) askRunner() {
 		if !s.network.VerifyRunner(s.RunnerCredentials) {
 			log.Panicln("Failed to verify this runner. Perhaps you are having network problems")
 		}
+		s.verified = true
 	} else {
 		// we store registration token as token, since we pass that to RunnerCredentials
 		s.Token = s.ask("registration-token", "Please enter the gitlab-ci token for this runner:")
 		s.Name = s.ask("name", "Please enter the gitlab-ci description for this runner:")
 		s.TagList = s.ask("tag-list", "Please enter the gitlab-ci tags for this runner (comma separated):", true)
+	}
+}
 
-		result := s.network.RegisterRunner(s.RunnerCredentials, s.Name, s.TagList)
-		if result == nil {
-			log.Panicln("Failed to register this runner. Perhaps you are having network problems")
-		}
+// renderDescription renders the templated description, eg. runner-{{.Hostname}},
+// the template is stored to render it again when the runner starts
+func (s *RegisterCommand) renderDescription() {
+	if !common.IsRunnerDescriptionTemplate(s.Name) {
+		return
+	}
+
+	s.NameTemplate = s.Name
+	_, err := s.RefreshName()
+	if err != nil {
+		log.Panicln("Invalid description template:", err)
+	}
+	log.Infoln("Runner description:", s.Name)
+}
+
+// registerRunner is done after asking for the executor,
+// so the coordinator receives the executor and the supported features
+func (s *RegisterCommand) registerRunner() {
+	if s.registered || s.verified {
+		return
+	}
 
-		s.Token = result.Token
-		s.registered = true
+	result := s.network.RegisterRunner(s.RunnerConfig, s.Name, s.TagList)
+	if result == nil {
+		log.Panicln("Failed to register this runner. Perhaps you are having network problems")
 	}
+
+	s.Token = result.Token
+	s.RunnerID = result.ID
+	s.registered = true
 }
 
 func (s *RegisterCommand) askExecutorOptions() {
@@ -193,6 +221,9 @@ func (s *RegisterCommand) Execute(context *cli.Context) {
 		log.Panicln(err)
 	}
 	s.askRunner()
+	s.askExecutor()
+	s.renderDescription()
+	s.registerRunner()
 
 	if !s.LeaveRunner {
 		defer func() {
@@ -217,16 +248,16 @@ func (s *RegisterCommand) Execute(context *cli.Context) {
 		}()
 	}
 
-	s.askExecutor()
-
 	if s.config.Concurrent < s.Limit {
 		log.Warningf("Specified limit (%d) larger then current concurrent limit (%d). Concurrent limit will not be enlarged.", s.Limit, s.config.Concurrent)
 	}
 	s.Machine = nil
 
 	s.askExecutorOptions()
-	s.addRunner(&s.RunnerConfig)
-	s.saveConfig()
+	err = s.addRunner(&s.RunnerConfig)
+	if err != nil {
+		log.Panicln("Failed to update", s.ConfigFile, err)
+	}
 
 	log.Printf("Runner registered successfully. Feel free to start it, but if it's running already the config should be automatically reloaded!")
 }
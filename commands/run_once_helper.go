@@ -0,0 +1,105 @@
+package commands
+
+import (
+	"sync"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+// runOnceHelper limits every runner to process a single build,
+// when the run command is started with --once
+type runOnceHelper struct {
+	enabled  bool
+	pending  map[string]bool
+	done     map[string]bool
+	exitCode int
+	finished bool
+	lock     sync.Mutex
+}
+
+// isDone checks if the runner doesn't need to request builds anymore
+func (r *runOnceHelper) isDone(runner *common.RunnerConfig) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.enabled && (r.done[runner.UniqueID()] || r.pending[runner.UniqueID()])
+}
+
+// acquire reserves the runner for requesting its build
+func (r *runOnceHelper) acquire(runner *common.RunnerConfig) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if !r.enabled {
+		return true
+	}
+	if r.done[runner.UniqueID()] || r.pending[runner.UniqueID()] {
+		return false
+	}
+
+	if r.pending == nil {
+		r.pending = make(map[string]bool)
+	}
+	r.pending[runner.UniqueID()] = true
+	return true
+}
+
+// release marks the runner as done if it processed the build
+func (r *runOnceHelper) release(runner *common.RunnerConfig, processed bool, err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if !r.enabled {
+		return
+	}
+
+	delete(r.pending, runner.UniqueID())
+	if !processed {
+		return
+	}
+
+	if r.done == nil {
+		r.done = make(map[string]bool)
+	}
+	r.done[runner.UniqueID()] = true
+	if r.exitCode == 0 {
+		r.exitCode = buildExitCode(err)
+	}
+}
+
+// buildExitCode is the exit code of the failed script, or 1 when the build failed otherwise
+func buildExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if buildError, ok := err.(*common.BuildError); ok && buildError.ExitCode > 0 {
+		return buildError.ExitCode
+	}
+	return 1
+}
+
+// finish returns true once, when all runners processed their builds
+func (r *runOnceHelper) finish(runners []*common.RunnerConfig) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if !r.enabled || r.finished {
+		return false
+	}
+	for _, runner := range runners {
+		if !r.done[runner.UniqueID()] {
+			return false
+		}
+	}
+
+	r.finished = true
+	return true
+}
+
+// getExitCode returns the exit code of the first failed build, it's 0 when all builds succeeded
+func (r *runOnceHelper) getExitCode() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.exitCode
+}
@@ -0,0 +1,92 @@
+package commands
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+var runOnceRunners = []*common.RunnerConfig{
+	{RunnerCredentials: common.RunnerCredentials{URL: "https://gitlab.example.com/", Token: "first"}},
+	{RunnerCredentials: common.RunnerCredentials{URL: "https://gitlab.example.com/", Token: "second"}},
+}
+
+func TestRunOnceHelperIsDisabled(t *testing.T) {
+	helper := runOnceHelper{}
+	assert.True(t, helper.acquire(runOnceRunners[0]))
+	assert.True(t, helper.acquire(runOnceRunners[0]))
+	helper.release(runOnceRunners[0], true, errors.New("failed"))
+	assert.False(t, helper.isDone(runOnceRunners[0]))
+	assert.False(t, helper.finish(runOnceRunners))
+	assert.Equal(t, 0, helper.getExitCode())
+}
+
+func TestRunOnceHelperProcessesSingleBuild(t *testing.T) {
+	helper := runOnceHelper{enabled: true}
+
+	assert.True(t, helper.acquire(runOnceRunners[0]))
+	assert.False(t, helper.acquire(runOnceRunners[0]), "the runner requests one build at a time")
+	helper.release(runOnceRunners[0], false, nil)
+	assert.False(t, helper.isDone(runOnceRunners[0]), "the runner without the build requests it again")
+
+	assert.True(t, helper.acquire(runOnceRunners[0]))
+	helper.release(runOnceRunners[0], true, nil)
+	assert.True(t, helper.isDone(runOnceRunners[0]))
+	assert.False(t, helper.acquire(runOnceRunners[0]), "the runner processed its build")
+	assert.False(t, helper.finish(runOnceRunners), "the other runner didn't process its build")
+
+	assert.True(t, helper.acquire(runOnceRunners[1]))
+	helper.release(runOnceRunners[1], true, nil)
+	assert.True(t, helper.finish(runOnceRunners))
+	assert.False(t, helper.finish(runOnceRunners), "it's finished once")
+	assert.Equal(t, 0, helper.getExitCode(), "the successful builds exit with 0")
+}
+
+func TestRunOnceHelperExitCode(t *testing.T) {
+	examples := []struct {
+		errors   []error
+		exitCode int
+	}{
+		{[]error{nil, nil}, 0},
+		{[]error{errors.New("timed out"), nil}, 1},
+		{[]error{&common.BuildError{Inner: errors.New("exit code 3"), ExitCode: 3}, nil}, 3},
+		{[]error{&common.BuildError{Inner: errors.New("failed")}, nil}, 1},
+		{[]error{nil, &common.BuildError{Inner: errors.New("exit code 2"), ExitCode: 2}}, 2},
+		{[]error{&common.BuildError{ExitCode: 4}, &common.BuildError{ExitCode: 2}}, 4},
+	}
+
+	for _, example := range examples {
+		helper := runOnceHelper{enabled: true}
+		for i, err := range example.errors {
+			helper.acquire(runOnceRunners[i])
+			helper.release(runOnceRunners[i], true, err)
+		}
+		assert.Equal(t, example.exitCode, helper.getExitCode(), "%v", example.errors)
+	}
+}
+
+func TestFinishRunOnceStopsRunner(t *testing.T) {
+	mr := &RunCommand{
+		stopSignals: make(chan os.Signal),
+	}
+	mr.config = &common.Config{Runners: runOnceRunners[:1]}
+	mr.runOnceHelper.enabled = true
+
+	var err error = &common.BuildError{ExitCode: 5}
+	mr.runOnceHelper.acquire(runOnceRunners[0])
+	mr.finishRunOnce(runOnceRunners[0], &err)
+
+	select {
+	case signal := <-mr.stopSignals:
+		assert.Equal(t, syscall.SIGQUIT, signal, "the builds are finished gracefully")
+	case <-time.After(time.Second):
+		t.Error("the runner isn't stopped")
+	}
+	assert.Equal(t, 5, mr.runOnceHelper.getExitCode(), "the runner exits with the status of the build")
+}
@@ -0,0 +1,283 @@
+package commands
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	service "github.com/ayufan/golang-kardianos-service"
+	"github.com/codegangsta/cli"
+	"github.com/kardianos/osext"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/service"
+)
+
+const defaultSelfUpdateURL = "https://gitlab-ci-multi-runner-downloads.s3.amazonaws.com"
+
+// The download of the binary can take a while, but the stalled connections are dropped
+const selfUpdateTimeout = 10 * time.Minute
+
+var selfUpdateClient = &http.Client{
+	Timeout: selfUpdateTimeout,
+	Transport: &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		Dial: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).Dial,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+	},
+}
+
+type SelfUpdateCommand struct {
+	To          string `long:"to" description:"Version to update to, eg. 1.6.0, latest or master"`
+	URL         string `long:"url" env:"SELF_UPDATE_URL" description:"Address from which the binaries are downloaded"`
+	Checksum    string `long:"checksum" description:"Expected SHA256 of the binary, by default it's downloaded together with the binary"`
+	PublicKey   string `long:"public-key" description:"The PEM file with the ECDSA public key verifying the checksum signature, the signature isn't verified without it"`
+	ServiceName string `short:"n" long:"service" description:"Name of the service restarted after the update"`
+	NoRestart   bool   `long:"no-restart" description:"Don't restart the service after the update"`
+}
+
+// binaryURL returns the address of the binary for the version, the tags are uploaded with the v prefix
+func (c *SelfUpdateCommand) binaryURL() string {
+	version := c.To
+	if version != "" && version[0] >= '0' && version[0] <= '9' {
+		version = "v" + version
+	}
+
+	name := fmt.Sprintf("%s-%s-%s", common.NAME, runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return fmt.Sprintf("%s/%s/binaries/%s", strings.TrimSuffix(c.URL, "/"), version, name)
+}
+
+func (c *SelfUpdateCommand) get(url string) (io.ReadCloser, int64, error) {
+	resp, err := selfUpdateClient.Get(url)
+	if err != nil {
+		return nil, 0, err
+	}
+	if resp.StatusCode/100 != 2 {
+		resp.Body.Close()
+		return nil, 0, fmt.Errorf("%s: received %s", url, resp.Status)
+	}
+	return resp.Body, resp.ContentLength, nil
+}
+
+func (c *SelfUpdateCommand) getData(url string) ([]byte, error) {
+	body, _, err := c.get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	return ioutil.ReadAll(body)
+}
+
+func (c *SelfUpdateCommand) publicKey() (*ecdsa.PublicKey, error) {
+	data, err := ioutil.ReadFile(c.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("the public key is not in the PEM format")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	ecdsaKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("the public key is not an ECDSA key")
+	}
+	return ecdsaKey, nil
+}
+
+// verifySignature checks the base64 encoded ASN.1 ECDSA signature of the SHA256 of the checksum file
+func (c *SelfUpdateCommand) verifySignature(data, signature []byte) error {
+	key, err := c.publicKey()
+	if err != nil {
+		return fmt.Errorf("failed to read the public key: %v", err)
+	}
+
+	der, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return fmt.Errorf("failed to decode the checksum signature: %v", err)
+	}
+
+	var sig struct {
+		R, S *big.Int
+	}
+	_, err = asn1.Unmarshal(der, &sig)
+	if err != nil {
+		return fmt.Errorf("failed to decode the checksum signature: %v", err)
+	}
+
+	hash := sha256.Sum256(data)
+	if !ecdsa.Verify(key, hash[:], sig.R, sig.S) {
+		return errors.New("the checksum signature is invalid")
+	}
+	return nil
+}
+
+func (c *SelfUpdateCommand) expectedChecksum(binaryURL string) (string, error) {
+	if c.Checksum != "" {
+		return strings.ToLower(c.Checksum), nil
+	}
+
+	data, err := c.getData(binaryURL + ".sha256")
+	if err != nil {
+		return "", fmt.Errorf("failed to get the checksum, use --checksum to specify it: %v", err)
+	}
+
+	// The releases aren't signed yet, so the signature is verified only with the key of the mirror signing them
+	if c.PublicKey != "" {
+		signature, err := c.getData(binaryURL + ".sha256.sig")
+		if err != nil {
+			return "", fmt.Errorf("failed to get the checksum signature: %v", err)
+		}
+
+		err = c.verifySignature(data, signature)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		log.Warningln("The checksum signature isn't verified, use --public-key to verify it")
+	}
+
+	// The file is in the format of sha256sum: <checksum>  <file name>
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return "", errors.New("the checksum file is empty")
+	}
+	return strings.ToLower(fields[0]), nil
+}
+
+// download writes the binary to the temporary file next to the executable,
+// so it can be renamed over the executable
+func (c *SelfUpdateCommand) download(binaryURL, executable string) (string, error) {
+	checksum, err := c.expectedChecksum(binaryURL)
+	if err != nil {
+		return "", err
+	}
+
+	body, size, err := c.get(binaryURL)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	file, err := ioutil.TempFile(filepath.Dir(executable), filepath.Base(executable))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	progress := helpers.NewProgressReader(body, size, "Downloading "+binaryURL)
+	_, err = io.Copy(io.MultiWriter(file, hash), progress)
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != checksum {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("checksum mismatch: expected %s, got %s", checksum, actual)
+	}
+
+	err = file.Chmod(0755)
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// replace swaps the executable with the downloaded binary
+func (c *SelfUpdateCommand) replace(fileName, executable string) error {
+	// The running executable can't be overwritten on Windows, but it can be renamed
+	if runtime.GOOS == "windows" {
+		oldExecutable := executable + ".old"
+		os.Remove(oldExecutable)
+		err := os.Rename(executable, oldExecutable)
+		if err != nil {
+			return err
+		}
+	}
+	return os.Rename(fileName, executable)
+}
+
+func (c *SelfUpdateCommand) restart() error {
+	s, err := service_helpers.New(&NullService{}, &service.Config{
+		Name: c.ServiceName,
+	})
+	if err != nil {
+		return err
+	}
+	return service.Control(s, "restart")
+}
+
+func (c *SelfUpdateCommand) Execute(context *cli.Context) {
+	executable, err := osext.Executable()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	binaryURL := c.binaryURL()
+	log.Println("Updating", executable, "from", common.AppVersion.Version, "to", c.To, "...")
+
+	fileName, err := c.download(binaryURL, executable)
+	if err != nil {
+		log.Fatalln("Failed to download the binary:", err)
+	}
+
+	err = c.replace(fileName, executable)
+	if err != nil {
+		os.Remove(fileName)
+		log.Fatalln("Failed to replace", executable, err)
+	}
+	log.Println("Updated", executable)
+
+	if c.NoRestart {
+		return
+	}
+
+	err = c.restart()
+	if err != nil {
+		log.Fatalln("Failed to restart the service:", err)
+	}
+	log.Println("Restarted the", c.ServiceName, "service")
+}
+
+func init() {
+	common.RegisterCommand2("self-update", "download the new version of the runner and restart the service", &SelfUpdateCommand{
+		To:          "latest",
+		URL:         defaultSelfUpdateURL,
+		ServiceName: defaultServiceName,
+	})
+}
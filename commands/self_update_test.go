@@ -0,0 +1,189 @@
+package commands
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var selfUpdateTestBinary = []byte("new runner binary")
+
+type selfUpdateTestServer struct {
+	*httptest.Server
+	checksum  string
+	signature string
+}
+
+func newSelfUpdateTestServer(t *testing.T, key *ecdsa.PrivateKey) *selfUpdateTestServer {
+	hash := sha256.Sum256(selfUpdateTestBinary)
+	checksum := hex.EncodeToString(hash[:]) + "  gitlab-ci-multi-runner\n"
+
+	checksumHash := sha256.Sum256([]byte(checksum))
+	r, s, err := ecdsa.Sign(rand.Reader, key, checksumHash[:])
+	require.NoError(t, err)
+	der, err := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	require.NoError(t, err)
+
+	server := &selfUpdateTestServer{
+		checksum:  checksum,
+		signature: base64.StdEncoding.EncodeToString(der),
+	}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.handle))
+	return server
+}
+
+func (s *selfUpdateTestServer) handle(w http.ResponseWriter, r *http.Request) {
+	binary := fmt.Sprintf("/v1.6.0/binaries/gitlab-ci-multi-runner-%s-%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		binary += ".exe"
+	}
+
+	switch r.URL.Path {
+	case binary:
+		w.Write(selfUpdateTestBinary)
+	case binary + ".sha256":
+		w.Write([]byte(s.checksum))
+	case binary + ".sha256.sig":
+		w.Write([]byte(s.signature))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeSelfUpdateTestKey(t *testing.T, dir string, key *ecdsa.PrivateKey) string {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	fileName := filepath.Join(dir, "key.pem")
+	data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	require.NoError(t, ioutil.WriteFile(fileName, data, 0600))
+	return fileName
+}
+
+func newSelfUpdateTest(t *testing.T) (cmd *SelfUpdateCommand, server *selfUpdateTestServer, dir string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	dir, err = ioutil.TempDir("", "self-update")
+	require.NoError(t, err)
+
+	server = newSelfUpdateTestServer(t, key)
+	cmd = &SelfUpdateCommand{
+		To:        "1.6.0",
+		URL:       server.URL + "/",
+		PublicKey: writeSelfUpdateTestKey(t, dir, key),
+	}
+	return
+}
+
+func TestSelfUpdateBinaryURL(t *testing.T) {
+	cmd := &SelfUpdateCommand{
+		To:  "1.6.0",
+		URL: defaultSelfUpdateURL + "/",
+	}
+	assert.Contains(t, cmd.binaryURL(), defaultSelfUpdateURL+"/v1.6.0/binaries/gitlab-ci-multi-runner-")
+
+	cmd.To = "latest"
+	assert.Contains(t, cmd.binaryURL(), defaultSelfUpdateURL+"/latest/binaries/")
+}
+
+func TestSelfUpdateDownloadsVerifiedBinary(t *testing.T) {
+	cmd, server, dir := newSelfUpdateTest(t)
+	defer server.Close()
+	defer os.RemoveAll(dir)
+
+	fileName, err := cmd.download(cmd.binaryURL(), filepath.Join(dir, "gitlab-runner"))
+	require.NoError(t, err)
+	assert.Equal(t, dir, filepath.Dir(fileName), "the binary is downloaded next to the executable")
+
+	data, err := ioutil.ReadFile(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, selfUpdateTestBinary, data)
+}
+
+func TestSelfUpdateRejectsInvalidSignature(t *testing.T) {
+	cmd, server, dir := newSelfUpdateTest(t)
+	defer server.Close()
+	defer os.RemoveAll(dir)
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	cmd.PublicKey = writeSelfUpdateTestKey(t, dir, otherKey)
+
+	_, err = cmd.download(cmd.binaryURL(), filepath.Join(dir, "gitlab-runner"))
+	assert.EqualError(t, err, "the checksum signature is invalid")
+}
+
+func TestSelfUpdateRejectsMissingSignature(t *testing.T) {
+	cmd, server, dir := newSelfUpdateTest(t)
+	defer server.Close()
+	defer os.RemoveAll(dir)
+
+	server.signature = ""
+
+	_, err := cmd.download(cmd.binaryURL(), filepath.Join(dir, "gitlab-runner"))
+	assert.Error(t, err)
+}
+
+func TestSelfUpdateRejectsChecksumMismatch(t *testing.T) {
+	cmd, server, dir := newSelfUpdateTest(t)
+	defer server.Close()
+	defer os.RemoveAll(dir)
+
+	cmd.Checksum = hex.EncodeToString(make([]byte, sha256.Size))
+
+	_, err := cmd.download(cmd.binaryURL(), filepath.Join(dir, "gitlab-runner"))
+	assert.Contains(t, err.Error(), "checksum mismatch")
+
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1, "only the key is left")
+}
+
+func TestSelfUpdateSpecifiedChecksumSkipsSignature(t *testing.T) {
+	cmd, server, dir := newSelfUpdateTest(t)
+	defer server.Close()
+	defer os.RemoveAll(dir)
+
+	hash := sha256.Sum256(selfUpdateTestBinary)
+	cmd.Checksum = hex.EncodeToString(hash[:])
+	server.signature = ""
+
+	fileName, err := cmd.download(cmd.binaryURL(), filepath.Join(dir, "gitlab-runner"))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, fileName)
+}
+
+func TestSelfUpdateWithoutPublicKeySkipsSignature(t *testing.T) {
+	cmd, server, dir := newSelfUpdateTest(t)
+	defer server.Close()
+	defer os.RemoveAll(dir)
+
+	cmd.PublicKey = ""
+	server.signature = ""
+
+	fileName, err := cmd.download(cmd.binaryURL(), filepath.Join(dir, "gitlab-runner"))
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadFile(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, selfUpdateTestBinary, data, "the binary is still verified with the published checksum")
+}
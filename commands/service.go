@@ -67,20 +67,12 @@ func runServiceInstall(s service.Service, c *cli.Context) error {
 	}
 
 	if configFile := c.String("config"); configFile != "" {
-		// try to load existing config
-		config := common.NewConfig()
-		err := config.LoadConfig(configFile)
+		// save config for the first time
+		options := &configOptions{ConfigFile: configFile}
+		err := options.touchConfig()
 		if err != nil {
 			return err
 		}
-
-		// save config for the first time
-		if !config.Loaded {
-			err = config.SaveConfig(configFile)
-			if err != nil {
-				return err
-			}
-		}
 	}
 	return service.Control(s, "install")
 }
@@ -123,7 +115,7 @@ func createServiceConfig(c *cli.Context) (svcConfig *service.Config) {
 	svcConfig.Arguments = append(svcConfig.Arguments, getServiceArguments(c)...)
 
 	switch runtime.GOOS {
-	case "linux":
+	case "linux", "freebsd":
 		if os.Getuid() != 0 {
 			logrus.Fatal("Please run the commands as root")
 		}
@@ -131,6 +123,12 @@ func createServiceConfig(c *cli.Context) (svcConfig *service.Config) {
 			svcConfig.Arguments = append(svcConfig.Arguments, "--user", user)
 		}
 
+		// used only by systemd
+		svcConfig.Option = service.KeyValue{
+			"TypeNotify":  true,
+			"WatchdogSec": "60",
+		}
+
 	case "darwin":
 		svcConfig.Option = service.KeyValue{
 			"KeepAlive":   true,
@@ -138,6 +136,15 @@ func createServiceConfig(c *cli.Context) (svcConfig *service.Config) {
 			"UserService": os.Getuid() != 0,
 		}
 
+		if sessionType := c.String("session-type"); sessionType != "" {
+			svcConfig.Option["SessionType"] = sessionType
+		}
+
+		if logFile := c.String("log-file"); logFile != "" {
+			svcConfig.Option["StandardOutPath"] = logFile
+			svcConfig.Option["StandardErrorPath"] = logFile
+		}
+
 		if user := c.String("user"); user != "" {
 			if os.Getuid() == 0 {
 				svcConfig.Arguments = append(svcConfig.Arguments, "--user", user)
@@ -168,6 +175,12 @@ func RunServiceControl(c *cli.Context) {
 		err = runServiceInstall(s, c)
 	case "status":
 		err = runServiceStatus(svcConfig.DisplayName, s, c)
+	case "stop":
+		if c.Bool("graceful") {
+			err = runServiceGracefulStop(s, c)
+		} else {
+			err = service.Control(s, c.Command.Name)
+		}
 	default:
 		err = service.Control(s, c.Command.Name)
 	}
@@ -198,6 +211,22 @@ func init() {
 		Usage: "Specify custom config file",
 	})
 
+	stopFlags := flags
+	stopFlags = append(stopFlags, cli.BoolFlag{
+		Name:  "graceful",
+		Usage: "Wait for the running builds to finish before stopping the service",
+	})
+	stopFlags = append(stopFlags, cli.DurationFlag{
+		Name:  "timeout",
+		Value: defaultGracefulStopTimeout,
+		Usage: "How long to wait for the builds to finish, they are aborted afterwards",
+	})
+	stopFlags = append(stopFlags, cli.StringFlag{
+		Name:  "config, c",
+		Value: getDefaultConfigFile(),
+		Usage: "Specify config file of the stopped runner",
+	})
+
 	if runtime.GOOS == "windows" {
 		installFlags = append(installFlags, cli.StringFlag{
 			Name:  "user, u",
@@ -217,6 +246,19 @@ func init() {
 		})
 	}
 
+	if runtime.GOOS == "darwin" {
+		installFlags = append(installFlags, cli.StringFlag{
+			Name:  "session-type",
+			Value: "",
+			Usage: "Limit the launchd session types (Aqua, Background, LoginWindow) the service is loaded in",
+		})
+		installFlags = append(installFlags, cli.StringFlag{
+			Name:  "log-file",
+			Value: "",
+			Usage: "Redirect the service output to the file",
+		})
+	}
+
 	common.RegisterCommand(cli.Command{
 		Name:   "install",
 		Usage:  "install service",
@@ -239,7 +281,7 @@ func init() {
 		Name:   "stop",
 		Usage:  "stop service",
 		Action: RunServiceControl,
-		Flags:  flags,
+		Flags:  stopFlags,
 	})
 	common.RegisterCommand(cli.Command{
 		Name:   "restart",
@@ -0,0 +1,132 @@
+package commands
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/ayufan/golang-kardianos-service"
+	"github.com/codegangsta/cli"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
+)
+
+const defaultGracefulStopTimeout = time.Hour
+
+// gracefulStopRequestPath is the file, in which the stop command asks the runner stopped
+// by the service manager to finish the running builds. It's used on Windows,
+// where the runner can't be sent SIGQUIT
+func gracefulStopRequestPath(configFile string) string {
+	return configFile + ".stop"
+}
+
+// readGracefulStopRequest returns the timeout of the graceful stop requested with
+// writeGracefulStopRequest, the request is removed, so it's used only once
+func readGracefulStopRequest(configFile string) (time.Duration, bool) {
+	requestPath := gracefulStopRequestPath(configFile)
+	data, err := ioutil.ReadFile(requestPath)
+	if err != nil {
+		return 0, false
+	}
+	os.Remove(requestPath)
+
+	timeout, err := time.ParseDuration(strings.TrimSpace(string(data)))
+	if err != nil {
+		logrus.Warningln("Invalid graceful stop request", requestPath, err)
+		return 0, false
+	}
+	return timeout, true
+}
+
+func writeGracefulStopRequest(configFile string, timeout time.Duration) error {
+	return ioutil.WriteFile(gracefulStopRequestPath(configFile), []byte(timeout.String()), 0600)
+}
+
+// processExited checks if the process doesn't exist anymore, the signal 0 checks the process without signaling it
+func processExited(process *os.Process) bool {
+	return process.Signal(syscall.Signal(0)) != nil
+}
+
+// waitForExit waits until the runner exits. The process is checked instead of the lock
+// of its config file, so the runner restarted by the service manager can lock it
+func waitForExit(process *os.Process, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if processExited(process) {
+			return true
+		}
+		time.Sleep(time.Second)
+	}
+	return false
+}
+
+// runServiceGracefulStop sends SIGQUIT to the runner to finish the running builds,
+// and SIGTERM to abort them when they don't finish before the timeout
+func runServiceGracefulStop(s service.Service, c *cli.Context) error {
+	if runtime.GOOS == "windows" {
+		return runServiceManagerGracefulStop(s, c)
+	}
+
+	lockPath := c.String("config") + ".lock"
+	timeout := c.Duration("timeout")
+
+	pid, err := helpers.ReadLockFileOwner(lockPath)
+	if err == helpers.ErrFileNotLocked {
+		logrus.Println("Runner using", c.String("config"), "is not running")
+		return service.Control(s, "stop")
+	} else if err != nil {
+		return err
+	}
+
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+
+	logrus.Println("Waiting up to", timeout, "for the builds of runner", pid, "to finish...")
+	err = process.Signal(syscall.SIGQUIT)
+	if err != nil && !processExited(process) {
+		return err
+	}
+
+	if !waitForExit(process, timeout) {
+		logrus.Warningln("The builds didn't finish in", timeout, "aborting them...")
+		err = process.Signal(syscall.SIGTERM)
+		if err != nil && !processExited(process) {
+			return err
+		}
+
+		if !waitForExit(process, 2*common.ShutdownTimeout*time.Second) {
+			return errors.New("runner didn't stop")
+		}
+	}
+	logrus.Println("Runner", pid, "stopped")
+
+	// The service manager could restart the exited runner
+	if err := service.Control(s, "stop"); err != nil {
+		logrus.Warningln("Failed to stop the service:", err)
+	}
+	return nil
+}
+
+// runServiceManagerGracefulStop stops the service with the service manager, which waits for it to stop.
+// The runner finishes the running builds and aborts them itself after the timeout of the request
+func runServiceManagerGracefulStop(s service.Service, c *cli.Context) error {
+	configFile := c.String("config")
+	timeout := c.Duration("timeout")
+
+	err := writeGracefulStopRequest(configFile, timeout)
+	if err != nil {
+		return err
+	}
+	// the request isn't left for the next start, when the service isn't running
+	defer os.Remove(gracefulStopRequestPath(configFile))
+
+	logrus.Println("Waiting up to", timeout, "for the builds of the service to finish...")
+	return service.Control(s, "stop")
+}
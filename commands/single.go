@@ -8,6 +8,7 @@ import (
 	log "github.com/Sirupsen/logrus"
 
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/sinks"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/network"
 	"os/signal"
 	"syscall"
@@ -15,7 +16,11 @@ import (
 
 type RunSingleCommand struct {
 	common.RunnerConfig
-	network common.Network
+	network        common.Network
+	finishedBuilds int
+
+	MaxBuilds  int `long:"max-builds" description:"How many builds to process before exiting"`
+	RunTimeout int `long:"run-timeout" description:"How long to run in seconds before exiting, the running build is finished first"`
 }
 
 func waitForInterrupts(finished *bool, abortSignal chan os.Signal, doneSignal chan int) {
@@ -77,18 +82,33 @@ func (r *RunSingleCommand) processBuild(data common.ExecutorData, abortSignal ch
 		SystemInterrupt:  abortSignal,
 		ExecutorData:     data,
 	}
+	detectCoordinatorFeatures(r.network, &r.RunnerConfig, &newBuild)
 
 	buildCredentials := &common.BuildCredentials{
 		ID:    buildData.ID,
 		Token: buildData.Token,
 	}
-	trace := r.network.ProcessBuild(r.RunnerConfig, buildCredentials)
+	trace := sinks.NewBuildTrace(r.network.ProcessBuild(r.RunnerConfig, buildCredentials), &r.RunnerConfig, buildData)
 	defer trace.Fail(err)
 
 	err = newBuild.Run(config, trace)
+	r.finishedBuilds++
 	return
 }
 
+// isFinished checks if the limit of builds or the run time were reached
+func (r *RunSingleCommand) isFinished(startTime time.Time) bool {
+	if r.MaxBuilds > 0 && r.finishedBuilds >= r.MaxBuilds {
+		log.Println("The limit of", r.MaxBuilds, "builds was reached")
+		return true
+	}
+	if r.RunTimeout > 0 && time.Since(startTime) >= time.Duration(r.RunTimeout)*time.Second {
+		log.Println("The run timeout of", r.RunTimeout, "seconds was reached")
+		return true
+	}
+	return false
+}
+
 func (r *RunSingleCommand) Execute(c *cli.Context) {
 	if len(r.URL) == 0 {
 		log.Fatalln("Missing URL")
@@ -113,7 +133,8 @@ func (r *RunSingleCommand) Execute(c *cli.Context) {
 
 	go waitForInterrupts(&finished, abortSignal, doneSignal)
 
-	for !finished {
+	startTime := time.Now()
+	for !finished && !r.isFinished(startTime) {
 		data, err := executorProvider.Acquire(&r.RunnerConfig)
 		if err != nil {
 			log.Warningln("Executor update:", err)
@@ -123,6 +144,9 @@ func (r *RunSingleCommand) Execute(c *cli.Context) {
 		executorProvider.Release(&r.RunnerConfig, data)
 	}
 
+	if !sinks.Wait() {
+		log.Warningln("Timed out sending the build traces to the log sink")
+	}
 	doneSignal <- 0
 }
 
@@ -38,27 +38,28 @@ func (c *UnregisterCommand) Execute(context *cli.Context) {
 		return
 	}
 
-	runners := []*common.RunnerConfig{}
-	for _, otherRunner := range c.config.Runners {
-		if otherRunner.RunnerCredentials == c.RunnerCredentials {
-			continue
+	// the config could be changed by other command in the meantime
+	updated := false
+	err = c.updateConfig(func(config *common.Config) bool {
+		runners := []*common.RunnerConfig{}
+		for _, otherRunner := range config.Runners {
+			if otherRunner.UniqueID() == c.UniqueID() {
+				continue
+			}
+			runners = append(runners, otherRunner)
 		}
-		runners = append(runners, otherRunner)
-	}
-
-	// check if anything changed
-	if len(c.config.Runners) == len(runners) {
-		return
-	}
 
-	c.config.Runners = runners
-
-	// save config file
-	err = c.saveConfig()
+		// check if anything changed
+		updated = len(config.Runners) != len(runners)
+		config.Runners = runners
+		return updated
+	})
 	if err != nil {
 		log.Fatalln("Failed to update", c.ConfigFile, err)
 	}
-	log.Println("Updated", c.ConfigFile)
+	if updated {
+		log.Println("Updated", c.ConfigFile)
+	}
 }
 
 func init() {
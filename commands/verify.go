@@ -25,26 +25,28 @@ func (c *VerifyCommand) Execute(context *cli.Context) {
 	}
 
 	// verify if runner exist
-	runners := []*common.RunnerConfig{}
+	deleted := map[string]bool{}
 	for _, runner := range c.config.Runners {
-		if c.network.VerifyRunner(runner.RunnerCredentials) {
-			runners = append(runners, runner)
+		if !c.network.VerifyRunner(runner.RunnerCredentials) {
+			deleted[runner.UniqueID()] = true
 		}
 	}
 
-	if !c.DeleteNonExisting {
+	if !c.DeleteNonExisting || len(deleted) == 0 {
 		return
 	}
 
-	// check if anything changed
-	if len(c.config.Runners) == len(runners) {
-		return
-	}
-
-	c.config.Runners = runners
-
-	// save config file
-	err = c.saveConfig()
+	// the config could be changed by other command in the meantime
+	err = c.updateConfig(func(config *common.Config) bool {
+		runners := []*common.RunnerConfig{}
+		for _, runner := range config.Runners {
+			if !deleted[runner.UniqueID()] {
+				runners = append(runners, runner)
+			}
+		}
+		config.Runners = runners
+		return true
+	})
 	if err != nil {
 		log.Fatalln("Failed to update", c.ConfigFile, err)
 	}
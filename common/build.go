@@ -1,6 +1,7 @@
 package common
 
 import (
+	"crypto/md5"
 	"errors"
 	"fmt"
 	"net/url"
@@ -42,6 +43,28 @@ type Build struct {
 	Runner          *RunnerConfig  `json:"runner"`
 	ExecutorData    ExecutorData
 
+	// BuildHostname is the hostname inside of the build environment, set by the executor
+	BuildHostname string `json:"-" yaml:"-"`
+
+	// CACertificates are the PEM encoded certificates trusted by the build, set by the
+	// executor when the build environment doesn't share the trust store of the host
+	CACertificates string `json:"-" yaml:"-"`
+
+	// Features are supported by the executor and the shell of the build, detected after preparing it
+	Features *FeaturesInfo `json:"-" yaml:"-"`
+
+	// SkipArtifactsDirectUpload is set when the runner detected that the coordinator doesn't offer
+	// the direct uploads of the artifacts, so the artifacts-uploader doesn't probe it again
+	SkipArtifactsDirectUpload bool `json:"-" yaml:"-"`
+
+	// Only print the scripts of the build, without executing them
+	DryRun bool `json:"-" yaml:"-"`
+
+	summary *BuildSummary
+
+	// runnerVariables are the variables of the runner with the resolved secrets
+	runnerVariables BuildVariables
+
 	// Unique ID for all running builds on this runner
 	RunnerID int `json:"runner_id"`
 
@@ -54,8 +77,36 @@ func (b *Build) Log() *logrus.Entry {
 }
 
 func (b *Build) ProjectUniqueName() string {
-	return fmt.Sprintf("runner-%s-project-%d-concurrent-%d",
+	name := fmt.Sprintf("runner-%s-project-%d-concurrent-%d",
 		b.Runner.ShortDescription(), b.ProjectID, b.ProjectRunnerID)
+
+	// The parallel builds of the job don't share the directories and containers
+	if b.IsParallel() {
+		name += fmt.Sprintf("-node-%d", b.NodeIndex)
+	}
+	return name
+}
+
+// maxHostnameLength is the limit of the DNS label
+const maxHostnameLength = 63
+
+// UniqueHostname is the hostname derived from ProjectUniqueName, which is a valid DNS label
+// and doesn't collide with the hostnames of the concurrent builds
+func (b *Build) UniqueHostname() string {
+	hostname := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' {
+			return r
+		}
+		return '-'
+	}, strings.ToLower(b.ProjectUniqueName()))
+
+	if len(hostname) <= maxHostnameLength {
+		return hostname
+	}
+
+	// The end of the shortened hostname is replaced with the hash of the whole name
+	hash := fmt.Sprintf("%x", md5.Sum([]byte(hostname)))[:8]
+	return strings.TrimRight(hostname[:maxHostnameLength-len(hash)-1], "-") + "-" + hash
 }
 
 func (b *Build) ProjectSlug() (string, error) {
@@ -102,6 +153,12 @@ func (b *Build) FullProjectDir() string {
 	return helpers.ToSlash(b.BuildDir)
 }
 
+// TmpProjectDir is the private temporary directory of the build,
+// it's placed next to the project directory to not be changed by git
+func (b *Build) TmpProjectDir() string {
+	return b.FullProjectDir() + ".tmp"
+}
+
 func (b *Build) StartBuild(rootDir, cacheDir string, sharedDir bool) {
 	b.RootDir = rootDir
 	b.BuildDir = path.Join(rootDir, b.ProjectUniqueDir(sharedDir))
@@ -124,6 +181,11 @@ func (b *Build) executeShellScript(scriptType ShellScriptType, executor Executor
 		return nil
 	}
 
+	if b.IsDryRun() {
+		b.printDryRunScript(scriptType, script)
+		return nil
+	}
+
 	cmd := ExecutorCommand{
 		Script: script,
 		Abort:  abort,
@@ -145,12 +207,12 @@ func (b *Build) executeUploadArtifacts(state error, executor Executor, abort cha
 	if state == nil {
 		// Previous stages were successful
 		if when == "" || when == "on_success" || when == "always" {
-			err = b.executeShellScript(ShellUploadArtifacts, executor, abort)
+			err = b.executeStage(BuildStageUploadArtifacts, executor, abort)
 		}
 	} else {
 		// Previous stage did fail
 		if when == "on_failure" || when == "always" {
-			err = b.executeShellScript(ShellUploadArtifacts, executor, abort)
+			err = b.executeStage(BuildStageUploadArtifacts, executor, abort)
 		}
 	}
 
@@ -162,27 +224,37 @@ func (b *Build) executeUploadArtifacts(state error, executor Executor, abort cha
 }
 
 func (b *Build) executeScript(executor Executor, abort chan interface{}) error {
-	// Execute pre script (git clone, cache restore, artifacts download)
-	err := b.executeShellScript(ShellPrepareScript, executor, abort)
+	if b.IsDryRun() {
+		b.printDryRunVariables()
+	}
+
+	// Execute pre stages (git clone, cache restore, artifacts download)
+	var err error
+	for _, stage := range []BuildStage{BuildStageGetSources, BuildStageRestoreCache, BuildStageDownloadArtifacts} {
+		err = b.executeStage(stage, executor, abort)
+		if err != nil {
+			break
+		}
+	}
 
 	if err == nil {
 		// Execute user build script (before_script + script)
-		err = b.executeShellScript(ShellBuildScript, executor, abort)
+		b.Trace.ScriptStarted()
+		err = b.executeStage(BuildStageUserScript, executor, abort)
 
-		// Execute after script (after_script)
-		timeoutCh := make(chan interface{}, 1)
-		timeout := time.AfterFunc(time.Minute*5, func() {
-			close(timeoutCh)
-		})
-		b.executeShellScript(ShellAfterScript, executor, timeoutCh)
-		timeout.Stop()
+		// Execute after script (after_script), it isn't aborted together with the build
+		b.executeStage(BuildStageAfterScript, executor, nil)
 	}
 
 	// Execute post script (cache store, artifacts upload)
 	if err == nil {
-		err = b.executeShellScript(ShellArchiveCache, executor, abort)
+		err = b.executeStage(BuildStageArchiveCache, executor, abort)
 	}
 	err = b.executeUploadArtifacts(err, executor, abort)
+
+	// Remove the temporary files of the build, the files of the aborted build
+	// are removed when the next build is prepared in the same directory
+	b.executeStage(BuildStageCleanup, executor, abort)
 	return err
 }
 
@@ -203,8 +275,13 @@ func (b *Build) run(executor Executor) (err error) {
 	// Wait for signals: cancel, timeout, abort or finish
 	b.Log().Debugln("Waiting for signals...")
 	select {
-	case <-b.Trace.Aborted():
-		err = &BuildError{Inner: errors.New("canceled")}
+	case reason := <-b.Trace.Aborted():
+		// the trace can abort the build with the reason, eg. when the trace exceeded the output limit
+		if abortErr, ok := reason.(error); ok {
+			err = &BuildError{Inner: abortErr}
+		} else {
+			err = &BuildError{Inner: errors.New("canceled")}
+		}
 
 	case <-time.After(time.Duration(buildTimeout) * time.Second):
 		err = &BuildError{Inner: fmt.Errorf("execution took longer than %v seconds", buildTimeout)}
@@ -228,6 +305,21 @@ func (b *Build) run(executor Executor) (err error) {
 	}
 }
 
+func (b *Build) prepareExecutor(globalConfig *Config, executor Executor) (err error) {
+	executor.SetCurrentStage(BuildStagePrepareExecutor)
+
+	started := time.Now()
+	defer func() {
+		b.finishStage(BuildStagePrepareExecutor, executor, time.Since(started), err)
+	}()
+
+	err = b.startStage(BuildStagePrepareExecutor, executor)
+	if err != nil {
+		return
+	}
+	return executor.Prepare(globalConfig, b.Runner, b)
+}
+
 func (b *Build) retryCreateExecutor(globalConfig *Config, provider ExecutorProvider, logger BuildLogger) (executor Executor, err error) {
 	for tries := 0; tries < PreparationRetries; tries++ {
 		executor = provider.Create()
@@ -236,12 +328,12 @@ func (b *Build) retryCreateExecutor(globalConfig *Config, provider ExecutorProvi
 			return
 		}
 
-		err = executor.Prepare(globalConfig, b.Runner, b)
+		err = b.prepareExecutor(globalConfig, executor)
 		if err == nil {
 			break
 		}
 		if executor != nil {
-			executor.Cleanup()
+			b.cleanupExecutor(executor)
 			executor = nil
 		}
 
@@ -255,10 +347,33 @@ func (b *Build) retryCreateExecutor(globalConfig *Config, provider ExecutorProvi
 func (b *Build) Run(globalConfig *Config, trace BuildTrace) (err error) {
 	var executor Executor
 
+	// The colors are removed last, so also the colors of timestamps are removed
+	trace = newUncoloredTrace(trace, b.Runner.DisableColors || helpers.NoColor())
+	trace = newSanitizedTrace(trace)
+
+	timestamps, timestampsErr := b.Runner.TraceTimestamps.Get()
+	if timestampsErr == nil {
+		trace = newTimestampedTrace(trace, timestamps)
+	}
+
 	logger := NewBuildLogger(trace, b.Log())
+	if timestampsErr != nil {
+		logger.Warningln(timestampsErr)
+	}
+	if _, policyErr := b.Runner.OutputLimitPolicy.Get(); policyErr != nil {
+		logger.Warningln(policyErr)
+	}
 	logger.Println("Running with " + AppVersion.Line() + helpers.ANSI_RESET)
+	b.warnUnsupportedSchema(logger)
+	b.logRunnerVariables(logger)
+
+	b.summary = b.newSummary()
+	if b.summary != nil {
+		trace = &summaryTrace{BuildTrace: trace, summary: b.summary}
+	}
 
 	defer func() {
+		b.writeSummary(err, logger)
 		if _, ok := err.(*BuildError); ok {
 			logger.SoftErrorln("Build failed:", err)
 			trace.Fail(err)
@@ -270,11 +385,16 @@ func (b *Build) Run(globalConfig *Config, trace BuildTrace) (err error) {
 			trace.Success()
 		}
 		if executor != nil {
-			executor.Cleanup()
+			b.cleanupExecutor(executor)
 		}
 	}()
 
 	b.Trace = trace
+	b.setupCoverage(trace, logger)
+
+	if secretsErr := b.resolveSecrets(); secretsErr != nil {
+		return &BuildError{Inner: secretsErr}
+	}
 
 	provider := GetExecutor(b.Runner.Executor)
 	if provider == nil {
@@ -283,20 +403,28 @@ func (b *Build) Run(globalConfig *Config, trace BuildTrace) (err error) {
 
 	executor, err = b.retryCreateExecutor(globalConfig, provider, logger)
 	if err == nil {
+		b.detectFeatures(provider, executor)
+		logger.Println("Executor features:", strings.Join(b.FeaturesNames(), ", "))
 		err = b.run(executor)
 	}
 	if executor != nil {
+		executor.SetCurrentStage(BuildStageFinishExecutor)
 		executor.Finish(err)
 	}
 	return err
 }
 
+func (b *Build) cleanupExecutor(executor Executor) {
+	executor.SetCurrentStage(BuildStageCleanupExecutor)
+	executor.Cleanup()
+}
+
 func (b *Build) String() string {
 	return helpers.ToYAML(b)
 }
 
 func (b *Build) GetDefaultVariables() BuildVariables {
-	return BuildVariables{
+	variables := BuildVariables{
 		{"CI", "true", true, true, false},
 		{"CI_BUILD_REF", b.Sha, true, true, false},
 		{"CI_BUILD_BEFORE_SHA", b.BeforeSha, true, true, false},
@@ -306,21 +434,80 @@ func (b *Build) GetDefaultVariables() BuildVariables {
 		{"CI_BUILD_TOKEN", b.Token, true, true, false},
 		{"CI_PROJECT_ID", strconv.Itoa(b.ProjectID), true, true, false},
 		{"CI_PROJECT_DIR", b.FullProjectDir(), true, true, false},
+		{"TMPDIR", b.TmpProjectDir(), true, true, false},
+		{"TMP", b.TmpProjectDir(), true, true, false},
+		{"TEMP", b.TmpProjectDir(), true, true, false},
 		{"CI_SERVER", "yes", true, true, false},
 		{"CI_SERVER_NAME", "GitLab CI", true, true, false},
 		{"CI_SERVER_VERSION", "", true, true, false},
 		{"CI_SERVER_REVISION", "", true, true, false},
 		{"GITLAB_CI", "true", true, true, false},
+		{"CI_RUNNER_ID", b.Runner.ShortDescription(), true, true, false},
+		{"CI_RUNNER_DESCRIPTION", b.Runner.Name, true, true, false},
+		{"CI_RUNNER_TAGS", b.Runner.TagList, true, true, false},
+		{"CI_RUNNER_EXECUTOR", b.Runner.Executor, true, true, false},
+		{"CI_RUNNER_VERSION", AppVersion.Version, true, true, false},
+		{"CI_RUNNER_REVISION", AppVersion.Revision, true, true, false},
 	}
+
+	if b.BuildHostname != "" {
+		variables = append(variables, BuildVariable{"CI_BUILD_HOSTNAME", b.BuildHostname, true, true, false})
+	}
+	return variables
 }
 
-func (b *Build) GetAllVariables() BuildVariables {
-	variables := b.Runner.GetVariables()
-	variables = append(variables, b.GetDefaultVariables()...)
+// GetParallelVariables describe the position of the build among the parallel builds of the job
+func (b *Build) GetParallelVariables() BuildVariables {
+	if !b.IsParallel() {
+		return nil
+	}
+
+	return BuildVariables{
+		{"CI_NODE_INDEX", strconv.Itoa(b.NodeIndex), true, true, false},
+		{"CI_NODE_TOTAL", strconv.Itoa(b.NodeTotal), true, true, false},
+	}
+}
+
+// getBuildVariables returns the variables overriding the ones of the runner
+func (b *Build) getBuildVariables() BuildVariables {
+	variables := b.GetDefaultVariables()
+	variables = append(variables, b.GetParallelVariables()...)
+	variables = append(variables, b.GetFeaturesVariables()...)
 	variables = append(variables, b.Variables...)
+	return variables
+}
+
+// getRunnerVariables returns the variables of the runner, with the secrets once they're resolved
+func (b *Build) getRunnerVariables() BuildVariables {
+	if b.runnerVariables != nil {
+		return append(BuildVariables{}, b.runnerVariables...)
+	}
+	return b.Runner.GetVariables()
+}
+
+func (b *Build) GetAllVariables() BuildVariables {
+	variables := b.getRunnerVariables()
+	variables = append(variables, b.getBuildVariables()...)
 	return variables.Expand()
 }
 
+// logRunnerVariables shows in the debug log which of the runner variables are used,
+// the values are not logged as they can be secret
+func (b *Build) logRunnerVariables(logger BuildLogger) {
+	overridden := make(map[string]bool)
+	for _, variable := range b.getBuildVariables() {
+		overridden[variable.Key] = true
+	}
+
+	for _, variable := range b.Runner.GetVariables() {
+		if overridden[variable.Key] {
+			logger.Debugln("The runner variable", variable.Key, "is overridden by the build")
+		} else {
+			logger.Debugln("Using the runner variable", variable.Key)
+		}
+	}
+}
+
 func (b *Build) GetGitDepth() string {
 	return b.GetAllVariables().Get("GIT_DEPTH")
 }
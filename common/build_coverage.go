@@ -0,0 +1,59 @@
+package common
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var coverageValueRegex = regexp.MustCompile(`\d+(\.\d+)?`)
+
+// ParseCoverageRegex compiles the coverage regex, it can be surrounded
+// by slashes like in the .gitlab-ci.yml
+func ParseCoverageRegex(regex string) (*regexp.Regexp, error) {
+	if len(regex) >= 2 && strings.HasPrefix(regex, "/") && strings.HasSuffix(regex, "/") {
+		regex = regex[1 : len(regex)-1]
+	}
+	return regexp.Compile(regex)
+}
+
+// ExtractCoverage returns the first number of the last line matching the regex,
+// or nil when the trace doesn't report the coverage
+func ExtractCoverage(regex *regexp.Regexp, trace string) *float64 {
+	var coverage *float64
+
+	for _, line := range strings.Split(trace, "\n") {
+		match := regex.FindString(line)
+		if match == "" {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(coverageValueRegex.FindString(match), 64)
+		if err == nil {
+			coverage = &value
+		}
+	}
+	return coverage
+}
+
+// GetCoverageRegex returns the coverage regex of the build, the job option overrides the runner setting
+func (b *Build) GetCoverageRegex() string {
+	if regex, ok := b.Options.GetString("coverage_regex"); ok && regex != "" {
+		return regex
+	}
+	return b.Runner.CoverageRegex
+}
+
+func (b *Build) setupCoverage(trace BuildTrace, logger BuildLogger) {
+	regex := b.GetCoverageRegex()
+	if regex == "" {
+		return
+	}
+
+	compiled, err := ParseCoverageRegex(regex)
+	if err != nil {
+		logger.Warningln("Invalid coverage regex:", err)
+		return
+	}
+	trace.SetCoverageRegex(compiled)
+}
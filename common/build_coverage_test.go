@@ -0,0 +1,47 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCoverageRegex(t *testing.T) {
+	regex, err := ParseCoverageRegex(`/Total: \d+%/`)
+	if assert.NoError(t, err) {
+		assert.Equal(t, `Total: \d+%`, regex.String(), "the slashes are removed")
+	}
+
+	regex, err = ParseCoverageRegex(`Total: \d+%`)
+	if assert.NoError(t, err) {
+		assert.Equal(t, `Total: \d+%`, regex.String())
+	}
+
+	_, err = ParseCoverageRegex(`/(invalid/`)
+	assert.Error(t, err)
+}
+
+func TestExtractCoverage(t *testing.T) {
+	regex, _ := ParseCoverageRegex(`/\(\d+\.\d+%\) covered/`)
+
+	assert.Nil(t, ExtractCoverage(regex, "no coverage\n"))
+
+	coverage := ExtractCoverage(regex, "1 (10.50%) covered\n2 (98.40%) covered\nsummary\n")
+	if assert.NotNil(t, coverage) {
+		assert.Equal(t, 98.4, *coverage, "the last match is used")
+	}
+}
+
+func TestBuildCoverageRegex(t *testing.T) {
+	build := &Build{
+		Runner: &RunnerConfig{
+			RunnerSettings: RunnerSettings{
+				CoverageRegex: "runner",
+			},
+		},
+	}
+	assert.Equal(t, "runner", build.GetCoverageRegex())
+
+	build.Options = BuildOptions{"coverage_regex": "job"}
+	assert.Equal(t, "job", build.GetCoverageRegex(), "the job overrides the runner setting")
+}
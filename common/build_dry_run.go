@@ -0,0 +1,53 @@
+package common
+
+import (
+	"fmt"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
+)
+
+// DryRunMask replaces the secrets in the output of the dry run
+const DryRunMask = "[MASKED]"
+
+// IsDryRun checks if the scripts of the build are only printed, without executing them
+func (b *Build) IsDryRun() bool {
+	return b.DryRun || b.GetAllVariables().Get("CI_DRY_RUN") == "true"
+}
+
+func isSecretVariable(variable BuildVariable) bool {
+	return !variable.Public || variable.Key == "CI_BUILD_TOKEN"
+}
+
+// MaskDryRunVariable hides the value of the secret variable, when it's written to the scripts of the dry run.
+// The shells mask the values before they are escaped, so every secret is masked whatever its length
+func (b *Build) MaskDryRunVariable(variable BuildVariable) BuildVariable {
+	if b.IsDryRun() && isSecretVariable(variable) {
+		variable.Value = DryRunMask
+	}
+	return variable
+}
+
+// MaskDryRunValue hides the secret, eg. the token passed to the helpers, written to the scripts of the dry run
+func (b *Build) MaskDryRunValue(secret string) string {
+	if b.IsDryRun() && secret != "" {
+		return DryRunMask
+	}
+	return secret
+}
+
+func (b *Build) printDryRunVariables() {
+	fmt.Fprintln(b.Trace, helpers.ANSI_BOLD_CYAN+"Dry run, the scripts will not be executed"+helpers.ANSI_RESET)
+	fmt.Fprintln(b.Trace, helpers.ANSI_BOLD_CYAN+"Variables:"+helpers.ANSI_RESET)
+	for _, variable := range b.GetAllVariables() {
+		value := variable.Value
+		if isSecretVariable(variable) {
+			value = DryRunMask
+		}
+		fmt.Fprintf(b.Trace, "%s=%s\n", variable.Key, value)
+	}
+}
+
+func (b *Build) printDryRunScript(scriptType ShellScriptType, script string) {
+	fmt.Fprintln(b.Trace, helpers.ANSI_BOLD_CYAN+"Script "+string(scriptType)+":"+helpers.ANSI_RESET)
+	fmt.Fprintln(b.Trace, script)
+}
@@ -0,0 +1,82 @@
+package common
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestBuildDryRun(t *testing.T) {
+	e := MockExecutor{}
+	defer e.AssertExpectations(t)
+	e.On("SetCurrentStage", mock.Anything).Return()
+
+	p := MockExecutorProvider{}
+	defer p.AssertExpectations(t)
+
+	// The executor is prepared, but nothing is run
+	p.On("Create").Return(&e).Once()
+	p.On("GetFeatures", mock.Anything).Return().Once()
+	e.On("Prepare", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+	e.On("Shell").Return(&ShellScriptInfo{Shell: "script-shell"})
+	e.On("Finish", nil).Return().Once()
+	e.On("Cleanup").Return().Once()
+
+	RegisterExecutor("build-dry-run-test", &p)
+
+	build := &Build{
+		GetBuildResponse: SuccessfulBuild,
+		Runner: &RunnerConfig{
+			RunnerSettings: RunnerSettings{
+				Executor: "build-dry-run-test",
+			},
+		},
+		DryRun: true,
+	}
+	build.Variables = BuildVariables{
+		{Key: "PUBLIC", Value: "public-value", Public: true},
+		{Key: "SECRET", Value: "secret-value"},
+	}
+
+	var buffer bytes.Buffer
+	err := build.Run(&Config{}, &Trace{Writer: &buffer})
+	assert.NoError(t, err)
+
+	output := buffer.String()
+	assert.True(t, strings.Contains(output, "PUBLIC=public-value"), output)
+	assert.True(t, strings.Contains(output, "SECRET=[MASKED]"), output)
+	assert.False(t, strings.Contains(output, "secret-value"), output)
+	assert.True(t, strings.Contains(output, "Script build_script:"), output)
+}
+
+func TestBuildDryRunVariable(t *testing.T) {
+	build := &Build{
+		Runner: &RunnerConfig{},
+	}
+	assert.False(t, build.IsDryRun())
+
+	build.Variables = BuildVariables{{Key: "CI_DRY_RUN", Value: "true"}}
+	assert.True(t, build.IsDryRun())
+}
+
+func TestBuildMaskDryRunVariable(t *testing.T) {
+	build := &Build{
+		Runner: &RunnerConfig{},
+	}
+	secret := BuildVariable{Key: "SHORT", Value: "secret"}
+	public := BuildVariable{Key: "PUBLIC", Value: "public-value", Public: true}
+	token := BuildVariable{Key: "CI_BUILD_TOKEN", Value: "token", Public: true}
+
+	assert.Equal(t, secret, build.MaskDryRunVariable(secret), "the scripts aren't masked without the dry run")
+	assert.Equal(t, "token", build.MaskDryRunValue("token"))
+
+	build.DryRun = true
+	assert.Equal(t, DryRunMask, build.MaskDryRunVariable(secret).Value, "the short secrets are masked too")
+	assert.Equal(t, DryRunMask, build.MaskDryRunVariable(token).Value)
+	assert.Equal(t, public, build.MaskDryRunVariable(public))
+	assert.Equal(t, DryRunMask, build.MaskDryRunValue("token"))
+	assert.Empty(t, build.MaskDryRunValue(""))
+}
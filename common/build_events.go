@@ -0,0 +1,55 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+type BuildEventType string
+
+const (
+	BuildEventCacheRestored     BuildEventType = "cache_restored"
+	BuildEventCacheMissed       BuildEventType = "cache_missed"
+	BuildEventArtifactsUploaded BuildEventType = "artifacts_uploaded"
+)
+
+// BuildEvent is reported by the helpers running in the build, eg. by the cache-extractor,
+// the runner records it in the build summary
+type BuildEvent struct {
+	Type BuildEventType `json:"type"`
+	Name string         `json:"name,omitempty"`
+	Size int64          `json:"size,omitempty"`
+}
+
+// buildEventMarker starts the line of the event in the output of the helper. It's the operating
+// system command escape sequence ignored by the terminals, the runner removes the line from the trace
+var buildEventMarker = []byte("\x1b]gitlab-runner-event;")
+
+const buildEventTerminator = '\a'
+
+// WriteBuildEvent writes the event to the output of the helper as a single line
+func WriteBuildEvent(w io.Writer, event BuildEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	line := append(append([]byte{}, buildEventMarker...), data...)
+	line = append(line, buildEventTerminator, '\n')
+	_, err = w.Write(line)
+	return err
+}
+
+// parseBuildEvent decodes the line written by WriteBuildEvent, without the new line
+func parseBuildEvent(line []byte) (event BuildEvent, ok bool) {
+	if !bytes.HasPrefix(line, buildEventMarker) {
+		return
+	}
+
+	data := bytes.TrimSuffix(bytes.TrimSuffix(line[len(buildEventMarker):], []byte{'\r'}), []byte{buildEventTerminator})
+	if err := json.Unmarshal(data, &event); err != nil {
+		return
+	}
+	return event, event.Type != ""
+}
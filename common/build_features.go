@@ -0,0 +1,64 @@
+package common
+
+import (
+	"strconv"
+	"strings"
+)
+
+type feature struct {
+	name    string
+	enabled bool
+}
+
+// list returns the features in a stable order
+func (f *FeaturesInfo) list() []feature {
+	return []feature{
+		{"variables", f.Variables},
+		{"image", f.Image},
+		{"services", f.Services},
+		{"artifacts", f.Artifacts},
+		{"cache", f.Cache},
+		{"shared", f.Shared},
+	}
+}
+
+// detectFeatures finds the features supported by the executor and the shell of the build
+func (b *Build) detectFeatures(provider ExecutorProvider, executor Executor) {
+	features := &FeaturesInfo{}
+	provider.GetFeatures(features)
+
+	if info := executor.Shell(); info != nil {
+		if shell := GetShell(info.Shell); shell != nil {
+			shell.GetFeatures(features)
+		}
+	}
+	b.Features = features
+}
+
+// FeaturesNames returns the names of the features supported by the build environment
+func (b *Build) FeaturesNames() (names []string) {
+	if b.Features == nil {
+		return
+	}
+
+	for _, feature := range b.Features.list() {
+		if feature.enabled {
+			names = append(names, feature.name)
+		}
+	}
+	return
+}
+
+// GetFeaturesVariables exposes the features as CI_RUNNER_FEATURE_*,
+// so the builds can check what the runner supports
+func (b *Build) GetFeaturesVariables() (variables BuildVariables) {
+	if b.Features == nil {
+		return
+	}
+
+	for _, feature := range b.Features.list() {
+		key := "CI_RUNNER_FEATURE_" + strings.ToUpper(feature.name)
+		variables = append(variables, BuildVariable{key, strconv.FormatBool(feature.enabled), true, true, false})
+	}
+	return
+}
@@ -0,0 +1,26 @@
+package common
+
+import (
+	"encoding/json"
+)
+
+// Image is the image of the build container defined by the build.
+// It's defined as the image name or with the extended syntax:
+// {"name": "vendor/tool:1.0", "entrypoint": [""], "command": ["/bin/bash"]}
+type Image struct {
+	Name       string   `json:"name"`
+	Entrypoint []string `json:"entrypoint,omitempty"`
+	Command    []string `json:"command,omitempty"`
+}
+
+type imageDefinition Image
+
+func (i *Image) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*i = Image{Name: name}
+		return nil
+	}
+
+	return json.Unmarshal(data, (*imageDefinition)(i))
+}
@@ -0,0 +1,30 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImageDecode(t *testing.T) {
+	examples := map[string]Image{
+		`{"image": "ruby:2.3"}`: {Name: "ruby:2.3"},
+		`{"image": {"name": "vendor/tool", "entrypoint": [""], "command": ["/bin/bash"]}}`: {
+			Name:       "vendor/tool",
+			Entrypoint: []string{""},
+			Command:    []string{"/bin/bash"},
+		},
+	}
+
+	for data, expected := range examples {
+		var options BuildOptions
+		var result struct {
+			Image Image `json:"image"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(data), &options))
+		require.NoError(t, options.Decode(&result))
+		assert.Equal(t, expected, result.Image, data)
+	}
+}
@@ -3,6 +3,8 @@ package common
 import (
 	"encoding/json"
 	"fmt"
+	"reflect"
+	"sort"
 	"strings"
 
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
@@ -44,6 +46,73 @@ func (m *BuildOptions) Decode(result interface{}, keys ...string) error {
 	return json.Unmarshal(data, result)
 }
 
+// UnknownKeys lists the keys of the options, which are not decoded to any field of the result
+func (m *BuildOptions) UnknownKeys(result interface{}, keys ...string) (unknown []string) {
+	value, ok := m.Get(keys...)
+	if !ok {
+		return nil
+	}
+
+	unknown = unknownKeys(value, reflect.TypeOf(result), "")
+	sort.Strings(unknown)
+	return
+}
+
+func jsonFields(t reflect.Type, fields map[string]reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		} else if name == "" && field.Anonymous && field.Type.Kind() == reflect.Struct {
+			jsonFields(field.Type, fields)
+			continue
+		} else if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+}
+
+func unknownKeys(value interface{}, t reflect.Type, prefix string) (unknown []string) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		if values, ok := value.([]interface{}); ok {
+			for _, item := range values {
+				unknown = append(unknown, unknownKeys(item, t.Elem(), prefix)...)
+			}
+		}
+
+	case reflect.Map:
+		if values, ok := value.(map[string]interface{}); ok {
+			for key, item := range values {
+				unknown = append(unknown, unknownKeys(item, t.Elem(), prefix+key+".")...)
+			}
+		}
+
+	case reflect.Struct:
+		values, ok := value.(map[string]interface{})
+		if !ok {
+			return
+		}
+
+		fields := make(map[string]reflect.Type)
+		jsonFields(t, fields)
+		for key, item := range values {
+			if fieldType, ok := fields[key]; ok {
+				unknown = append(unknown, unknownKeys(item, fieldType, prefix+key+".")...)
+			} else {
+				unknown = append(unknown, prefix+key)
+			}
+		}
+	}
+	return
+}
+
 func convertMapToStringMap(in interface{}) (out interface{}, err error) {
 	mapString, ok := in.(map[string]interface{})
 	if ok {
@@ -111,3 +111,25 @@ func TestBuildOptionsSanitizeWithYamlDecode(t *testing.T) {
 		},
 	}, options)
 }
+
+const exampleOptionsUnknownJSON = `{
+	"options": {
+		"root": "value",
+		"other": "value",
+		"data": {
+			"string": "value",
+			"float": 1.0
+		}
+	}
+}`
+
+func TestBuildOptionsUnknownKeys(t *testing.T) {
+	var options buildTest
+	require.NoError(t, options.Unmarshal(exampleOptionsJSON))
+	assert.Equal(t, 0, len(options.UnknownKeys(&testOptions{})))
+
+	require.NoError(t, options.Unmarshal(exampleOptionsUnknownJSON))
+	assert.Equal(t, []string{"data.float", "other"}, options.UnknownKeys(&testOptions{}))
+	assert.Equal(t, []string{"float"}, options.UnknownKeys(&dataOptions{}, "data"))
+	assert.Equal(t, 0, len(options.UnknownKeys(&dataOptions{}, "missing")))
+}
@@ -0,0 +1,120 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// BuildSchemaVersion is the version of the build payload understood by the runner,
+// the builds declaring the newer schema_version are reported as not fully supported.
+// Increase it together with the new fields of GetBuildResponse.
+const BuildSchemaVersion = 1
+
+// knownBuildFields are the fields of GetBuildResponse and of the build entity of GitLab,
+// which is the same for the build and its dependencies, see BuildInfo
+var knownBuildFields = getJSONFieldNames(reflect.TypeOf(GetBuildResponse{}), reflect.TypeOf(BuildInfo{}))
+
+// buildDisplayFields are exposed by the build entity of GitLab for the UI,
+// they're never needed by the runner
+var buildDisplayFields = map[string]bool{
+	"status":       true,
+	"project_name": true,
+}
+
+type buildOptionsSchema struct {
+	schema interface{}
+	known  map[string]bool
+}
+
+// buildOptionsSchemas are the structures, to which the options of the build are decoded,
+// the keys of the options without the structure are the keywords unknown to the runner
+var buildOptionsSchemas = map[string]buildOptionsSchema{
+	"image":          {schema: &Image{}},
+	"services":       {schema: &Services{}},
+	"coverage_regex": {schema: new(string)},
+}
+
+// RegisterBuildOptions registers the structure, to which the options under the key are decoded.
+// The known are the keys of the options not covered by the structure, but read by the runner.
+func RegisterBuildOptions(key string, schema interface{}, known map[string]bool) {
+	buildOptionsSchemas[key] = buildOptionsSchema{schema: schema, known: known}
+}
+
+func getJSONFieldNames(types ...reflect.Type) map[string]bool {
+	names := make(map[string]bool)
+	for _, t := range types {
+		for i := 0; i < t.NumField(); i++ {
+			name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+			if name != "" && name != "-" {
+				names[name] = true
+			}
+		}
+	}
+	return names
+}
+
+func unknownBuildOptions(options BuildOptions) (unknown []string) {
+	for key := range options {
+		option, ok := buildOptionsSchemas[key]
+		if !ok {
+			unknown = append(unknown, "options."+key)
+			continue
+		}
+
+		for _, name := range options.UnknownKeys(option.schema, key) {
+			if !option.known[name] {
+				unknown = append(unknown, "options."+key+"."+name)
+			}
+		}
+	}
+	return
+}
+
+// ParseBuildResponse decodes the build received from GitLab. The fields and the keywords of the options
+// added by the newer GitLab are ignored, but they're returned in UnknownFields, so the runner can tell
+// that it needs an update
+func ParseBuildResponse(data []byte) (*GetBuildResponse, error) {
+	var response GetBuildResponse
+	err := json.Unmarshal(data, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	for name := range fields {
+		if !knownBuildFields[name] && !buildDisplayFields[name] {
+			response.UnknownFields = append(response.UnknownFields, name)
+		}
+	}
+	response.UnknownFields = append(response.UnknownFields, unknownBuildOptions(response.Options)...)
+	sort.Strings(response.UnknownFields)
+	return &response, nil
+}
+
+func (b *Build) warnUnsupportedSchema(logger BuildLogger) {
+	if b.IsSchemaSupported() {
+		return
+	}
+
+	if b.SchemaVersion > BuildSchemaVersion {
+		logger.Warningln(fmt.Sprintf("The build uses the version %d of the build format, the runner supports the version %d.",
+			b.SchemaVersion, BuildSchemaVersion))
+	}
+	if len(b.UnknownFields) > 0 {
+		logger.Warningln("The features not supported by the runner are ignored:", strings.Join(b.UnknownFields, ", "))
+	}
+	logger.Warningln("Update the runner to use them.")
+}
+
+// IsSchemaSupported checks if the build doesn't use the features added after the version of the runner
+func (b *GetBuildResponse) IsSchemaSupported() bool {
+	return b.SchemaVersion <= BuildSchemaVersion && len(b.UnknownFields) == 0
+}
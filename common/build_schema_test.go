@@ -0,0 +1,84 @@
+package common
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBuildResponse(t *testing.T) {
+	response, err := ParseBuildResponse([]byte(`{"id": 10, "sha": "abcdef", "variables": [], "options": {}, "token": "token"}`))
+	require.NoError(t, err)
+	assert.Equal(t, 10, response.ID)
+	assert.Equal(t, "abcdef", response.Sha)
+	assert.Empty(t, response.UnknownFields)
+	assert.True(t, response.IsSchemaSupported())
+}
+
+func TestParseBuildResponseWithUnknownFields(t *testing.T) {
+	response, err := ParseBuildResponse([]byte(`{"id": 10, "schema_version": 1, "triggered_by": {}, "artifacts_reports": []}`))
+	require.NoError(t, err)
+	assert.Equal(t, 10, response.ID)
+	assert.Equal(t, []string{"artifacts_reports", "triggered_by"}, response.UnknownFields)
+	assert.False(t, response.IsSchemaSupported())
+}
+
+func TestParseBuildResponseWithDisplayFields(t *testing.T) {
+	response, err := ParseBuildResponse([]byte(`{"id": 10, "status": "running", "project_name": "project", "artifacts_file": null}`))
+	require.NoError(t, err)
+	assert.Empty(t, response.UnknownFields, "the fields of the build entity of GitLab aren't unknown")
+	assert.True(t, response.IsSchemaSupported())
+}
+
+func TestParseBuildResponseWithUnknownOptions(t *testing.T) {
+	response, err := ParseBuildResponse([]byte(`{"id": 10, "options": {
+		"image": {"name": "alpine", "pull_policy": "always"},
+		"services": [{"name": "mysql", "alias": "db", "variables": {}}],
+		"coverage_regex": "/\\d+%/",
+		"release": {"tag_name": "v1.0"}
+	}}`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"options.image.pull_policy", "options.release", "options.services.variables"}, response.UnknownFields)
+	assert.False(t, response.IsSchemaSupported())
+}
+
+func TestParseBuildResponseWithRegisteredOptions(t *testing.T) {
+	defer delete(buildOptionsSchemas, "test")
+	RegisterBuildOptions("test", &struct {
+		Paths []string `json:"paths"`
+	}{}, map[string]bool{"when": true})
+
+	response, err := ParseBuildResponse([]byte(`{"id": 10, "options": {"test": {"paths": [], "when": "always", "reports": {}}}}`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"options.test.reports"}, response.UnknownFields)
+}
+
+func TestParseBuildResponseWithNewerSchema(t *testing.T) {
+	response, err := ParseBuildResponse([]byte(`{"id": 10, "schema_version": 1000}`))
+	require.NoError(t, err)
+	assert.Empty(t, response.UnknownFields)
+	assert.False(t, response.IsSchemaSupported())
+}
+
+func TestParseInvalidBuildResponse(t *testing.T) {
+	_, err := ParseBuildResponse([]byte(`[]`))
+	assert.Error(t, err)
+}
+
+func TestBuildWarnsUnsupportedSchema(t *testing.T) {
+	var trace bytes.Buffer
+	logger := NewBuildLogger(&Trace{Writer: &trace}, logrus.WithFields(logrus.Fields{}))
+
+	build := &Build{}
+	build.warnUnsupportedSchema(logger)
+	assert.Empty(t, trace.String())
+
+	build.SchemaVersion = BuildSchemaVersion + 1
+	build.UnknownFields = []string{"triggered_by"}
+	build.warnUnsupportedSchema(logger)
+	assert.Contains(t, trace.String(), "The features not supported by the runner are ignored: triggered_by")
+	assert.Contains(t, trace.String(), "Update the runner")
+}
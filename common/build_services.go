@@ -0,0 +1,51 @@
+package common
+
+import (
+	"encoding/json"
+)
+
+// Service is the service container requested by the build.
+// It's defined as the image name or with the extended syntax:
+// {"name": "postgres:9.5", "alias": "db", "command": [...], "entrypoint": [...]}
+// The artifacts are the paths in the service copied to the artifacts of the failed build
+type Service struct {
+	Name       string            `json:"name"`
+	Alias      string            `json:"alias,omitempty"`
+	Command    []string          `json:"command,omitempty"`
+	Entrypoint []string          `json:"entrypoint,omitempty"`
+	Readiness  *ServiceReadiness `json:"readiness,omitempty"`
+	Artifacts  []string          `json:"artifacts,omitempty"`
+}
+
+// ServiceReadiness is the check repeated before the build starts, until the
+// service is ready: the port accepts connections, the HTTP path responds
+// with a non-error status and the command run in the service exits with 0
+type ServiceReadiness struct {
+	Port    int      `json:"port,omitempty"`
+	Path    string   `json:"path,omitempty"`
+	Command []string `json:"command,omitempty"`
+	Timeout int      `json:"timeout,omitempty"`
+}
+
+type serviceDefinition Service
+
+func (s *Service) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*s = Service{Name: name}
+		return nil
+	}
+
+	return json.Unmarshal(data, (*serviceDefinition)(s))
+}
+
+// Services is a list of services defined with either syntax
+type Services []Service
+
+// NewServices converts the list of image names to services
+func NewServices(names ...string) (services Services) {
+	for _, name := range names {
+		services = append(services, Service{Name: name})
+	}
+	return
+}
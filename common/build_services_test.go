@@ -0,0 +1,41 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const exampleServicesJSON = `{
+	"services": [
+		"redis:latest",
+		{"name": "postgres:9.5", "alias": "db", "command": ["postgres", "-c", "fsync=off"]},
+		{"name": "postgres:9.5", "alias": "replica", "entrypoint": ["/replica.sh"]},
+		{"name": "nginx", "readiness": {"port": 80, "path": "/health", "command": ["true"], "timeout": 60}},
+		{"name": "mysql", "artifacts": ["/var/log/mysql"]}
+	]
+}`
+
+func TestServicesDecode(t *testing.T) {
+	var options BuildOptions
+	var result struct {
+		Services Services `json:"services"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(exampleServicesJSON), &options))
+	require.NoError(t, options.Decode(&result))
+
+	assert.Equal(t, Services{
+		{Name: "redis:latest"},
+		{Name: "postgres:9.5", Alias: "db", Command: []string{"postgres", "-c", "fsync=off"}},
+		{Name: "postgres:9.5", Alias: "replica", Entrypoint: []string{"/replica.sh"}},
+		{Name: "nginx", Readiness: &ServiceReadiness{Port: 80, Path: "/health", Command: []string{"true"}, Timeout: 60}},
+		{Name: "mysql", Artifacts: []string{"/var/log/mysql"}},
+	}, result.Services)
+}
+
+func TestNewServices(t *testing.T) {
+	assert.Equal(t, Services{{Name: "redis"}, {Name: "mysql"}}, NewServices("redis", "mysql"))
+	assert.Nil(t, NewServices())
+}
@@ -0,0 +1,224 @@
+package common
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// BuildStage is the named step of the build, the executor knows the stage it's in.
+// The stages of the executor itself don't execute the scripts,
+// all other stages execute the shell script of the same name
+type BuildStage string
+
+const (
+	BuildStagePrepareExecutor   BuildStage = "prepare_executor"
+	BuildStageFinishExecutor    BuildStage = "finish_executor"
+	BuildStageCleanupExecutor   BuildStage = "cleanup_executor"
+	BuildStageGetSources        BuildStage = BuildStage(ShellGetSources)
+	BuildStageRestoreCache      BuildStage = BuildStage(ShellRestoreCache)
+	BuildStageDownloadArtifacts BuildStage = BuildStage(ShellDownloadArtifacts)
+	BuildStageUserScript        BuildStage = BuildStage(ShellBuildScript)
+	BuildStageAfterScript       BuildStage = BuildStage(ShellAfterScript)
+	BuildStageArchiveCache      BuildStage = BuildStage(ShellArchiveCache)
+	BuildStageUploadArtifacts   BuildStage = BuildStage(ShellUploadArtifacts)
+	BuildStageCleanup           BuildStage = BuildStage(ShellCleanupScript)
+)
+
+// defaultStageTimeouts are used when the runner doesn't configure the timeout of the stage,
+// the after_script runs even after the build is canceled, so it has to be always limited
+var defaultStageTimeouts = map[BuildStage]time.Duration{
+	BuildStageAfterScript: 5 * time.Minute,
+}
+
+// BuildStageHook is notified about the stages of the build, eg. to collect their metrics.
+// The hook can run its own commands with the executor, which is prepared for all stages
+// except of BuildStagePrepareExecutor. The error returned by BeforeStage fails the stage
+type BuildStageHook interface {
+	BeforeStage(build *Build, executor Executor, stage BuildStage) error
+	AfterStage(build *Build, executor Executor, stage BuildStage, duration time.Duration, err error)
+}
+
+var buildStageHooks []BuildStageHook
+var buildStageHooksLock sync.RWMutex
+
+// RegisterBuildStageHook adds the hook called around the stages of all builds
+func RegisterBuildStageHook(hook BuildStageHook) {
+	buildStageHooksLock.Lock()
+	defer buildStageHooksLock.Unlock()
+
+	buildStageHooks = append(buildStageHooks, hook)
+}
+
+func getBuildStageHooks() []BuildStageHook {
+	buildStageHooksLock.RLock()
+	defer buildStageHooksLock.RUnlock()
+
+	return buildStageHooks
+}
+
+// GetStageTimeout returns how long the stage can run, zero means that it's limited only by the build timeout.
+// The stage with the default timeout can't be unlimited, so it uses the default timeout instead of zero
+func (b *Build) GetStageTimeout(stage BuildStage) time.Duration {
+	if seconds, ok := b.Runner.StageTimeouts[string(stage)]; ok {
+		if seconds > 0 || defaultStageTimeouts[stage] == 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+	return defaultStageTimeouts[stage]
+}
+
+func (b *Build) startStage(stage BuildStage, executor Executor) error {
+	b.Log().WithField("stage", stage).Debugln("Starting stage...")
+	if b.summary != nil {
+		b.summary.startStage(stage)
+	}
+
+	for _, hook := range getBuildStageHooks() {
+		if err := hook.BeforeStage(b, executor, stage); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Build) finishStage(stage BuildStage, executor Executor, duration time.Duration, err error) {
+	b.Log().WithField("stage", stage).WithField("duration", duration).WithError(err).Debugln("Stage finished")
+	if b.summary != nil {
+		b.summary.finishStage(duration, err)
+	}
+
+	for _, hook := range getBuildStageHooks() {
+		hook.AfterStage(b, executor, stage, duration, err)
+	}
+}
+
+// uploadStages store the archives, they can finish during the grace period after the build is aborted,
+// so the cache and artifacts backends don't receive truncated archives
+var uploadStages = map[BuildStage]bool{
+	BuildStageArchiveCache:    true,
+	BuildStageUploadArtifacts: true,
+}
+
+// withAbortSignal runs the function with the abort channel closed when wait returns true,
+// wait has to return false when the finished channel is closed
+func withAbortSignal(wait func(finished chan struct{}) bool, run func(abort chan interface{}) error) error {
+	stageAbort := make(chan interface{})
+	finished := make(chan struct{})
+	exited := make(chan struct{})
+
+	go func() {
+		defer close(exited)
+		if wait(finished) {
+			close(stageAbort)
+		}
+	}()
+
+	err := run(stageAbort)
+	close(finished)
+	<-exited
+	return err
+}
+
+// withStageTimeout runs the function with the abort channel, which is closed when either
+// the build is aborted or the stage times out
+func withStageTimeout(timeout time.Duration, abort chan interface{}, run func(abort chan interface{}) error) error {
+	expired := false
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	err := withAbortSignal(func(finished chan struct{}) bool {
+		select {
+		case <-abort:
+		case <-timer.C:
+			expired = true
+		case <-finished:
+			return false
+		}
+		return true
+	}, run)
+
+	if expired {
+		return &BuildError{Inner: fmt.Errorf("the stage took longer than %v", timeout)}
+	}
+	return err
+}
+
+// withAbortGracePeriod delays the abort of the build, so the function can finish during the grace period
+func withAbortGracePeriod(grace time.Duration, abort chan interface{}, aborted func(), run func(abort chan interface{}) error) error {
+	return withAbortSignal(func(finished chan struct{}) bool {
+		select {
+		case <-abort:
+		case <-finished:
+			return false
+		}
+
+		aborted()
+		select {
+		case <-time.After(grace):
+		case <-finished:
+			return false
+		}
+		return true
+	}, run)
+}
+
+// isAbortPending checks if the build is already aborted, the abort is sent until the build finishes
+func isAbortPending(abort chan interface{}) bool {
+	select {
+	case <-abort:
+		return true
+	default:
+		return false
+	}
+}
+
+// GetUploadGracePeriod returns how long the upload stage can run after the build is aborted
+func (b *Build) GetUploadGracePeriod(stage BuildStage) time.Duration {
+	if !uploadStages[stage] {
+		return 0
+	}
+	return time.Duration(b.Runner.UploadGracePeriod) * time.Second
+}
+
+// executeStage runs the script of the stage, the nil abort channel means that
+// the stage isn't aborted together with the build, but only when it times out
+func (b *Build) executeStage(stage BuildStage, executor Executor, abort chan interface{}) (err error) {
+	executor.SetCurrentStage(stage)
+
+	started := time.Now()
+	defer func() {
+		b.finishStage(stage, executor, time.Since(started), err)
+	}()
+
+	err = b.startStage(stage, executor)
+	if err != nil {
+		return
+	}
+
+	// The upload isn't started when the build is already aborted, so it's not interrupted
+	logger := NewBuildLogger(b.Trace, b.Log())
+	if uploadStages[stage] && isAbortPending(abort) {
+		logger.Warningln("Skipping", stage, "as the build is aborted")
+		return &BuildError{Inner: fmt.Errorf("%s skipped, the build is aborted", stage)}
+	}
+
+	execute := func(abort chan interface{}) error {
+		timeout := b.GetStageTimeout(stage)
+		if timeout <= 0 {
+			return b.executeShellScript(ShellScriptType(stage), executor, abort)
+		}
+		return withStageTimeout(timeout, abort, func(abort chan interface{}) error {
+			return b.executeShellScript(ShellScriptType(stage), executor, abort)
+		})
+	}
+
+	grace := b.GetUploadGracePeriod(stage)
+	if grace <= 0 {
+		return execute(abort)
+	}
+	return withAbortGracePeriod(grace, abort, func() {
+		logger.Warningln("The build is aborted, waiting up to", grace, "for", stage, "to finish...")
+	}, execute)
+}
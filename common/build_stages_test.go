@@ -0,0 +1,189 @@
+package common
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type recordingStageHook struct {
+	build  *Build
+	stages []BuildStage
+}
+
+func (h *recordingStageHook) BeforeStage(build *Build, executor Executor, stage BuildStage) error {
+	return nil
+}
+
+func (h *recordingStageHook) AfterStage(build *Build, executor Executor, stage BuildStage, duration time.Duration, err error) {
+	if build == h.build {
+		h.stages = append(h.stages, stage)
+	}
+}
+
+func TestBuildStagesHooks(t *testing.T) {
+	e := MockExecutor{}
+	defer e.AssertExpectations(t)
+	e.On("SetCurrentStage", mock.Anything).Return()
+
+	p := MockExecutorProvider{}
+	defer p.AssertExpectations(t)
+
+	p.On("Create").Return(&e).Once()
+	p.On("GetFeatures", mock.Anything).Return().Once()
+	e.On("Prepare", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+	e.On("Shell").Return(&ShellScriptInfo{Shell: "script-shell"})
+	e.On("Run", mock.Anything).Return(nil)
+	e.On("Finish", nil).Return().Once()
+	e.On("Cleanup").Return().Once()
+
+	RegisterExecutor("build-stages-hooks", &p)
+
+	build := &Build{
+		GetBuildResponse: SuccessfulBuild,
+		Runner: &RunnerConfig{
+			RunnerSettings: RunnerSettings{
+				Executor: "build-stages-hooks",
+			},
+		},
+	}
+	hook := &recordingStageHook{build: build}
+	RegisterBuildStageHook(hook)
+
+	err := build.Run(&Config{}, &Trace{Writer: os.Stdout})
+	assert.NoError(t, err)
+	assert.Equal(t, []BuildStage{
+		BuildStagePrepareExecutor,
+		BuildStageGetSources,
+		BuildStageRestoreCache,
+		BuildStageDownloadArtifacts,
+		BuildStageUserScript,
+		BuildStageAfterScript,
+		BuildStageArchiveCache,
+		BuildStageUploadArtifacts,
+		BuildStageCleanup,
+	}, hook.stages)
+
+	var executorStages []BuildStage
+	for _, call := range e.Calls {
+		if call.Method == "SetCurrentStage" {
+			executorStages = append(executorStages, call.Arguments.Get(0).(BuildStage))
+		}
+	}
+	assert.Equal(t, append(hook.stages, BuildStageFinishExecutor, BuildStageCleanupExecutor), executorStages,
+		"the executor knows the stage it's in")
+}
+
+func TestBuildStageTimeout(t *testing.T) {
+	build := &Build{Runner: &RunnerConfig{}}
+	assert.Equal(t, 5*time.Minute, build.GetStageTimeout(BuildStageAfterScript))
+	assert.Equal(t, time.Duration(0), build.GetStageTimeout(BuildStageGetSources))
+
+	build.Runner.StageTimeouts = map[string]int{"get_sources": 600, "after_script": 60}
+	assert.Equal(t, 10*time.Minute, build.GetStageTimeout(BuildStageGetSources))
+	assert.Equal(t, time.Minute, build.GetStageTimeout(BuildStageAfterScript))
+
+	build.Runner.StageTimeouts = map[string]int{"get_sources": 0, "after_script": 0}
+	assert.Equal(t, time.Duration(0), build.GetStageTimeout(BuildStageGetSources))
+	assert.Equal(t, 5*time.Minute, build.GetStageTimeout(BuildStageAfterScript), "the after_script can't be unlimited")
+
+	build.Runner.StageTimeouts = map[string]int{"after_script": -1}
+	assert.Equal(t, 5*time.Minute, build.GetStageTimeout(BuildStageAfterScript))
+}
+
+func TestWithStageTimeout(t *testing.T) {
+	waitForAbort := func(abort chan interface{}) error {
+		<-abort
+		return errors.New("aborted")
+	}
+
+	err := withStageTimeout(10*time.Millisecond, nil, waitForAbort)
+	if assert.IsType(t, &BuildError{}, err) {
+		assert.Contains(t, err.Error(), "the stage took longer than")
+	}
+
+	abort := make(chan interface{})
+	go func() {
+		abort <- true
+	}()
+	err = withStageTimeout(time.Minute, abort, waitForAbort)
+	assert.EqualError(t, err, "aborted", "the build abort is passed to the stage")
+
+	err = withStageTimeout(time.Minute, nil, func(abort chan interface{}) error {
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestIsAbortPending(t *testing.T) {
+	assert.False(t, isAbortPending(nil))
+
+	abort := make(chan interface{})
+	assert.False(t, isAbortPending(abort))
+
+	close(abort)
+	assert.True(t, isAbortPending(abort))
+}
+
+func TestWithAbortGracePeriod(t *testing.T) {
+	abort := make(chan interface{})
+	close(abort)
+
+	aborted := 0
+	onAbort := func() {
+		aborted++
+	}
+
+	err := withAbortGracePeriod(time.Minute, abort, onAbort, func(abort chan interface{}) error {
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+	assert.NoError(t, err, "the stage finishes during the grace period")
+	assert.Equal(t, 1, aborted)
+
+	err = withAbortGracePeriod(10*time.Millisecond, abort, onAbort, func(abort chan interface{}) error {
+		<-abort
+		return errors.New("aborted")
+	})
+	assert.EqualError(t, err, "aborted", "the stage is aborted after the grace period")
+	assert.Equal(t, 2, aborted)
+
+	err = withAbortGracePeriod(time.Minute, nil, onAbort, func(abort chan interface{}) error {
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, aborted, "the build isn't aborted")
+}
+
+func TestGetUploadGracePeriod(t *testing.T) {
+	build := &Build{Runner: &RunnerConfig{}}
+	assert.Equal(t, time.Duration(0), build.GetUploadGracePeriod(BuildStageArchiveCache))
+
+	build.Runner.UploadGracePeriod = 30
+	assert.Equal(t, 30*time.Second, build.GetUploadGracePeriod(BuildStageArchiveCache))
+	assert.Equal(t, 30*time.Second, build.GetUploadGracePeriod(BuildStageUploadArtifacts))
+	assert.Equal(t, time.Duration(0), build.GetUploadGracePeriod(BuildStageUserScript))
+}
+
+func TestUploadStageIsSkippedWhenBuildIsAborted(t *testing.T) {
+	e := MockExecutor{}
+	defer e.AssertExpectations(t)
+	e.On("SetCurrentStage", mock.Anything).Return()
+
+	build := &Build{
+		Runner: &RunnerConfig{},
+		Trace:  &Trace{Writer: os.Stdout},
+	}
+
+	abort := make(chan interface{})
+	close(abort)
+
+	err := build.executeStage(BuildStageArchiveCache, &e, abort)
+	if assert.IsType(t, &BuildError{}, err) {
+		assert.Contains(t, err.Error(), "archive_cache skipped")
+	}
+}
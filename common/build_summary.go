@@ -0,0 +1,246 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
+)
+
+// summaryMaxLineLength limits the line of the event kept by the summary, the events are short
+const summaryMaxLineLength = 4096
+
+// summaryScannedStages run the cache and artifacts helpers, the events printed in the other
+// stages are ignored, so the scripts of the build can't change the summary
+var summaryScannedStages = map[BuildStage]bool{
+	BuildStageRestoreCache:    true,
+	BuildStageUploadArtifacts: true,
+}
+
+type BuildStageSummary struct {
+	Name      BuildStage         `json:"name"`
+	Duration  float64            `json:"duration"`
+	Error     string             `json:"error,omitempty"`
+	ExitCode  *int               `json:"exit_code,omitempty"`
+	CacheHit  *bool              `json:"cache_hit,omitempty"`
+	Artifacts []ArtifactsSummary `json:"artifacts,omitempty"`
+}
+
+type ArtifactsSummary struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// BuildSummary is written after the build, for the analytics of the runners
+type BuildSummary struct {
+	BuildID    int                 `json:"build_id"`
+	ProjectID  int                 `json:"project_id"`
+	Name       string              `json:"name"`
+	Stage      string              `json:"stage"`
+	Ref        string              `json:"ref"`
+	Sha        string              `json:"sha"`
+	Runner     string              `json:"runner"`
+	RunnerName string              `json:"runner_name,omitempty"`
+	Executor   string              `json:"executor"`
+	Status     BuildState          `json:"status"`
+	Error      string              `json:"error,omitempty"`
+	ExitCode   *int                `json:"exit_code,omitempty"`
+	StartedAt  time.Time           `json:"started_at"`
+	FinishedAt time.Time           `json:"finished_at"`
+	Duration   float64             `json:"duration"`
+	Stages     []BuildStageSummary `json:"stages"`
+	CacheHit   *bool               `json:"cache_hit,omitempty"`
+	Artifacts  []ArtifactsSummary  `json:"artifacts,omitempty"`
+
+	// stage is the running stage, only the events of its helpers are recorded.
+	// The line is kept while it can be the event, the other lines are passed to the trace
+	stage   BuildStage
+	line    bytes.Buffer
+	passing bool
+	lock    sync.Mutex
+}
+
+// summaryTrace records the events of the cache and artifacts helpers in the output of their stages
+type summaryTrace struct {
+	BuildTrace
+
+	summary *BuildSummary
+}
+
+func (t *summaryTrace) Write(p []byte) (n int, err error) {
+	_, err = t.BuildTrace.Write(t.summary.filter(p))
+	return len(p), err
+}
+
+// filter records the events and returns the output without them
+func (s *BuildSummary) filter(p []byte) []byte {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if !summaryScannedStages[s.stage] {
+		return p
+	}
+
+	output := make([]byte, 0, len(p))
+	for _, c := range p {
+		if s.passing {
+			output = append(output, c)
+			s.passing = c != '\n'
+			continue
+		}
+
+		if s.line.Len() < summaryMaxLineLength {
+			s.line.WriteByte(c)
+		}
+
+		if c == '\n' {
+			line := bytes.TrimSuffix(s.line.Bytes(), []byte{'\n'})
+			if event, ok := parseBuildEvent(line); ok {
+				s.recordEvent(event)
+			} else if !bytes.HasPrefix(line, buildEventMarker) {
+				output = append(output, s.line.Bytes()...)
+			}
+			s.line.Reset()
+		} else if s.line.Len() <= len(buildEventMarker) && !bytes.HasPrefix(buildEventMarker, s.line.Bytes()) {
+			// The line isn't the event, it's passed to the trace as it's written
+			output = append(output, s.line.Bytes()...)
+			s.line.Reset()
+			s.passing = true
+		}
+	}
+	return output
+}
+
+func (s *BuildSummary) recordEvent(event BuildEvent) {
+	stage := &s.Stages[len(s.Stages)-1]
+
+	switch event.Type {
+	case BuildEventCacheRestored, BuildEventCacheMissed:
+		hit := event.Type == BuildEventCacheRestored
+		stage.CacheHit = &hit
+
+	case BuildEventArtifactsUploaded:
+		stage.Artifacts = append(stage.Artifacts, ArtifactsSummary{
+			Name: event.Name,
+			Size: event.Size,
+		})
+	}
+}
+
+// errorExitCode returns the exit code of the failed script reported by the executor
+func errorExitCode(err error) *int {
+	if buildErr, ok := err.(*BuildError); ok && buildErr.ExitCode != 0 {
+		exitCode := buildErr.ExitCode
+		return &exitCode
+	}
+	return nil
+}
+
+func (s *BuildSummary) startStage(stage BuildStage) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.stage = stage
+	s.line.Reset()
+	s.passing = false
+	s.Stages = append(s.Stages, BuildStageSummary{Name: stage})
+}
+
+func (s *BuildSummary) finishStage(duration time.Duration, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.stage == "" {
+		return
+	}
+
+	// The last event of the stage can be missing the new line
+	if event, ok := parseBuildEvent(s.line.Bytes()); ok {
+		s.recordEvent(event)
+	}
+	s.line.Reset()
+	s.passing = false
+
+	summary := &s.Stages[len(s.Stages)-1]
+	summary.Duration = duration.Seconds()
+	if err != nil {
+		summary.Error = err.Error()
+		summary.ExitCode = errorExitCode(err)
+	}
+
+	if summary.CacheHit != nil {
+		s.CacheHit = summary.CacheHit
+	}
+	s.Artifacts = append(s.Artifacts, summary.Artifacts...)
+	s.stage = ""
+}
+
+func (s *BuildSummary) finish(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.FinishedAt = time.Now()
+	s.Duration = s.FinishedAt.Sub(s.StartedAt).Seconds()
+	s.Status = Success
+	if err == nil {
+		return
+	}
+
+	s.Status = Failed
+	s.Error = err.Error()
+	s.ExitCode = errorExitCode(err)
+}
+
+// write stores the summary atomically, so the analytics never read the partial files
+func (s *BuildSummary) write(dir string) error {
+	s.lock.Lock()
+	data, err := json.MarshalIndent(s, "", "  ")
+	s.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	fileName := fmt.Sprintf("%s-%d.json", s.Runner, s.BuildID)
+	return helpers.WriteFileAtomically(filepath.Join(dir, fileName), data, 0600)
+}
+
+func (b *Build) newSummary() *BuildSummary {
+	if b.Runner.SummaryDir == "" {
+		return nil
+	}
+
+	return &BuildSummary{
+		BuildID:    b.ID,
+		ProjectID:  b.ProjectID,
+		Name:       b.Name,
+		Stage:      b.Stage,
+		Ref:        b.RefName,
+		Sha:        b.Sha,
+		Runner:     b.Runner.ShortDescription(),
+		RunnerName: b.Runner.Name,
+		Executor:   b.Runner.Executor,
+		StartedAt:  time.Now(),
+		Stages:     []BuildStageSummary{},
+	}
+}
+
+func (b *Build) writeSummary(err error, logger BuildLogger) {
+	if b.summary == nil {
+		return
+	}
+
+	b.summary.finish(err)
+	if err := b.summary.write(b.Runner.SummaryDir); err != nil {
+		logger.Warningln("Failed to write the build summary:", err)
+	}
+}
@@ -0,0 +1,179 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func writeTestBuildEvent(w io.Writer, event BuildEvent) {
+	var buffer bytes.Buffer
+	WriteBuildEvent(&buffer, event)
+
+	// The event is written in parts, like the output of the helpers
+	data := buffer.Bytes()
+	w.Write(data[:5])
+	w.Write(data[5:])
+}
+
+func TestBuildSummaryRecordsEvents(t *testing.T) {
+	var output bytes.Buffer
+	summary := &BuildSummary{}
+	trace := &summaryTrace{
+		BuildTrace: &Trace{Writer: &output},
+		summary:    summary,
+	}
+
+	summary.startStage(BuildStageRestoreCache)
+	fmt.Fprintln(trace, "Checking cache for default...")
+	writeTestBuildEvent(trace, BuildEvent{Type: BuildEventCacheRestored})
+	fmt.Fprint(trace, "Successfully extr")
+	fmt.Fprintln(trace, "acted cache")
+	summary.finishStage(time.Second, nil)
+
+	summary.startStage(BuildStageUploadArtifacts)
+	writeTestBuildEvent(trace, BuildEvent{Type: BuildEventArtifactsUploaded, Name: "artifacts.zip", Size: 1234})
+	summary.finishStage(time.Second, nil)
+
+	if assert.NotNil(t, summary.CacheHit) {
+		assert.True(t, *summary.CacheHit)
+	}
+	assert.Equal(t, []ArtifactsSummary{{Name: "artifacts.zip", Size: 1234}}, summary.Artifacts)
+	assert.Equal(t, summary.Artifacts, summary.Stages[1].Artifacts)
+	assert.Equal(t, summary.CacheHit, summary.Stages[0].CacheHit)
+	assert.Equal(t, "Checking cache for default...\nSuccessfully extracted cache\n", output.String(), "the events are removed from the trace")
+}
+
+func TestBuildSummaryIgnoresEventsOfOtherStages(t *testing.T) {
+	var output bytes.Buffer
+	summary := &BuildSummary{}
+	trace := &summaryTrace{
+		BuildTrace: &Trace{Writer: &output},
+		summary:    summary,
+	}
+
+	summary.startStage(BuildStageUserScript)
+	writeTestBuildEvent(trace, BuildEvent{Type: BuildEventCacheRestored})
+	writeTestBuildEvent(trace, BuildEvent{Type: BuildEventArtifactsUploaded, Name: "artifacts.zip", Size: 1234})
+	summary.finishStage(time.Second, nil)
+
+	assert.Nil(t, summary.CacheHit)
+	assert.Empty(t, summary.Artifacts)
+	assert.NotEmpty(t, output.String(), "the output of the build scripts isn't changed")
+}
+
+func TestBuildSummaryIgnoresMessages(t *testing.T) {
+	summary := &BuildSummary{}
+	summary.startStage(BuildStageUploadArtifacts)
+	output := summary.filter([]byte("Uploaded artifacts.zip: 1234 bytes\n\x1b]gitlab-runner-event;invalid\a\n"))
+	summary.finishStage(time.Second, nil)
+
+	assert.Empty(t, summary.Artifacts, "only the events are recorded")
+	assert.Equal(t, "Uploaded artifacts.zip: 1234 bytes\n", string(output))
+}
+
+func TestBuildSummaryCacheMiss(t *testing.T) {
+	summary := &BuildSummary{}
+	summary.startStage(BuildStageRestoreCache)
+	summary.filter([]byte("Checking cache for default...\n"))
+	assert.Nil(t, summary.Stages[0].CacheHit, "the cache isn't used")
+
+	var event bytes.Buffer
+	WriteBuildEvent(&event, BuildEvent{Type: BuildEventCacheMissed})
+	summary.filter(event.Bytes())
+	summary.finishStage(time.Second, nil)
+	if assert.NotNil(t, summary.CacheHit) {
+		assert.False(t, *summary.CacheHit)
+	}
+}
+
+func TestBuildSummaryExitCode(t *testing.T) {
+	summary := &BuildSummary{StartedAt: time.Now()}
+	summary.startStage(BuildStageUserScript)
+	summary.finishStage(time.Second, &BuildError{Inner: errors.New("exit status 2"), ExitCode: 2})
+	summary.finish(&BuildError{Inner: errors.New("exit status 2"), ExitCode: 2})
+	assert.Equal(t, Failed, summary.Status)
+	if assert.NotNil(t, summary.ExitCode) {
+		assert.Equal(t, 2, *summary.ExitCode)
+	}
+	if assert.NotNil(t, summary.Stages[0].ExitCode) {
+		assert.Equal(t, 2, *summary.Stages[0].ExitCode)
+	}
+
+	summary = &BuildSummary{StartedAt: time.Now()}
+	summary.finish(&BuildError{Inner: errors.New("exit status 3")})
+	assert.Nil(t, summary.ExitCode, "the exit code isn't parsed from the error")
+
+	summary = &BuildSummary{StartedAt: time.Now()}
+	summary.finish(nil)
+	assert.Equal(t, Success, summary.Status)
+	assert.Nil(t, summary.ExitCode)
+}
+
+func TestBuildSummaryIsWritten(t *testing.T) {
+	summaryDir, err := ioutil.TempDir("", "summary")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(summaryDir)
+
+	e := MockExecutor{}
+	defer e.AssertExpectations(t)
+	e.On("SetCurrentStage", mock.Anything).Return()
+
+	p := MockExecutorProvider{}
+	defer p.AssertExpectations(t)
+
+	p.On("Create").Return(&e).Once()
+	p.On("GetFeatures", mock.Anything).Return().Once()
+	e.On("Prepare", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
+	e.On("Shell").Return(&ShellScriptInfo{Shell: "script-shell"})
+	e.On("Run", mock.Anything).Return(nil)
+	e.On("Finish", nil).Return().Once()
+	e.On("Cleanup").Return().Once()
+
+	RegisterExecutor("build-summary", &p)
+
+	build := &Build{
+		GetBuildResponse: SuccessfulBuild,
+		Runner: &RunnerConfig{
+			RunnerCredentials: RunnerCredentials{
+				Token: "summary-token",
+			},
+			RunnerSettings: RunnerSettings{
+				Executor:   "build-summary",
+				SummaryDir: summaryDir,
+			},
+		},
+	}
+
+	err = build.Run(&Config{}, &Trace{Writer: os.Stdout})
+	assert.NoError(t, err)
+
+	fileName := filepath.Join(summaryDir, fmt.Sprintf("%s-%d.json", build.Runner.ShortDescription(), build.ID))
+	data, err := ioutil.ReadFile(fileName)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var summary BuildSummary
+	err = json.Unmarshal(data, &summary)
+	assert.NoError(t, err)
+	assert.Equal(t, build.ID, summary.BuildID)
+	assert.Equal(t, Success, summary.Status)
+	assert.Equal(t, "build-summary", summary.Executor)
+	assert.Len(t, summary.Stages, 9)
+
+	files, _ := ioutil.ReadDir(summaryDir)
+	assert.Len(t, files, 1, "the temporary file is removed")
+}
@@ -2,6 +2,7 @@ package common
 
 import (
 	"os"
+	"strings"
 	"testing"
 
 	"errors"
@@ -13,6 +14,7 @@ import (
 func init() {
 	s := MockShell{}
 	s.On("GetName").Return("script-shell")
+	s.On("GetFeatures", mock.Anything).Return()
 	s.On("GenerateScript", mock.Anything, mock.Anything).Return("script", nil)
 	RegisterShell(&s)
 }
@@ -20,12 +22,14 @@ func init() {
 func TestBuildRun(t *testing.T) {
 	e := MockExecutor{}
 	defer e.AssertExpectations(t)
+	e.On("SetCurrentStage", mock.Anything).Return()
 
 	p := MockExecutorProvider{}
 	defer p.AssertExpectations(t)
 
 	// Create executor only once
 	p.On("Create").Return(&e).Once()
+	p.On("GetFeatures", mock.Anything).Return().Once()
 
 	// We run everything once
 	e.On("Prepare", mock.Anything, mock.Anything, mock.Anything).Return(nil).Once()
@@ -48,6 +52,57 @@ func TestBuildRun(t *testing.T) {
 	}
 	err := build.Run(&Config{}, &Trace{Writer: os.Stdout})
 	assert.NoError(t, err)
+	assert.NotNil(t, build.Features, "the features are detected when the executor is prepared")
+}
+
+// abortWaitingExecutor runs the build script until the build is aborted
+type abortWaitingExecutor struct {
+	MockExecutor
+	stage BuildStage
+}
+
+func (e *abortWaitingExecutor) GetCurrentStage() BuildStage {
+	return e.stage
+}
+
+func (e *abortWaitingExecutor) SetCurrentStage(stage BuildStage) {
+	e.stage = stage
+}
+
+func (e *abortWaitingExecutor) Shell() *ShellScriptInfo {
+	return &ShellScriptInfo{Shell: "script-shell"}
+}
+
+func (e *abortWaitingExecutor) Run(cmd ExecutorCommand) error {
+	if e.stage != BuildStageUserScript {
+		return nil
+	}
+	<-cmd.Abort
+	return errors.New("aborted")
+}
+
+func TestBuildAbortedByTrace(t *testing.T) {
+	examples := map[interface{}]string{
+		true: "canceled",
+		errors.New("build log exceeded limit of 1024 bytes"): "build log exceeded limit of 1024 bytes",
+	}
+
+	for reason, expected := range examples {
+		abort := make(chan interface{})
+		build := &Build{
+			GetBuildResponse: SuccessfulBuild,
+			Runner:           &RunnerConfig{},
+			Trace:            &Trace{Writer: os.Stdout, Abort: abort},
+		}
+
+		go func() {
+			abort <- reason
+		}()
+
+		err := build.run(&abortWaitingExecutor{})
+		assert.IsType(t, &BuildError{}, err)
+		assert.EqualError(t, err, expected)
+	}
 }
 
 func TestRetryPrepare(t *testing.T) {
@@ -55,12 +110,14 @@ func TestRetryPrepare(t *testing.T) {
 
 	e := MockExecutor{}
 	defer e.AssertExpectations(t)
+	e.On("SetCurrentStage", mock.Anything).Return()
 
 	p := MockExecutorProvider{}
 	defer p.AssertExpectations(t)
 
 	// Create executor
 	p.On("Create").Return(&e).Times(3)
+	p.On("GetFeatures", mock.Anything).Return().Once()
 
 	// Prepare plan
 	e.On("Prepare", mock.Anything, mock.Anything, mock.Anything).
@@ -93,6 +150,7 @@ func TestPrepareFailure(t *testing.T) {
 
 	e := MockExecutor{}
 	defer e.AssertExpectations(t)
+	e.On("SetCurrentStage", mock.Anything).Return()
 
 	p := MockExecutorProvider{}
 	defer p.AssertExpectations(t)
@@ -122,12 +180,14 @@ func TestPrepareFailure(t *testing.T) {
 func TestRunFailure(t *testing.T) {
 	e := MockExecutor{}
 	defer e.AssertExpectations(t)
+	e.On("SetCurrentStage", mock.Anything).Return()
 
 	p := MockExecutorProvider{}
 	defer p.AssertExpectations(t)
 
 	// Create executor
 	p.On("Create").Return(&e).Once()
+	p.On("GetFeatures", mock.Anything).Return().Once()
 
 	// Prepare plan
 	e.On("Prepare", mock.Anything, mock.Anything, mock.Anything).Return(nil)
@@ -151,3 +211,137 @@ func TestRunFailure(t *testing.T) {
 	err := build.Run(&Config{}, &Trace{Writer: os.Stdout})
 	assert.EqualError(t, err, "build fail")
 }
+
+func TestBuildRunnerVariables(t *testing.T) {
+	build := &Build{
+		Runner: &RunnerConfig{
+			Name:    "my-runner",
+			TagList: "docker,linux",
+			RunnerCredentials: RunnerCredentials{
+				Token: "0123456789abcdef",
+			},
+			RunnerSettings: RunnerSettings{
+				Executor: "docker",
+			},
+		},
+	}
+
+	variables := build.GetAllVariables()
+	assert.Equal(t, "01234567", variables.Get("CI_RUNNER_ID"))
+	assert.Equal(t, "my-runner", variables.Get("CI_RUNNER_DESCRIPTION"))
+	assert.Equal(t, "docker,linux", variables.Get("CI_RUNNER_TAGS"))
+	assert.Equal(t, "docker", variables.Get("CI_RUNNER_EXECUTOR"))
+	assert.Equal(t, AppVersion.Version, variables.Get("CI_RUNNER_VERSION"))
+}
+
+func TestBuildRunnerDefaultVariables(t *testing.T) {
+	build := &Build{
+		GetBuildResponse: GetBuildResponse{
+			Variables: BuildVariables{
+				{Key: "DEPLOY_ENV", Value: "production", Public: true},
+			},
+		},
+		Runner: &RunnerConfig{
+			RunnerSettings: RunnerSettings{
+				Environment: []string{"GIT_DEPTH=10", "DEPLOY_ENV=from-environment"},
+				Variables: map[string]string{
+					"GIT_DEPTH":      "3",
+					"DEPLOY_ENV":     "staging",
+					"CI_PROJECT_DIR": "/overridden",
+					"DEPLOY_MESSAGE": "deployed by $CI_RUNNER_EXECUTOR",
+					"PACKAGE_MIRROR": "http://mirror.local",
+				},
+				Executor: "shell",
+			},
+		},
+		BuildDir: "/builds/project",
+	}
+
+	variables := build.GetAllVariables()
+	assert.Equal(t, "3", variables.Get("GIT_DEPTH"), "the variables override the environment")
+	assert.Equal(t, "production", variables.Get("DEPLOY_ENV"), "the project variables override the runner ones")
+	assert.Equal(t, "/builds/project", variables.Get("CI_PROJECT_DIR"), "the predefined variables override the runner ones")
+	assert.Equal(t, "deployed by shell", variables.Get("DEPLOY_MESSAGE"))
+	assert.Equal(t, "http://mirror.local", variables.Get("PACKAGE_MIRROR"))
+	assert.Equal(t, "3", build.GetGitDepth())
+}
+
+func TestBuildTmpProjectDir(t *testing.T) {
+	build := &Build{
+		Runner:   &RunnerConfig{},
+		BuildDir: "/builds/group/project",
+	}
+
+	variables := build.GetAllVariables()
+	assert.Equal(t, "/builds/group/project.tmp", build.TmpProjectDir())
+	assert.Equal(t, build.TmpProjectDir(), variables.Get("TMPDIR"))
+	assert.Equal(t, build.TmpProjectDir(), variables.Get("TEMP"))
+}
+
+func TestBuildParallelVariables(t *testing.T) {
+	build := &Build{
+		GetBuildResponse: GetBuildResponse{
+			ProjectID: 10,
+		},
+		Runner: &RunnerConfig{
+			RunnerCredentials: RunnerCredentials{
+				Token: "0123456789abcdef",
+			},
+		},
+		ProjectRunnerID: 1,
+	}
+
+	variables := build.GetAllVariables()
+	assert.Empty(t, variables.Get("CI_NODE_INDEX"))
+	assert.Equal(t, "runner-01234567-project-10-concurrent-1", build.ProjectUniqueName())
+
+	build.NodeIndex = 2
+	build.NodeTotal = 4
+	variables = build.GetAllVariables()
+	assert.Equal(t, "2", variables.Get("CI_NODE_INDEX"))
+	assert.Equal(t, "4", variables.Get("CI_NODE_TOTAL"))
+	assert.Equal(t, "runner-01234567-project-10-concurrent-1-node-2", build.ProjectUniqueName())
+}
+
+func TestBuildUniqueHostname(t *testing.T) {
+	build := &Build{
+		GetBuildResponse: GetBuildResponse{
+			ProjectID: 10,
+		},
+		Runner: &RunnerConfig{
+			RunnerCredentials: RunnerCredentials{
+				Token: "AB_cdef0123",
+			},
+		},
+	}
+	assert.Equal(t, "runner-ab-cdef0-project-10-concurrent-0", build.UniqueHostname())
+	assert.Empty(t, build.GetAllVariables().Get("CI_BUILD_HOSTNAME"))
+
+	build.ProjectID = 1234567890
+	build.ProjectRunnerID = 123456
+	build.NodeIndex = 1000000
+	build.NodeTotal = 2000000
+	hostname := build.UniqueHostname()
+	assert.Equal(t, 63, len(hostname))
+	assert.True(t, strings.HasPrefix(hostname, "runner-ab-cdef0-project-1234567890-concurrent-"), hostname)
+
+	build.NodeIndex = 1000001
+	assert.NotEqual(t, hostname, build.UniqueHostname(), "the shortened hostnames don't collide")
+
+	build.BuildHostname = "build-host"
+	assert.Equal(t, "build-host", build.GetAllVariables().Get("CI_BUILD_HOSTNAME"))
+}
+
+func TestBuildFeaturesVariables(t *testing.T) {
+	build := &Build{Runner: &RunnerConfig{}}
+	assert.Empty(t, build.GetFeaturesVariables(), "the features aren't detected yet")
+
+	build.Features = &FeaturesInfo{Variables: true, Artifacts: true, Cache: true, Shared: true}
+	assert.Equal(t, []string{"variables", "artifacts", "cache", "shared"}, build.FeaturesNames())
+
+	variables := build.GetAllVariables()
+	assert.Equal(t, "true", variables.Get("CI_RUNNER_FEATURE_ARTIFACTS"))
+	assert.Equal(t, "true", variables.Get("CI_RUNNER_FEATURE_SHARED"))
+	assert.Equal(t, "false", variables.Get("CI_RUNNER_FEATURE_IMAGE"))
+	assert.Equal(t, "false", variables.Get("CI_RUNNER_FEATURE_SERVICES"))
+}
@@ -3,12 +3,12 @@ package common
 import (
 	"bufio"
 	"bytes"
-	"io/ioutil"
 	"os"
 	"time"
 
 	"fmt"
 	"path/filepath"
+	"sort"
 
 	"github.com/BurntSushi/toml"
 	log "github.com/Sirupsen/logrus"
@@ -41,29 +41,142 @@ func (p DockerPullPolicy) Get() (DockerPullPolicy, error) {
 	return p, nil
 }
 
+type TraceTimestamps string
+
+const (
+	TraceTimestampsNone    TraceTimestamps = "none"
+	TraceTimestampsElapsed                 = "elapsed"
+	TraceTimestampsRFC3339                 = "rfc3339"
+)
+
+// Get returns one of the predefined values or returns an error if the value can't match the predefined
+func (p TraceTimestamps) Get() (TraceTimestamps, error) {
+	// Default is to not prefix the lines
+	if p == "" {
+		return TraceTimestampsNone, nil
+	}
+
+	if p != TraceTimestampsNone &&
+		p != TraceTimestampsElapsed &&
+		p != TraceTimestampsRFC3339 {
+		return "", fmt.Errorf("unsupported trace-timestamps: %v", p)
+	}
+	return p, nil
+}
+
+type OutputLimitPolicy string
+
+const (
+	OutputLimitContinue OutputLimitPolicy = "continue"
+	OutputLimitFail                       = "fail"
+)
+
+// Get returns one of the predefined values or returns an error if the value can't match the predefined
+func (p OutputLimitPolicy) Get() (OutputLimitPolicy, error) {
+	// Default is to truncate the trace and continue the build
+	if p == "" {
+		return OutputLimitContinue, nil
+	}
+
+	if p != OutputLimitContinue &&
+		p != OutputLimitFail {
+		return "", fmt.Errorf("unsupported output-limit-policy: %v", p)
+	}
+	return p, nil
+}
+
+type CacheFormat string
+
+const (
+	CacheFormatZip   CacheFormat = "zip"
+	CacheFormatTarGz CacheFormat = "tar.gz"
+)
+
+// Get returns one of the predefined values or returns an error if the value can't match the predefined
+func (f CacheFormat) Get() (CacheFormat, error) {
+	// Default is the zip archive
+	if f == "" {
+		return CacheFormatZip, nil
+	}
+
+	if f != CacheFormatZip && f != CacheFormatTarGz {
+		return "", fmt.Errorf("unsupported cache format: %v", f)
+	}
+	return f, nil
+}
+
+// FileName is the name of the cache archive
+func (f CacheFormat) FileName() string {
+	if f == CacheFormatTarGz {
+		return "cache.tar.gz"
+	}
+	return "cache.zip"
+}
+
+type DockerServicesLogs string
+
+const (
+	DockerServicesLogsNever     DockerServicesLogs = "never"
+	DockerServicesLogsOnFailure                    = "on-failure"
+	DockerServicesLogsAlways                       = "always"
+)
+
+// Get returns one of the predefined values or returns an error if the value can't match the predefined
+func (p DockerServicesLogs) Get() (DockerServicesLogs, error) {
+	// Default is to not print the logs
+	if p == "" {
+		return DockerServicesLogsNever, nil
+	}
+
+	if p != DockerServicesLogsNever &&
+		p != DockerServicesLogsOnFailure &&
+		p != DockerServicesLogsAlways {
+		return "", fmt.Errorf("unsupported docker-services-logs: %v", p)
+	}
+	return p, nil
+}
+
 type DockerConfig struct {
 	docker_helpers.DockerCredentials
-	Hostname               string           `toml:"hostname,omitempty" json:"hostname" long:"hostname" env:"DOCKER_HOSTNAME" description:"Custom container hostname"`
-	Image                  string           `toml:"image" json:"image" long:"image" env:"DOCKER_IMAGE" description:"Docker image to be used"`
-	CPUSetCPUs             string           `toml:"cpuset_cpus,omitempty" json:"cpuset_cpus" long:"cpuset-cpus" env:"DOCKER_CPUSET_CPUS" description:"String value containing the cgroups CpusetCpus to use"`
-	DNS                    []string         `toml:"dns,omitempty" json:"dns" long:"dns" env:"DOCKER_DNS" description:"A list of DNS servers for the container to use"`
-	DNSSearch              []string         `toml:"dns_search,omitempty" json:"dns_search" long:"dns-search" env:"DOCKER_DNS_SEARCH" description:"A list of DNS search domains"`
-	Privileged             bool             `toml:"privileged,omitzero" json:"privileged" long:"privileged" env:"DOCKER_PRIVILEGED" description:"Give extended privileges to container"`
-	CapAdd                 []string         `toml:"cap_add" json:"cap_add" long:"cap-add" env:"DOCKER_CAP_ADD" description:"Add Linux capabilities"`
-	CapDrop                []string         `toml:"cap_drop" json:"cap_drop" long:"cap-drop" env:"DOCKER_CAP_DROP" description:"Drop Linux capabilities"`
-	SecurityOpt            []string         `toml:"security_opt" json:"security_opt" long:"security-opt" env:"DOCKER_SECURITY_OPT" description:"Security Options"`
-	Devices                []string         `toml:"devices" json:"devices" long:"devices" env:"DOCKER_DEVICES" description:"Add a host device to the container"`
-	DisableCache           bool             `toml:"disable_cache,omitzero" json:"disable_cache" long:"disable-cache" env:"DOCKER_DISABLE_CACHE" description:"Disable all container caching"`
-	Volumes                []string         `toml:"volumes,omitempty" json:"volumes" long:"volumes" env:"DOCKER_VOLUMES" description:"Bind mount a volumes"`
-	CacheDir               string           `toml:"cache_dir,omitempty" json:"cache_dir" long:"cache-dir" env:"DOCKER_CACHE_DIR" description:"Directory where to store caches"`
-	ExtraHosts             []string         `toml:"extra_hosts,omitempty" json:"extra_hosts" long:"extra-hosts" env:"DOCKER_EXTRA_HOSTS" description:"Add a custom host-to-IP mapping"`
-	NetworkMode            string           `toml:"network_mode,omitempty" json:"network_mode" long:"network-mode" env:"DOCKER_NETWORK_MODE" description:"Add container to a custom network"`
-	Links                  []string         `toml:"links,omitempty" json:"links" long:"links" env:"DOCKER_LINKS" description:"Add link to another container"`
-	Services               []string         `toml:"services,omitempty" json:"services" long:"services" env:"DOCKER_SERVICES" description:"Add service that is started with container"`
-	WaitForServicesTimeout int              `toml:"wait_for_services_timeout,omitzero" json:"wait_for_services_timeout" long:"wait-for-services-timeout" env:"DOCKER_WAIT_FOR_SERVICES_TIMEOUT" description:"How long to wait for service startup"`
-	AllowedImages          []string         `toml:"allowed_images,omitempty" json:"allowed_images" long:"allowed-images" env:"DOCKER_ALLOWED_IMAGES" description:"Whitelist allowed images"`
-	AllowedServices        []string         `toml:"allowed_services,omitempty" json:"allowed_services" long:"allowed-services" env:"DOCKER_ALLOWED_SERVICES" description:"Whitelist allowed services"`
-	PullPolicy             DockerPullPolicy `toml:"pull_policy,omitempty" json:"pull_policy" long:"pull-policy" env:"DOCKER_PULL_POLICY" description:"Image pull policy: never, if-not-present, always"`
+	Hostname               string             `toml:"hostname,omitempty" json:"hostname" long:"hostname" env:"DOCKER_HOSTNAME" description:"Custom container hostname"`
+	Image                  string             `toml:"image" json:"image" long:"image" env:"DOCKER_IMAGE" description:"Docker image to be used"`
+	Entrypoint             []string           `toml:"entrypoint,omitempty" json:"entrypoint" long:"entrypoint" env:"DOCKER_ENTRYPOINT" description:"The entrypoint of the build container used instead of the ENTRYPOINT of the image"`
+	Command                []string           `toml:"command,omitempty" json:"command" long:"command" env:"DOCKER_COMMAND" description:"The command reading the build script in the build container, used instead of the detected shell"`
+	CPUSetCPUs             string             `toml:"cpuset_cpus,omitempty" json:"cpuset_cpus" long:"cpuset-cpus" env:"DOCKER_CPUSET_CPUS" description:"String value containing the cgroups CpusetCpus to use"`
+	DNS                    []string           `toml:"dns,omitempty" json:"dns" long:"dns" env:"DOCKER_DNS" description:"A list of DNS servers for the container to use"`
+	DNSSearch              []string           `toml:"dns_search,omitempty" json:"dns_search" long:"dns-search" env:"DOCKER_DNS_SEARCH" description:"A list of DNS search domains"`
+	Privileged             bool               `toml:"privileged,omitzero" json:"privileged" long:"privileged" env:"DOCKER_PRIVILEGED" description:"Give extended privileges to container"`
+	Runtime                string             `toml:"runtime,omitempty" json:"runtime" long:"runtime" env:"DOCKER_RUNTIME" description:"The OCI runtime of the build containers, eg. nvidia, runsc or kata-runtime"`
+	CapAdd                 []string           `toml:"cap_add" json:"cap_add" long:"cap-add" env:"DOCKER_CAP_ADD" description:"Add Linux capabilities"`
+	CapDrop                []string           `toml:"cap_drop" json:"cap_drop" long:"cap-drop" env:"DOCKER_CAP_DROP" description:"Drop Linux capabilities"`
+	SecurityOpt            []string           `toml:"security_opt" json:"security_opt" long:"security-opt" env:"DOCKER_SECURITY_OPT" description:"Security Options"`
+	Devices                []string           `toml:"devices" json:"devices" long:"devices" env:"DOCKER_DEVICES" description:"Add a host device to the container"`
+	DisableCache           bool               `toml:"disable_cache,omitzero" json:"disable_cache" long:"disable-cache" env:"DOCKER_DISABLE_CACHE" description:"Disable all container caching"`
+	Volumes                []string           `toml:"volumes,omitempty" json:"volumes" long:"volumes" env:"DOCKER_VOLUMES" description:"Bind mount a volumes"`
+	VolumesFrom            []string           `toml:"volumes_from,omitempty" json:"volumes_from" long:"volumes-from" env:"DOCKER_VOLUMES_FROM" description:"A list of containers to inherit volumes from"`
+	Tmpfs                  map[string]string  `toml:"tmpfs,omitempty" json:"tmpfs" long:"tmpfs" env:"DOCKER_TMPFS" description:"A tmpfs mount for the build container, as path:options"`
+	ServicesTmpfs          map[string]string  `toml:"services_tmpfs,omitempty" json:"services_tmpfs" long:"services-tmpfs" env:"DOCKER_SERVICES_TMPFS" description:"A tmpfs mount for the service containers, as path:options"`
+	CleanupBuildsDir       bool               `toml:"cleanup_builds_dir,omitzero" json:"cleanup_builds_dir" long:"cleanup-builds-dir" env:"DOCKER_CLEANUP_BUILDS_DIR" description:"Remove the build directory shared with the host after the build"`
+	CACertificates         bool               `toml:"ca_certificates,omitzero" json:"ca_certificates" long:"ca-certificates" env:"DOCKER_CA_CERTIFICATES" description:"Pass the CA certificates of the host and the GitLab server to the build container as SSL_CERT_FILE"`
+	CacheDir               string             `toml:"cache_dir,omitempty" json:"cache_dir" long:"cache-dir" env:"DOCKER_CACHE_DIR" description:"Directory where to store caches"`
+	CacheVolumes           []string           `toml:"cache_volumes,omitempty" json:"cache_volumes" long:"cache-volumes" env:"DOCKER_CACHE_VOLUMES" description:"Container paths stored in named volumes shared by the builds of the project"`
+	CacheVolumesKey        string             `toml:"cache_volumes_key,omitempty" json:"cache_volumes_key" long:"cache-volumes-key" env:"DOCKER_CACHE_VOLUMES_KEY" description:"The key of the cache volumes, can use the build variables"`
+	ExtraHosts             []string           `toml:"extra_hosts,omitempty" json:"extra_hosts" long:"extra-hosts" env:"DOCKER_EXTRA_HOSTS" description:"Add a custom host-to-IP mapping"`
+	NetworkMode            string             `toml:"network_mode,omitempty" json:"network_mode" long:"network-mode" env:"DOCKER_NETWORK_MODE" description:"Add container to a custom network"`
+	Links                  []string           `toml:"links,omitempty" json:"links" long:"links" env:"DOCKER_LINKS" description:"Add link to another container"`
+	Services               []string           `toml:"services,omitempty" json:"services" long:"services" env:"DOCKER_SERVICES" description:"Add service that is started with container"`
+	ServicesLogs           DockerServicesLogs `toml:"services_logs,omitempty" json:"services_logs" long:"services-logs" env:"DOCKER_SERVICES_LOGS" description:"When to print the logs of services to the build trace: never, on-failure, always"`
+	WaitForServicesTimeout int                `toml:"wait_for_services_timeout,omitzero" json:"wait_for_services_timeout" long:"wait-for-services-timeout" env:"DOCKER_WAIT_FOR_SERVICES_TIMEOUT" description:"How long to wait for service startup"`
+	AllowedImages          []string           `toml:"allowed_images,omitempty" json:"allowed_images" long:"allowed-images" env:"DOCKER_ALLOWED_IMAGES" description:"Whitelist allowed images"`
+	AllowedServices        []string           `toml:"allowed_services,omitempty" json:"allowed_services" long:"allowed-services" env:"DOCKER_ALLOWED_SERVICES" description:"Whitelist allowed services"`
+	RegistryMirror         string             `toml:"registry_mirror,omitempty" json:"registry_mirror" long:"registry-mirror" env:"DOCKER_REGISTRY_MIRROR" description:"Registry used to pull the Docker Hub images, eg. mirror.example.com:5000"`
+	InsecureRegistries     []string           `toml:"insecure_registries,omitempty" json:"insecure_registries" long:"insecure-registries" env:"DOCKER_INSECURE_REGISTRIES" description:"Registries that are accessed without TLS verification by the created machines"`
+	PullPolicy             DockerPullPolicy   `toml:"pull_policy,omitempty" json:"pull_policy" long:"pull-policy" env:"DOCKER_PULL_POLICY" description:"Image pull policy: never, if-not-present, always"`
+	HelperImage            string             `toml:"helper_image,omitempty" json:"helper_image" long:"helper-image" env:"DOCKER_HELPER_IMAGE" description:"The helper image used to clone repositories and handle caches and artifacts, instead of the built-in one"`
+	HelperImageFile        string             `toml:"helper_image_file,omitempty" json:"helper_image_file" long:"helper-image-file" env:"DOCKER_HELPER_IMAGE_FILE" description:"The prebuilt-<arch>.tar.xz archive of the helper image loaded instead of the built-in one"`
+	EnvironmentScript      string             `toml:"environment_script,omitempty" json:"environment_script" long:"environment-script" env:"DOCKER_ENVIRONMENT_SCRIPT" description:"The script run once in the build image, the committed image is reused by the next builds"`
+	EnvironmentTimeout     int                `toml:"environment_script_timeout,omitzero" json:"environment_script_timeout" long:"environment-script-timeout" env:"DOCKER_ENVIRONMENT_SCRIPT_TIMEOUT" description:"How long the environment script can run, in seconds"`
+	MaxContainers          int                `toml:"max_containers,omitzero" json:"max_containers" long:"max-containers" env:"DOCKER_MAX_CONTAINERS" description:"The builds aren't requested when the Docker host runs this many containers"`
 }
 
 type DockerMachine struct {
@@ -73,6 +186,8 @@ type DockerMachine struct {
 	MachineDriver  string   `long:"machine-driver" env:"MACHINE_DRIVER" description:"The driver to use when creating machine"`
 	MachineName    string   `long:"machine-name" env:"MACHINE_NAME" description:"The template for machine name (needs to include %s)"`
 	MachineOptions []string `long:"machine-options" env:"MACHINE_OPTIONS" description:"Additional machine creation options"`
+
+	RemoveOnShutdown bool `toml:"RemoveOnShutdown,omitzero" long:"remove-on-shutdown" env:"MACHINE_REMOVE_ON_SHUTDOWN" description:"Remove the idle machines when the runner is stopped"`
 }
 
 type ParallelsConfig struct {
@@ -99,12 +214,42 @@ type KubernetesConfig struct {
 	Memory        string `toml:"memory" json:"memory" long:"memory" env:"KUBERNETES_MEMORY" description:"The amount of memory allocated to build containers"`
 	ServiceCPUs   string `toml:"service_cpus" json:"service_cpus" long:"service-cpus" env:"KUBERNETES_SERVICE_CPUS" description:"The CPU allocation given to build service containers"`
 	ServiceMemory string `toml:"service_memory" json:"service_memory" long:"service-memory" env:"KUBERNETES_SERVICE_MEMORY" description:"The amount of memory allocated to build service containers"`
+
+	PullPolicy     string            `toml:"pull_policy" json:"pull_policy" long:"pull-policy" env:"KUBERNETES_PULL_POLICY" description:"How the images are pulled: Always, IfNotPresent or Never, the default of the cluster is used when empty"`
+	ServiceAccount string            `toml:"service_account" json:"service_account" long:"service-account" env:"KUBERNETES_SERVICE_ACCOUNT" description:"The service account used by the build pods"`
+	NodeSelector   map[string]string `toml:"node_selector" json:"node_selector" long:"node-selector" env:"KUBERNETES_NODE_SELECTOR" description:"The labels of the nodes the build pods are scheduled on, as label:value"`
+}
+
+type CgroupConfig struct {
+	Enabled     bool   `toml:"enabled,omitzero" json:"enabled" long:"enabled" env:"CGROUP_ENABLED" description:"Run each build of shell executor in a transient systemd scope"`
+	CPUQuota    string `toml:"cpu_quota,omitempty" json:"cpu_quota" long:"cpu-quota" env:"CGROUP_CPU_QUOTA" description:"CPU time quota of the build, eg. 200%"`
+	MemoryLimit string `toml:"memory_limit,omitempty" json:"memory_limit" long:"memory-limit" env:"CGROUP_MEMORY_LIMIT" description:"Memory limit of the build, eg. 2G"`
+	PidsLimit   int    `toml:"pids_limit,omitzero" json:"pids_limit" long:"pids-limit" env:"CGROUP_PIDS_LIMIT" description:"Maximum number of processes of the build"`
+}
+
+type LogSinkConfig struct {
+	Type  string `toml:"type,omitempty" json:"type" long:"type" env:"LOG_SINK_TYPE" description:"Mirror the build traces to: file or elasticsearch"`
+	Path  string `toml:"path,omitempty" json:"path" long:"path" env:"LOG_SINK_PATH" description:"File to which the build traces are appended as JSON lines"`
+	URL   string `toml:"url,omitempty" json:"url" long:"url" env:"LOG_SINK_URL" description:"Elasticsearch URL, eg. http://localhost:9200"`
+	Index string `toml:"index,omitempty" json:"index" long:"index" env:"LOG_SINK_INDEX" description:"Elasticsearch index, gitlab-ci-builds by default"`
+}
+
+// SecretsConfig enables the secret resolver for the builds of the runner
+type SecretsConfig struct {
+	Resolver          string   `toml:"resolver,omitempty" json:"resolver" long:"resolver" env:"SECRETS_RESOLVER" description:"The secret resolver of the build variables referencing the secrets"`
+	AllowedReferences []string `toml:"allowed_references,omitempty" json:"allowed_references" long:"allowed-references" env:"SECRETS_ALLOWED_REFERENCES" description:"The patterns of the secrets the builds can read, they can use the predefined variables, eg. ci/$CI_PROJECT_ID/*"`
 }
 
 type RunnerCredentials struct {
 	URL       string `toml:"url" json:"url" short:"u" long:"url" env:"CI_SERVER_URL" required:"true" description:"Runner URL"`
 	Token     string `toml:"token" json:"token" short:"t" long:"token" env:"CI_SERVER_TOKEN" required:"true" description:"Runner token"`
 	TLSCAFile string `toml:"tls-ca-file,omitempty" json:"tls-ca-file" long:"tls-ca-file" env:"CI_SERVER_TLS_CA_FILE" description:"File containing the certificates to verify the peer when using HTTPS"`
+
+	Headers    []string `toml:"headers,omitempty" json:"headers" long:"header" env:"CI_SERVER_HEADERS" description:"The header added to the requests to GitLab, as Name: value, eg. for the API gateway"`
+	SigningKey string   `toml:"signing-key,omitempty" json:"signing-key" long:"signing-key" env:"CI_SERVER_SIGNING_KEY" description:"The key of the HMAC-SHA256 signature added to the requests to GitLab"`
+
+	// RequestSignatures are the requests of the helpers pre-signed by the runner
+	RequestSignatures []string `toml:"-" json:"-"`
 }
 
 type CacheConfig struct {
@@ -114,7 +259,16 @@ type CacheConfig struct {
 	SecretKey      string `toml:"SecretKey,omitempty" long:"s3-secret-key" env:"S3_SECRET_KEY" description:"S3 Secret Key"`
 	BucketName     string `toml:"BucketName,omitempty" long:"s3-bucket-name" env:"S3_BUCKET_NAME" description:"S3 bucket name"`
 	BucketLocation string `toml:"BucketLocation,omitempty" long:"s3-bucket-location" env:"S3_BUCKET_LOCATION" description:"S3 location"`
+	Path           string `toml:"Path,omitempty" long:"s3-path" env:"S3_PATH" description:"The path prefix of the cache objects in the bucket"`
 	Insecure       bool   `toml:"Insecure,omitempty" long:"s3-insecure" env:"S3_CACHE_INSECURE" description:"Use insecure mode (without https)"`
+	TLSCAFile      string `toml:"TLSCAFile,omitempty" long:"s3-tls-ca-file" env:"S3_TLS_CA_FILE" description:"File containing the certificates to verify the S3 server"`
+	TLSSkipVerify  bool   `toml:"TLSSkipVerify,omitempty" long:"s3-tls-skip-verify" env:"S3_TLS_SKIP_VERIFY" description:"Don't verify the TLS certificate of the S3 server"`
+
+	SigningKey string `toml:"SigningKey,omitempty" long:"signing-key" env:"CACHE_SIGNING_KEY" description:"The key of the HMAC-SHA256 signature added to the cache requests"`
+
+	Format CacheFormat `toml:"Format,omitempty" long:"format" env:"CACHE_FORMAT" description:"The format of the cache archive: zip or tar.gz"`
+
+	FallbackRef string `toml:"FallbackRef,omitempty" long:"fallback-ref" env:"CACHE_FALLBACK_REF" description:"The branch, which cache is restored when the cache of the build is missing, eg. master, there's no fallback by default"`
 }
 
 type RunnerSettings struct {
@@ -122,9 +276,27 @@ type RunnerSettings struct {
 	BuildsDir string `toml:"builds_dir,omitempty" json:"builds_dir" long:"builds-dir" env:"RUNNER_BUILDS_DIR" description:"Directory where builds are stored"`
 	CacheDir  string `toml:"cache_dir,omitempty" json:"cache_dir" long:"cache-dir" env:"RUNNER_CACHE_DIR" description:"Directory where build cache is stored"`
 
-	Environment []string `toml:"environment,omitempty" json:"environment" long:"env" env:"RUNNER_ENV" description:"Custom environment variables injected to build environment"`
+	Environment []string          `toml:"environment,omitempty" json:"environment" long:"env" env:"RUNNER_ENV" description:"Custom environment variables injected to build environment"`
+	Variables   map[string]string `toml:"variables,omitempty" json:"variables" long:"variable" env:"RUNNER_VARIABLES" description:"The default variables of the builds, as KEY:value, the variables of the project override them"`
+
+	Shell string `toml:"shell,omitempty" json:"shell" long:"shell" env:"RUNNER_SHELL" description:"Select bash, sh, cmd, powershell or pwsh, it is detected when empty"`
+
+	PreCloneScript string `toml:"pre_clone_script,omitempty" json:"pre_clone_script" long:"pre-clone-script" env:"RUNNER_PRE_CLONE_SCRIPT" description:"Runner-specific command script executed before code is pulled"`
+
+	ValidateScripts bool `toml:"validate_scripts,omitempty" json:"validate_scripts" long:"validate-scripts" env:"RUNNER_VALIDATE_SCRIPTS" description:"Check the syntax of the build scripts before executing them"`
+
+	StageTimeouts map[string]int `toml:"stage_timeouts,omitempty" json:"stage_timeouts" long:"stage-timeouts" env:"RUNNER_STAGE_TIMEOUTS" description:"The timeouts of the build stages in seconds, as stage:seconds"`
+
+	CoverageRegex string `toml:"coverage_regex,omitempty" json:"coverage_regex" long:"coverage-regex" env:"RUNNER_COVERAGE_REGEX" description:"The regex extracting the test coverage from the build log, used when the job doesn't define one"`
+
+	SummaryDir string `toml:"summary_dir,omitempty" json:"summary_dir" long:"summary-dir" env:"RUNNER_SUMMARY_DIR" description:"Directory where the JSON summary of every build is written"`
 
-	Shell string `toml:"shell,omitempty" json:"shell" long:"shell" env:"RUNNER_SHELL" description:"Select bash, cmd or powershell"`
+	UploadGracePeriod int `toml:"upload_grace_period,omitzero" json:"upload_grace_period" long:"upload-grace-period" env:"RUNNER_UPLOAD_GRACE_PERIOD" description:"How many seconds the cache and artifacts upload can continue after the build is aborted"`
+
+	Offline bool `toml:"offline,omitzero" json:"offline" long:"offline" env:"RUNNER_OFFLINE" description:"The runner has no internet access, the images are not pulled from Docker Hub"`
+
+	Nice   int    `toml:"nice,omitzero" json:"nice" long:"nice" env:"RUNNER_NICE" description:"CPU priority (niceness) of the shell builds, from -20 to 19"`
+	IONice string `toml:"ionice,omitempty" json:"ionice" long:"ionice" env:"RUNNER_IONICE" description:"IO priority of the shell builds on Linux: idle or best-effort[:0-7]"`
 
 	SSH        *ssh.Config       `toml:"ssh" json:"ssh" group:"ssh executor" namespace:"ssh"`
 	Docker     *DockerConfig     `toml:"docker" json:"docker" group:"docker executor" namespace:"docker"`
@@ -133,12 +305,32 @@ type RunnerSettings struct {
 	Cache      *CacheConfig      `toml:"cache" json:"cache" group:"cache configuration" namespace:"cache"`
 	Machine    *DockerMachine    `toml:"machine" json:"machine" group:"docker machine provider" namespace:"machine"`
 	Kubernetes *KubernetesConfig `toml:"kubernetes" json:"kubernetes" group:"kubernetes executor" namespace:"kubernetes"`
+	Cgroup     *CgroupConfig     `toml:"cgroup" json:"cgroup" group:"cgroup configuration" namespace:"cgroup"`
+	LogSink    *LogSinkConfig    `toml:"log_sink" json:"log_sink" group:"log sink configuration" namespace:"log-sink"`
+	Secrets    *SecretsConfig    `toml:"secrets" json:"secrets" group:"secrets configuration" namespace:"secrets"`
 }
 
 type RunnerConfig struct {
-	Name        string `toml:"name" json:"name" short:"name" long:"description" env:"RUNNER_NAME" description:"Runner name"`
+	Name        string `toml:"name" json:"name" short:"name" long:"description" env:"RUNNER_NAME" description:"Runner name, it can be a template, eg. runner-{{.Hostname}}"`
 	Limit       int    `toml:"limit,omitzero" json:"limit" long:"limit" env:"RUNNER_LIMIT" description:"Maximum number of builds processed by this runner"`
 	OutputLimit int    `toml:"output_limit,omitzero" long:"output-limit" env:"RUNNER_OUTPUT_LIMIT" description:"Maximum build trace size in kilobytes"`
+	TagList     string `toml:"tag_list,omitempty" json:"tag_list" long:"tag-list" env:"RUNNER_TAG_LIST" description:"Tag list"`
+
+	OutputLimitPolicy OutputLimitPolicy `toml:"output_limit_policy,omitempty" json:"output_limit_policy" long:"output-limit-policy" env:"RUNNER_OUTPUT_LIMIT_POLICY" description:"What happens to the build when its trace exceeds the output limit: continue or fail"`
+
+	// NameTemplate is set when the name is rendered from a template, it's rendered again on startup
+	NameTemplate string `toml:"name_template,omitempty" json:"name_template"`
+	// RunnerID is the ID of the registered runner, it's needed to update its description in GitLab
+	RunnerID int    `toml:"runner_id,omitzero" json:"runner_id"`
+	APIToken string `toml:"api_token,omitempty" json:"api_token" long:"api-token" env:"RUNNER_API_TOKEN" description:"The private token of the administrator updating the description of the runner in GitLab, when its name template is rendered again"`
+
+	LimitSchedules []LimitSchedule `toml:"limit_schedules,omitempty" json:"limit_schedules"`
+
+	TraceTimestamps TraceTimestamps `toml:"trace_timestamps,omitempty" json:"trace_timestamps" long:"trace-timestamps" env:"RUNNER_TRACE_TIMESTAMPS" description:"Prefix the lines of build trace with: none, elapsed or rfc3339"`
+	DisableColors   bool            `toml:"disable_colors,omitzero" json:"disable_colors" long:"disable-colors" env:"RUNNER_DISABLE_COLORS" description:"Remove the ANSI colors from the build trace"`
+
+	UpdateInterval      int `toml:"update_interval,omitzero" json:"update_interval" long:"update-interval" env:"RUNNER_UPDATE_INTERVAL" description:"How often to send the build trace updates, in seconds"`
+	ForceUpdateInterval int `toml:"force_update_interval,omitzero" json:"force_update_interval" long:"force-update-interval" env:"RUNNER_FORCE_UPDATE_INTERVAL" description:"Maximum time between the build trace updates, even without new output, in seconds"`
 
 	RunnerCredentials
 	RunnerSettings
@@ -152,6 +344,9 @@ type Config struct {
 	SentryDSN     *string         `toml:"sentry_dsn"`
 	ModTime       time.Time       `toml:"-"`
 	Loaded        bool            `toml:"-"`
+
+	MaintenanceWindows  []MaintenanceWindow `toml:"maintenance_windows,omitempty" json:"maintenance_windows"`
+	ConcurrentSchedules []LimitSchedule     `toml:"concurrent_schedules,omitempty" json:"concurrent_schedules"`
 }
 
 func (c *RunnerCredentials) ShortDescription() string {
@@ -183,6 +378,17 @@ func (c *RunnerConfig) GetVariables() BuildVariables {
 		}
 	}
 
+	// The variables are sorted, so they're always expanded in the same order
+	keys := make([]string, 0, len(c.Variables))
+	for key := range c.Variables {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		variables = append(variables, BuildVariable{Key: key, Value: c.Variables[key], Internal: true})
+	}
+
 	return variables
 }
 
@@ -219,6 +425,19 @@ func (c *Config) LoadConfig(configFile string) error {
 	return nil
 }
 
+// LockConfigFile acquires the lock of the config file, so its concurrent
+// updates don't overwrite each other. It's other than the lock of the running
+// service, which is held as long as the service runs.
+func LockConfigFile(configFile string) (*helpers.LockFile, error) {
+	os.MkdirAll(filepath.Dir(configFile), 0700)
+
+	lock, err := helpers.WaitForLockFile(configFile+".write.lock", ConfigLockTimeout)
+	if err == helpers.ErrFileLocked {
+		return nil, fmt.Errorf("%s is locked by other process", configFile)
+	}
+	return lock, err
+}
+
 func (c *Config) SaveConfig(configFile string) error {
 	var newConfig bytes.Buffer
 	newBuffer := bufio.NewWriter(&newConfig)
@@ -235,8 +454,8 @@ func (c *Config) SaveConfig(configFile string) error {
 	// create directory to store configuration
 	os.MkdirAll(filepath.Dir(configFile), 0700)
 
-	// write config file
-	if err := ioutil.WriteFile(configFile, newConfig.Bytes(), 0600); err != nil {
+	// write config file, it's replaced atomically as the running service can reload it anytime
+	if err := helpers.WriteFileAtomically(configFile, newConfig.Bytes(), 0600); err != nil {
 		return err
 	}
 
@@ -244,6 +463,16 @@ func (c *Config) SaveConfig(configFile string) error {
 	return nil
 }
 
+// GetMaintenanceWindow returns the maintenance window containing now, if any
+func (c *Config) GetMaintenanceWindow(now time.Time) *MaintenanceWindow {
+	for idx := range c.MaintenanceWindows {
+		if c.MaintenanceWindows[idx].Contains(now) {
+			return &c.MaintenanceWindows[idx]
+		}
+	}
+	return nil
+}
+
 func (c *Config) GetCheckInterval() time.Duration {
 	if c.CheckInterval > 0 {
 		return time.Duration(c.CheckInterval) * time.Second
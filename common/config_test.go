@@ -0,0 +1,36 @@
+// +build !windows
+
+package common
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
+)
+
+func TestLockConfigFileWhileServiceIsRunning(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	configFile := filepath.Join(dir, "config.toml")
+
+	// the running service holds its own lock
+	serviceLock, err := helpers.NewLockFile(configFile + ".lock")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer serviceLock.Unlock()
+
+	lock, err := LockConfigFile(configFile)
+	if assert.NoError(t, err) {
+		lock.Unlock()
+	}
+}
@@ -12,9 +12,11 @@ const ReloadConfigInterval = 3
 const HealthyChecks = 3
 const HealthCheckInterval = 3600
 const DefaultWaitForServicesTimeout = 30
+const DefaultEnvironmentScriptTimeout = 3600
 const ShutdownTimeout = 30
 const DefaultOutputLimit = 4096 // 4MB in kilobytes
 const ForceTraceSentInterval = 30 * time.Second
 const PreparationRetries = 3
+const ConfigLockTimeout = 30 * time.Second
 
 var PreparationRetryInterval = 3 * time.Second
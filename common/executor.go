@@ -18,18 +18,35 @@ type Executor interface {
 	Run(cmd ExecutorCommand) error
 	Finish(err error)
 	Cleanup()
+
+	// The build sets the stage before the executor is prepared, runs the script of the stage,
+	// is finished and cleaned up, so the executor and the stage hooks know what the executor does
+	GetCurrentStage() BuildStage
+	SetCurrentStage(stage BuildStage)
 }
 
+// UnlimitedCapacity is returned by the providers which don't limit the number of builds
+const UnlimitedCapacity = -1
+
 type ExecutorProvider interface {
 	CanCreate() bool
 	Create() Executor
+	// GetCapacity returns how many builds can be acquired now, the runner isn't asked
+	// for new builds when it's 0, eg. when all machines are used
+	GetCapacity(config *RunnerConfig) int
 	Acquire(config *RunnerConfig) (ExecutorData, error)
 	Release(config *RunnerConfig, data ExecutorData) error
+	// Shutdown is called for every runner when the builds are finished and the runner is stopped gracefully,
+	// eg. to remove the machines created for the builds
+	Shutdown(config *RunnerConfig)
 	GetFeatures(features *FeaturesInfo)
 }
 
 type BuildError struct {
 	Inner error
+
+	// ExitCode of the failed script, it's 0 when the executor doesn't report it
+	ExitCode int
 }
 
 func (b *BuildError) Error() string {
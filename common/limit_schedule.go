@@ -0,0 +1,62 @@
+package common
+
+import (
+	"fmt"
+	"time"
+)
+
+// LimitSchedule changes the limit of the concurrent builds during the recurring time range,
+// in the local time of the runner, eg. to run less builds at night when the backups run
+type LimitSchedule struct {
+	Days  []string `toml:"days,omitempty" json:"days"`
+	Start string   `toml:"start" json:"start"`
+	End   string   `toml:"end" json:"end"`
+	Limit int      `toml:"limit" json:"limit"`
+}
+
+// The time range of the schedule is checked the same way as of the maintenance window
+func (s *LimitSchedule) window() *MaintenanceWindow {
+	return &MaintenanceWindow{
+		Days:  s.Days,
+		Start: s.Start,
+		End:   s.End,
+	}
+}
+
+func (s *LimitSchedule) Verify() error {
+	if s.Limit < 0 {
+		return fmt.Errorf("limit of schedule %s can't be negative", s)
+	}
+	return s.window().Verify()
+}
+
+func (s *LimitSchedule) Contains(now time.Time) bool {
+	return s.window().Contains(now)
+}
+
+func (s *LimitSchedule) String() string {
+	return s.window().String()
+}
+
+// getScheduledLimit returns the limit of the first valid schedule containing now, or the default limit
+func getScheduledLimit(schedules []LimitSchedule, defaultLimit int, now time.Time) int {
+	for idx := range schedules {
+		if schedules[idx].Verify() != nil {
+			continue
+		}
+		if schedules[idx].Contains(now) {
+			return schedules[idx].Limit
+		}
+	}
+	return defaultLimit
+}
+
+// GetConcurrent returns the number of concurrent builds of the runner at the time
+func (c *Config) GetConcurrent(now time.Time) int {
+	return getScheduledLimit(c.ConcurrentSchedules, c.Concurrent, now)
+}
+
+// GetLimit returns the maximum number of concurrent builds of the runner entry at the time
+func (c *RunnerConfig) GetLimit(now time.Time) int {
+	return getScheduledLimit(c.LimitSchedules, c.Limit, now)
+}
@@ -0,0 +1,53 @@
+package common
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitScheduleVerify(t *testing.T) {
+	assert.NoError(t, (&LimitSchedule{Start: "22:00", End: "06:00", Limit: 5}).Verify())
+	assert.Error(t, (&LimitSchedule{Start: "22:00", End: "06:00", Limit: -1}).Verify())
+	assert.Error(t, (&LimitSchedule{Start: "22:00", End: "22:00", Limit: 5}).Verify())
+	assert.Error(t, (&LimitSchedule{Start: "22:00", End: "06:00", Days: []string{"Caturday"}}).Verify())
+}
+
+func TestConfigGetConcurrent(t *testing.T) {
+	config := Config{
+		Concurrent: 20,
+		ConcurrentSchedules: []LimitSchedule{
+			{Start: "22:00", End: "06:00", Limit: 5},
+			{Start: "00:00", End: "12:00", Days: []string{"Sat", "Sun"}, Limit: 2},
+		},
+	}
+
+	assert.Equal(t, 20, config.GetConcurrent(maintenanceTestTime(14, 12, 0)), "uses the concurrent during the day")
+	assert.Equal(t, 5, config.GetConcurrent(maintenanceTestTime(14, 23, 0)), "uses the schedule at night")
+	assert.Equal(t, 5, config.GetConcurrent(maintenanceTestTime(15, 1, 0)), "uses the first matching schedule")
+	assert.Equal(t, 2, config.GetConcurrent(maintenanceTestTime(15, 8, 0)))
+}
+
+func TestRunnerConfigGetLimit(t *testing.T) {
+	runner := RunnerConfig{
+		Limit: 10,
+		LimitSchedules: []LimitSchedule{
+			{Start: "09:00", End: "17:00", Days: []string{"Mon", "Tue", "Wed", "Thu", "Fri"}, Limit: 2},
+		},
+	}
+
+	assert.Equal(t, 2, runner.GetLimit(maintenanceTestTime(14, 10, 0)), "Friday is a working day")
+	assert.Equal(t, 10, runner.GetLimit(maintenanceTestTime(14, 18, 0)))
+	assert.Equal(t, 10, runner.GetLimit(maintenanceTestTime(15, 10, 0)), "Saturday isn't scheduled")
+}
+
+func TestScheduledLimitSkipsInvalidSchedules(t *testing.T) {
+	schedules := []LimitSchedule{
+		{Start: "22:00", End: "06:00", Limit: -1},
+		{Start: "22:00", End: "06:00", Days: []string{"Caturday"}, Limit: 1},
+		{Start: "22:00", End: "06:00", Limit: 5},
+	}
+
+	assert.Equal(t, 5, getScheduledLimit(schedules, 20, maintenanceTestTime(14, 23, 0)), "the invalid schedules are skipped")
+	assert.Equal(t, 20, getScheduledLimit(schedules[:2], 20, maintenanceTestTime(14, 23, 0)))
+}
@@ -0,0 +1,93 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MaintenanceWindow is a recurring time range, in the local time of the runner,
+// during which no new builds are requested
+type MaintenanceWindow struct {
+	Days  []string `toml:"days,omitempty" json:"days"`
+	Start string   `toml:"start" json:"start"`
+	End   string   `toml:"end" json:"end"`
+}
+
+func parseTimeOfDay(value string) (time.Duration, error) {
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q, expected HH:MM", value)
+	}
+	return time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute, nil
+}
+
+func parseWeekday(value string) (time.Weekday, error) {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		name := day.String()
+		if strings.EqualFold(value, name) || strings.EqualFold(value, name[0:3]) {
+			return day, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid day %q", value)
+}
+
+func (w *MaintenanceWindow) startsOn(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, value := range w.Days {
+		if weekday, err := parseWeekday(value); err == nil && weekday == day {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *MaintenanceWindow) Verify() error {
+	start, err := parseTimeOfDay(w.Start)
+	if err != nil {
+		return err
+	}
+	end, err := parseTimeOfDay(w.End)
+	if err != nil {
+		return err
+	}
+	if start == end {
+		return fmt.Errorf("window starting at %s is empty", w.Start)
+	}
+	for _, value := range w.Days {
+		if _, err := parseWeekday(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Contains checks if now is within the window, the invalid window contains nothing.
+// The window ending before it starts lasts over the midnight to the next day.
+func (w *MaintenanceWindow) Contains(now time.Time) bool {
+	if w.Verify() != nil {
+		return false
+	}
+	start, _ := parseTimeOfDay(w.Start)
+	end, _ := parseTimeOfDay(w.End)
+
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	timeOfDay := now.Sub(midnight)
+
+	if start < end {
+		return w.startsOn(now.Weekday()) && timeOfDay >= start && timeOfDay < end
+	}
+	if timeOfDay >= start {
+		return w.startsOn(now.Weekday())
+	}
+	return timeOfDay < end && w.startsOn(midnight.AddDate(0, 0, -1).Weekday())
+}
+
+func (w *MaintenanceWindow) String() string {
+	if len(w.Days) == 0 {
+		return fmt.Sprintf("%s-%s", w.Start, w.End)
+	}
+	return fmt.Sprintf("%s %s-%s", strings.Join(w.Days, ","), w.Start, w.End)
+}
@@ -0,0 +1,63 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 2016-10-15 is Saturday
+func maintenanceTestTime(day int, hour, minute int) time.Time {
+	return time.Date(2016, 10, day, hour, minute, 0, 0, time.Local)
+}
+
+func TestMaintenanceWindowVerify(t *testing.T) {
+	assert.NoError(t, (&MaintenanceWindow{Start: "02:00", End: "04:30", Days: []string{"sat", "Sunday"}}).Verify())
+	assert.Error(t, (&MaintenanceWindow{Start: "2am", End: "04:00"}).Verify())
+	assert.Error(t, (&MaintenanceWindow{Start: "02:00", End: "25:00"}).Verify())
+	assert.Error(t, (&MaintenanceWindow{Start: "02:00", End: "02:00"}).Verify())
+	assert.Error(t, (&MaintenanceWindow{Start: "02:00", End: "04:00", Days: []string{"Caturday"}}).Verify())
+}
+
+func TestMaintenanceWindowContains(t *testing.T) {
+	window := MaintenanceWindow{Start: "02:00", End: "04:00", Days: []string{"Sat"}}
+
+	assert.False(t, window.Contains(maintenanceTestTime(15, 1, 59)))
+	assert.True(t, window.Contains(maintenanceTestTime(15, 2, 0)))
+	assert.True(t, window.Contains(maintenanceTestTime(15, 3, 59)))
+	assert.False(t, window.Contains(maintenanceTestTime(15, 4, 0)))
+	assert.False(t, window.Contains(maintenanceTestTime(16, 3, 0)), "should not be active on Sunday")
+}
+
+func TestMaintenanceWindowOverMidnight(t *testing.T) {
+	window := MaintenanceWindow{Start: "22:00", End: "02:00", Days: []string{"Sat"}}
+
+	assert.False(t, window.Contains(maintenanceTestTime(15, 1, 0)), "should not be active after Friday")
+	assert.True(t, window.Contains(maintenanceTestTime(15, 23, 0)))
+	assert.True(t, window.Contains(maintenanceTestTime(16, 1, 0)), "should last to Sunday")
+	assert.False(t, window.Contains(maintenanceTestTime(16, 2, 0)))
+}
+
+func TestInvalidMaintenanceWindowContainsNothing(t *testing.T) {
+	empty := &MaintenanceWindow{Start: "02:00", End: "02:00"}
+	assert.False(t, empty.Contains(maintenanceTestTime(15, 2, 0)), "the empty window isn't the whole day")
+	assert.False(t, empty.Contains(maintenanceTestTime(15, 12, 0)))
+
+	invalidDay := &MaintenanceWindow{Start: "02:00", End: "04:00", Days: []string{"Caturday", "Sat"}}
+	assert.False(t, invalidDay.Contains(maintenanceTestTime(15, 3, 0)))
+}
+
+func TestConfigMaintenanceWindow(t *testing.T) {
+	config := Config{
+		MaintenanceWindows: []MaintenanceWindow{
+			{Start: "02:00", End: "04:00"},
+		},
+	}
+
+	assert.Nil(t, config.GetMaintenanceWindow(maintenanceTestTime(15, 12, 0)))
+	window := config.GetMaintenanceWindow(maintenanceTestTime(17, 3, 0))
+	if assert.NotNil(t, window) {
+		assert.Equal(t, "02:00-04:00", window.String())
+	}
+}
@@ -1,6 +1,10 @@
 package common
 
-import "github.com/stretchr/testify/mock"
+import (
+	"regexp"
+
+	"github.com/stretchr/testify/mock"
+)
 
 type MockBuildTrace struct {
 	mock.Mock
@@ -22,6 +26,12 @@ func (m *MockBuildTrace) Aborted() chan interface{} {
 
 	return r0
 }
+func (m *MockBuildTrace) ScriptStarted() {
+	m.Called()
+}
+func (m *MockBuildTrace) SetCoverageRegex(regex *regexp.Regexp) {
+	m.Called(regex)
+}
 func (m *MockBuildTrace) IsStdout() bool {
 	ret := m.Called()
 
@@ -36,3 +36,13 @@ func (m *MockExecutor) Finish(err error) {
 func (m *MockExecutor) Cleanup() {
 	m.Called()
 }
+func (m *MockExecutor) GetCurrentStage() BuildStage {
+	ret := m.Called()
+
+	r0 := ret.Get(0).(BuildStage)
+
+	return r0
+}
+func (m *MockExecutor) SetCurrentStage(stage BuildStage) {
+	m.Called(stage)
+}
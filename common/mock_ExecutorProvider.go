@@ -20,6 +20,13 @@ func (m *MockExecutorProvider) Create() Executor {
 
 	return r0
 }
+func (m *MockExecutorProvider) GetCapacity(config *RunnerConfig) int {
+	ret := m.Called(config)
+
+	r0 := ret.Int(0)
+
+	return r0
+}
 func (m *MockExecutorProvider) Acquire(config *RunnerConfig) (ExecutorData, error) {
 	ret := m.Called(config)
 
@@ -28,6 +35,9 @@ func (m *MockExecutorProvider) Acquire(config *RunnerConfig) (ExecutorData, erro
 
 	return r0, r1
 }
+func (m *MockExecutorProvider) Shutdown(config *RunnerConfig) {
+	m.Called(config)
+}
 func (m *MockExecutorProvider) Release(config *RunnerConfig, data ExecutorData) error {
 	ret := m.Called(config, data)
 
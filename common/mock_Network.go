@@ -19,7 +19,7 @@ func (m *MockNetwork) GetBuild(config RunnerConfig) (*GetBuildResponse, bool) {
 
 	return r0, r1
 }
-func (m *MockNetwork) RegisterRunner(config RunnerCredentials, description string, tags string) *RegisterRunnerResponse {
+func (m *MockNetwork) RegisterRunner(config RunnerConfig, description string, tags string) *RegisterRunnerResponse {
 	ret := m.Called(config, description, tags)
 
 	var r0 *RegisterRunnerResponse
@@ -36,6 +36,13 @@ func (m *MockNetwork) DeleteRunner(config RunnerCredentials) bool {
 
 	return r0
 }
+func (m *MockNetwork) UpdateRunnerDescription(config RunnerCredentials, id int, apiToken string, description string) bool {
+	ret := m.Called(config, id, apiToken, description)
+
+	r0 := ret.Get(0).(bool)
+
+	return r0
+}
 func (m *MockNetwork) VerifyRunner(config RunnerCredentials) bool {
 	ret := m.Called(config)
 
@@ -43,8 +50,8 @@ func (m *MockNetwork) VerifyRunner(config RunnerCredentials) bool {
 
 	return r0
 }
-func (m *MockNetwork) UpdateBuild(config RunnerConfig, id int, state BuildState, trace *string) UpdateState {
-	ret := m.Called(config, id, state, trace)
+func (m *MockNetwork) UpdateBuild(config RunnerConfig, id int, request UpdateBuildRequest) UpdateState {
+	ret := m.Called(config, id, request)
 
 	r0 := ret.Get(0).(UpdateState)
 
@@ -64,6 +71,13 @@ func (m *MockNetwork) DownloadArtifacts(config BuildCredentials, artifactsFile s
 
 	return r0
 }
+func (m *MockNetwork) DownloadProjectArtifacts(config ProjectArtifactsCredentials, artifactsFile string) DownloadState {
+	ret := m.Called(config, artifactsFile)
+
+	r0 := ret.Get(0).(DownloadState)
+
+	return r0
+}
 func (m *MockNetwork) UploadRawArtifacts(config BuildCredentials, reader io.Reader, baseName string, expireIn string) UploadState {
 	ret := m.Called(config, reader, baseName, expireIn)
 
@@ -71,6 +85,30 @@ func (m *MockNetwork) UploadRawArtifacts(config BuildCredentials, reader io.Read
 
 	return r0
 }
+func (m *MockNetwork) AuthorizeArtifacts(config BuildCredentials, baseName string) *ArtifactsUploadAuthorization {
+	ret := m.Called(config, baseName)
+
+	var r0 *ArtifactsUploadAuthorization
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*ArtifactsUploadAuthorization)
+	}
+
+	return r0
+}
+func (m *MockNetwork) IsArtifactsDirectUploadSupported(config BuildCredentials) bool {
+	ret := m.Called(config)
+
+	r0 := ret.Get(0).(bool)
+
+	return r0
+}
+func (m *MockNetwork) UploadDirectArtifacts(config BuildCredentials, authorization *ArtifactsUploadAuthorization, reader io.Reader, size int64, baseName string, expireIn string) UploadState {
+	ret := m.Called(config, authorization, reader, size, baseName, expireIn)
+
+	r0 := ret.Get(0).(UploadState)
+
+	return r0
+}
 func (m *MockNetwork) UploadArtifacts(config BuildCredentials, artifactsFile string) UploadState {
 	ret := m.Called(config, artifactsFile)
 
@@ -0,0 +1,16 @@
+package common
+
+import "github.com/stretchr/testify/mock"
+
+type MockSecretResolver struct {
+	mock.Mock
+}
+
+func (m *MockSecretResolver) Resolve(build *Build, reference string) (string, error) {
+	ret := m.Called(build, reference)
+
+	r0 := ret.Get(0).(string)
+	r1 := ret.Error(1)
+
+	return r0, r1
+}
@@ -2,6 +2,8 @@ package common
 
 import (
 	"io"
+	"regexp"
+	"time"
 
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/url"
 )
@@ -38,6 +40,7 @@ type FeaturesInfo struct {
 	Services  bool `json:"services"`
 	Artifacts bool `json:"features"`
 	Cache     bool `json:"cache"`
+	Shared    bool `json:"shared"`
 }
 
 type VersionInfo struct {
@@ -89,6 +92,20 @@ type GetBuildResponse struct {
 	Tag             bool           `json:"tag"`
 	DependsOnBuilds []BuildInfo    `json:"depends_on_builds"`
 	TLSCAChain      string         `json:"-"`
+
+	// NodeIndex is the 1-based index of the build among NodeTotal parallel builds of the job
+	NodeIndex int `json:"node_index,omitempty"`
+	NodeTotal int `json:"node_total,omitempty"`
+
+	// SchemaVersion is the version of the payload, UnknownFields are the fields of the newer
+	// version ignored by the runner, see ParseBuildResponse
+	SchemaVersion int      `json:"schema_version,omitempty"`
+	UnknownFields []string `json:"-"`
+}
+
+// IsParallel checks if the build is one of the parallel builds of the job
+func (b *GetBuildResponse) IsParallel() bool {
+	return b.NodeTotal > 1
 }
 
 func (b *GetBuildResponse) RepoCleanURL() (ret string) {
@@ -103,9 +120,16 @@ type RegisterRunnerRequest struct {
 }
 
 type RegisterRunnerResponse struct {
+	ID    int    `json:"id,omitempty"`
 	Token string `json:"token,omitempty"`
 }
 
+// UpdateRunnerRequest changes the description of the runner with the API of GitLab,
+// the API of runners can't change it
+type UpdateRunnerRequest struct {
+	Description string `json:"description"`
+}
+
 type DeleteRunnerRequest struct {
 	Token string `json:"token,omitempty"`
 }
@@ -114,11 +138,23 @@ type VerifyRunnerRequest struct {
 	Token string `json:"token,omitempty"`
 }
 
+// BuildTimings describe the time spent by the build on the runner, in seconds
+type BuildTimings struct {
+	// PrepareDuration is the time between receiving the build and starting its script
+	PrepareDuration float64 `json:"prepare_duration"`
+	// Duration is the time between receiving the build and finishing it
+	Duration float64 `json:"duration"`
+}
+
+// UpdateBuildRequest is the update of the build sent to the coordinator,
+// the runner version and token are filled in by the network
 type UpdateBuildRequest struct {
-	Info  VersionInfo `json:"info,omitempty"`
-	Token string      `json:"token,omitempty"`
-	State BuildState  `json:"state,omitempty"`
-	Trace *string     `json:"trace,omitempty"`
+	Info     VersionInfo   `json:"info,omitempty"`
+	Token    string        `json:"token,omitempty"`
+	State    BuildState    `json:"state,omitempty"`
+	Trace    *string       `json:"trace,omitempty"`
+	Timings  *BuildTimings `json:"timings,omitempty"`
+	Coverage *float64      `json:"coverage,omitempty"`
 }
 
 type BuildCredentials struct {
@@ -126,6 +162,31 @@ type BuildCredentials struct {
 	Token     string `long:"token" env:"CI_BUILD_TOKEN" required:"true" description:"Build token"`
 	URL       string `long:"url" env:"CI_SERVER_URL" required:"true" description:"GitLab CI URL"`
 	TLSCAFile string `long:"tls-ca-file" env:"CI_SERVER_TLS_CA_FILE" description:"File containing the certificates to verify the peer when using HTTPS"`
+
+	RequestSignatures []string `long:"request-signature" description:"The request to GitLab pre-signed by the runner"`
+
+	// ProgressInterval is how often the progress of the download is reported, it's set by the helper
+	ProgressInterval time.Duration
+}
+
+// ProjectArtifactsCredentials are used to download the artifacts
+// of the latest successful job of other project
+type ProjectArtifactsCredentials struct {
+	URL               string
+	Token             string
+	TLSCAFile         string
+	RequestSignatures []string
+	Project           string
+	Ref               string
+	Job               string
+	ProgressInterval  time.Duration
+}
+
+// ArtifactsUploadAuthorization describes where the artifacts can be stored
+// directly, bypassing the coordinator
+type ArtifactsUploadAuthorization struct {
+	RemoteURL    string `json:"remote_url"`
+	RemoteObject string `json:"remote_object_id"`
 }
 
 type BuildTrace interface {
@@ -134,6 +195,8 @@ type BuildTrace interface {
 	Fail(err error)
 	Aborted() chan interface{}
 	IsStdout() bool
+	ScriptStarted()
+	SetCoverageRegex(regex *regexp.Regexp)
 }
 
 type BuildTracePatch interface {
@@ -145,13 +208,18 @@ type BuildTracePatch interface {
 
 type Network interface {
 	GetBuild(config RunnerConfig) (*GetBuildResponse, bool)
-	RegisterRunner(config RunnerCredentials, description, tags string) *RegisterRunnerResponse
+	RegisterRunner(config RunnerConfig, description, tags string) *RegisterRunnerResponse
 	DeleteRunner(config RunnerCredentials) bool
+	UpdateRunnerDescription(config RunnerCredentials, id int, apiToken, description string) bool
 	VerifyRunner(config RunnerCredentials) bool
-	UpdateBuild(config RunnerConfig, id int, state BuildState, trace *string) UpdateState
+	UpdateBuild(config RunnerConfig, id int, request UpdateBuildRequest) UpdateState
 	PatchTrace(config RunnerConfig, buildCredentials *BuildCredentials, tracePart BuildTracePatch) UpdateState
 	DownloadArtifacts(config BuildCredentials, artifactsFile string) DownloadState
+	DownloadProjectArtifacts(config ProjectArtifactsCredentials, artifactsFile string) DownloadState
 	UploadRawArtifacts(config BuildCredentials, reader io.Reader, baseName string, expireIn string) UploadState
 	UploadArtifacts(config BuildCredentials, artifactsFile string) UploadState
+	AuthorizeArtifacts(config BuildCredentials, baseName string) *ArtifactsUploadAuthorization
+	IsArtifactsDirectUploadSupported(config BuildCredentials) bool
+	UploadDirectArtifacts(config BuildCredentials, authorization *ArtifactsUploadAuthorization, reader io.Reader, size int64, baseName string, expireIn string) UploadState
 	ProcessBuild(config RunnerConfig, buildCredentials *BuildCredentials) BuildTrace
 }
@@ -0,0 +1,70 @@
+package common
+
+import (
+	"bytes"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
+)
+
+// The cloud metadata is read only by the templates using it, as it takes time outside of the cloud
+var cloudFieldsRegex = regexp.MustCompile(`\.(InstanceID|Zone)\b`)
+
+// RunnerDescriptionData is available in the templates of the runner description
+type RunnerDescriptionData struct {
+	Hostname   string
+	InstanceID string
+	Zone       string
+	Executor   string
+}
+
+// IsRunnerDescriptionTemplate checks if the description has to be rendered, eg. "runner-{{.Hostname}}"
+func IsRunnerDescriptionTemplate(description string) bool {
+	return strings.Contains(description, "{{")
+}
+
+// RenderRunnerDescription renders the template of the runner description
+func RenderRunnerDescription(text, executor string) (string, error) {
+	tmpl, err := template.New("description").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+
+	data := RunnerDescriptionData{
+		Executor: executor,
+	}
+	data.Hostname, _ = os.Hostname()
+	if cloudFieldsRegex.MatchString(text) {
+		if instance := helpers.DetectCloudInstance(); instance != nil {
+			data.InstanceID = instance.ID
+			data.Zone = instance.Zone
+		}
+	}
+
+	var description bytes.Buffer
+	err = tmpl.Execute(&description, data)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(description.String()), nil
+}
+
+// RefreshName renders the name of the runner again, if it's defined by a template.
+// It returns true if the name changed.
+func (c *RunnerConfig) RefreshName() (bool, error) {
+	if c.NameTemplate == "" {
+		return false, nil
+	}
+
+	name, err := RenderRunnerDescription(c.NameTemplate, c.Executor)
+	if err != nil {
+		return false, err
+	}
+
+	changed := name != c.Name
+	c.Name = name
+	return changed, nil
+}
@@ -0,0 +1,46 @@
+package common
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderRunnerDescription(t *testing.T) {
+	hostname, _ := os.Hostname()
+
+	description, err := RenderRunnerDescription("runner-{{.Hostname}}-{{.Executor}}", "docker")
+	assert.NoError(t, err)
+	assert.Equal(t, "runner-"+hostname+"-docker", description)
+
+	_, err = RenderRunnerDescription("runner-{{.Unknown}}", "docker")
+	assert.Error(t, err)
+
+	_, err = RenderRunnerDescription("runner-{{.Hostname", "docker")
+	assert.Error(t, err)
+}
+
+func TestIsRunnerDescriptionTemplate(t *testing.T) {
+	assert.True(t, IsRunnerDescriptionTemplate("runner-{{.Hostname}}"))
+	assert.False(t, IsRunnerDescriptionTemplate("my runner"))
+}
+
+func TestRunnerConfigRefreshName(t *testing.T) {
+	runner := &RunnerConfig{Name: "static"}
+	changed, err := runner.RefreshName()
+	assert.NoError(t, err)
+	assert.False(t, changed, "the name without template isn't changed")
+	assert.Equal(t, "static", runner.Name)
+
+	runner.NameTemplate = "runner-{{.Executor}}"
+	runner.Executor = "shell"
+	changed, err = runner.RefreshName()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "runner-shell", runner.Name)
+
+	changed, err = runner.RefreshName()
+	assert.NoError(t, err)
+	assert.False(t, changed)
+}
@@ -0,0 +1,135 @@
+package common
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// SecretReferencePrefix marks the value of the build variable as the reference of the secret,
+// eg. secret://vault/secret/deploy#password is resolved by the vault resolver
+const SecretReferencePrefix = "secret://"
+
+// SecretResolver reads the referenced secret from the secret store, eg. Vault or AWS Secrets Manager.
+// The resolvers are compiled in and register themselves, like the executors
+type SecretResolver interface {
+	Resolve(build *Build, reference string) (string, error)
+}
+
+var secretResolvers map[string]SecretResolver
+
+func RegisterSecretResolver(name string, resolver SecretResolver) {
+	log.Debugln("Registering", name, "secret resolver...")
+
+	if secretResolvers == nil {
+		secretResolvers = make(map[string]SecretResolver)
+	}
+	if _, ok := secretResolvers[name]; ok {
+		panic("Secret resolver already exist: " + name)
+	}
+	secretResolvers[name] = resolver
+}
+
+func GetSecretResolver(name string) SecretResolver {
+	if secretResolvers == nil {
+		return nil
+	}
+
+	resolver, _ := secretResolvers[name]
+	return resolver
+}
+
+func GetSecretResolvers() []string {
+	names := []string{}
+	if secretResolvers != nil {
+		for name := range secretResolvers {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// ParseSecretReference splits the value of the variable to the name of the resolver and the reference of the secret
+func ParseSecretReference(value string) (resolver, reference string, ok bool) {
+	if !strings.HasPrefix(value, SecretReferencePrefix) {
+		return "", "", false
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(value, SecretReferencePrefix), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// isAllowedSecretReference checks if the reference matches one of the allowed patterns,
+// the predefined variables of the build are expanded in them, so they can be scoped to the project
+func (b *Build) isAllowedSecretReference(reference string) bool {
+	for _, segment := range strings.Split(reference, "/") {
+		if segment == ".." {
+			return false
+		}
+	}
+
+	variables := b.GetDefaultVariables()
+	for _, pattern := range b.Runner.Secrets.AllowedReferences {
+		if matched, _ := path.Match(variables.ExpandValue(pattern), reference); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveVariableSecrets returns the copy of the variables with the secrets of the resolver resolved,
+// the values referencing the other resolvers and the ones that aren't the references are left as they are
+func (b *Build) resolveVariableSecrets(resolver SecretResolver, variables BuildVariables) (BuildVariables, error) {
+	resolved := make(BuildVariables, 0, len(variables))
+	for _, variable := range variables {
+		name, reference, ok := ParseSecretReference(variable.Value)
+		if ok && name == b.Runner.Secrets.Resolver {
+			if !b.isAllowedSecretReference(reference) {
+				return nil, fmt.Errorf("the secret %q of the variable %s is not allowed for this runner", reference, variable.Key)
+			}
+
+			value, err := resolver.Resolve(b, reference)
+			if err != nil {
+				return nil, fmt.Errorf("resolving the secret of the variable %s: %v", variable.Key, err)
+			}
+
+			variable.Value = value
+			variable.Public = false
+		}
+		resolved = append(resolved, variable)
+	}
+	return resolved, nil
+}
+
+// resolveSecrets replaces the secret references of the build and runner variables with the secrets,
+// only when the resolver is enabled for the runner. The secrets aren't public, so they're masked
+// in the dry run and aren't passed to the services
+func (b *Build) resolveSecrets() error {
+	if b.Runner.Secrets == nil || b.Runner.Secrets.Resolver == "" {
+		return nil
+	}
+
+	resolver := GetSecretResolver(b.Runner.Secrets.Resolver)
+	if resolver == nil {
+		return fmt.Errorf("the secret resolver %q is not supported", b.Runner.Secrets.Resolver)
+	}
+
+	runnerVariables, err := b.resolveVariableSecrets(resolver, b.Runner.GetVariables())
+	if err != nil {
+		return err
+	}
+
+	variables, err := b.resolveVariableSecrets(resolver, b.Variables)
+	if err != nil {
+		return err
+	}
+
+	b.runnerVariables = runnerVariables
+	b.Variables = variables
+	return nil
+}
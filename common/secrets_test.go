@@ -0,0 +1,105 @@
+package common
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSecretReference(t *testing.T) {
+	resolver, reference, ok := ParseSecretReference("secret://vault/secret/deploy#password")
+	assert.True(t, ok)
+	assert.Equal(t, "vault", resolver)
+	assert.Equal(t, "secret/deploy#password", reference)
+
+	invalid := []string{"value", "secret://", "secret://vault", "secret://vault/", "secret:///reference"}
+	for _, value := range invalid {
+		_, _, ok := ParseSecretReference(value)
+		assert.False(t, ok, value)
+	}
+}
+
+func TestGetSecretResolver(t *testing.T) {
+	r := &MockSecretResolver{}
+	RegisterSecretResolver("get-secret-resolver-test", r)
+
+	assert.Equal(t, r, GetSecretResolver("get-secret-resolver-test"))
+	assert.Contains(t, GetSecretResolvers(), "get-secret-resolver-test")
+	assert.Nil(t, GetSecretResolver("unknown"))
+	assert.Panics(t, func() {
+		RegisterSecretResolver("get-secret-resolver-test", r)
+	})
+}
+
+func newSecretsBuild(resolver string, variables BuildVariables) *Build {
+	return &Build{
+		GetBuildResponse: GetBuildResponse{
+			ProjectID: 20,
+			Variables: variables,
+		},
+		Runner: &RunnerConfig{
+			RunnerSettings: RunnerSettings{
+				Secrets: &SecretsConfig{
+					Resolver:          resolver,
+					AllowedReferences: []string{"ci/$CI_PROJECT_ID/*"},
+				},
+			},
+		},
+	}
+}
+
+func TestBuildResolveSecrets(t *testing.T) {
+	r := &MockSecretResolver{}
+	defer r.AssertExpectations(t)
+	RegisterSecretResolver("resolve-secrets-test", r)
+
+	build := newSecretsBuild("resolve-secrets-test", BuildVariables{
+		{Key: "PASSWORD", Value: "secret://resolve-secrets-test/ci/20/deploy#password", Public: true},
+		{Key: "USER", Value: "deploy", Public: true},
+		{Key: "OTHER", Value: "secret://other/ci/20/deploy", Public: true},
+	})
+	build.Runner.Environment = []string{"TOKEN=secret://resolve-secrets-test/ci/20/token"}
+	r.On("Resolve", build, "ci/20/deploy#password").Return("s3cr3t", nil).Once()
+	r.On("Resolve", build, "ci/20/token").Return("t0k3n", nil).Once()
+
+	assert.NoError(t, build.resolveSecrets())
+	assert.Equal(t, "s3cr3t", build.GetAllVariables().Get("PASSWORD"))
+	assert.False(t, build.Variables[0].Public, "the secret isn't passed to the services")
+	assert.Equal(t, BuildVariable{Key: "USER", Value: "deploy", Public: true}, build.Variables[1])
+	assert.Equal(t, "secret://other/ci/20/deploy", build.GetAllVariables().Get("OTHER"), "the other resolvers aren't used")
+	assert.Equal(t, "t0k3n", build.GetAllVariables().Get("TOKEN"), "the runner variables are resolved the same way")
+}
+
+func TestBuildResolveSecretsWithoutResolver(t *testing.T) {
+	variables := BuildVariables{
+		{Key: "VALUE", Value: "secret://vault/ci/20/deploy", Public: true},
+	}
+	build := newSecretsBuild("", variables)
+	assert.NoError(t, build.resolveSecrets())
+	assert.Equal(t, "secret://vault/ci/20/deploy", build.GetAllVariables().Get("VALUE"))
+
+	build.Runner.Secrets = nil
+	assert.NoError(t, build.resolveSecrets(), "the values aren't resolved without the resolver of the runner")
+	assert.Equal(t, "secret://vault/ci/20/deploy", build.GetAllVariables().Get("VALUE"))
+}
+
+func TestBuildResolveSecretsErrors(t *testing.T) {
+	r := &MockSecretResolver{}
+	defer r.AssertExpectations(t)
+	RegisterSecretResolver("resolve-secrets-errors-test", r)
+
+	build := newSecretsBuild("resolve-secrets-errors-test", BuildVariables{
+		{Key: "PASSWORD", Value: "secret://resolve-secrets-errors-test/ci/20/deploy#password"},
+	})
+	r.On("Resolve", build, "ci/20/deploy#password").Return("", errors.New("permission denied")).Once()
+	assert.EqualError(t, build.resolveSecrets(), "resolving the secret of the variable PASSWORD: permission denied")
+
+	for _, reference := range []string{"ci/21/deploy", "ci/20/../21", "deploy"} {
+		build.Variables[0].Value = "secret://resolve-secrets-errors-test/" + reference
+		assert.EqualError(t, build.resolveSecrets(), `the secret "`+reference+`" of the variable PASSWORD is not allowed for this runner`)
+	}
+
+	build.Runner.Secrets.Resolver = "unknown"
+	assert.EqualError(t, build.resolveSecrets(), `the secret resolver "unknown" is not supported`)
+}
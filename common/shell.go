@@ -25,11 +25,14 @@ const (
 type ShellScriptType string
 
 const (
-	ShellPrepareScript   ShellScriptType = "prepare_script"
-	ShellBuildScript                     = "build_script"
-	ShellAfterScript                     = "after_script"
-	ShellArchiveCache                    = "archive_cache"
-	ShellUploadArtifacts                 = "upload_artifacts"
+	ShellGetSources        ShellScriptType = "get_sources"
+	ShellRestoreCache                      = "restore_cache"
+	ShellDownloadArtifacts                 = "download_artifacts"
+	ShellBuildScript                       = "build_script"
+	ShellAfterScript                       = "after_script"
+	ShellArchiveCache                      = "archive_cache"
+	ShellUploadArtifacts                   = "upload_artifacts"
+	ShellCleanupScript                     = "cleanup_script"
 )
 
 func (s *ShellConfiguration) GetCommandWithArguments() []string {
@@ -124,3 +127,17 @@ func GetDefaultShell() string {
 	}
 	panic("no default shell defined")
 }
+
+// shellDetectionOrder is the order of trying the shells, when the shell isn't configured
+var shellDetectionOrder = []string{"bash", "sh", "pwsh", "powershell", "cmd"}
+
+// DetectShell returns the first registered shell which is available on the target,
+// the default shell is tried first. It returns the empty name if there's none
+func DetectShell(available func(shell string) bool) string {
+	for _, name := range append([]string{GetDefaultShell()}, shellDetectionOrder...) {
+		if GetShell(name) != nil && available(name) {
+			return name
+		}
+	}
+	return ""
+}
@@ -3,6 +3,7 @@ package common
 import (
 	"io"
 	"os"
+	"regexp"
 )
 
 type Trace struct {
@@ -30,3 +31,9 @@ func (s *Trace) Aborted() chan interface{} {
 func (s *Trace) IsStdout() bool {
 	return true
 }
+
+func (s *Trace) ScriptStarted() {
+}
+
+func (s *Trace) SetCoverageRegex(regex *regexp.Regexp) {
+}
@@ -0,0 +1,70 @@
+package common
+
+import (
+	"bytes"
+	"sync"
+)
+
+type ansiState int
+
+const (
+	ansiText ansiState = iota
+	ansiEscape
+	ansiSequence
+)
+
+// uncoloredTrace removes the ANSI escape sequences from the trace,
+// the sequence can be split between the writes
+type uncoloredTrace struct {
+	BuildTrace
+
+	state ansiState
+	lock  sync.Mutex
+}
+
+func (t *uncoloredTrace) Write(p []byte) (n int, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var buffer bytes.Buffer
+	for _, c := range p {
+		switch t.state {
+		case ansiText:
+			if c == '\033' {
+				t.state = ansiEscape
+			} else {
+				buffer.WriteByte(c)
+			}
+
+		case ansiEscape:
+			// The control sequence starts with ESC [, other escapes have a single character
+			if c == '[' {
+				t.state = ansiSequence
+			} else {
+				t.state = ansiText
+			}
+
+		case ansiSequence:
+			// The parameters and intermediate bytes are followed by the final byte
+			if c >= 0x40 && c <= 0x7e {
+				t.state = ansiText
+			}
+		}
+	}
+
+	_, err = t.BuildTrace.Write(buffer.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func newUncoloredTrace(trace BuildTrace, disabled bool) BuildTrace {
+	if !disabled {
+		return trace
+	}
+
+	return &uncoloredTrace{
+		BuildTrace: trace,
+	}
+}
@@ -0,0 +1,36 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
+)
+
+func TestUncoloredTrace(t *testing.T) {
+	trace := &Trace{}
+	assert.Equal(t, trace, newUncoloredTrace(trace, false))
+
+	var buffer bytes.Buffer
+	uncolored := newUncoloredTrace(&Trace{Writer: &buffer}, true)
+
+	fmt.Fprint(uncolored, helpers.ANSI_CLEAR+"Running"+helpers.ANSI_RESET+"\n")
+	colored := helpers.ANSI_BOLD_GREEN + "ok\033["
+	n, err := fmt.Fprint(uncolored, colored)
+	assert.NoError(t, err)
+	assert.Equal(t, len(colored), n, "the length of input is returned")
+	fmt.Fprint(uncolored, "0;m done\n")
+
+	assert.Equal(t, "Running\nok done\n", buffer.String())
+}
+
+func TestUncoloredTraceRemovesTimestampColors(t *testing.T) {
+	trace, buffer := newTimestampsTestTrace(TraceTimestampsElapsed)
+	trace.BuildTrace = newUncoloredTrace(trace.BuildTrace, true)
+
+	fmt.Fprint(trace, "line\n")
+	assert.Equal(t, "[01:02:03] line\n", buffer.String())
+}
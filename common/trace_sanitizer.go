@@ -0,0 +1,192 @@
+package common
+
+import (
+	"bytes"
+	"sync"
+	"unicode/utf8"
+)
+
+// The longest escape sequence kept in the trace, the colors are much shorter
+const maxKeptSequenceLength = 32
+
+// The longest string sequence skipped, eg. the terminal title. The trace continues
+// after it, so the unterminated sequence in the binary output doesn't hide the rest of the trace
+const maxSkippedStringLength = 512
+
+type sanitizerState int
+
+const (
+	sanitizerText sanitizerState = iota
+	sanitizerEscape
+	sanitizerSequence
+	sanitizerString
+	sanitizerStringEscape
+)
+
+// sanitizedTrace replaces the invalid UTF-8 with U+FFFD and removes the control characters
+// and the escape sequences moving the cursor or setting the terminal title, as they corrupt
+// the trace in the browser. Only the colors (ESC [ ... m) and the line clearing (ESC [ ... K)
+// are kept. The characters and sequences can be split between the writes.
+type sanitizedTrace struct {
+	BuildTrace
+
+	state    sanitizerState
+	sequence bytes.Buffer
+	skipped  int
+	pending  []byte
+	lock     sync.Mutex
+}
+
+func isKeptSequence(sequence []byte, final byte) bool {
+	if final != 'm' && final != 'K' || len(sequence) > maxKeptSequenceLength {
+		return false
+	}
+	// ESC [ followed only by the numeric parameters
+	for _, c := range sequence[2:] {
+		if (c < '0' || c > '9') && c != ';' {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *sanitizedTrace) writeText(buffer *bytes.Buffer, data []byte) int {
+	c := data[0]
+	switch {
+	case c == '\033':
+		t.state = sanitizerEscape
+		t.sequence.Reset()
+		t.sequence.WriteByte(c)
+
+	case c == '\n' || c == '\r' || c == '\t':
+		buffer.WriteByte(c)
+
+	case c < 0x20 || c == 0x7f:
+		// the other control characters are removed
+
+	case c < utf8.RuneSelf:
+		buffer.WriteByte(c)
+
+	default:
+		r, size := utf8.DecodeRune(data)
+		switch {
+		case r == utf8.RuneError && size == 1:
+			buffer.WriteRune(utf8.RuneError)
+		case r == 0x9b:
+			// the C1 control sequence introducer is the same as ESC [
+			t.state = sanitizerSequence
+			t.sequence.Reset()
+			t.sequence.WriteString("\033[")
+		case r == 0x90 || r == 0x98 || r == 0x9d || r == 0x9e || r == 0x9f:
+			t.state = sanitizerString
+			t.skipped = 0
+		case r >= 0x80 && r < 0xa0:
+			// the other C1 control characters are removed
+		default:
+			buffer.Write(data[:size])
+		}
+		return size
+	}
+	return 1
+}
+
+// process handles the first byte of data and returns how many bytes were consumed,
+// it returns 0 when the byte has to be processed again in the new state
+func (t *sanitizedTrace) process(buffer *bytes.Buffer, data []byte) int {
+	c := data[0]
+	if c >= utf8.RuneSelf && t.state != sanitizerString {
+		// the escape sequences are ASCII, the unfinished one is removed
+		t.state = sanitizerText
+	}
+
+	switch t.state {
+	case sanitizerText:
+		return t.writeText(buffer, data)
+
+	case sanitizerEscape:
+		t.sequence.WriteByte(c)
+		switch {
+		case c == '[':
+			t.state = sanitizerSequence
+		case c == ']' || c == 'P' || c == 'X' || c == '^' || c == '_':
+			// OSC, eg. the title, DCS, SOS, PM and APC are terminated by BEL or ESC \
+			t.state = sanitizerString
+			t.skipped = 0
+		case c >= 0x20 && c <= 0x2f:
+			// the intermediate bytes are followed by the final byte, eg. ESC ( B
+		case c < 0x20:
+			t.state = sanitizerText
+			return 0
+		default:
+			t.state = sanitizerText
+		}
+
+	case sanitizerSequence:
+		switch {
+		case c >= 0x20 && c <= 0x3f:
+			t.sequence.WriteByte(c)
+		case c >= 0x40 && c <= 0x7e:
+			if isKeptSequence(t.sequence.Bytes(), c) {
+				buffer.Write(t.sequence.Bytes())
+				buffer.WriteByte(c)
+			}
+			t.state = sanitizerText
+		default:
+			t.state = sanitizerText
+			return 0
+		}
+
+	case sanitizerString:
+		t.skipped++
+		switch {
+		case c == '\a':
+			t.state = sanitizerText
+		case c == '\033':
+			t.state = sanitizerStringEscape
+		case c == '\n' || t.skipped > maxSkippedStringLength:
+			t.state = sanitizerText
+			return 0
+		}
+
+	case sanitizerStringEscape:
+		if c == '\\' {
+			t.state = sanitizerText
+		} else {
+			t.state = sanitizerEscape
+			t.sequence.Reset()
+			t.sequence.WriteByte('\033')
+			return 0
+		}
+	}
+	return 1
+}
+
+func (t *sanitizedTrace) Write(p []byte) (n int, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	data := append(t.pending, p...)
+	t.pending = nil
+
+	var buffer bytes.Buffer
+	for len(data) > 0 {
+		// the rest of the character is expected with the next write
+		if t.state != sanitizerString && data[0] >= utf8.RuneSelf && !utf8.FullRune(data) {
+			t.pending = append([]byte{}, data...)
+			break
+		}
+		data = data[t.process(&buffer, data):]
+	}
+
+	_, err = t.BuildTrace.Write(buffer.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func newSanitizedTrace(trace BuildTrace) BuildTrace {
+	return &sanitizedTrace{
+		BuildTrace: trace,
+	}
+}
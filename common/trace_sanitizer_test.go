@@ -0,0 +1,55 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
+)
+
+func sanitizeTrace(writes ...string) string {
+	var buffer bytes.Buffer
+	trace := newSanitizedTrace(&Trace{Writer: &buffer})
+	for _, data := range writes {
+		fmt.Fprint(trace, data)
+	}
+	return buffer.String()
+}
+
+func TestSanitizedTraceKeepsColors(t *testing.T) {
+	text := helpers.ANSI_CLEAR + helpers.ANSI_BOLD_GREEN + "Build succeeded" + helpers.ANSI_RESET + "\r\n\tdone ✓\n"
+	assert.Equal(t, text, sanitizeTrace(text))
+}
+
+func TestSanitizedTraceRemovesControlSequences(t *testing.T) {
+	examples := map[string]string{
+		"cursor movement":    "a\033[2Ab\033[10;20Hc",
+		"screen clearing":    "a\033[2Jb\033[?25lc",
+		"terminal title":     "a\033]0;title\007b\033]2;title\033\\c",
+		"terminal reset":     "a\033cb\033(Bc",
+		"control characters": "a\000\007b\b\x7fc",
+		"C1 characters":      "a\u009b2Jb\u009d0;title\u0007\u0085c",
+		"private colors":     "a\033[?1mbc",
+	}
+
+	for name, text := range examples {
+		assert.Equal(t, "abc", sanitizeTrace(text), name)
+	}
+}
+
+func TestSanitizedTraceReplacesInvalidUTF8(t *testing.T) {
+	assert.Equal(t, "a�b��c", sanitizeTrace("a\xffb\xc3\xe2c"))
+}
+
+func TestSanitizedTraceSplitWrites(t *testing.T) {
+	assert.Equal(t, "zażółć", sanitizeTrace("za\xc5", "\xbc\xc3\xb3\xc5", "\x82\xc4\x87"), "the split characters are kept")
+	assert.Equal(t, helpers.ANSI_BOLD_RED+"error\n", sanitizeTrace("\033[31", ";1merror\033]0;ti", "tle\007\n"))
+}
+
+func TestSanitizedTraceUnterminatedSequence(t *testing.T) {
+	assert.Equal(t, "a\nb\n", sanitizeTrace("a\033]0;binary junk\nb\n"), "the title ends with the line")
+	assert.Equal(t, "a\nb", sanitizeTrace("a\033[12\nb"), "the sequence is interrupted by the new line")
+}
@@ -0,0 +1,73 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
+)
+
+// timestampedTrace prefixes each line written to the trace with a timestamp
+type timestampedTrace struct {
+	BuildTrace
+
+	format  TraceTimestamps
+	started time.Time
+	now     func() time.Time
+	midLine bool
+	lock    sync.Mutex
+}
+
+func (t *timestampedTrace) timestamp() string {
+	now := t.now()
+	if t.format == TraceTimestampsRFC3339 {
+		return now.UTC().Format(time.RFC3339) + " "
+	}
+
+	elapsed := now.Sub(t.started) / time.Second
+	return fmt.Sprintf("%s[%02d:%02d:%02d]%s ", helpers.ANSI_BOLD_CYAN,
+		elapsed/3600, elapsed/60%60, elapsed%60, helpers.ANSI_RESET)
+}
+
+func (t *timestampedTrace) Write(p []byte) (n int, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var buffer bytes.Buffer
+	for data := p; len(data) > 0; {
+		if !t.midLine {
+			buffer.WriteString(t.timestamp())
+			t.midLine = true
+		}
+
+		idx := bytes.IndexByte(data, '\n')
+		if idx < 0 {
+			buffer.Write(data)
+			break
+		}
+		buffer.Write(data[0 : idx+1])
+		data = data[idx+1:]
+		t.midLine = false
+	}
+
+	_, err = t.BuildTrace.Write(buffer.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func newTimestampedTrace(trace BuildTrace, format TraceTimestamps) BuildTrace {
+	if format == TraceTimestampsNone {
+		return trace
+	}
+
+	return &timestampedTrace{
+		BuildTrace: trace,
+		format:     format,
+		started:    time.Now(),
+		now:        time.Now,
+	}
+}
@@ -0,0 +1,52 @@
+package common
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTimestampsTestTrace(format TraceTimestamps) (*timestampedTrace, *bytes.Buffer) {
+	var buffer bytes.Buffer
+	started := time.Date(2016, 10, 15, 12, 0, 0, 0, time.UTC)
+	trace := newTimestampedTrace(&Trace{Writer: &buffer}, format).(*timestampedTrace)
+	trace.started = started
+	trace.now = func() time.Time {
+		return started.Add(time.Hour + 2*time.Minute + 3*time.Second)
+	}
+	return trace, &buffer
+}
+
+func TestTraceTimestamps(t *testing.T) {
+	_, err := TraceTimestamps("invalid").Get()
+	assert.Error(t, err)
+
+	format, err := TraceTimestamps("").Get()
+	assert.NoError(t, err)
+	assert.Equal(t, TraceTimestampsNone, format)
+
+	trace := &Trace{}
+	assert.Equal(t, trace, newTimestampedTrace(trace, TraceTimestampsNone))
+}
+
+func TestTraceTimestampsElapsed(t *testing.T) {
+	trace, buffer := newTimestampsTestTrace(TraceTimestampsElapsed)
+
+	fmt.Fprint(trace, "line 1\nline")
+	n, err := fmt.Fprint(trace, " 2\n")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	prefix := "\033[36;1m[01:02:03]\033[0;m "
+	assert.Equal(t, prefix+"line 1\n"+prefix+"line 2\n", buffer.String())
+}
+
+func TestTraceTimestampsRFC3339(t *testing.T) {
+	trace, buffer := newTimestampsTestTrace(TraceTimestampsRFC3339)
+
+	fmt.Fprint(trace, "line 1\n\n")
+	assert.Equal(t, "2016-10-15T13:02:03Z line 1\n2016-10-15T13:02:03Z \n", buffer.String())
+}
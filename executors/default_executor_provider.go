@@ -18,6 +18,10 @@ func (e DefaultExecutorProvider) Create() common.Executor {
 	return e.Creator()
 }
 
+func (e DefaultExecutorProvider) GetCapacity(config *common.RunnerConfig) int {
+	return common.UnlimitedCapacity
+}
+
 func (e DefaultExecutorProvider) Acquire(config *common.RunnerConfig) (common.ExecutorData, error) {
 	return nil, nil
 }
@@ -26,6 +30,9 @@ func (e DefaultExecutorProvider) Release(config *common.RunnerConfig, data commo
 	return nil
 }
 
+func (e DefaultExecutorProvider) Shutdown(config *common.RunnerConfig) {
+}
+
 func (e DefaultExecutorProvider) GetFeatures(features *common.FeaturesInfo) {
 	if e.FeaturesUpdater != nil {
 		e.FeaturesUpdater(features)
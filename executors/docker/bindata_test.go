@@ -15,3 +15,8 @@ func TestPrebuiltARMAssets(t *testing.T) {
 	_, err := Asset("prebuilt-arm" + prebuiltImageExtension)
 	assert.NoError(t, err)
 }
+
+func TestPrebuiltARM64Assets(t *testing.T) {
+	_, err := Asset("prebuilt-arm64" + prebuiltImageExtension)
+	assert.NoError(t, err)
+}
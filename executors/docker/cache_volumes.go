@@ -0,0 +1,87 @@
+package docker
+
+import (
+	"crypto/md5"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/fsouza/go-dockerclient"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	docker_helpers "gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/docker"
+)
+
+var invalidVolumeNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+func cacheVolumeNamePrefix(runner *common.RunnerCredentials) string {
+	return fmt.Sprintf("runner-%s-project-", runner.ShortDescription())
+}
+
+func isCacheVolumeName(runner *common.RunnerCredentials, name string) bool {
+	return strings.HasPrefix(name, cacheVolumeNamePrefix(runner)) &&
+		strings.Contains(name, "-"+cacheVolumeType+"-")
+}
+
+func (s *executor) getCacheVolumesKey() string {
+	key := s.Build.GetAllVariables().ExpandValue(s.Config.Docker.CacheVolumesKey)
+	key = strings.Trim(invalidVolumeNameChars.ReplaceAllString(key, "-"), "-")
+	if key == "" {
+		return "default"
+	}
+	return key
+}
+
+func (s *executor) getCacheVolumeName(key, containerPath string) string {
+	return fmt.Sprintf("%s%d-%s-%s-%x", cacheVolumeNamePrefix(&s.Build.Runner.RunnerCredentials),
+		s.Build.ProjectID, cacheVolumeType, key, md5.Sum([]byte(containerPath)))
+}
+
+// createCacheVolumes mounts the named volumes shared by the builds of the project using the same key
+func (s *executor) createCacheVolumes() error {
+	if len(s.Config.Docker.CacheVolumes) == 0 {
+		return nil
+	}
+
+	key := s.getCacheVolumesKey()
+	for _, containerPath := range s.Config.Docker.CacheVolumes {
+		containerPath = s.getAbsoluteContainerPath(containerPath)
+		name := s.getCacheVolumeName(key, containerPath)
+
+		// The volume is created only when it doesn't exist yet
+		_, err := s.client.CreateVolumeWithLabels(docker.CreateVolumeOptions{
+			Name: name,
+		}, s.getLabels(cacheVolumeType, "cache.dir="+containerPath, "cache.key="+key))
+		if err != nil {
+			return fmt.Errorf("failed to create cache volume for %s: %v", containerPath, err)
+		}
+
+		s.Debugln("Using volume", name, "as cache", containerPath, "...")
+		s.binds = append(s.binds, fmt.Sprintf("%v:%v", name, containerPath))
+	}
+	return nil
+}
+
+// CleanupCacheVolumes removes the cache volumes of the runner, the volumes used by the running builds are left
+func CleanupCacheVolumes(client docker_helpers.Client, runner *common.RunnerCredentials) (removed []string, err error) {
+	volumes, err := client.ListVolumes(docker.ListVolumesOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, volume := range volumes {
+		if !isCacheVolumeName(runner, volume.Name) {
+			continue
+		}
+
+		err := client.RemoveVolume(volume.Name)
+		if err == docker.ErrVolumeInUse {
+			logrus.Warningln("Cache volume", volume.Name, "is in use, skipping")
+			continue
+		} else if err != nil {
+			return removed, err
+		}
+		removed = append(removed, volume.Name)
+	}
+	return removed, nil
+}
@@ -1,7 +1,21 @@
 package docker
 
+import "time"
+
 const DockerAPIVersion = "1.18"
+const DockerMaxAPIVersion = "1.26"
 const dockerLabelPrefix = "com.gitlab.gitlab-runner"
 
 const prebuiltImageName = "gitlab-runner-prebuilt"
 const prebuiltImageExtension = ".tar.xz"
+
+const environmentImageName = "gitlab-runner-environment"
+
+const exitedServiceLogLines = 50
+
+const serviceReadinessRetryInterval = time.Second
+const serviceCommandPollInterval = 100 * time.Millisecond
+
+const cacheVolumeType = "cache-volume"
+
+const dockerAuthConfigVariable = "DOCKER_AUTH_CONFIG"
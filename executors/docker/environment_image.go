@@ -0,0 +1,159 @@
+package docker
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+// getEnvironmentImageTag identifies the image prepared by the script, it changes
+// when the build image is updated or the script is changed
+func getEnvironmentImageTag(image *docker.Image, script string) string {
+	checksum := sha256.Sum256([]byte(image.ID + "\n" + script))
+	return fmt.Sprintf("%x", checksum[:8])
+}
+
+func (s *executor) getEnvironmentScriptTimeout() time.Duration {
+	timeout := s.Config.Docker.EnvironmentTimeout
+	if timeout <= 0 {
+		timeout = common.DefaultEnvironmentScriptTimeout
+	}
+	return time.Duration(timeout) * time.Second
+}
+
+// removeOldEnvironmentImages untags the images prepared before for the same image name,
+// the images still used by the containers of the running builds are kept by Docker
+func (s *executor) removeOldEnvironmentImages(imageName, environmentName string) {
+	images, err := s.client.ListImages(docker.ListImagesOptions{
+		Filters: map[string][]string{
+			"label": {dockerLabelPrefix + ".environment.image=" + imageName},
+		},
+	})
+	if err != nil {
+		s.Debugln("Failed to list the environment images:", err)
+		return
+	}
+
+	for _, image := range images {
+		for _, repoTag := range image.RepoTags {
+			if repoTag == environmentName || !strings.HasPrefix(repoTag, environmentImageName+":") {
+				continue
+			}
+
+			err = s.client.RemoveImage(repoTag)
+			s.Debugln("Removed environment image", repoTag, "with", err)
+		}
+	}
+}
+
+// prepareEnvironmentImage runs the environment script in the container created from the image
+// and commits it. The container doesn't get the variables of the build, so they aren't stored in the image
+func (s *executor) prepareEnvironmentImage(imageName string, image *docker.Image, environmentName, tag string) (*docker.Image, error) {
+	s.Println("Preparing environment image", environmentName, "...")
+
+	containerName := s.Build.ProjectUniqueName() + "-environment"
+	options := docker.CreateContainerOptions{
+		Name: containerName,
+		Config: &docker.Config{
+			Image:        image.ID,
+			Cmd:          s.BuildShell.DockerCommand,
+			Entrypoint:   s.Config.Docker.Entrypoint,
+			Labels:       s.getLabels("environment", "environment.image="+imageName),
+			AttachStdin:  true,
+			AttachStdout: true,
+			AttachStderr: true,
+			OpenStdin:    true,
+			StdinOnce:    true,
+		},
+		HostConfig: &docker.HostConfig{
+			DNS:           s.Config.Docker.DNS,
+			DNSSearch:     s.Config.Docker.DNSSearch,
+			ExtraHosts:    s.Config.Docker.ExtraHosts,
+			NetworkMode:   s.Config.Docker.NetworkMode,
+			RestartPolicy: docker.NeverRestart(),
+			LogConfig: docker.LogConfig{
+				Type: "json-file",
+			},
+		},
+	}
+
+	s.removeContainer(containerName)
+
+	s.Debugln("Creating container", options.Name, "...")
+	container, err := s.client.CreateContainer(options)
+	if container != nil {
+		defer s.removeContainer(container.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// the script is killed when it hangs, eg. waiting for the input
+	timeout := s.getEnvironmentScriptTimeout()
+	abort := make(chan interface{})
+	timer := time.AfterFunc(timeout, func() {
+		s.Warningln("Environment script took longer than", timeout)
+		close(abort)
+	})
+	defer timer.Stop()
+
+	err = s.watchContainer(container, bytes.NewBufferString("set -e\n"+s.Config.Docker.EnvironmentScript), abort)
+	if err != nil {
+		return nil, fmt.Errorf("environment script failed: %v", err)
+	}
+
+	_, err = s.client.CommitContainer(docker.CommitContainerOptions{
+		Container:  container.ID,
+		Repository: environmentImageName,
+		Tag:        tag,
+		Message:    "Prepared by the environment_script of runner " + s.Config.ShortDescription(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.removeOldEnvironmentImages(imageName, environmentName)
+	return s.client.InspectImage(environmentName)
+}
+
+// getEnvironmentImage returns the ID of the image prepared by the environment script of the runner,
+// the script is run only once for each image and the concurrent builds wait for it
+func (s *executor) getEnvironmentImage(imageName string) (string, error) {
+	script := s.Config.Docker.EnvironmentScript
+	if script == "" {
+		return imageName, nil
+	}
+
+	image, err := s.getDockerImage(imageName)
+	if err != nil {
+		return "", err
+	}
+
+	tag := getEnvironmentImageTag(image, script)
+	environmentName := environmentImageName + ":" + tag
+
+	s.Debugln("Looking for environment image", environmentName, "...")
+	environment, err := s.client.InspectImage(environmentName)
+	if err != nil {
+		key := fmt.Sprintf("%s %s", s.Config.Docker.Host, environmentName)
+		wait := func() {
+			s.Println("Waiting for the environment image", environmentName, "prepared by other build...")
+		}
+		environment, err = dockerImagePulls.pull(key, func() (*docker.Image, error) {
+			return s.prepareEnvironmentImage(imageName, image, environmentName, tag)
+		}, wait)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// The build container is created from the ID, so the environment image isn't pulled
+	s.Println("Using environment image", environmentName, "prepared from", imageName)
+	return environment.ID, nil
+}
@@ -0,0 +1,164 @@
+package docker
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/docker"
+)
+
+const environmentTestScript = "apt-get update && apt-get install -y libpq-dev"
+
+func newEnvironmentImageExecutor(c *docker_helpers.MockClient) *executor {
+	e := &executor{client: c}
+	e.Build = &common.Build{
+		Runner: &common.RunnerConfig{},
+	}
+	e.Config.Token = "abcdef1234567890"
+	e.Config.Docker = &common.DockerConfig{
+		PullPolicy:        common.DockerPullPolicyIfNotPresent,
+		EnvironmentScript: environmentTestScript,
+	}
+	e.BuildShell = &common.ShellConfiguration{
+		DockerCommand: []string{"sh"},
+	}
+	e.BuildTrace = &common.Trace{Writer: &bytes.Buffer{}}
+	e.BuildLogger = common.NewBuildLogger(e.BuildTrace, logrus.WithFields(logrus.Fields{}))
+	return e
+}
+
+func TestEnvironmentImageTag(t *testing.T) {
+	image := &docker.Image{ID: "image-id"}
+	tag := getEnvironmentImageTag(image, environmentTestScript)
+	assert.Len(t, tag, 16)
+	assert.Equal(t, tag, getEnvironmentImageTag(image, environmentTestScript))
+	assert.NotEqual(t, tag, getEnvironmentImageTag(image, "npm install -g yarn"), "the changed script prepares new image")
+	assert.NotEqual(t, tag, getEnvironmentImageTag(&docker.Image{ID: "updated-image-id"}, environmentTestScript), "the updated image is prepared again")
+}
+
+func TestEnvironmentImageWithoutScript(t *testing.T) {
+	c := &docker_helpers.MockClient{}
+	defer c.AssertExpectations(t)
+
+	e := newEnvironmentImageExecutor(c)
+	e.Config.Docker.EnvironmentScript = ""
+
+	imageName, err := e.getEnvironmentImage("ruby:2.3")
+	assert.NoError(t, err)
+	assert.Equal(t, "ruby:2.3", imageName)
+}
+
+func TestEnvironmentImageIsReused(t *testing.T) {
+	c := &docker_helpers.MockClient{}
+	defer c.AssertExpectations(t)
+
+	e := newEnvironmentImageExecutor(c)
+	image := &docker.Image{ID: "image-id"}
+	environmentName := environmentImageName + ":" + getEnvironmentImageTag(image, environmentTestScript)
+
+	c.On("InspectImage", "ruby:2.3").Return(image, nil).Once()
+	c.On("InspectImage", environmentName).Return(&docker.Image{ID: "environment-id"}, nil).Once()
+
+	imageName, err := e.getEnvironmentImage("ruby:2.3")
+	assert.NoError(t, err)
+	assert.Equal(t, "environment-id", imageName)
+}
+
+func TestEnvironmentImageIsPrepared(t *testing.T) {
+	c := &docker_helpers.MockClient{}
+	defer c.AssertExpectations(t)
+
+	e := newEnvironmentImageExecutor(c)
+	image := &docker.Image{ID: "image-id"}
+	tag := getEnvironmentImageTag(image, environmentTestScript)
+	container := &docker.Container{ID: "container-id"}
+
+	c.On("InspectImage", "ruby:2.3").Return(image, nil).Once()
+	c.On("InspectImage", environmentImageName+":"+tag).Return(nil, errors.New("no such image")).Once()
+	c.On("RemoveContainer", mock.AnythingOfType("docker.RemoveContainerOptions")).Return(nil).Twice()
+	c.On("CreateContainer", mock.AnythingOfType("docker.CreateContainerOptions")).Return(container, nil).Once()
+	c.On("StartContainer", "container-id", mock.Anything).Return(nil).Once()
+	c.On("AttachToContainer", mock.AnythingOfType("docker.AttachToContainerOptions")).Return(nil).Once()
+	c.On("WaitContainer", "container-id").Return(0, nil).Once()
+	c.On("CommitContainer", mock.AnythingOfType("docker.CommitContainerOptions")).Return(&docker.Image{ID: "environment-id"}, nil).Once()
+	c.On("ListImages", docker.ListImagesOptions{
+		Filters: map[string][]string{
+			"label": {dockerLabelPrefix + ".environment.image=ruby:2.3"},
+		},
+	}).Return([]docker.APIImages{
+		{ID: "environment-id", RepoTags: []string{environmentImageName + ":" + tag}},
+		{ID: "old-environment-id", RepoTags: []string{environmentImageName + ":old-tag", "ruby:custom"}},
+	}, nil).Once()
+	c.On("RemoveImage", environmentImageName+":old-tag").Return(nil).Once()
+	c.On("InspectImage", environmentImageName+":"+tag).Return(&docker.Image{ID: "environment-id"}, nil).Once()
+
+	imageName, err := e.getEnvironmentImage("ruby:2.3")
+	assert.NoError(t, err)
+	assert.Equal(t, "environment-id", imageName)
+}
+
+func TestEnvironmentImageScriptFailure(t *testing.T) {
+	c := &docker_helpers.MockClient{}
+	defer c.AssertExpectations(t)
+
+	e := newEnvironmentImageExecutor(c)
+	image := &docker.Image{ID: "image-id"}
+	tag := getEnvironmentImageTag(image, environmentTestScript)
+	container := &docker.Container{ID: "container-id"}
+
+	c.On("InspectImage", "ruby:2.3").Return(image, nil).Once()
+	c.On("InspectImage", environmentImageName+":"+tag).Return(nil, errors.New("no such image")).Once()
+	c.On("RemoveContainer", mock.AnythingOfType("docker.RemoveContainerOptions")).Return(nil).Twice()
+	c.On("CreateContainer", mock.AnythingOfType("docker.CreateContainerOptions")).Return(container, nil).Once()
+	c.On("StartContainer", "container-id", mock.Anything).Return(nil).Once()
+	c.On("AttachToContainer", mock.AnythingOfType("docker.AttachToContainerOptions")).Return(nil).Once()
+	c.On("WaitContainer", "container-id").Return(100, nil).Once()
+
+	_, err := e.getEnvironmentImage("ruby:2.3")
+	assert.Error(t, err, "the image isn't committed")
+}
+
+// hangingContainerClient runs the container until it's killed
+type hangingContainerClient struct {
+	*docker_helpers.MockClient
+	killed chan bool
+}
+
+func (c *hangingContainerClient) WaitContainer(id string) (int, error) {
+	<-c.killed
+	return 137, nil
+}
+
+func (c *hangingContainerClient) KillContainer(opts docker.KillContainerOptions) error {
+	close(c.killed)
+	return nil
+}
+
+func TestEnvironmentImageScriptTimeout(t *testing.T) {
+	c := &docker_helpers.MockClient{}
+	defer c.AssertExpectations(t)
+
+	e := newEnvironmentImageExecutor(c)
+	e.client = &hangingContainerClient{MockClient: c, killed: make(chan bool)}
+	e.Config.Docker.EnvironmentTimeout = 1
+	image := &docker.Image{ID: "image-id"}
+	tag := getEnvironmentImageTag(image, environmentTestScript)
+	container := &docker.Container{ID: "container-id"}
+
+	c.On("InspectImage", "ruby:2.3").Return(image, nil).Once()
+	c.On("InspectImage", environmentImageName+":"+tag).Return(nil, errors.New("no such image")).Once()
+	c.On("RemoveContainer", mock.AnythingOfType("docker.RemoveContainerOptions")).Return(nil).Twice()
+	c.On("CreateContainer", mock.AnythingOfType("docker.CreateContainerOptions")).Return(container, nil).Once()
+	c.On("StartContainer", "container-id", mock.Anything).Return(nil).Once()
+	c.On("AttachToContainer", mock.AnythingOfType("docker.AttachToContainerOptions")).Return(nil).Once()
+
+	_, err := e.getEnvironmentImage("ruby:2.3")
+	assert.EqualError(t, err, "environment script failed: Aborted")
+}
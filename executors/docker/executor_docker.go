@@ -6,11 +6,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/user"
 	"path"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -25,8 +27,8 @@ import (
 )
 
 type dockerOptions struct {
-	Image    string   `json:"image"`
-	Services []string `json:"services"`
+	Image    common.Image    `json:"image"`
+	Services common.Services `json:"services"`
 }
 
 type executor struct {
@@ -35,6 +37,9 @@ type executor struct {
 	failures    []*docker.Container
 	builds      []*docker.Container
 	services    []*docker.Container
+	readiness   map[string]*common.ServiceReadiness
+	artifacts   map[string]serviceArtifacts
+	buildFailed bool
 	caches      []*docker.Container
 	options     dockerOptions
 	info        *docker.Env
@@ -44,11 +49,69 @@ type executor struct {
 	links       []string
 }
 
+// getContainerIPAddress returns the IPv4 address of the container, or the IPv6 address
+// on the IPv6-only networks. The addresses of the container in the custom network are used
+// when it isn't connected to the default bridge
+func getContainerIPAddress(container *docker.Container) string {
+	settings := container.NetworkSettings
+	if settings == nil {
+		return ""
+	}
+	if settings.IPAddress != "" {
+		return settings.IPAddress
+	}
+	if settings.GlobalIPv6Address != "" {
+		return settings.GlobalIPv6Address
+	}
+
+	names := make([]string, 0, len(settings.Networks))
+	for name := range settings.Networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if network := settings.Networks[name]; network.IPAddress != "" {
+			return network.IPAddress
+		}
+	}
+	for _, name := range names {
+		if network := settings.Networks[name]; network.GlobalIPv6Address != "" {
+			return network.GlobalIPv6Address
+		}
+	}
+	return ""
+}
+
 func (s *executor) getServiceVariables() []string {
 	return s.Build.GetAllVariables().PublicOrInternal().StringList()
 }
 
+// getBuildAuthConfigs reads the credentials from the DOCKER_AUTH_CONFIG variable of the build,
+// so the projects sharing the runner can pull from their private registries
+func (s *executor) getBuildAuthConfigs() (*docker.AuthConfigurations, error) {
+	if s.Build == nil {
+		return nil, nil
+	}
+
+	authConfig := s.Build.Variables.Get(dockerAuthConfigVariable)
+	if authConfig == "" {
+		return nil, nil
+	}
+	return docker.NewAuthConfigurations(strings.NewReader(authConfig))
+}
+
 func (s *executor) getAuthConfig(imageName string) (docker.AuthConfiguration, error) {
+	indexName, _ := docker_helpers.SplitDockerImageName(imageName)
+
+	buildAuthConfigs, err := s.getBuildAuthConfigs()
+	if err != nil {
+		s.Warningln("Cannot parse", dockerAuthConfigVariable, "variable:", err)
+	} else if authConfig := docker_helpers.ResolveDockerAuthConfig(indexName, buildAuthConfigs); authConfig != nil {
+		s.Debugln("Using", authConfig.Username, "from", dockerAuthConfigVariable, "to connect to", authConfig.ServerAddress, "in order to resolve", imageName, "...")
+		return *authConfig, nil
+	}
+
 	homeDir := homedir.Get()
 	if s.Shell().User != "" {
 		u, err := user.Lookup(s.Shell().User)
@@ -61,8 +124,6 @@ func (s *executor) getAuthConfig(imageName string) (docker.AuthConfiguration, er
 		return docker.AuthConfiguration{}, fmt.Errorf("Failed to get home directory")
 	}
 
-	indexName, _ := docker_helpers.SplitDockerImageName(imageName)
-
 	authConfigs, err := docker_helpers.ReadDockerAuthConfigs(homeDir)
 	if err != nil {
 		// ignore doesn't exist errors
@@ -81,8 +142,38 @@ func (s *executor) getAuthConfig(imageName string) (docker.AuthConfiguration, er
 	return docker.AuthConfiguration{}, fmt.Errorf("No credentials found for %v", indexName)
 }
 
-func (s *executor) pullDockerImage(imageName string) (*docker.Image, error) {
-	s.Println("Pulling docker image", imageName, "...")
+// splitImageTag splits the image name to the repository and the tag, ":latest" is used when not specified
+func splitImageTag(imageName string) (string, string) {
+	if i := strings.LastIndex(imageName, ":"); i > strings.LastIndex(imageName, "/") {
+		return imageName[:i], imageName[i+1:]
+	}
+	return imageName, "latest"
+}
+
+// getMirrorImageName returns the name of Docker Hub image in the registry mirror
+func (s *executor) getMirrorImageName(imageName string) string {
+	if s.Config.Docker == nil {
+		return ""
+	}
+
+	mirror := strings.TrimSuffix(s.Config.Docker.RegistryMirror, "/")
+	if mirror == "" || strings.Contains(imageName, "@") {
+		return ""
+	}
+
+	indexName, remoteName := docker_helpers.SplitDockerImageName(imageName)
+	if indexName != docker_helpers.DefaultDockerRegistry {
+		return ""
+	}
+
+	// the official images are stored in library/
+	if !strings.Contains(remoteName, "/") {
+		remoteName = "library/" + remoteName
+	}
+	return mirror + "/" + remoteName
+}
+
+func (s *executor) pullImage(imageName string) error {
 	authConfig, err := s.getAuthConfig(imageName)
 	if err != nil {
 		s.Debugln(err)
@@ -97,7 +188,45 @@ func (s *executor) pullDockerImage(imageName string) (*docker.Image, error) {
 		pullImageOptions.Repository += ":latest"
 	}
 
-	err = s.client.PullImage(pullImageOptions, authConfig)
+	return s.client.PullImage(pullImageOptions, authConfig)
+}
+
+func (s *executor) pullMirrorImage(imageName, mirrorImageName string) error {
+	err := s.pullImage(mirrorImageName)
+	if err != nil {
+		return err
+	}
+
+	// tag the image with the original name, so it can be found by the next builds
+	repository, tag := splitImageTag(imageName)
+	mirrorRepository, mirrorTag := splitImageTag(mirrorImageName)
+	return s.client.TagImage(mirrorRepository+":"+mirrorTag, docker.TagImageOptions{
+		Repo:  repository,
+		Tag:   tag,
+		Force: true,
+	})
+}
+
+// isPullFromDockerHub checks if the image would be pulled from Docker Hub, which isn't accessible in the offline mode
+func (s *executor) isPullFromDockerHub(imageName string) bool {
+	indexName, _ := docker_helpers.SplitDockerImageName(imageName)
+	return indexName == docker_helpers.DefaultDockerRegistry && s.getMirrorImageName(imageName) == ""
+}
+
+func (s *executor) pullDockerImage(imageName string) (*docker.Image, error) {
+	s.Println("Pulling docker image", imageName, "...")
+
+	if mirrorImageName := s.getMirrorImageName(imageName); mirrorImageName != "" {
+		err := s.pullMirrorImage(imageName, mirrorImageName)
+		if err == nil {
+			return s.client.InspectImage(imageName)
+		} else if s.Config.Offline {
+			return nil, fmt.Errorf("cannot pull %s from registry mirror in the offline mode: %v", imageName, err)
+		}
+		s.Warningln("Cannot pull", imageName, "from registry mirror:", err)
+	}
+
+	err := s.pullImage(imageName)
 	if err != nil {
 		return nil, err
 	}
@@ -106,6 +235,20 @@ func (s *executor) pullDockerImage(imageName string) (*docker.Image, error) {
 	return image, err
 }
 
+// pullDockerImageOnce waits for the pull of the image started by other build on the same Docker daemon,
+// the builds share the pull only when they use the same credentials
+func (s *executor) pullDockerImageOnce(imageName string) (*docker.Image, error) {
+	authConfig, _ := s.getAuthConfig(imageName)
+	credentials := md5.Sum([]byte(fmt.Sprintf("%#v", authConfig)))
+	key := fmt.Sprintf("%s %s %x", s.Config.Docker.Host, imageName, credentials)
+	wait := func() {
+		s.Println("Waiting for the pull of docker image", imageName, "started by other build...")
+	}
+	return dockerImagePulls.pull(key, func() (*docker.Image, error) {
+		return s.pullDockerImage(imageName)
+	}, wait)
+}
+
 func (s *executor) getDockerImage(imageName string) (*docker.Image, error) {
 	pullPolicy, err := s.Config.Docker.PullPolicy.Get()
 	if err != nil {
@@ -120,6 +263,14 @@ func (s *executor) getDockerImage(imageName string) (*docker.Image, error) {
 		return image, err
 	}
 
+	if s.Config.Offline && s.isPullFromDockerHub(imageName) {
+		if err != nil {
+			return nil, fmt.Errorf("image %s isn't present locally and it can't be pulled from Docker Hub "+
+				"in the offline mode: load it with 'docker load' or set the registry_mirror", imageName)
+		}
+		return image, nil
+	}
+
 	if err == nil {
 		// Don't pull image that is passed by ID
 		if image.ID == imageName {
@@ -132,7 +283,7 @@ func (s *executor) getDockerImage(imageName string) (*docker.Image, error) {
 		}
 	}
 
-	newImage, err := s.pullDockerImage(imageName)
+	newImage, err := s.pullDockerImageOnce(imageName)
 	if err != nil {
 		if image != nil {
 			s.Warningln("Cannot pull the latest version of image", imageName, ":", err)
@@ -147,8 +298,10 @@ func (s *executor) getDockerImage(imageName string) (*docker.Image, error) {
 func (s *executor) getArchitecture() string {
 	architecture := s.info.Get("Architecture")
 	switch architecture {
-	case "armv7l", "aarch64":
+	case "armv6l", "armv7l":
 		architecture = "arm"
+	case "aarch64":
+		architecture = "arm64"
 	case "amd64":
 		architecture = "x86_64"
 	}
@@ -165,7 +318,28 @@ func (s *executor) getArchitecture() string {
 	}
 }
 
+// getPrebuiltImageData reads the helper image from the configured archive,
+// or from the one embedded in the binary
+func (s *executor) getPrebuiltImageData(architecture string) ([]byte, error) {
+	if fileName := s.Config.Docker.HelperImageFile; fileName != "" {
+		s.Debugln("Reading prebuilt image from", fileName, "...")
+		return ioutil.ReadFile(fileName)
+	}
+
+	data, err := Asset("prebuilt-" + architecture + prebuiltImageExtension)
+	if err != nil {
+		return nil, fmt.Errorf("Unsupported architecture: %s: %q, "+
+			"use helper_image or helper_image_file to specify the helper image", architecture, err.Error())
+	}
+	return data, nil
+}
+
 func (s *executor) getPrebuiltImage() (image *docker.Image, err error) {
+	// The configured helper image is pulled like the other images
+	if s.Config.Docker.HelperImage != "" {
+		return s.getDockerImage(s.Config.Docker.HelperImage)
+	}
+
 	architecture := s.getArchitecture()
 	if architecture == "" {
 		return nil, errors.New("unsupported docker architecture")
@@ -178,9 +352,9 @@ func (s *executor) getPrebuiltImage() (image *docker.Image, err error) {
 		return
 	}
 
-	data, err := Asset("prebuilt-" + architecture + prebuiltImageExtension)
+	data, err := s.getPrebuiltImageData(architecture)
 	if err != nil {
-		return nil, fmt.Errorf("Unsupported architecture: %s: %q", architecture, err.Error())
+		return nil, err
 	}
 
 	s.Debugln("Loading prebuilt image...")
@@ -213,11 +387,13 @@ func (s *executor) addHostVolume(hostPath, containerPath string) error {
 
 func (s *executor) getLabels(containerType string, otherLabels ...string) map[string]string {
 	labels := make(map[string]string)
+	labels[dockerLabelPrefix+".managed"] = "true"
 	labels[dockerLabelPrefix+".build.id"] = strconv.Itoa(s.Build.ID)
 	labels[dockerLabelPrefix+".build.sha"] = s.Build.Sha
 	labels[dockerLabelPrefix+".build.before_sha"] = s.Build.BeforeSha
 	labels[dockerLabelPrefix+".build.ref_name"] = s.Build.RefName
 	labels[dockerLabelPrefix+".project.id"] = strconv.Itoa(s.Build.ProjectID)
+	labels[dockerLabelPrefix+".project.runner_id"] = strconv.Itoa(s.Build.ProjectRunnerID)
 	labels[dockerLabelPrefix+".runner.id"] = s.Build.Runner.ShortDescription()
 	labels[dockerLabelPrefix+".runner.local_id"] = strconv.Itoa(s.Build.RunnerID)
 	labels[dockerLabelPrefix+".type"] = containerType
@@ -389,6 +565,8 @@ func (s *executor) createUserVolumes() (err error) {
 			return
 		}
 	}
+
+	s.volumesFrom = append(s.volumesFrom, s.Config.Docker.VolumesFrom...)
 	return nil
 }
 
@@ -485,7 +663,7 @@ func (s *executor) splitServiceAndVersion(serviceDescription string) (service st
 	return
 }
 
-func (s *executor) createService(service, version string) (*docker.Container, error) {
+func (s *executor) createService(service, version string, definition common.Service) (*docker.Container, error) {
 	if len(service) == 0 {
 		return nil, errors.New("invalid service name")
 	}
@@ -495,7 +673,12 @@ func (s *executor) createService(service, version string) (*docker.Container, er
 		return nil, err
 	}
 
-	containerName := s.Build.ProjectUniqueName() + "-" + strings.Replace(service, "/", "__", -1)
+	// the alias allows to run many instances of the same service
+	serviceName := strings.Replace(service, "/", "__", -1)
+	if definition.Alias != "" {
+		serviceName = definition.Alias
+	}
+	containerName := s.Build.ProjectUniqueName() + "-" + serviceName
 
 	// this will fail potentially some builds if there's name collision
 	s.removeContainer(containerName)
@@ -504,11 +687,16 @@ func (s *executor) createService(service, version string) (*docker.Container, er
 	createContainerOpts := docker.CreateContainerOptions{
 		Name: containerName,
 		Config: &docker.Config{
-			Image:  serviceImage.ID,
-			Labels: s.getLabels("service", "service="+service, "service.version="+version),
-			Env:    s.getServiceVariables(),
+			Image:      serviceImage.ID,
+			Labels:     s.getLabels("service", "service="+service, "service.version="+version),
+			Env:        s.getServiceVariables(),
+			Cmd:        definition.Command,
+			Entrypoint: definition.Entrypoint,
 		},
 		HostConfig: &docker.HostConfig{
+			DNS:           s.Config.Docker.DNS,
+			DNSSearch:     s.Config.Docker.DNSSearch,
+			ExtraHosts:    s.Config.Docker.ExtraHosts,
 			RestartPolicy: docker.NeverRestart(),
 			Privileged:    s.Config.Docker.Privileged,
 			NetworkMode:   s.Config.Docker.NetworkMode,
@@ -521,7 +709,9 @@ func (s *executor) createService(service, version string) (*docker.Container, er
 	}
 
 	s.Debugln("Creating service container", createContainerOpts.Name, "...")
-	container, err := s.client.CreateContainer(createContainerOpts)
+	container, err := s.client.CreateContainerExtended(createContainerOpts, docker_helpers.HostConfigExtension{
+		Tmpfs: s.Config.Docker.ServicesTmpfs,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -536,12 +726,12 @@ func (s *executor) createService(service, version string) (*docker.Container, er
 	return container, nil
 }
 
-func (s *executor) getServiceNames() ([]string, error) {
-	services := s.Config.Docker.Services
+func (s *executor) getServices() (common.Services, error) {
+	services := common.NewServices(s.Config.Docker.Services...)
 
 	for _, service := range s.options.Services {
-		service = s.Build.GetAllVariables().ExpandValue(service)
-		err := s.verifyAllowedImage(service, "services", s.Config.Docker.AllowedServices, s.Config.Docker.Services)
+		service.Name = s.Build.GetAllVariables().ExpandValue(service.Name)
+		err := s.verifyAllowedImage(service.Name, "services", s.Config.Docker.AllowedServices, s.Config.Docker.Services)
 		if err != nil {
 			return nil, err
 		}
@@ -552,28 +742,45 @@ func (s *executor) getServiceNames() ([]string, error) {
 	return services, nil
 }
 
-func (s *executor) waitForServices() {
+// getServiceTimeout returns how long to wait for the service,
+// the readiness check defined by the build is done even if waiting is disabled
+func (s *executor) getServiceTimeout(readiness *common.ServiceReadiness) time.Duration {
 	waitForServicesTimeout := s.Config.Docker.WaitForServicesTimeout
-	if waitForServicesTimeout == 0 {
+	if readiness != nil && readiness.Timeout > 0 {
+		waitForServicesTimeout = readiness.Timeout
+	} else if waitForServicesTimeout == 0 || (waitForServicesTimeout < 0 && readiness != nil) {
 		waitForServicesTimeout = common.DefaultWaitForServicesTimeout
 	}
+	return time.Duration(waitForServicesTimeout) * time.Second
+}
 
+func (s *executor) waitForServices() {
 	// wait for all services to came up
-	if waitForServicesTimeout > 0 && len(s.services) > 0 {
-		s.Println("Waiting for services to be up and running...")
-		wg := sync.WaitGroup{}
-		for _, service := range s.services {
-			wg.Add(1)
-			go func(service *docker.Container) {
-				s.waitForServiceContainer(service, time.Duration(waitForServicesTimeout)*time.Second)
-				wg.Done()
-			}(service)
+	wg := sync.WaitGroup{}
+	waiting := false
+	for _, service := range s.services {
+		readiness := s.readiness[service.ID]
+		timeout := s.getServiceTimeout(readiness)
+		if timeout <= 0 {
+			continue
+		}
+
+		if !waiting {
+			s.Println("Waiting for services to be up and running...")
+			waiting = true
 		}
-		wg.Wait()
+
+		wg.Add(1)
+		go func(service *docker.Container) {
+			s.waitForServiceContainer(service, readiness, timeout)
+			wg.Done()
+		}(service)
 	}
+	wg.Wait()
 }
 
 func (s *executor) buildServiceLinks(linksMap map[string]*docker.Container) (links []string) {
+	exited := make(map[string]bool)
 	for linkName, container := range linksMap {
 		newContainer, err := s.client.InspectContainer(container.ID)
 		if err != nil {
@@ -581,30 +788,74 @@ func (s *executor) buildServiceLinks(linksMap map[string]*docker.Container) (lin
 		}
 		if newContainer.State.Running {
 			links = append(links, container.ID+":"+linkName)
+		} else if !exited[container.ID] {
+			exited[container.ID] = true
+			s.writeExitedServiceLogs(newContainer)
 		}
 	}
 	return
 }
 
-func (s *executor) createFromServiceDescription(description string, linksMap map[string]*docker.Container) (err error) {
+// writeExitedServiceLogs explains why the service isn't linked to the build,
+// together with the last lines of its log
+func (s *executor) writeExitedServiceLogs(container *docker.Container) {
+	var buffer bytes.Buffer
+	buffer.WriteString("\n")
+	buffer.WriteString(fmt.Sprintf("%s*** ERROR:%s Service %s exited with code %d before the build started, it will not be linked.\n",
+		helpers.ANSI_BOLD_RED, helpers.ANSI_RESET, container.Name, container.State.ExitCode))
+	buffer.WriteString("\n")
+
+	containerLog, err := s.getContainerLogs(container.ID, strconv.Itoa(exitedServiceLogLines))
+	if err != nil {
+		buffer.WriteString(strings.TrimSpace(err.Error()) + "\n")
+	} else if containerLog = strings.TrimSpace(containerLog); containerLog != "" {
+		buffer.WriteString(fmt.Sprintf("The last %d lines of its log:\n", exitedServiceLogLines))
+		buffer.WriteString(containerLog + "\n")
+	}
+
+	buffer.WriteString("\n")
+	buffer.WriteString(helpers.ANSI_BOLD_RED + "*********" + helpers.ANSI_RESET + "\n")
+	buffer.WriteString("\n")
+	io.Copy(s.BuildTrace, &buffer)
+}
+
+func (s *executor) createFromServiceDescription(definition common.Service, linksMap map[string]*docker.Container) (err error) {
 	var container *docker.Container
 
-	service, version, linkNames := s.splitServiceAndVersion(description)
+	service, version, linkNames := s.splitServiceAndVersion(definition.Name)
+	if definition.Alias != "" {
+		linkNames = []string{definition.Alias}
+	}
 
 	for _, linkName := range linkNames {
 		if linksMap[linkName] != nil {
-			s.Warningln("Service", description, "is already created. Ignoring.")
+			s.Warningln("Service", definition.Name, "is already created as", linkName+". Ignoring.")
 			continue
 		}
 
 		// Create service if not yet created
 		if container == nil {
-			container, err = s.createService(service, version)
+			container, err = s.createService(service, version, definition)
 			if err != nil {
 				return
 			}
-			s.Debugln("Created service", description, "as", container.ID)
+			s.Debugln("Created service", definition.Name, "as", container.ID)
 			s.services = append(s.services, container)
+			if definition.Readiness != nil {
+				if s.readiness == nil {
+					s.readiness = make(map[string]*common.ServiceReadiness)
+				}
+				s.readiness[container.ID] = definition.Readiness
+			}
+			if len(definition.Artifacts) > 0 {
+				if s.artifacts == nil {
+					s.artifacts = make(map[string]serviceArtifacts)
+				}
+				s.artifacts[container.ID] = serviceArtifacts{
+					alias: linkName,
+					paths: definition.Artifacts,
+				}
+			}
 		}
 		linksMap[linkName] = container
 	}
@@ -612,15 +863,15 @@ func (s *executor) createFromServiceDescription(description string, linksMap map
 }
 
 func (s *executor) createServices() (err error) {
-	serviceNames, err := s.getServiceNames()
+	services, err := s.getServices()
 	if err != nil {
 		return
 	}
 
 	linksMap := make(map[string]*docker.Container)
 
-	for _, serviceDescription := range serviceNames {
-		err = s.createFromServiceDescription(serviceDescription, linksMap)
+	for _, service := range services {
+		err = s.createFromServiceDescription(service, linksMap)
 		if err != nil {
 			return
 		}
@@ -632,16 +883,63 @@ func (s *executor) createServices() (err error) {
 	return
 }
 
-func (s *executor) createContainer(containerType, imageName string, cmd []string) (container *docker.Container, err error) {
+// getHostname returns the hostname of the build and predefined containers
+func (s *executor) getHostname() string {
+	if s.Config.Docker.Hostname != "" {
+		return s.Config.Docker.Hostname
+	}
+	return s.Build.UniqueHostname()
+}
+
+// getCACertificates returns the CA bundle of the host extended with the certificates
+// of the GitLab server, as the images usually don't trust the internal CAs.
+// It replaces the trust store of the image, so it's passed only when it's enabled
+func (s *executor) getCACertificates() string {
+	if !s.Config.Docker.CACertificates {
+		return ""
+	}
+
+	certificates := helpers.SystemCertificates()
+	if s.Build.TLSCAChain != "" {
+		if certificates != "" && !strings.HasSuffix(certificates, "\n") {
+			certificates += "\n"
+		}
+		certificates += s.Build.TLSCAChain
+	}
+	return certificates
+}
+
+// getBuildEntrypoint returns the entrypoint of the build container,
+// the one defined by the build takes precedence over the configured one
+func (s *executor) getBuildEntrypoint() []string {
+	if s.options.Image.Entrypoint != nil {
+		return s.options.Image.Entrypoint
+	}
+	return s.Config.Docker.Entrypoint
+}
+
+// getBuildCommand returns the command of the build container, which reads the build script
+// from the standard input, the one defined by the build takes precedence over the configured one
+func (s *executor) getBuildCommand() []string {
+	if s.options.Image.Command != nil {
+		return s.options.Image.Command
+	}
+	if s.Config.Docker.Command != nil {
+		return s.Config.Docker.Command
+	}
+	return s.BuildShell.DockerCommand
+}
+
+func (s *executor) createContainer(containerType, imageName string, cmd, entrypoint []string) (container *docker.Container, err error) {
 	// Fetch image
 	image, err := s.getDockerImage(imageName)
 	if err != nil {
 		return nil, err
 	}
 
-	hostname := s.Config.Docker.Hostname
+	hostname := s.Build.BuildHostname
 	if hostname == "" {
-		hostname = s.Build.ProjectUniqueName()
+		hostname = s.getHostname()
 	}
 
 	containerName := s.Build.ProjectUniqueName() + "-" + containerType
@@ -652,6 +950,7 @@ func (s *executor) createContainer(containerType, imageName string, cmd []string
 			Image:        image.ID,
 			Hostname:     hostname,
 			Cmd:          cmd,
+			Entrypoint:   entrypoint,
 			Labels:       s.getLabels(containerType),
 			Tty:          false,
 			AttachStdin:  true,
@@ -686,7 +985,10 @@ func (s *executor) createContainer(containerType, imageName string, cmd []string
 	s.removeContainer(containerName)
 
 	s.Debugln("Creating container", options.Name, "...")
-	container, err = s.client.CreateContainer(options)
+	container, err = s.client.CreateContainerExtended(options, docker_helpers.HostConfigExtension{
+		Tmpfs:   s.Config.Docker.Tmpfs,
+		Runtime: s.Config.Docker.Runtime,
+	})
 	if err != nil {
 		if container != nil {
 			s.failures = append(s.failures, container)
@@ -750,7 +1052,8 @@ func (s *executor) watchContainer(container *docker.Container, input io.Reader,
 		if err == nil {
 			if exitCode != 0 {
 				err = &common.BuildError{
-					Inner: fmt.Errorf("exit code %d", exitCode),
+					Inner:    fmt.Errorf("exit code %d", exitCode),
+					ExitCode: exitCode,
 				}
 			}
 		}
@@ -810,9 +1113,9 @@ func (s *executor) verifyAllowedImage(image, optionName string, allowedImages []
 }
 
 func (s *executor) getImageName() (string, error) {
-	if s.options.Image != "" {
-		image := s.Build.GetAllVariables().ExpandValue(s.options.Image)
-		err := s.verifyAllowedImage(s.options.Image, "images", s.Config.Docker.AllowedImages, []string{s.Config.Docker.Image})
+	if s.options.Image.Name != "" {
+		image := s.Build.GetAllVariables().ExpandValue(s.options.Image.Name)
+		err := s.verifyAllowedImage(image, "images", s.Config.Docker.AllowedImages, []string{s.Config.Docker.Image})
 		if err != nil {
 			return "", err
 		}
@@ -827,7 +1130,7 @@ func (s *executor) getImageName() (string, error) {
 }
 
 func (s *executor) connectDocker() (err error) {
-	client, err := docker_helpers.New(s.Config.Docker.DockerCredentials, DockerAPIVersion)
+	client, err := docker_helpers.NewNegotiated(s.Config.Docker.DockerCredentials, DockerAPIVersion, DockerMaxAPIVersion)
 	if err != nil {
 		return err
 	}
@@ -865,6 +1168,12 @@ func (s *executor) createDependencies() (err error) {
 		return err
 	}
 
+	s.Debugln("Creating cache volumes...")
+	err = s.createCacheVolumes()
+	if err != nil {
+		return err
+	}
+
 	return
 }
 
@@ -892,6 +1201,9 @@ func (s *executor) Prepare(globalConfig *common.Config, config *common.RunnerCon
 		return err
 	}
 
+	build.BuildHostname = s.getHostname()
+	build.CACertificates = s.getCACertificates()
+
 	imageName, err := s.getImageName()
 	if err != nil {
 		return err
@@ -952,13 +1264,85 @@ func (s *executor) Cleanup() {
 	wg.Wait()
 
 	if s.client != nil {
+		err := s.cleanupBuildsDir()
+		if err != nil {
+			s.Warningln("Failed to remove the build directory:", err)
+		}
 		docker_helpers.Close(s.client)
 	}
 
 	s.AbstractExecutor.Cleanup()
 }
 
-func (s *executor) runServiceHealthCheckContainer(container *docker.Container, timeout time.Duration) error {
+// cleanupBuildsDir removes the build directory shared with the host, as root inside the container,
+// because the files created in the build container can't be removed by the user running the shell builds
+func (s *executor) cleanupBuildsDir() error {
+	if s.Config.Docker == nil || !s.Config.Docker.CleanupBuildsDir || !s.SharedBuildsDir {
+		return nil
+	}
+	if s.Build == nil || s.Build.BuildDir == "" {
+		return nil
+	}
+
+	cleanupImage, err := s.getPrebuiltImage()
+	if err != nil {
+		return err
+	}
+
+	projectDir := s.Build.FullProjectDir()
+	cleanupContainerOpts := docker.CreateContainerOptions{
+		Config: &docker.Config{
+			Cmd:    []string{"gitlab-runner-helper", "fs-cleanup", "--path", projectDir},
+			Image:  cleanupImage.ID,
+			User:   "root",
+			Labels: s.getLabels("cleanup", "cleanup.dir="+projectDir),
+		},
+		HostConfig: &docker.HostConfig{
+			RestartPolicy: docker.NeverRestart(),
+			Binds:         s.binds,
+			LogConfig: docker.LogConfig{
+				Type: "json-file",
+			},
+		},
+	}
+
+	s.Debugln("Removing build directory", projectDir, "...")
+	cleanupContainer, err := s.client.CreateContainer(cleanupContainerOpts)
+	if err != nil {
+		return err
+	}
+	defer s.removeContainer(cleanupContainer.ID)
+
+	err = s.client.StartContainer(cleanupContainer.ID, nil)
+	if err != nil {
+		return err
+	}
+
+	statusCode, err := s.client.WaitContainer(cleanupContainer.ID)
+	if err == nil && statusCode != 0 {
+		err = fmt.Errorf("cleanup container for %s returned %d", projectDir, statusCode)
+	}
+	return err
+}
+
+// getHealthCheckCommand returns the command checking the port of the service,
+// by default the first port exposed by the service is checked
+func getHealthCheckCommand(container *docker.Container, readiness *common.ServiceReadiness) []string {
+	cmd := []string{"gitlab-runner-helper", "health-check"}
+	if readiness == nil || (readiness.Port == 0 && readiness.Path == "") {
+		return cmd
+	}
+
+	if readiness.Port != 0 {
+		cmd = append(cmd, "--host", container.Name, "--port", strconv.Itoa(readiness.Port))
+	}
+	if readiness.Path != "" {
+		cmd = append(cmd, "--path", readiness.Path)
+	}
+	return cmd
+}
+
+func (s *executor) runServiceHealthCheckContainer(container *docker.Container, cmd []string, timeout time.Duration) error {
 	waitImage, err := s.getPrebuiltImage()
 	if err != nil {
 		return err
@@ -967,7 +1351,7 @@ func (s *executor) runServiceHealthCheckContainer(container *docker.Container, t
 	waitContainerOpts := docker.CreateContainerOptions{
 		Name: container.Name + "-wait-for-service",
 		Config: &docker.Config{
-			Cmd:    []string{"gitlab-runner-service"},
+			Cmd:    cmd,
 			Image:  waitImage.ID,
 			Labels: s.getLabels("wait", "wait="+container.ID),
 		},
@@ -1009,8 +1393,105 @@ func (s *executor) runServiceHealthCheckContainer(container *docker.Container, t
 	}
 }
 
-func (s *executor) waitForServiceContainer(container *docker.Container, timeout time.Duration) error {
-	err := s.runServiceHealthCheckContainer(container, timeout)
+func (s *executor) getContainerLogs(id, tail string) (string, error) {
+	var containerBuffer bytes.Buffer
+
+	err := s.client.Logs(docker.LogsOptions{
+		Container:    id,
+		OutputStream: &containerBuffer,
+		ErrorStream:  &containerBuffer,
+		Stdout:       true,
+		Stderr:       true,
+		Timestamps:   true,
+		Tail:         tail,
+	})
+	return containerBuffer.String(), err
+}
+
+// runServiceCommand executes the command in the service container and returns its exit code.
+// The command is started in background, so it's not waited for anymore when stop is closed
+func (s *executor) runServiceCommand(container *docker.Container, cmd []string, stop chan bool) (int, error) {
+	exec, err := s.client.CreateExec(docker.CreateExecOptions{
+		Container: container.ID,
+		Cmd:       cmd,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.client.StartExec(exec.ID, docker.StartExecOptions{
+		Detach: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		inspect, err := s.client.InspectExec(exec.ID)
+		if err != nil {
+			return 0, err
+		}
+		if !inspect.Running {
+			return inspect.ExitCode, nil
+		}
+
+		select {
+		case <-stop:
+			return 0, errors.New("the readiness command was stopped")
+		case <-time.After(serviceCommandPollInterval):
+		}
+	}
+}
+
+// waitForServiceCommand repeats the readiness command of the service until it succeeds
+func (s *executor) waitForServiceCommand(container *docker.Container, cmd []string, timeout time.Duration) error {
+	s.Debugln("Waiting for the readiness command of service container", container.Name, "...")
+
+	waitResult := make(chan error, 1)
+	stop := make(chan bool)
+	defer close(stop)
+
+	go func() {
+		for {
+			exitCode, err := s.runServiceCommand(container, cmd, stop)
+			if err == nil && exitCode == 0 {
+				waitResult <- nil
+				return
+			}
+
+			select {
+			case <-stop:
+				return
+			case <-time.After(serviceReadinessRetryInterval):
+			}
+		}
+	}()
+
+	select {
+	case err := <-waitResult:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("service %v did timeout, the readiness command %q didn't succeed", container.Name, cmd)
+	}
+}
+
+func (s *executor) checkServiceReadiness(container *docker.Container, readiness *common.ServiceReadiness, timeout time.Duration) error {
+	started := time.Now()
+	if readiness == nil || readiness.Port != 0 || readiness.Path != "" || len(readiness.Command) == 0 {
+		err := s.runServiceHealthCheckContainer(container, getHealthCheckCommand(container, readiness), timeout)
+		if err != nil {
+			return err
+		}
+	}
+
+	if readiness != nil && len(readiness.Command) > 0 {
+		return s.waitForServiceCommand(container, readiness.Command, timeout-time.Since(started))
+	}
+	return nil
+}
+
+func (s *executor) waitForServiceContainer(container *docker.Container, readiness *common.ServiceReadiness, timeout time.Duration) error {
+	err := s.checkServiceReadiness(container, readiness, timeout)
 	if err == nil {
 		return nil
 	}
@@ -1021,18 +1502,9 @@ func (s *executor) waitForServiceContainer(container *docker.Container, timeout
 	buffer.WriteString("\n")
 	buffer.WriteString(strings.TrimSpace(err.Error()) + "\n")
 
-	var containerBuffer bytes.Buffer
-
-	err = s.client.Logs(docker.LogsOptions{
-		Container:    container.ID,
-		OutputStream: &containerBuffer,
-		ErrorStream:  &containerBuffer,
-		Stdout:       true,
-		Stderr:       true,
-		Timestamps:   true,
-	})
+	containerLog, err := s.getContainerLogs(container.ID, "all")
 	if err == nil {
-		if containerLog := containerBuffer.String(); containerLog != "" {
+		if containerLog != "" {
 			buffer.WriteString("\n")
 			buffer.WriteString(strings.TrimSpace(containerLog))
 			buffer.WriteString("\n")
@@ -1047,3 +1519,40 @@ func (s *executor) waitForServiceContainer(container *docker.Container, timeout
 	io.Copy(s.BuildTrace, &buffer)
 	return err
 }
+
+func (s *executor) writeServicesLogs(buildErr error) {
+	if s.client == nil || s.Config.Docker == nil || len(s.services) == 0 {
+		return
+	}
+
+	policy, err := s.Config.Docker.ServicesLogs.Get()
+	if err != nil {
+		s.Warningln(err)
+		return
+	}
+	if policy == common.DockerServicesLogsNever ||
+		policy == common.DockerServicesLogsOnFailure && buildErr == nil {
+		return
+	}
+
+	var buffer bytes.Buffer
+	for _, service := range s.services {
+		buffer.WriteString("\n")
+		buffer.WriteString(helpers.ANSI_BOLD_CYAN + "*** Logs of service " + service.Name + ":" + helpers.ANSI_RESET + "\n")
+		buffer.WriteString("\n")
+
+		containerLog, err := s.getContainerLogs(service.ID, "all")
+		if err != nil {
+			buffer.WriteString(strings.TrimSpace(err.Error()) + "\n")
+		} else if containerLog = strings.TrimSpace(containerLog); containerLog != "" {
+			buffer.WriteString(containerLog + "\n")
+		}
+	}
+	buffer.WriteString("\n")
+	io.Copy(s.BuildTrace, &buffer)
+}
+
+func (s *executor) Finish(err error) {
+	s.writeServicesLogs(err)
+	s.AbstractExecutor.Finish(err)
+}
@@ -32,19 +32,24 @@ func (s *commandExecutor) Prepare(globalConfig *common.Config, config *common.Ru
 		return err
 	}
 
+	imageName, err = s.getEnvironmentImage(imageName)
+	if err != nil {
+		return err
+	}
+
 	buildImage, err := s.getPrebuiltImage()
 	if err != nil {
 		return err
 	}
 
 	// Start pre-build container which will git clone changes
-	s.predefinedContainer, err = s.createContainer("predefined", buildImage.ID, []string{"gitlab-runner-build"})
+	s.predefinedContainer, err = s.createContainer("predefined", buildImage.ID, []string{"gitlab-runner-build"}, nil)
 	if err != nil {
 		return err
 	}
 
 	// Start build container which will run actual build
-	s.buildContainer, err = s.createContainer("build", imageName, s.BuildShell.DockerCommand)
+	s.buildContainer, err = s.createContainer("build", imageName, s.getBuildCommand(), s.getBuildEntrypoint())
 	if err != nil {
 		return err
 	}
@@ -60,9 +65,18 @@ func (s *commandExecutor) Run(cmd common.ExecutorCommand) error {
 		container = s.buildContainer
 	}
 
+	// The artifacts are uploaded after the failed build only with when on_failure or always
+	if s.GetCurrentStage() == common.BuildStageUploadArtifacts && s.buildFailed {
+		s.copyServiceArtifacts(container)
+	}
+
 	s.Debugln("Executing on", container.Name, "the", cmd.Script)
 
-	return s.watchContainer(container, bytes.NewBufferString(cmd.Script), cmd.Abort)
+	err := s.watchContainer(container, bytes.NewBufferString(cmd.Script), cmd.Abort)
+	if err != nil && s.GetCurrentStage() != common.BuildStageAfterScript {
+		s.buildFailed = true
+	}
+	return err
 }
 
 func init() {
@@ -95,8 +109,10 @@ func init() {
 		features.Services = true
 	}
 
-	common.RegisterExecutor("docker", executors.DefaultExecutorProvider{
-		Creator:         creator,
-		FeaturesUpdater: featuresUpdater,
+	common.RegisterExecutor("docker", hostCapacityProvider{
+		DefaultExecutorProvider: executors.DefaultExecutorProvider{
+			Creator:         creator,
+			FeaturesUpdater: featuresUpdater,
+		},
 	})
 }
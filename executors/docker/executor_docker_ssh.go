@@ -31,7 +31,7 @@ func (s *sshExecutor) Prepare(globalConfig *common.Config, config *common.Runner
 	}
 
 	// Start build container which will run actual build
-	container, err := s.createContainer("build", imageName, []string{})
+	container, err := s.createContainer("build", imageName, []string{}, s.getBuildEntrypoint())
 	if err != nil {
 		return err
 	}
@@ -53,7 +53,7 @@ func (s *sshExecutor) Prepare(globalConfig *common.Config, config *common.Runner
 		Stdout: s.BuildTrace,
 		Stderr: s.BuildTrace,
 	}
-	s.sshCommand.Host = containerData.NetworkSettings.IPAddress
+	s.sshCommand.Host = getContainerIPAddress(containerData)
 
 	s.Debugln("Connecting to SSH server...")
 	err = s.sshCommand.Connect()
@@ -70,8 +70,8 @@ func (s *sshExecutor) Run(cmd common.ExecutorCommand) error {
 		Stdin:       cmd.Script,
 		Abort:       cmd.Abort,
 	})
-	if _, ok := err.(*ssh.ExitError); ok {
-		err = &common.BuildError{Inner: err}
+	if exitErr, ok := err.(*ssh.ExitError); ok {
+		err = &common.BuildError{Inner: err, ExitCode: exitErr.ExitCode()}
 	}
 	return err
 }
@@ -1,11 +1,16 @@
 package docker
 
 import (
+	"bytes"
+	"errors"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/Sirupsen/logrus"
 	"github.com/fsouza/go-dockerclient"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/docker"
@@ -83,6 +88,65 @@ func TestSplitService(t *testing.T) {
 	}
 }
 
+func TestDockerGetArchitecture(t *testing.T) {
+	architectures := map[string]string{
+		"x86_64":  "x86_64",
+		"amd64":   "x86_64",
+		"armv6l":  "arm",
+		"armv7l":  "arm",
+		"aarch64": "arm64",
+	}
+
+	for dockerArchitecture, expected := range architectures {
+		e := executor{
+			info: &docker.Env{"Architecture=" + dockerArchitecture},
+		}
+		assert.Equal(t, expected, e.getArchitecture(), dockerArchitecture)
+	}
+}
+
+func newImageVariablesExecutor(image string, services ...string) *executor {
+	e := &executor{
+		options: dockerOptions{
+			Image:    common.Image{Name: image},
+			Services: common.NewServices(services...),
+		},
+	}
+	e.Build = &common.Build{
+		GetBuildResponse: common.GetBuildResponse{
+			Variables: common.BuildVariables{
+				{Key: "RUBY_VERSION", Value: "2.3", Public: true},
+				{Key: "DB_IMAGE", Value: "postgres:9.5", Public: true},
+			},
+		},
+		Runner: &common.RunnerConfig{},
+	}
+	e.BuildLogger = common.NewBuildLogger(&common.Trace{Writer: &bytes.Buffer{}}, logrus.WithFields(logrus.Fields{}))
+	e.Config.Docker = &common.DockerConfig{
+		AllowedImages:   []string{"ruby:2.*"},
+		AllowedServices: []string{"postgres:9.*"},
+	}
+	return e
+}
+
+func TestDockerGetImageNameExpandsVariables(t *testing.T) {
+	image, err := newImageVariablesExecutor("ruby:$RUBY_VERSION").getImageName()
+	assert.NoError(t, err)
+	assert.Equal(t, "ruby:2.3", image)
+
+	_, err = newImageVariablesExecutor("$DB_IMAGE").getImageName()
+	assert.Error(t, err, "the expanded image has to be allowed")
+}
+
+func TestDockerGetServicesExpandsVariables(t *testing.T) {
+	services, err := newImageVariablesExecutor("", "$DB_IMAGE").getServices()
+	assert.NoError(t, err)
+	assert.Equal(t, common.NewServices("postgres:9.5"), services)
+
+	_, err = newImageVariablesExecutor("", "ruby:$RUBY_VERSION").getServices()
+	assert.Error(t, err, "the expanded service has to be allowed")
+}
+
 func TestDockerForNamedImage(t *testing.T) {
 	var c docker_helpers.MockClient
 	defer c.AssertExpectations(t)
@@ -213,6 +277,68 @@ func TestDockerPolicyModeIfNotPresentForExistingImage(t *testing.T) {
 	assert.NotNil(t, image)
 }
 
+func TestDockerCustomHelperImage(t *testing.T) {
+	var c docker_helpers.MockClient
+	defer c.AssertExpectations(t)
+
+	e := executor{client: &c}
+	e.setPolicyMode(common.DockerPullPolicyIfNotPresent)
+	e.Config.Docker.HelperImage = "registry.example.com/gitlab-runner-helper:x86_64-pinned"
+
+	helperImage := &docker.Image{ID: "helper-image-id"}
+	c.On("InspectImage", "registry.example.com/gitlab-runner-helper:x86_64-pinned").
+		Return(helperImage, nil).
+		Once()
+
+	image, err := e.getPrebuiltImage()
+	assert.NoError(t, err)
+	assert.Equal(t, helperImage, image)
+}
+
+func TestDockerOfflineMode(t *testing.T) {
+	var c docker_helpers.MockClient
+	defer c.AssertExpectations(t)
+
+	e := executor{client: &c}
+	e.setPolicyMode(common.DockerPullPolicyAlways)
+	e.Config.Offline = true
+
+	c.On("InspectImage", "existing").
+		Return(&docker.Image{}, nil).
+		Once()
+
+	c.On("InspectImage", "not-existing").
+		Return(nil, os.ErrNotExist).
+		Once()
+
+	c.On("InspectImage", "registry.example.com/private").
+		Return(nil, os.ErrNotExist).
+		Once()
+
+	c.On("InspectImage", "registry.example.com/private").
+		Return(&docker.Image{}, nil).
+		Once()
+
+	ac := docker.AuthConfiguration{}
+	c.On("PullImage", docker.PullImageOptions{Repository: "registry.example.com/private:latest"}, ac).
+		Return(nil).
+		Once()
+
+	image, err := e.getDockerImage("existing")
+	assert.NoError(t, err)
+	assert.NotNil(t, image)
+
+	image, err = e.getDockerImage("not-existing")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "offline mode")
+	}
+	assert.Nil(t, image)
+
+	image, err = e.getDockerImage("registry.example.com/private")
+	assert.NoError(t, err)
+	assert.NotNil(t, image)
+}
+
 func TestDockerPolicyModeIfNotPresentForNotExistingImage(t *testing.T) {
 	var c docker_helpers.MockClient
 	defer c.AssertExpectations(t)
@@ -338,3 +464,465 @@ func TestHostMountedBuildsDirectory(t *testing.T) {
 		assert.Equal(t, i.result, e.SharedBuildsDir)
 	}
 }
+
+func testServicesLogs(t *testing.T, policy common.DockerServicesLogs, buildErr error) string {
+	var c docker_helpers.MockClient
+	defer c.AssertExpectations(t)
+
+	var trace bytes.Buffer
+	e := executor{client: &c}
+	e.BuildTrace = &common.Trace{Writer: &trace}
+	e.Config.Docker = &common.DockerConfig{
+		ServicesLogs: policy,
+	}
+	e.services = []*docker.Container{
+		{ID: "postgres-id", Name: "runner-postgres"},
+	}
+
+	if policy == common.DockerServicesLogsAlways ||
+		policy == common.DockerServicesLogsOnFailure && buildErr != nil {
+		c.On("Logs", mock.AnythingOfType("docker.LogsOptions")).
+			Return(errors.New("no logs")).
+			Once()
+	}
+
+	e.Finish(buildErr)
+	return trace.String()
+}
+
+func TestDockerServicesLogs(t *testing.T) {
+	buildErr := errors.New("build failed")
+
+	assert.Empty(t, testServicesLogs(t, "", buildErr))
+	assert.Empty(t, testServicesLogs(t, common.DockerServicesLogsNever, buildErr))
+	assert.Empty(t, testServicesLogs(t, common.DockerServicesLogsOnFailure, nil))
+
+	output := testServicesLogs(t, common.DockerServicesLogsOnFailure, buildErr)
+	assert.Contains(t, output, "Logs of service runner-postgres")
+	assert.Contains(t, output, "no logs")
+
+	output = testServicesLogs(t, common.DockerServicesLogsAlways, nil)
+	assert.Contains(t, output, "Logs of service runner-postgres")
+}
+
+func TestDockerExitedServiceLogs(t *testing.T) {
+	var c docker_helpers.MockClient
+	defer c.AssertExpectations(t)
+
+	var trace bytes.Buffer
+	e := executor{client: &c}
+	e.BuildTrace = &common.Trace{Writer: &trace}
+
+	running := &docker.Container{ID: "redis-id", Name: "runner-redis", State: docker.State{Running: true}}
+	exited := &docker.Container{ID: "postgres-id", Name: "runner-postgres", State: docker.State{ExitCode: 1}}
+	c.On("InspectContainer", "redis-id").Return(running, nil).Once()
+	c.On("InspectContainer", "postgres-id").Return(exited, nil).Twice()
+	c.On("Logs", mock.AnythingOfType("docker.LogsOptions")).
+		Return(errors.New("no logs")).
+		Once()
+
+	links := e.buildServiceLinks(map[string]*docker.Container{
+		"redis":    running,
+		"postgres": exited,
+		"db":       exited,
+	})
+	assert.Equal(t, []string{"redis-id:redis"}, links)
+
+	output := trace.String()
+	assert.Contains(t, output, "Service runner-postgres exited with code 1 before the build started")
+	assert.Contains(t, output, "no logs")
+}
+
+func TestDockerUserVolumesFrom(t *testing.T) {
+	e := executor{volumesFrom: []string{"cache-id"}}
+	e.Config.Docker = &common.DockerConfig{
+		VolumesFrom: []string{"tools:ro"},
+	}
+
+	err := e.createUserVolumes()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cache-id", "tools:ro"}, e.volumesFrom)
+}
+
+func TestDockerGetLabels(t *testing.T) {
+	e := executor{}
+	e.Build = &common.Build{
+		GetBuildResponse: common.GetBuildResponse{
+			ID:        10,
+			ProjectID: 20,
+			RefName:   "master",
+		},
+		Runner: &common.RunnerConfig{
+			RunnerCredentials: common.RunnerCredentials{
+				Token: "abcdef1234567890",
+			},
+		},
+	}
+
+	labels := e.getLabels("service", "service=postgres")
+	assert.Equal(t, "true", labels["com.gitlab.gitlab-runner.managed"])
+	assert.Equal(t, "10", labels["com.gitlab.gitlab-runner.build.id"])
+	assert.Equal(t, "20", labels["com.gitlab.gitlab-runner.project.id"])
+	assert.Equal(t, "abcdef12", labels["com.gitlab.gitlab-runner.runner.id"])
+	assert.Equal(t, "service", labels["com.gitlab.gitlab-runner.type"])
+	assert.Equal(t, "postgres", labels["com.gitlab.gitlab-runner.service"])
+}
+
+func TestDockerCleanupBuildsDirDisabled(t *testing.T) {
+	var c docker_helpers.MockClient
+	defer c.AssertExpectations(t)
+
+	e := executor{client: &c}
+	e.Build = &common.Build{BuildDir: "/builds/group/project"}
+	e.Config.Docker = &common.DockerConfig{}
+	e.SharedBuildsDir = true
+	assert.NoError(t, e.cleanupBuildsDir())
+
+	e.Config.Docker.CleanupBuildsDir = true
+	e.SharedBuildsDir = false
+	assert.NoError(t, e.cleanupBuildsDir())
+}
+
+func TestDockerGetMirrorImageName(t *testing.T) {
+	e := executor{}
+	e.Config.Docker = &common.DockerConfig{}
+	assert.Empty(t, e.getMirrorImageName("ruby:2.1"))
+
+	e.Config.Docker.RegistryMirror = "mirror.example.com:5000/"
+	assert.Equal(t, "mirror.example.com:5000/library/ruby:2.1", e.getMirrorImageName("ruby:2.1"))
+	assert.Equal(t, "mirror.example.com:5000/tutum/mysql", e.getMirrorImageName("tutum/mysql"))
+	assert.Empty(t, e.getMirrorImageName("registry.example.com/group/image"))
+	assert.Empty(t, e.getMirrorImageName("ruby@sha256:1234"))
+}
+
+func TestDockerSplitImageTag(t *testing.T) {
+	repository, tag := splitImageTag("localhost:5000/ruby")
+	assert.Equal(t, "localhost:5000/ruby", repository)
+	assert.Equal(t, "latest", tag)
+
+	repository, tag = splitImageTag("localhost:5000/ruby:2.1")
+	assert.Equal(t, "localhost:5000/ruby", repository)
+	assert.Equal(t, "2.1", tag)
+}
+
+func TestDockerPullImageFromMirror(t *testing.T) {
+	var c docker_helpers.MockClient
+	defer c.AssertExpectations(t)
+
+	e := executor{client: &c}
+	e.setPolicyMode(common.DockerPullPolicyAlways)
+	e.Config.Docker.RegistryMirror = "mirror.example.com"
+
+	ac, _ := e.getAuthConfig("mirror.example.com/library/ruby:2.1")
+
+	c.On("PullImage", docker.PullImageOptions{Repository: "mirror.example.com/library/ruby:2.1"}, ac).
+		Return(nil).
+		Once()
+	c.On("TagImage", "mirror.example.com/library/ruby:2.1", docker.TagImageOptions{Repo: "ruby", Tag: "2.1", Force: true}).
+		Return(nil).
+		Once()
+	c.On("InspectImage", "ruby:2.1").
+		Return(&docker.Image{}, nil).
+		Once()
+
+	image, err := e.pullDockerImage("ruby:2.1")
+	assert.NoError(t, err)
+	assert.NotNil(t, image)
+}
+
+func newBuildAuthConfigExecutor(authConfig string) *executor {
+	e := &executor{}
+	e.Build = &common.Build{
+		GetBuildResponse: common.GetBuildResponse{
+			Variables: common.BuildVariables{
+				{Key: "DOCKER_AUTH_CONFIG", Value: authConfig},
+			},
+		},
+		Runner: &common.RunnerConfig{},
+	}
+	e.BuildLogger = common.NewBuildLogger(&common.Trace{Writer: &bytes.Buffer{}}, logrus.WithFields(logrus.Fields{}))
+	return e
+}
+
+func TestDockerGetAuthConfigFromBuildVariable(t *testing.T) {
+	// the auth is base64 of "project-user:project-password"
+	e := newBuildAuthConfigExecutor(`{"auths":{"https://registry.example.com":{"auth":"cHJvamVjdC11c2VyOnByb2plY3QtcGFzc3dvcmQ="}}}`)
+
+	authConfig, err := e.getAuthConfig("registry.example.com/group/image:tag")
+	assert.NoError(t, err)
+	assert.Equal(t, "project-user", authConfig.Username)
+	assert.Equal(t, "project-password", authConfig.Password)
+
+	authConfig, _ = e.getAuthConfig("other.example.com/group/image:tag")
+	assert.Empty(t, authConfig.Username, "the build credentials are used only for their registry")
+}
+
+func TestDockerGetAuthConfigFromInvalidBuildVariable(t *testing.T) {
+	e := newBuildAuthConfigExecutor("invalid")
+
+	authConfig, _ := e.getAuthConfig("registry.example.com/group/image:tag")
+	assert.Empty(t, authConfig.Username)
+}
+
+func TestDockerPullImageWithBuildCredentials(t *testing.T) {
+	var c docker_helpers.MockClient
+	defer c.AssertExpectations(t)
+
+	e := newBuildAuthConfigExecutor(`{"auths":{"registry.example.com":{"auth":"cHJvamVjdC11c2VyOnByb2plY3QtcGFzc3dvcmQ="}}}`)
+	e.client = &c
+	e.Config.Docker = &common.DockerConfig{}
+
+	c.On("PullImage", docker.PullImageOptions{Repository: "registry.example.com/image:latest"}, docker.AuthConfiguration{
+		Username:      "project-user",
+		Password:      "project-password",
+		ServerAddress: "registry.example.com",
+	}).Return(nil).Once()
+	c.On("InspectImage", "registry.example.com/image").Return(&docker.Image{}, nil).Once()
+
+	_, err := e.pullDockerImageOnce("registry.example.com/image")
+	assert.NoError(t, err)
+}
+
+func TestDockerGetServices(t *testing.T) {
+	e := executor{}
+	e.Build = &common.Build{
+		GetBuildResponse: common.GetBuildResponse{
+			Variables: common.BuildVariables{
+				{Key: "POSTGRES_VERSION", Value: "9.5"},
+			},
+		},
+		Runner: &common.RunnerConfig{},
+	}
+	e.Config.Docker = &common.DockerConfig{
+		Services: []string{"redis"},
+	}
+	e.options.Services = common.Services{
+		{Name: "postgres:$POSTGRES_VERSION", Alias: "db"},
+		{Name: "postgres:$POSTGRES_VERSION", Alias: "replica", Command: []string{"replica"}},
+	}
+
+	services, err := e.getServices()
+	assert.NoError(t, err)
+	assert.Equal(t, common.Services{
+		{Name: "redis"},
+		{Name: "postgres:9.5", Alias: "db"},
+		{Name: "postgres:9.5", Alias: "replica", Command: []string{"replica"}},
+	}, services)
+}
+
+func newCacheVolumesExecutor(c *docker_helpers.MockClient) *executor {
+	e := &executor{client: c}
+	e.Build = &common.Build{
+		GetBuildResponse: common.GetBuildResponse{
+			ProjectID: 20,
+			RefName:   "feature/branch",
+		},
+		BuildDir: "/builds/group/project",
+		Runner: &common.RunnerConfig{
+			RunnerCredentials: common.RunnerCredentials{
+				Token: "abcdef1234567890",
+			},
+		},
+	}
+	e.Config.Docker = &common.DockerConfig{
+		CacheVolumes:    []string{"/root/.m2", "node_modules"},
+		CacheVolumesKey: "$CI_BUILD_REF_NAME",
+	}
+	return e
+}
+
+func TestDockerCreateCacheVolumes(t *testing.T) {
+	var c docker_helpers.MockClient
+	defer c.AssertExpectations(t)
+
+	e := newCacheVolumesExecutor(&c)
+	c.On("CreateVolumeWithLabels", mock.AnythingOfType("docker.CreateVolumeOptions"), mock.AnythingOfType("map[string]string")).
+		Return(&docker.Volume{}, nil).
+		Twice()
+
+	err := e.createCacheVolumes()
+	assert.NoError(t, err)
+	if assert.Equal(t, 2, len(e.binds)) {
+		assert.Equal(t, "runner-abcdef12-project-20-cache-volume-feature-branch-2214eff0c714668652405dbc6675970d:/root/.m2", e.binds[0])
+		assert.Contains(t, e.binds[1], ":/builds/group/project/node_modules")
+	}
+	if assert.Len(t, c.Calls, 2) {
+		labels := c.Calls[0].Arguments.Get(1).(map[string]string)
+		assert.Equal(t, "true", labels[dockerLabelPrefix+".managed"])
+		assert.Equal(t, cacheVolumeType, labels[dockerLabelPrefix+".type"])
+		assert.Equal(t, "/root/.m2", labels[dockerLabelPrefix+".cache.dir"])
+		assert.Equal(t, "feature-branch", labels[dockerLabelPrefix+".cache.key"])
+	}
+}
+
+func TestDockerCreateCacheVolumesFails(t *testing.T) {
+	var c docker_helpers.MockClient
+	defer c.AssertExpectations(t)
+
+	e := newCacheVolumesExecutor(&c)
+	c.On("CreateVolumeWithLabels", mock.AnythingOfType("docker.CreateVolumeOptions"), mock.AnythingOfType("map[string]string")).
+		Return(nil, errors.New("volume error")).
+		Once()
+
+	err := e.createCacheVolumes()
+	assert.Error(t, err)
+	assert.Equal(t, 0, len(e.binds))
+}
+
+func TestDockerCleanupCacheVolumes(t *testing.T) {
+	var c docker_helpers.MockClient
+	defer c.AssertExpectations(t)
+
+	runner := &common.RunnerCredentials{Token: "abcdef1234567890"}
+	c.On("ListVolumes", docker.ListVolumesOptions{}).
+		Return([]docker.Volume{
+			{Name: "runner-abcdef12-project-20-cache-volume-default-hash"},
+			{Name: "runner-abcdef12-project-20-cache-volume-master-hash"},
+			{Name: "runner-abcdef12-project-20-concurrent-0-cache-hash"},
+			{Name: "runner-00000000-project-20-cache-volume-default-hash"},
+			{Name: "user-volume"},
+		}, nil).
+		Once()
+	c.On("RemoveVolume", "runner-abcdef12-project-20-cache-volume-default-hash").
+		Return(nil).
+		Once()
+	c.On("RemoveVolume", "runner-abcdef12-project-20-cache-volume-master-hash").
+		Return(docker.ErrVolumeInUse).
+		Once()
+
+	removed, err := CleanupCacheVolumes(&c, runner)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"runner-abcdef12-project-20-cache-volume-default-hash"}, removed)
+}
+
+func TestDockerBuildEntrypointAndCommand(t *testing.T) {
+	e := newImageVariablesExecutor("ruby:2.3")
+	e.BuildShell = &common.ShellConfiguration{DockerCommand: []string{"sh", "-c", "detect-shell"}}
+	assert.Nil(t, e.getBuildEntrypoint(), "the entrypoint of the image is used by default")
+	assert.Equal(t, []string{"sh", "-c", "detect-shell"}, e.getBuildCommand())
+
+	e.Config.Docker.Entrypoint = []string{""}
+	e.Config.Docker.Command = []string{"/bin/bash"}
+	assert.Equal(t, []string{""}, e.getBuildEntrypoint())
+	assert.Equal(t, []string{"/bin/bash"}, e.getBuildCommand())
+
+	e.options.Image.Entrypoint = []string{"/custom-entrypoint.sh"}
+	e.options.Image.Command = []string{"/bin/sh"}
+	assert.Equal(t, []string{"/custom-entrypoint.sh"}, e.getBuildEntrypoint(), "the build takes precedence")
+	assert.Equal(t, []string{"/bin/sh"}, e.getBuildCommand(), "the build takes precedence")
+}
+
+func TestDockerServiceHealthCheckCommand(t *testing.T) {
+	container := &docker.Container{Name: "runner-project-0-nginx"}
+
+	assert.Equal(t, []string{"gitlab-runner-helper", "health-check"}, getHealthCheckCommand(container, nil))
+	assert.Equal(t, []string{"gitlab-runner-helper", "health-check"},
+		getHealthCheckCommand(container, &common.ServiceReadiness{Command: []string{"true"}}))
+	assert.Equal(t, []string{"gitlab-runner-helper", "health-check", "--host", "runner-project-0-nginx", "--port", "8080", "--path", "/health"},
+		getHealthCheckCommand(container, &common.ServiceReadiness{Port: 8080, Path: "/health"}))
+}
+
+func TestDockerServiceTimeout(t *testing.T) {
+	e := executor{}
+	e.Config.Docker = &common.DockerConfig{}
+	assert.Equal(t, common.DefaultWaitForServicesTimeout*time.Second, e.getServiceTimeout(nil))
+	assert.Equal(t, 60*time.Second, e.getServiceTimeout(&common.ServiceReadiness{Timeout: 60}))
+
+	e.Config.Docker.WaitForServicesTimeout = -1
+	assert.True(t, e.getServiceTimeout(nil) < 0, "waiting for services is disabled")
+	assert.Equal(t, common.DefaultWaitForServicesTimeout*time.Second, e.getServiceTimeout(&common.ServiceReadiness{Port: 80}),
+		"the readiness check of the build is done anyway")
+}
+
+func TestDockerWaitForServiceCommand(t *testing.T) {
+	var c docker_helpers.MockClient
+	defer c.AssertExpectations(t)
+
+	container := &docker.Container{ID: "service-id", Name: "service"}
+	options := docker.CreateExecOptions{
+		Container: "service-id",
+		Cmd:       []string{"pg_isready"},
+	}
+	c.On("CreateExec", options).
+		Return(&docker.Exec{ID: "exec-id"}, nil).
+		Twice()
+	c.On("StartExec", "exec-id", docker.StartExecOptions{Detach: true}).
+		Return(nil).
+		Twice()
+	c.On("InspectExec", "exec-id").
+		Return(&docker.ExecInspect{ExitCode: 1}, nil).
+		Once()
+	c.On("InspectExec", "exec-id").
+		Return(&docker.ExecInspect{Running: true}, nil).
+		Once()
+	c.On("InspectExec", "exec-id").
+		Return(&docker.ExecInspect{ExitCode: 0}, nil).
+		Once()
+
+	e := executor{client: &c}
+	e.BuildLogger = common.NewBuildLogger(&common.Trace{Writer: &bytes.Buffer{}}, logrus.WithFields(logrus.Fields{}))
+	err := e.waitForServiceCommand(container, []string{"pg_isready"}, 5*time.Second)
+	assert.NoError(t, err)
+}
+
+func TestDockerWaitForServiceCommandTimeout(t *testing.T) {
+	var c docker_helpers.MockClient
+	defer c.AssertExpectations(t)
+
+	container := &docker.Container{ID: "service-id", Name: "service"}
+	c.On("CreateExec", mock.AnythingOfType("docker.CreateExecOptions")).
+		Return(&docker.Exec{ID: "exec-id"}, nil).
+		Once()
+	c.On("StartExec", "exec-id", docker.StartExecOptions{Detach: true}).
+		Return(nil).
+		Once()
+	c.On("InspectExec", "exec-id").
+		Return(&docker.ExecInspect{Running: true}, nil)
+
+	e := executor{client: &c}
+	e.BuildLogger = common.NewBuildLogger(&common.Trace{Writer: &bytes.Buffer{}}, logrus.WithFields(logrus.Fields{}))
+	err := e.waitForServiceCommand(container, []string{"pg_isready"}, 300*time.Millisecond)
+	assert.Error(t, err, "the hanging command times out")
+
+	// the command isn't waited for after the timeout
+	time.Sleep(2 * serviceCommandPollInterval)
+	calls := len(c.Calls)
+	time.Sleep(2 * serviceCommandPollInterval)
+	assert.Equal(t, calls, len(c.Calls))
+}
+
+func TestGetContainerIPAddress(t *testing.T) {
+	tests := []struct {
+		settings *docker.NetworkSettings
+		address  string
+	}{
+		{nil, ""},
+		{&docker.NetworkSettings{IPAddress: "172.17.0.2", GlobalIPv6Address: "2001:db8::2"}, "172.17.0.2"},
+		{&docker.NetworkSettings{GlobalIPv6Address: "2001:db8::2"}, "2001:db8::2"},
+		{&docker.NetworkSettings{Networks: map[string]docker.ContainerNetwork{
+			"ipv6-only": {GlobalIPv6Address: "2001:db8:1::3"},
+			"custom":    {IPAddress: "10.0.0.3"},
+		}}, "10.0.0.3"},
+		{&docker.NetworkSettings{Networks: map[string]docker.ContainerNetwork{
+			"ipv6-only": {GlobalIPv6Address: "2001:db8:1::3"},
+		}}, "2001:db8:1::3"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.address, getContainerIPAddress(&docker.Container{NetworkSettings: test.settings}))
+	}
+}
+
+func TestDockerCACertificatesAreOptIn(t *testing.T) {
+	e := &executor{}
+	e.Build = &common.Build{
+		GetBuildResponse: common.GetBuildResponse{
+			TLSCAChain: "-----BEGIN CERTIFICATE-----\n",
+		},
+	}
+	e.Config.Docker = &common.DockerConfig{}
+	assert.Empty(t, e.getCACertificates(), "the trust store of the image is used by default")
+
+	e.Config.Docker.CACertificates = true
+	assert.Contains(t, e.getCACertificates(), "-----BEGIN CERTIFICATE-----")
+}
@@ -0,0 +1,43 @@
+package docker
+
+import (
+	"github.com/Sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/executors"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/docker"
+)
+
+var newHostClient = docker_helpers.New
+
+// hostCapacityProvider doesn't let the runner request the builds, when the Docker host
+// already runs max_containers containers, eg. the builds of other runners using the host
+type hostCapacityProvider struct {
+	executors.DefaultExecutorProvider
+}
+
+// GetCapacity returns how many containers can be still started on the Docker host. When the host
+// can't be checked, the capacity isn't limited, so the build is requested and reports the failure
+func (p hostCapacityProvider) GetCapacity(config *common.RunnerConfig) int {
+	if config.Docker == nil || config.Docker.MaxContainers <= 0 {
+		return common.UnlimitedCapacity
+	}
+
+	client, err := newHostClient(config.Docker.DockerCredentials, DockerAPIVersion)
+	if err != nil {
+		logrus.WithError(err).Warningln("Failed to connect to the Docker host to check its capacity")
+		return common.UnlimitedCapacity
+	}
+
+	info, err := client.Info()
+	if err != nil {
+		logrus.WithError(err).Warningln("Failed to check the capacity of the Docker host")
+		return common.UnlimitedCapacity
+	}
+
+	capacity := config.Docker.MaxContainers - info.GetInt("ContainersRunning")
+	if capacity < 0 {
+		return 0
+	}
+	return capacity
+}
@@ -0,0 +1,59 @@
+package docker
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/docker"
+)
+
+func withHostClient(c docker_helpers.Client, err error) func() {
+	previous := newHostClient
+	newHostClient = func(docker_helpers.DockerCredentials, string) (docker_helpers.Client, error) {
+		return c, err
+	}
+	return func() {
+		newHostClient = previous
+	}
+}
+
+func hostCapacityConfig(maxContainers int) *common.RunnerConfig {
+	return &common.RunnerConfig{
+		RunnerSettings: common.RunnerSettings{
+			Docker: &common.DockerConfig{MaxContainers: maxContainers},
+		},
+	}
+}
+
+func TestHostCapacity(t *testing.T) {
+	c := &docker_helpers.MockClient{}
+	defer c.AssertExpectations(t)
+	defer withHostClient(c, nil)()
+
+	info := &docker.Env{}
+	info.SetInt("ContainersRunning", 8)
+	c.On("Info").Return(info, nil).Twice()
+
+	p := hostCapacityProvider{}
+	assert.Equal(t, common.UnlimitedCapacity, p.GetCapacity(hostCapacityConfig(0)), "the host isn't checked")
+	assert.Equal(t, 2, p.GetCapacity(hostCapacityConfig(10)))
+	assert.Equal(t, 0, p.GetCapacity(hostCapacityConfig(5)), "the host runs more containers")
+}
+
+func TestHostCapacityIsUnlimitedWhenHostFails(t *testing.T) {
+	c := &docker_helpers.MockClient{}
+	defer c.AssertExpectations(t)
+	defer withHostClient(c, nil)()
+
+	c.On("Info").Return(nil, errors.New("connection refused")).Once()
+
+	p := hostCapacityProvider{}
+	assert.Equal(t, common.UnlimitedCapacity, p.GetCapacity(hostCapacityConfig(10)))
+
+	defer withHostClient(nil, errors.New("invalid host"))()
+	assert.Equal(t, common.UnlimitedCapacity, p.GetCapacity(hostCapacityConfig(10)))
+}
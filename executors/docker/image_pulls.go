@@ -0,0 +1,66 @@
+package docker
+
+import (
+	"sync"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+type imagePull struct {
+	done  chan struct{}
+	image *docker.Image
+	err   error
+}
+
+// imagePulls deduplicates the concurrent pulls of the same image to the same Docker daemon,
+// the builds wait for the pull in progress instead of downloading the image in parallel
+type imagePulls struct {
+	pulls map[string]*imagePull
+	lock  sync.Mutex
+}
+
+var dockerImagePulls = imagePulls{
+	pulls: make(map[string]*imagePull),
+}
+
+// start returns the pull in progress, or registers a new one when there's no pull of the image
+func (p *imagePulls) start(key string) (pull *imagePull, started bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if pull, ok := p.pulls[key]; ok {
+		return pull, false
+	}
+
+	pull = &imagePull{done: make(chan struct{})}
+	p.pulls[key] = pull
+	return pull, true
+}
+
+func (p *imagePulls) finish(key string, pull *imagePull, image *docker.Image, err error) {
+	p.lock.Lock()
+	delete(p.pulls, key)
+	p.lock.Unlock()
+
+	pull.image, pull.err = image, err
+	close(pull.done)
+}
+
+// pull executes the pullImage once for the concurrent requests of the same key, the waiting
+// callers are notified with wait. When the pull of the other build fails, eg. because
+// of its credentials, the waiting callers pull the image on their own
+func (p *imagePulls) pull(key string, pullImage func() (*docker.Image, error), wait func()) (*docker.Image, error) {
+	pull, started := p.start(key)
+	if !started {
+		wait()
+		<-pull.done
+		if pull.err == nil {
+			return pull.image, nil
+		}
+		return pullImage()
+	}
+
+	image, err := pullImage()
+	p.finish(key, pull, image, err)
+	return image, err
+}
@@ -0,0 +1,90 @@
+package docker
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImagePullsDeduplicateConcurrentPulls(t *testing.T) {
+	pulls := imagePulls{pulls: make(map[string]*imagePull)}
+	release := make(chan struct{})
+	waiting := make(chan struct{}, 2)
+
+	var pullsCount int
+	pullImage := func() (*docker.Image, error) {
+		pullsCount++
+		<-release
+		return &docker.Image{ID: "image-id"}, nil
+	}
+	wait := func() {
+		waiting <- struct{}{}
+	}
+
+	var wg sync.WaitGroup
+	images := make([]*docker.Image, 3)
+	pull := func(i int) {
+		defer wg.Done()
+		images[i], _ = pulls.pull("host image", pullImage, wait)
+	}
+
+	wg.Add(1)
+	go pull(0)
+	for i := 1; i < 3; i++ {
+		for {
+			pulls.lock.Lock()
+			_, started := pulls.pulls["host image"]
+			pulls.lock.Unlock()
+			if started {
+				break
+			}
+		}
+		wg.Add(1)
+		go pull(i)
+	}
+
+	<-waiting
+	<-waiting
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, 1, pullsCount)
+	for _, image := range images {
+		assert.Equal(t, "image-id", image.ID)
+	}
+	assert.Empty(t, pulls.pulls, "the finished pull is removed")
+}
+
+func TestImagePullsPullAgainWhenOtherPullFails(t *testing.T) {
+	pulls := imagePulls{pulls: make(map[string]*imagePull)}
+	pull, started := pulls.start("host image")
+	assert.True(t, started)
+
+	waited := make(chan struct{})
+	result := make(chan *docker.Image)
+	go func() {
+		image, err := pulls.pull("host image", func() (*docker.Image, error) {
+			return &docker.Image{ID: "own-image"}, nil
+		}, func() {
+			close(waited)
+		})
+		assert.NoError(t, err)
+		result <- image
+	}()
+
+	<-waited
+	pulls.finish("host image", pull, nil, errors.New("unauthorized"))
+	assert.Equal(t, "own-image", (<-result).ID)
+}
+
+func TestImagePullsDifferentKeys(t *testing.T) {
+	pulls := imagePulls{pulls: make(map[string]*imagePull)}
+	_, started := pulls.start("host1 image")
+	assert.True(t, started)
+
+	_, started = pulls.start("host2 image")
+	assert.True(t, started, "the images are pulled in parallel to different daemons")
+}
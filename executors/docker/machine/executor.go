@@ -18,6 +18,8 @@ type machineExecutor struct {
 	build    *common.Build
 	data     common.ExecutorData
 	config   common.RunnerConfig
+
+	currentStage common.BuildStage
 }
 
 func (e *machineExecutor) log() (log *logrus.Entry) {
@@ -73,6 +75,7 @@ func (e *machineExecutor) Prepare(globalConfig *common.Config, config *common.Ru
 	if e.executor == nil {
 		return errors.New("failed to create an executor")
 	}
+	e.executor.SetCurrentStage(e.currentStage)
 	return e.executor.Prepare(globalConfig, &e.config, build)
 }
 
@@ -83,6 +86,18 @@ func (e *machineExecutor) Run(cmd common.ExecutorCommand) error {
 	return e.executor.Run(cmd)
 }
 
+func (e *machineExecutor) GetCurrentStage() common.BuildStage {
+	return e.currentStage
+}
+
+// SetCurrentStage is passed to the executor running the build on the machine, once it's created
+func (e *machineExecutor) SetCurrentStage(stage common.BuildStage) {
+	e.currentStage = stage
+	if e.executor != nil {
+		e.executor.SetCurrentStage(stage)
+	}
+}
+
 func (e *machineExecutor) Finish(err error) {
 	if e.executor != nil {
 		e.executor.Finish(err)
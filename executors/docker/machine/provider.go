@@ -47,6 +47,18 @@ func (m *machineProvider) machineDetails(name string, acquire bool) *machineDeta
 	return details
 }
 
+// machineOptions returns the options used to create the machine,
+// the insecure registries have to be configured in the Docker Engine
+func machineOptions(config *common.RunnerConfig) (options []string) {
+	options = append(options, config.Machine.MachineOptions...)
+	if config.Docker != nil {
+		for _, registry := range config.Docker.InsecureRegistries {
+			options = append(options, "--engine-insecure-registry="+registry)
+		}
+	}
+	return
+}
+
 func (m *machineProvider) create(config *common.RunnerConfig, state machineState) (details *machineDetails, errCh chan error) {
 	name := newMachineName(machineFilter(config))
 	details = m.machineDetails(name, true)
@@ -57,7 +69,7 @@ func (m *machineProvider) create(config *common.RunnerConfig, state machineState
 	// Create machine asynchronously
 	go func() {
 		started := time.Now()
-		err := m.machine.Create(config.Machine.MachineDriver, details.Name, config.Machine.MachineOptions...)
+		err := m.machine.Create(config.Machine.MachineDriver, details.Name, machineOptions(config)...)
 		for i := 0; i < 3 && err != nil; i++ {
 			logrus.WithField("name", details.Name).WithError(err).
 				Warningln("Machine creation failed, trying to provision")
@@ -253,6 +265,31 @@ func (m *machineProvider) loadMachines(config *common.RunnerConfig) ([]string, e
 	return m.machine.List(machineFilter(config))
 }
 
+// GetCapacity returns how many machines can be still used by the builds. It's counted
+// from the machines found by the previous Acquire, so the docker-machine isn't executed
+func (m *machineProvider) GetCapacity(config *common.RunnerConfig) int {
+	if config.Machine == nil || config.Limit <= 0 {
+		return common.UnlimitedCapacity
+	}
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	filter := machineFilter(config)
+	var data machinesData
+	for _, details := range m.details {
+		if details.match(filter) {
+			data.Add(details.State)
+		}
+	}
+
+	capacity := config.Limit - data.Acquired - data.Used
+	if capacity < 0 {
+		return 0
+	}
+	return capacity
+}
+
 func (m *machineProvider) Acquire(config *common.RunnerConfig) (data common.ExecutorData, err error) {
 	if config.Machine == nil || config.Machine.MachineName == "" {
 		err = fmt.Errorf("Missing Machine options")
@@ -355,6 +392,65 @@ func (m *machineProvider) Release(config *common.RunnerConfig, data common.Execu
 	return nil
 }
 
+// Shutdown removes the idle machines of the runner, so they aren't left running after the runner is
+// stopped. The machines still used by the builds are kept
+func (m *machineProvider) Shutdown(config *common.RunnerConfig) {
+	if config.Machine == nil || !config.Machine.RemoveOnShutdown {
+		return
+	}
+
+	machines, err := m.loadMachines(config)
+	if err != nil {
+		logrus.WithError(err).Errorln("Failed to list the machines removed on shutdown")
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, name := range machines {
+		// Acquire the machine, so it isn't used while it's removed
+		details := m.machineDetails(name, true)
+		if details == nil {
+			logrus.WithField("name", name).Warningln("Skipping removal of the used machine")
+			continue
+		}
+
+		wg.Add(1)
+		go func(details *machineDetails) {
+			defer wg.Done()
+			m.removeOnShutdown(details)
+		}(details)
+	}
+	wg.Wait()
+}
+
+// removeOnShutdown removes the machine without retrying, so the runner isn't blocked by the failed removal
+func (m *machineProvider) removeOnShutdown(details *machineDetails) {
+	m.lock.Lock()
+	details.Reason = "Runner shutdown"
+	details.State = machineStateRemoving
+	m.lock.Unlock()
+
+	logrus.WithField("name", details.Name).
+		WithField("created", time.Since(details.Created)).
+		WithField("used", time.Since(details.Used)).
+		WithField("reason", details.Reason).
+		Warningln("Removing machine")
+
+	err := m.machine.Remove(details.Name)
+	if err != nil {
+		logrus.WithField("name", details.Name).
+			WithError(err).
+			Errorln("Failed to remove machine")
+		return
+	}
+
+	m.lock.Lock()
+	delete(m.details, details.Name)
+	m.lock.Unlock()
+
+	logrus.WithField("name", details.Name).Infoln("Machine removed")
+}
+
 func (m *machineProvider) CanCreate() bool {
 	return m.provider.CanCreate()
 }
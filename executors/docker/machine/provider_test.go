@@ -388,6 +388,33 @@ func TestMachineLimitMax(t *testing.T) {
 	assertIdleMachines(t, p, 2, "it should downscale to 2 nodes")
 }
 
+func TestMachineCapacity(t *testing.T) {
+	p, _ := testMachineProvider()
+
+	config := createMachineConfig(0, 5)
+	assert.Equal(t, common.UnlimitedCapacity, p.GetCapacity(config), "the machines aren't limited")
+
+	config.Limit = 2
+	assert.Equal(t, 2, p.GetCapacity(config), "no machine is used yet")
+
+	_, d1, err := p.Use(config, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, p.GetCapacity(config))
+
+	_, d2, err := p.Use(config, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, p.GetCapacity(config), "all machines are used")
+
+	p.Release(config, d2)
+	assert.Equal(t, 1, p.GetCapacity(config), "the released machine can be used again")
+	p.Release(config, d1)
+
+	other := createMachineConfig(0, 5)
+	other.Machine.MachineName = "other-machine-%s"
+	other.Limit = 1
+	assert.Equal(t, 1, p.GetCapacity(other), "the machines of other runners aren't counted")
+}
+
 func TestMachineMaxBuildsForExistingMachines(t *testing.T) {
 	provisionRetryInterval = 0
 
@@ -467,3 +494,46 @@ func TestMachineUseOnDemand(t *testing.T) {
 	assert.Error(t, err, "fail to create a new machine on connect")
 	assertTotalMachines(t, p, 3, "it fails on no-connect, but we leave the machine created")
 }
+
+func TestMachineOptionsWithInsecureRegistries(t *testing.T) {
+	config := &common.RunnerConfig{
+		RunnerSettings: common.RunnerSettings{
+			Docker: &common.DockerConfig{
+				InsecureRegistries: []string{"mirror.example.com:5000"},
+			},
+			Machine: &common.DockerMachine{
+				MachineOptions: []string{"digitalocean-image=coreos-stable"},
+			},
+		},
+	}
+
+	assert.Equal(t, []string{
+		"digitalocean-image=coreos-stable",
+		"--engine-insecure-registry=mirror.example.com:5000",
+	}, machineOptions(config))
+	assert.Len(t, config.Machine.MachineOptions, 1)
+}
+
+func TestMachineShutdown(t *testing.T) {
+	p, tm := testMachineProvider("machine1", "machine2", "remove-fail")
+	config := createMachineConfig(1, 5)
+	config.Machine.RemoveOnShutdown = true
+
+	used := p.machineDetails("machine2", true)
+	used.State = machineStateUsed
+
+	p.Shutdown(config)
+	assert.Equal(t, []string{"machine2", "remove-fail"}, tm.machines, "the idle machine is removed")
+	assert.Nil(t, p.details["machine1"])
+	assert.Equal(t, machineStateUsed, used.State, "the used machine is kept")
+	assert.Equal(t, machineStateRemoving, p.details["remove-fail"].State, "the failed removal isn't retried")
+	assert.Equal(t, "Runner shutdown", p.details["remove-fail"].Reason)
+}
+
+func TestMachineShutdownDisabled(t *testing.T) {
+	p, tm := testMachineProvider("machine1")
+
+	p.Shutdown(createMachineConfig(1, 5))
+	assert.Equal(t, []string{"machine1"}, tm.machines, "the machines are kept by default")
+	assert.Empty(t, p.details)
+}
@@ -0,0 +1,141 @@
+package docker
+
+import (
+	"archive/tar"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// The directory in the project where the files of the services are copied,
+// each service has its own subdirectory named after the alias
+const serviceArtifactsDir = ".gitlab-services"
+
+type serviceArtifacts struct {
+	alias string
+	paths []string
+}
+
+// getServiceArtifactPrefix returns the directory of the copied path in the archive,
+// eg. .gitlab-services/db/var/log/ for /var/log/postgresql of the db service
+func getServiceArtifactPrefix(alias, artifactPath string) string {
+	dir := strings.TrimPrefix(path.Dir(path.Clean("/"+artifactPath)), "/")
+	return path.Join(serviceArtifactsDir, alias, dir) + "/"
+}
+
+// rewriteServiceArtifactArchive moves all files of the archive downloaded from the service to the prefix
+func rewriteServiceArtifactArchive(archive io.Reader, prefix string, output io.Writer) error {
+	reader := tar.NewReader(archive)
+	writer := tar.NewWriter(output)
+
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		header.Name = prefix + strings.TrimPrefix(header.Name, "/")
+		if header.Typeflag == tar.TypeLink {
+			header.Linkname = prefix + strings.TrimPrefix(header.Linkname, "/")
+		}
+
+		err = writer.WriteHeader(header)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(writer, reader)
+		if err != nil {
+			return err
+		}
+	}
+
+	return writer.Close()
+}
+
+// serviceArtifactUpload starts the upload with the first write,
+// so nothing is uploaded when the path can't be downloaded from the service
+type serviceArtifactUpload struct {
+	upload func(input io.Reader) error
+	writer *io.PipeWriter
+	result chan error
+}
+
+func (u *serviceArtifactUpload) Write(data []byte) (int, error) {
+	if u.writer == nil {
+		reader, writer := io.Pipe()
+		u.writer = writer
+		u.result = make(chan error, 1)
+		go func() {
+			err := u.upload(reader)
+			reader.CloseWithError(err)
+			u.result <- err
+		}()
+	}
+	return u.writer.Write(data)
+}
+
+// finish waits for the upload, the upload is aborted when the archive couldn't be rewritten
+func (u *serviceArtifactUpload) finish(err error) error {
+	if u.writer == nil {
+		return err
+	}
+
+	u.writer.CloseWithError(err)
+	uploadErr := <-u.result
+	if err != nil {
+		return err
+	}
+	return uploadErr
+}
+
+// copyServiceArtifact streams the archive from the service to the container, it isn't stored in memory
+func (s *executor) copyServiceArtifact(service *docker.Container, artifacts serviceArtifacts, artifactPath string, container *docker.Container) error {
+	archive, archiveWriter := io.Pipe()
+	defer archive.Close()
+
+	go func() {
+		err := s.client.DownloadFromContainer(service.ID, docker.DownloadFromContainerOptions{
+			OutputStream: archiveWriter,
+			Path:         artifactPath,
+		})
+		archiveWriter.CloseWithError(err)
+	}()
+
+	// The project directory is on the volume shared with the container uploading the artifacts
+	upload := &serviceArtifactUpload{
+		upload: func(input io.Reader) error {
+			return s.client.UploadToContainer(container.ID, docker.UploadToContainerOptions{
+				InputStream: input,
+				Path:        s.Build.FullProjectDir(),
+			})
+		},
+	}
+
+	err := rewriteServiceArtifactArchive(archive, getServiceArtifactPrefix(artifacts.alias, artifactPath), upload)
+	return upload.finish(err)
+}
+
+// copyServiceArtifacts copies the paths requested by the build out of the services to the project
+// directory, so they are uploaded together with the artifacts of the failed build
+func (s *executor) copyServiceArtifacts(container *docker.Container) {
+	for _, service := range s.services {
+		artifacts, ok := s.artifacts[service.ID]
+		if !ok {
+			continue
+		}
+
+		for _, artifactPath := range artifacts.paths {
+			s.Debugln("Copying", artifactPath, "from service", artifacts.alias, "...")
+			err := s.copyServiceArtifact(service, artifacts, artifactPath, container)
+			if err != nil {
+				s.Warningln("Failed to copy", artifactPath, "from service", artifacts.alias+":", err)
+				continue
+			}
+			s.Println("Copied", artifactPath, "from service", artifacts.alias, "to", getServiceArtifactPrefix(artifacts.alias, artifactPath))
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package docker
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/docker"
+)
+
+func TestServiceArtifactPrefix(t *testing.T) {
+	assert.Equal(t, ".gitlab-services/db/var/log/", getServiceArtifactPrefix("db", "/var/log/postgresql"))
+	assert.Equal(t, ".gitlab-services/db/var/log/", getServiceArtifactPrefix("db", "/var/log/postgresql/"))
+	assert.Equal(t, ".gitlab-services/db/", getServiceArtifactPrefix("db", "dump.sql"))
+	assert.Equal(t, ".gitlab-services/db/", getServiceArtifactPrefix("db", "../../dump.sql"), "the files are kept in the directory of the service")
+}
+
+func TestRewriteServiceArtifactArchive(t *testing.T) {
+	var archive bytes.Buffer
+	writer := tar.NewWriter(&archive)
+	require.NoError(t, writer.WriteHeader(&tar.Header{Name: "postgresql/", Typeflag: tar.TypeDir, Mode: 0755}))
+	require.NoError(t, writer.WriteHeader(&tar.Header{Name: "postgresql/server.log", Typeflag: tar.TypeReg, Mode: 0644, Size: 5}))
+	_, err := writer.Write([]byte("FATAL"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	var rewritten bytes.Buffer
+	err = rewriteServiceArtifactArchive(&archive, ".gitlab-services/db/var/log/", &rewritten)
+	require.NoError(t, err)
+
+	reader := tar.NewReader(&rewritten)
+	header, err := reader.Next()
+	require.NoError(t, err)
+	assert.Equal(t, ".gitlab-services/db/var/log/postgresql/", header.Name)
+
+	header, err = reader.Next()
+	require.NoError(t, err)
+	assert.Equal(t, ".gitlab-services/db/var/log/postgresql/server.log", header.Name)
+	content, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "FATAL", string(content))
+}
+
+func TestCopyServiceArtifactsDownloadFailure(t *testing.T) {
+	c := &docker_helpers.MockClient{}
+	defer c.AssertExpectations(t)
+
+	e := &executor{client: c}
+	e.BuildLogger = common.NewBuildLogger(&common.Trace{Writer: &bytes.Buffer{}}, logrus.WithFields(logrus.Fields{}))
+	e.services = []*docker.Container{{ID: "db-id"}, {ID: "redis-id"}}
+	e.artifacts = map[string]serviceArtifacts{
+		"db-id": {alias: "db", paths: []string{"/var/log/postgresql"}},
+	}
+
+	c.On("DownloadFromContainer", "db-id", mock.Anything).
+		Return(errors.New("Could not find the file /var/log/postgresql in container db-id")).
+		Once()
+
+	// the missing files don't fail the build and nothing is uploaded
+	e.copyServiceArtifacts(&docker.Container{ID: "predefined-id"})
+}
+
+// serviceArtifactsClient streams the archives between the containers
+type serviceArtifactsClient struct {
+	*docker_helpers.MockClient
+	archive  []byte
+	uploaded bytes.Buffer
+}
+
+func (c *serviceArtifactsClient) DownloadFromContainer(id string, opts docker.DownloadFromContainerOptions) error {
+	_, err := opts.OutputStream.Write(c.archive)
+	return err
+}
+
+func (c *serviceArtifactsClient) UploadToContainer(id string, opts docker.UploadToContainerOptions) error {
+	_, err := io.Copy(&c.uploaded, opts.InputStream)
+	return err
+}
+
+func TestCopyServiceArtifactStreamsArchive(t *testing.T) {
+	var archive bytes.Buffer
+	writer := tar.NewWriter(&archive)
+	require.NoError(t, writer.WriteHeader(&tar.Header{Name: "dump.sql", Typeflag: tar.TypeReg, Mode: 0644, Size: 6}))
+	_, err := writer.Write([]byte("SELECT"))
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	c := &serviceArtifactsClient{MockClient: &docker_helpers.MockClient{}, archive: archive.Bytes()}
+	e := &executor{client: c}
+	e.Build = &common.Build{Runner: &common.RunnerConfig{}}
+
+	err = e.copyServiceArtifact(&docker.Container{ID: "db-id"}, serviceArtifacts{alias: "db"}, "/dump.sql", &docker.Container{ID: "predefined-id"})
+	require.NoError(t, err)
+
+	reader := tar.NewReader(&c.uploaded)
+	header, err := reader.Next()
+	require.NoError(t, err)
+	assert.Equal(t, ".gitlab-services/db/dump.sql", header.Name)
+	content, err := ioutil.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "SELECT", string(content))
+}
+
+func TestCopyServiceArtifactInvalidArchive(t *testing.T) {
+	c := &serviceArtifactsClient{MockClient: &docker_helpers.MockClient{}, archive: []byte("not an archive")}
+	e := &executor{client: c}
+	e.Build = &common.Build{Runner: &common.RunnerConfig{}}
+
+	err := e.copyServiceArtifact(&docker.Container{ID: "db-id"}, serviceArtifacts{alias: "db"}, "/dump.sql", &docker.Container{ID: "predefined-id"})
+	assert.Error(t, err)
+	assert.Equal(t, 0, c.uploaded.Len(), "the invalid archive is not uploaded")
+}
@@ -13,6 +13,10 @@ type ExecutorOptions struct {
 	Shell            common.ShellScriptInfo
 	ShowHostname     bool
 	SupportedOptions []string
+
+	// ShellAvailable checks if the shell can be used on the target,
+	// it's used to detect the shell when it isn't configured
+	ShellAvailable func(shell string) bool
 }
 
 type AbstractExecutor struct {
@@ -22,6 +26,26 @@ type AbstractExecutor struct {
 	Build      *common.Build
 	BuildTrace common.BuildTrace
 	BuildShell *common.ShellConfiguration
+
+	currentStage common.BuildStage
+}
+
+func (e *AbstractExecutor) GetCurrentStage() common.BuildStage {
+	return e.currentStage
+}
+
+func (e *AbstractExecutor) SetCurrentStage(stage common.BuildStage) {
+	e.currentStage = stage
+}
+
+func (e *AbstractExecutor) detectShell(available func(shell string) bool) {
+	script := e.Shell()
+	if shell := common.DetectShell(available); shell != "" {
+		script.Shell = shell
+		e.Println("Using detected", script.Shell, "shell...")
+	} else {
+		e.Warningln("None of the supported shells was found, trying", script.Shell, "shell")
+	}
 }
 
 func (e *AbstractExecutor) updateShell() error {
@@ -29,10 +53,23 @@ func (e *AbstractExecutor) updateShell() error {
 	script.Build = e.Build
 	if e.Config.Shell != "" {
 		script.Shell = e.Config.Shell
+	} else if e.ShellAvailable != nil {
+		e.detectShell(e.ShellAvailable)
 	}
 	return nil
 }
 
+// DetectShell selects the shell available on the target, when the shell isn't configured.
+// It's used by the executors, which can check the target only after connecting to it
+func (e *AbstractExecutor) DetectShell(available func(shell string) bool) error {
+	if e.Config.Shell != "" {
+		return nil
+	}
+
+	e.detectShell(available)
+	return e.generateShellConfiguration()
+}
+
 func (e *AbstractExecutor) generateShellConfiguration() error {
 	shellConfiguration, err := common.GetShellConfiguration(*e.Shell())
 	if err != nil {
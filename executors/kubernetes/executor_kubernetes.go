@@ -2,6 +2,8 @@ package kubernetes
 
 import (
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"golang.org/x/net/context"
@@ -26,8 +28,8 @@ var (
 )
 
 type kubernetesOptions struct {
-	Image    string   `json:"image"`
-	Services []string `json:"services"`
+	Image    common.Image    `json:"image"`
+	Services common.Services `json:"services"`
 }
 
 type executor struct {
@@ -40,6 +42,7 @@ type executor struct {
 
 	buildLimits   api.ResourceList
 	serviceLimits api.ResourceList
+	pullPolicy    api.PullPolicy
 }
 
 func (s *executor) Prepare(globalConfig *common.Config, config *common.RunnerConfig, build *common.Build) error {
@@ -57,6 +60,8 @@ func (s *executor) Prepare(globalConfig *common.Config, config *common.RunnerCon
 		return err
 	}
 
+	build.BuildHostname = build.UniqueHostname()
+
 	s.kubeClient, err = getKubeClient(config.Kubernetes)
 	if err != nil {
 		return fmt.Errorf("error connecting to Kubernetes: %s", err.Error())
@@ -70,11 +75,15 @@ func (s *executor) Prepare(globalConfig *common.Config, config *common.RunnerCon
 		return err
 	}
 
+	if s.pullPolicy, err = pullPolicy(s.Config.Kubernetes.PullPolicy); err != nil {
+		return err
+	}
+
 	if err = s.checkDefaults(); err != nil {
 		return err
 	}
 
-	s.Println("Using Kubernetes executor with image", s.options.Image, "...")
+	s.Println("Using Kubernetes executor with image", s.options.Image.Name, "...")
 
 	return nil
 }
@@ -95,8 +104,8 @@ func (s *executor) Run(cmd common.ExecutorCommand) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	select {
 	case err := <-s.runInContainer(ctx, containerName, cmd.Script):
-		if err != nil && strings.Contains(err.Error(), "executing in Docker Container") {
-			return &common.BuildError{Inner: err}
+		if buildErr := newScriptError(err); buildErr != nil {
+			return buildErr
 		}
 		return err
 	case <-cmd.Abort:
@@ -105,6 +114,24 @@ func (s *executor) Run(cmd common.ExecutorCommand) error {
 	}
 }
 
+// scriptExitCodeRegex matches the error of the failed script, the remote command
+// reports it only as the message ending with the exit code of the script
+var scriptExitCodeRegex = regexp.MustCompile(`executing in Docker Container: (\d+)`)
+
+// newScriptError returns the build error of the failed script with its exit code,
+// it's nil for the other errors
+func newScriptError(err error) *common.BuildError {
+	if err == nil || !strings.Contains(err.Error(), "executing in Docker Container") {
+		return nil
+	}
+
+	buildErr := &common.BuildError{Inner: err}
+	if match := scriptExitCodeRegex.FindStringSubmatch(err.Error()); match != nil {
+		buildErr.ExitCode, _ = strconv.Atoi(match[1])
+	}
+	return buildErr
+}
+
 func (s *executor) Cleanup() {
 	if s.pod != nil {
 		err := s.kubeClient.Pods(s.pod.Namespace).Delete(s.pod.Name, nil)
@@ -126,10 +153,11 @@ func (s *executor) buildContainer(name, image string, limits api.ResourceList, c
 	}
 
 	return api.Container{
-		Name:    name,
-		Image:   image,
-		Command: command,
-		Env:     buildVariables(s.Build.GetAllVariables().PublicOrInternal()),
+		Name:            name,
+		Image:           image,
+		ImagePullPolicy: s.pullPolicy,
+		Command:         command,
+		Env:             buildVariables(s.Build.GetAllVariables().PublicOrInternal()),
 		Resources: api.ResourceRequirements{
 			Limits: limits,
 		},
@@ -146,14 +174,37 @@ func (s *executor) buildContainer(name, image string, limits api.ResourceList, c
 	}
 }
 
+// getBuildCommand returns the command reading the build script from the standard input,
+// the one defined by the build is used instead of the detected shell
+func (s *executor) getBuildCommand() []string {
+	if s.options.Image.Command != nil {
+		return s.options.Image.Command
+	}
+	return s.BuildShell.DockerCommand
+}
+
+// buildPodContainer creates the build container, which runs the entrypoint defined by the build
+// with the build command as its arguments, the empty entrypoint runs only the build command
+func (s *executor) buildPodContainer(image string) api.Container {
+	entrypoint := s.options.Image.Entrypoint
+	if len(entrypoint) == 0 || (len(entrypoint) == 1 && entrypoint[0] == "") {
+		return s.buildContainer("build", image, s.buildLimits, s.getBuildCommand()...)
+	}
+
+	container := s.buildContainer("build", image, s.buildLimits, entrypoint...)
+	container.Args = s.getBuildCommand()
+	return container
+}
+
 func (s *executor) setupBuildPod() error {
 	services := make([]api.Container, len(s.options.Services))
-	for i, image := range s.options.Services {
-		resolvedImage := s.Build.GetAllVariables().ExpandValue(image)
-		services[i] = s.buildContainer(fmt.Sprintf("svc-%d", i), resolvedImage, s.serviceLimits)
+	for i, service := range s.options.Services {
+		resolvedImage := s.Build.GetAllVariables().ExpandValue(service.Name)
+		services[i] = s.buildContainer(fmt.Sprintf("svc-%d", i), resolvedImage, s.serviceLimits, service.Entrypoint...)
+		services[i].Args = service.Command
 	}
 
-	buildImage := s.Build.GetAllVariables().ExpandValue(s.options.Image)
+	buildImage := s.Build.GetAllVariables().ExpandValue(s.options.Image.Name)
 	pod, err := s.kubeClient.Pods(s.Config.Kubernetes.Namespace).Create(&api.Pod{
 		ObjectMeta: api.ObjectMeta{
 			GenerateName: s.Build.ProjectUniqueName(),
@@ -168,9 +219,12 @@ func (s *executor) setupBuildPod() error {
 					},
 				},
 			},
-			RestartPolicy: api.RestartPolicyNever,
+			RestartPolicy:      api.RestartPolicyNever,
+			Hostname:           s.Build.BuildHostname,
+			ServiceAccountName: s.Config.Kubernetes.ServiceAccount,
+			NodeSelector:       s.Config.Kubernetes.NodeSelector,
 			Containers: append([]api.Container{
-				s.buildContainer("build", buildImage, s.buildLimits, s.BuildShell.DockerCommand...),
+				s.buildPodContainer(buildImage),
 			}, services...),
 		},
 	})
@@ -212,7 +266,7 @@ func (s *executor) runInContainer(ctx context.Context, name, command string) <-c
 			PodName:       s.pod.Name,
 			Namespace:     s.pod.Namespace,
 			ContainerName: name,
-			Command:       s.BuildShell.DockerCommand,
+			Command:       s.getBuildCommand(),
 			In:            strings.NewReader(command),
 			Out:           s.BuildTrace,
 			Err:           s.BuildTrace,
@@ -229,12 +283,12 @@ func (s *executor) runInContainer(ctx context.Context, name, command string) <-c
 }
 
 func (s *executor) checkDefaults() error {
-	if s.options.Image == "" {
+	if s.options.Image.Name == "" {
 		if s.Config.Kubernetes.Image == "" {
 			return fmt.Errorf("no image specified and no default set in config")
 		}
 
-		s.options.Image = s.Config.Kubernetes.Image
+		s.options.Image.Name = s.Config.Kubernetes.Image
 	}
 
 	if s.Config.Kubernetes.Namespace == "" {
@@ -5,6 +5,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
@@ -188,7 +189,7 @@ func TestPrepare(t *testing.T) {
 			},
 			Expected: &executor{
 				options: &kubernetesOptions{
-					Image: "test-image",
+					Image: common.Image{Name: "test-image"},
 				},
 				serviceLimits: api.ResourceList{
 					api.ResourceLimitsCPU:    resource.MustParse("0.5"),
@@ -225,7 +226,7 @@ func TestPrepare(t *testing.T) {
 			},
 			Expected: &executor{
 				options: &kubernetesOptions{
-					Image: "test-image",
+					Image: common.Image{Name: "test-image"},
 				},
 				serviceLimits: api.ResourceList{
 					api.ResourceLimitsCPU:    resource.MustParse("0.5"),
@@ -238,6 +239,55 @@ func TestPrepare(t *testing.T) {
 			},
 			Error: true,
 		},
+		{
+			GlobalConfig: &common.Config{},
+			RunnerConfig: &common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{
+					Kubernetes: &common.KubernetesConfig{
+						Host:       "test-server",
+						PullPolicy: "Always",
+					},
+				},
+			},
+			Build: &common.Build{
+				GetBuildResponse: common.GetBuildResponse{
+					Sha: "1234567890",
+					Options: common.BuildOptions{
+						"image": "test-image",
+					},
+				},
+				Runner: &common.RunnerConfig{},
+			},
+			Expected: &executor{
+				options: &kubernetesOptions{
+					Image: common.Image{Name: "test-image"},
+				},
+				serviceLimits: api.ResourceList{},
+				buildLimits:   api.ResourceList{},
+				pullPolicy:    api.PullAlways,
+			},
+		},
+		{
+			GlobalConfig: &common.Config{},
+			RunnerConfig: &common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{
+					Kubernetes: &common.KubernetesConfig{
+						Host:       "test-server",
+						PullPolicy: "Sometimes",
+					},
+				},
+			},
+			Build: &common.Build{
+				GetBuildResponse: common.GetBuildResponse{
+					Sha: "1234567890",
+					Options: common.BuildOptions{
+						"image": "test-image",
+					},
+				},
+				Runner: &common.RunnerConfig{},
+			},
+			Error: true,
+		},
 	}
 
 	for _, test := range tests {
@@ -273,6 +323,57 @@ func TestPrepare(t *testing.T) {
 	}
 }
 
+func TestBuildPodContainer(t *testing.T) {
+	tests := []struct {
+		Image   common.Image
+		Command []string
+		Args    []string
+	}{
+		{
+			Image:   common.Image{Name: "test-image"},
+			Command: []string{"sh"},
+		},
+		{
+			Image:   common.Image{Name: "test-image", Entrypoint: []string{""}, Command: []string{"/bin/bash"}},
+			Command: []string{"/bin/bash"},
+		},
+		{
+			Image:   common.Image{Name: "test-image", Entrypoint: []string{"/init"}},
+			Command: []string{"/init"},
+			Args:    []string{"sh"},
+		},
+	}
+
+	for _, test := range tests {
+		e := &executor{
+			AbstractExecutor: executors.AbstractExecutor{
+				Build: &common.Build{
+					Runner: &common.RunnerConfig{},
+				},
+				BuildShell: &common.ShellConfiguration{
+					DockerCommand: []string{"sh"},
+				},
+			},
+			options: &kubernetesOptions{Image: test.Image},
+		}
+
+		container := e.buildPodContainer(test.Image.Name)
+		assert.Equal(t, "build", container.Name)
+		assert.Equal(t, test.Command, container.Command)
+		assert.Equal(t, test.Args, container.Args)
+	}
+}
+
+func TestNewScriptError(t *testing.T) {
+	err := newScriptError(fmt.Errorf("error executing remote command: Error executing in Docker Container: 2"))
+	if assert.NotNil(t, err) {
+		assert.Equal(t, 2, err.ExitCode)
+	}
+
+	assert.Nil(t, newScriptError(fmt.Errorf("pod failed to enter running state: Failed")), "it's the system failure")
+	assert.Nil(t, newScriptError(nil))
+}
+
 func TestKubernetesSuccessRun(t *testing.T) {
 	if helpers.SkipIntegrationTests(t, "kubectl", "cluster-info") {
 		return
@@ -437,3 +538,5 @@ func (f FakeBuildTrace) Aborted() chan interface{} {
 func (f FakeBuildTrace) IsStdout() bool {
 	return false
 }
+func (f FakeBuildTrace) ScriptStarted()                        {}
+func (f FakeBuildTrace) SetCoverageRegex(regex *regexp.Regexp) {}
@@ -211,3 +211,14 @@ func buildVariables(bv common.BuildVariables) []api.EnvVar {
 	}
 	return e
 }
+
+// pullPolicy checks the pull policy of the images, the empty policy
+// leaves the default of the cluster
+func pullPolicy(policy string) (api.PullPolicy, error) {
+	switch api.PullPolicy(policy) {
+	case "", api.PullAlways, api.PullIfNotPresent, api.PullNever:
+		return api.PullPolicy(policy), nil
+	default:
+		return "", fmt.Errorf("unsupported pull_policy: %s, use one of: Always, IfNotPresent, Never", policy)
+	}
+}
@@ -213,6 +213,39 @@ func TestWaitForPodRunning(t *testing.T) {
 	}
 }
 
+func TestPullPolicy(t *testing.T) {
+	tests := []struct {
+		Policy   string
+		Expected api.PullPolicy
+		Error    bool
+	}{
+		{Policy: "", Expected: ""},
+		{Policy: "Always", Expected: api.PullAlways},
+		{Policy: "IfNotPresent", Expected: api.PullIfNotPresent},
+		{Policy: "Never", Expected: api.PullNever},
+		{Policy: "always", Error: true},
+		{Policy: "Sometimes", Error: true},
+	}
+
+	for _, test := range tests {
+		policy, err := pullPolicy(test.Policy)
+
+		if err != nil && !test.Error {
+			t.Errorf("[%s] Expected success. Got: %s", test.Policy, err.Error())
+			continue
+		}
+
+		if err == nil && test.Error {
+			t.Errorf("[%s] Expected error. Got: %v", test.Policy, policy)
+			continue
+		}
+
+		if policy != test.Expected {
+			t.Errorf("[%s] Invalid pull policy. Expected '%v', got: '%v'", test.Policy, test.Expected, policy)
+		}
+	}
+}
+
 type testWriter struct {
 	call func([]byte) (int, error)
 }
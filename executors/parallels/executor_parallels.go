@@ -288,6 +288,14 @@ func (s *executor) Prepare(globalConfig *common.Config, config *common.RunnerCon
 	if err != nil {
 		return err
 	}
+
+	err = s.DetectShell(s.sshCommand.CommandAvailable)
+	if err != nil {
+		return err
+	}
+	if s.BuildShell.PassFile {
+		return errors.New("Parallels doesn't support shells that require script file")
+	}
 	return nil
 }
 
@@ -298,8 +306,8 @@ func (s *executor) Run(cmd common.ExecutorCommand) error {
 		Stdin:       cmd.Script,
 		Abort:       cmd.Abort,
 	})
-	if _, ok := err.(*ssh.ExitError); ok {
-		err = &common.BuildError{Inner: err}
+	if exitErr, ok := err.(*ssh.ExitError); ok {
+		err = &common.BuildError{Inner: err, ExitCode: exitErr.ExitCode()}
 	}
 	return err
 }
@@ -2,11 +2,14 @@ package shell
 
 import (
 	"bytes"
+	"crypto/md5"
 	"errors"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
+	"syscall"
 
 	"fmt"
 	"github.com/Sirupsen/logrus"
@@ -17,8 +20,50 @@ import (
 	"time"
 )
 
+// maxBuildDirLockAttempts limits how many concurrent directories are tried
+// when the builds directory is used by other process
+const maxBuildDirLockAttempts = 100
+
 type executor struct {
 	executors.AbstractExecutor
+	scopes       int
+	buildDirLock *helpers.LockFile
+	priority     *buildPriority
+}
+
+// buildDirLockPath returns the lock file for the build directory, it's kept in the directory
+// next to the builds directory, which is private to the runner, so other users can't replace it
+func buildDirLockPath(rootDir, buildDir string) string {
+	name := fmt.Sprintf("%x.lock", md5.Sum([]byte(filepath.Clean(buildDir))))
+	return filepath.Join(filepath.Clean(rootDir)+".locks", name)
+}
+
+// lockBuildDir acquires an advisory lock of the build directory. When the directory
+// is already used by other process sharing the same builds_dir, the build is moved
+// to the next concurrent directory, so the jobs don't clean the sources of each other
+func (s *executor) lockBuildDir() error {
+	// Only the locks directory is created, the builds directory has to be owned by the user running the builds
+	locksDir := filepath.Dir(buildDirLockPath(s.Build.RootDir, s.Build.BuildDir))
+	if err := os.Mkdir(locksDir, 0700); err != nil && !os.IsExist(err) {
+		s.Warningln("Failed to lock the build directory:", err)
+		return nil
+	}
+
+	for i := 0; i < maxBuildDirLockAttempts; i++ {
+		lock, err := helpers.NewLockFile(buildDirLockPath(s.Build.RootDir, s.Build.BuildDir))
+		if err == nil {
+			s.buildDirLock = lock
+			return nil
+		} else if err != helpers.ErrFileLocked {
+			s.Warningln("Failed to lock the build directory:", err)
+			return nil
+		}
+
+		s.Debugln("Build directory", s.Build.BuildDir, "is used by other process")
+		s.Build.ProjectRunnerID++
+		s.Build.BuildDir = path.Join(s.Build.RootDir, s.Build.ProjectUniqueDir(s.SharedBuildsDir))
+	}
+	return errors.New("no free build directory found")
 }
 
 func (s *executor) Prepare(globalConfig *common.Config, config *common.RunnerConfig, build *common.Build) error {
@@ -50,14 +95,51 @@ func (s *executor) Prepare(globalConfig *common.Config, config *common.RunnerCon
 		return err
 	}
 
+	err = verifyCgroupConfig(s.Config.Cgroup)
+	if err != nil {
+		return err
+	}
+
+	s.priority, err = newBuildPriority(&s.Config.RunnerSettings)
+	if err != nil {
+		return err
+	}
+
+	err = s.lockBuildDir()
+	if err != nil {
+		return err
+	}
+
 	s.Println("Using Shell executor...")
 	return nil
 }
 
-func (s *executor) killAndWait(cmd *exec.Cmd, waitCh chan error) error {
+func (s *executor) Cleanup() {
+	s.buildDirLock.Unlock()
+	s.buildDirLock = nil
+	s.AbstractExecutor.Cleanup()
+}
+
+func (s *executor) newScope() *systemdScope {
+	cgroup := s.Config.Cgroup
+	if cgroup == nil || !cgroup.Enabled {
+		return nil
+	}
+
+	s.scopes++
+	return &systemdScope{
+		unit:   fmt.Sprintf("%s-build-%d-%d", s.Build.ProjectUniqueName(), s.Build.ID, s.scopes),
+		config: cgroup,
+	}
+}
+
+func (s *executor) killAndWait(cmd *exec.Cmd, scope *systemdScope, waitCh chan error) error {
 	for {
 		s.Debugln("Aborting command...")
 		helpers.KillProcessGroup(cmd)
+		if scope != nil {
+			scope.kill()
+		}
 		select {
 		case <-time.After(time.Second):
 		case err := <-waitCh:
@@ -67,13 +149,31 @@ func (s *executor) killAndWait(cmd *exec.Cmd, waitCh chan error) error {
 }
 
 func (s *executor) Run(cmd common.ExecutorCommand) error {
+	command, arguments := s.BuildShell.Command, s.BuildShell.Arguments
+
+	// Lower the priority of the build processes if requested
+	if s.priority != nil {
+		command, arguments = s.priority.wrap(command, arguments)
+	}
+
+	// Run the build in a dedicated cgroup if requested
+	scope := s.newScope()
+	if scope != nil {
+		s.Debugln("Using systemd scope", scope.unit, "...")
+		command, arguments = scope.wrap(command, arguments)
+		defer scope.kill()
+	}
+
 	// Create execution command
-	c := exec.Command(s.BuildShell.Command, s.BuildShell.Arguments...)
+	c := exec.Command(command, arguments...)
 	if c == nil {
 		return errors.New("Failed to generate execution command")
 	}
 
 	helpers.SetProcessGroup(c)
+	if s.priority != nil {
+		s.priority.setPriorityClass(c)
+	}
 	defer helpers.KillProcessGroup(c)
 
 	// Fill process environment variables
@@ -100,7 +200,7 @@ func (s *executor) Run(cmd common.ExecutorCommand) error {
 	}
 
 	// Start a process
-	err := c.Start()
+	err := helpers.StartProcessGroup(c)
 	if err != nil {
 		return fmt.Errorf("Failed to start process: %s", err)
 	}
@@ -109,8 +209,12 @@ func (s *executor) Run(cmd common.ExecutorCommand) error {
 	waitCh := make(chan error)
 	go func() {
 		err := c.Wait()
-		if _, ok := err.(*exec.ExitError); ok {
-			err = &common.BuildError{Inner: err}
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			buildErr := &common.BuildError{Inner: err}
+			if status, ok := exitErr.Sys().(syscall.WaitStatus); ok {
+				buildErr.ExitCode = status.ExitStatus()
+			}
+			err = buildErr
 		}
 		waitCh <- err
 	}()
@@ -121,7 +225,7 @@ func (s *executor) Run(cmd common.ExecutorCommand) error {
 		return err
 
 	case <-cmd.Abort:
-		return s.killAndWait(c, waitCh)
+		return s.killAndWait(c, scope, waitCh)
 	}
 }
 
@@ -142,6 +246,10 @@ func init() {
 			RunnerCommand: runnerCommand,
 		},
 		ShowHostname: false,
+		ShellAvailable: func(shell string) bool {
+			_, err := exec.LookPath(shell)
+			return err == nil
+		},
 	}
 
 	creator := func() common.Executor {
@@ -154,6 +262,7 @@ func init() {
 
 	featuresUpdater := func(features *common.FeaturesInfo) {
 		features.Variables = true
+		features.Shared = true
 	}
 
 	common.RegisterExecutor("shell", executors.DefaultExecutorProvider{
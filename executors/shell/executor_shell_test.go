@@ -1,6 +1,7 @@
 package shell_test
 
 import (
+	"io/ioutil"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -10,6 +11,14 @@ import (
 	"time"
 )
 
+func TestMain(m *testing.M) {
+	code := m.Run()
+
+	// The builds use the default builds directory, so the locks are created next to it
+	os.RemoveAll("builds.locks")
+	os.Exit(code)
+}
+
 func TestBashShellSuccessRun(t *testing.T) {
 	if helpers.SkipIntegrationTests(t, "bash") {
 		return
@@ -130,3 +139,57 @@ func TestShellBuildCancel(t *testing.T) {
 	assert.EqualError(t, err, "canceled")
 	assert.IsType(t, err, &common.BuildError{})
 }
+
+func TestShellBuildDirLocking(t *testing.T) {
+	buildsDir, err := ioutil.TempDir("", "builds")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(buildsDir)
+	defer os.RemoveAll(buildsDir + ".locks")
+
+	runner := &common.RunnerConfig{
+		RunnerSettings: common.RunnerSettings{
+			Executor:  "shell",
+			BuildsDir: buildsDir,
+		},
+	}
+	newBuild := func() *common.Build {
+		return &common.Build{
+			GetBuildResponse: common.SuccessfulBuild,
+			Runner:           runner,
+			Trace:            &common.Trace{Writer: os.Stdout},
+		}
+	}
+
+	first := common.NewExecutor("shell")
+	firstBuild := newBuild()
+	err = first.Prepare(&common.Config{}, runner, firstBuild)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	second := common.NewExecutor("shell")
+	secondBuild := newBuild()
+	err = second.Prepare(&common.Config{}, runner, secondBuild)
+	if !assert.NoError(t, err) {
+		first.Cleanup()
+		return
+	}
+	assert.Equal(t, 0, firstBuild.ProjectRunnerID)
+	assert.Equal(t, 1, secondBuild.ProjectRunnerID)
+	assert.NotEqual(t, firstBuild.BuildDir, secondBuild.BuildDir)
+	locks, err := ioutil.ReadDir(buildsDir + ".locks")
+	assert.NoError(t, err)
+	assert.Len(t, locks, 2, "the locks are next to the builds directory")
+
+	first.Cleanup()
+	second.Cleanup()
+
+	third := common.NewExecutor("shell")
+	thirdBuild := newBuild()
+	err = third.Prepare(&common.Config{}, runner, thirdBuild)
+	assert.NoError(t, err)
+	assert.Equal(t, firstBuild.BuildDir, thirdBuild.BuildDir, "the released directory should be reused")
+	third.Cleanup()
+}
@@ -0,0 +1,101 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+const (
+	ioniceIdle       = "idle"
+	ioniceBestEffort = "best-effort"
+)
+
+// buildPriority lowers the CPU and IO priority of the build processes,
+// so the builds don't slow down the interactive use of the machine
+type buildPriority struct {
+	nice    int
+	ioClass string
+	ioLevel string
+}
+
+func newBuildPriority(settings *common.RunnerSettings) (*buildPriority, error) {
+	if settings.Nice == 0 && settings.IONice == "" {
+		return nil, nil
+	}
+
+	if settings.Nice < -20 || settings.Nice > 19 {
+		return nil, fmt.Errorf("nice has to be between -20 and 19, got %d", settings.Nice)
+	}
+
+	priority := &buildPriority{
+		nice: settings.Nice,
+	}
+	if settings.IONice == "" {
+		return priority, nil
+	}
+
+	if runtime.GOOS != "linux" {
+		return nil, errors.New("ionice is supported only on Linux")
+	}
+	if _, err := exec.LookPath("ionice"); err != nil {
+		return nil, fmt.Errorf("ionice is not available: %v", err)
+	}
+
+	class, level := settings.IONice, ""
+	if parts := strings.SplitN(settings.IONice, ":", 2); len(parts) == 2 {
+		class, level = parts[0], parts[1]
+	}
+
+	switch class {
+	case ioniceIdle:
+		priority.ioClass = "3"
+		if level != "" {
+			return nil, errors.New("ionice idle class doesn't have levels")
+		}
+	case ioniceBestEffort:
+		priority.ioClass = "2"
+		if level != "" {
+			if value, err := strconv.Atoi(level); err != nil || value < 0 || value > 7 {
+				return nil, fmt.Errorf("ionice best-effort level has to be between 0 and 7, got %q", level)
+			}
+			priority.ioLevel = level
+		}
+	default:
+		return nil, fmt.Errorf("unsupported ionice class: %q, use idle or best-effort", class)
+	}
+	return priority, nil
+}
+
+// wrap starts the command with nice and ionice, they exec the command
+// in the same process, so it stays in the process group of the build
+func (p *buildPriority) wrap(command string, arguments []string) (string, []string) {
+	var wrapper []string
+	if p.nice != 0 && runtime.GOOS != "windows" {
+		wrapper = append(wrapper, "nice", "-n", strconv.Itoa(p.nice))
+	}
+	if p.ioClass != "" {
+		wrapper = append(wrapper, "ionice", "-c", p.ioClass)
+		if p.ioLevel != "" {
+			wrapper = append(wrapper, "-n", p.ioLevel)
+		}
+	}
+	if len(wrapper) == 0 {
+		return command, arguments
+	}
+
+	wrapper = append(wrapper, command)
+	return wrapper[0], append(wrapper[1:], arguments...)
+}
+
+// setPriorityClass sets the priority of the build on Windows, it's inherited by the child processes
+func (p *buildPriority) setPriorityClass(cmd *exec.Cmd) {
+	if p.nice != 0 {
+		setProcessPriorityClass(cmd, p.nice)
+	}
+}
@@ -0,0 +1,11 @@
+// +build !windows
+
+package shell
+
+import (
+	"os/exec"
+)
+
+// setProcessPriorityClass isn't needed, the niceness is set by the nice command
+func setProcessPriorityClass(cmd *exec.Cmd, nice int) {
+}
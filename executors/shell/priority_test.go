@@ -0,0 +1,75 @@
+// +build !windows
+
+package shell
+
+import (
+	"os/exec"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func TestBuildPriorityWrap(t *testing.T) {
+	priority := &buildPriority{
+		nice:    10,
+		ioClass: "2",
+		ioLevel: "7",
+	}
+
+	command, arguments := priority.wrap("bash", []string{"--login"})
+	assert.Equal(t, "nice", command)
+	assert.Equal(t, []string{"-n", "10", "ionice", "-c", "2", "-n", "7", "bash", "--login"}, arguments)
+}
+
+func TestBuildPriorityWrapOnlyIONice(t *testing.T) {
+	priority := &buildPriority{
+		ioClass: "3",
+	}
+
+	command, arguments := priority.wrap("bash", nil)
+	assert.Equal(t, "ionice", command)
+	assert.Equal(t, []string{"-c", "3", "bash"}, arguments)
+}
+
+func TestBuildPriorityDisabled(t *testing.T) {
+	priority, err := newBuildPriority(&common.RunnerSettings{})
+	assert.NoError(t, err)
+	assert.Nil(t, priority)
+}
+
+func TestBuildPriorityInvalidNice(t *testing.T) {
+	_, err := newBuildPriority(&common.RunnerSettings{Nice: 20})
+	assert.Error(t, err)
+
+	priority, err := newBuildPriority(&common.RunnerSettings{Nice: 19})
+	assert.NoError(t, err)
+	assert.Equal(t, &buildPriority{nice: 19}, priority)
+}
+
+func TestBuildPriorityIONice(t *testing.T) {
+	if _, err := exec.LookPath("ionice"); runtime.GOOS != "linux" || err != nil {
+		t.Skip("ionice is not available")
+	}
+
+	examples := map[string]*buildPriority{
+		"idle":          {ioClass: "3"},
+		"best-effort":   {ioClass: "2"},
+		"best-effort:4": {ioClass: "2", ioLevel: "4"},
+		"best-effort:8": nil,
+		"idle:1":        nil,
+		"realtime":      nil,
+	}
+
+	for ionice, expected := range examples {
+		priority, err := newBuildPriority(&common.RunnerSettings{IONice: ionice})
+		if expected == nil {
+			assert.Error(t, err, ionice)
+		} else {
+			assert.NoError(t, err, ionice)
+			assert.Equal(t, expected, priority, ionice)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package shell
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+const (
+	idlePriorityClass        = 0x00000040
+	belowNormalPriorityClass = 0x00004000
+	aboveNormalPriorityClass = 0x00008000
+)
+
+// setProcessPriorityClass maps the niceness to the closest priority class
+func setProcessPriorityClass(cmd *exec.Cmd, nice int) {
+	var class uint32
+	switch {
+	case nice >= 15:
+		class = idlePriorityClass
+	case nice > 0:
+		class = belowNormalPriorityClass
+	default:
+		class = aboveNormalPriorityClass
+	}
+
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= class
+}
@@ -0,0 +1,59 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+// systemdScope places the build process tree in a transient systemd scope,
+// so it can be limited in resources and killed as a whole
+type systemdScope struct {
+	unit   string
+	config *common.CgroupConfig
+}
+
+func (s *systemdScope) properties() (properties []string) {
+	if s.config.CPUQuota != "" {
+		properties = append(properties, "CPUQuota="+s.config.CPUQuota)
+	}
+	if s.config.MemoryLimit != "" {
+		properties = append(properties, "MemoryLimit="+s.config.MemoryLimit)
+	}
+	if s.config.PidsLimit > 0 {
+		properties = append(properties, "TasksMax="+strconv.Itoa(s.config.PidsLimit))
+	}
+	return
+}
+
+func (s *systemdScope) wrap(command string, arguments []string) (string, []string) {
+	scopeArguments := []string{"--scope", "--quiet", "--unit=" + s.unit}
+	for _, property := range s.properties() {
+		scopeArguments = append(scopeArguments, "--property="+property)
+	}
+	scopeArguments = append(scopeArguments, "--", command)
+	scopeArguments = append(scopeArguments, arguments...)
+	return "systemd-run", scopeArguments
+}
+
+// kill terminates all processes left in the scope
+func (s *systemdScope) kill() error {
+	return exec.Command("systemctl", "kill", "--signal=SIGKILL", s.unit+".scope").Run()
+}
+
+func verifyCgroupConfig(config *common.CgroupConfig) error {
+	if config == nil || !config.Enabled {
+		return nil
+	}
+	if runtime.GOOS != "linux" {
+		return errors.New("cgroup limits are supported only on Linux")
+	}
+	if _, err := exec.LookPath("systemd-run"); err != nil {
+		return fmt.Errorf("cgroup limits require systemd: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package shell
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func TestSystemdScopeWrap(t *testing.T) {
+	scope := &systemdScope{
+		unit: "runner-build",
+		config: &common.CgroupConfig{
+			Enabled:     true,
+			CPUQuota:    "200%",
+			MemoryLimit: "2G",
+			PidsLimit:   512,
+		},
+	}
+
+	command, arguments := scope.wrap("bash", []string{"--login"})
+	assert.Equal(t, "systemd-run", command)
+	assert.Equal(t, []string{
+		"--scope", "--quiet", "--unit=runner-build",
+		"--property=CPUQuota=200%",
+		"--property=MemoryLimit=2G",
+		"--property=TasksMax=512",
+		"--", "bash", "--login",
+	}, arguments)
+}
+
+func TestSystemdScopeWithoutLimits(t *testing.T) {
+	scope := &systemdScope{
+		unit:   "runner-build",
+		config: &common.CgroupConfig{Enabled: true},
+	}
+
+	_, arguments := scope.wrap("bash", nil)
+	assert.Equal(t, []string{"--scope", "--quiet", "--unit=runner-build", "--", "bash"}, arguments)
+}
+
+func TestVerifyDisabledCgroupConfig(t *testing.T) {
+	assert.NoError(t, verifyCgroupConfig(nil))
+	assert.NoError(t, verifyCgroupConfig(&common.CgroupConfig{}))
+}
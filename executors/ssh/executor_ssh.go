@@ -42,6 +42,14 @@ func (s *executor) Prepare(globalConfig *common.Config, config *common.RunnerCon
 	if err != nil {
 		return err
 	}
+
+	err = s.DetectShell(s.sshCommand.CommandAvailable)
+	if err != nil {
+		return err
+	}
+	if s.BuildShell.PassFile {
+		return errors.New("SSH doesn't support shells that require script file")
+	}
 	return nil
 }
 
@@ -52,8 +60,8 @@ func (s *executor) Run(cmd common.ExecutorCommand) error {
 		Stdin:       cmd.Script,
 		Abort:       cmd.Abort,
 	})
-	if _, ok := err.(*ssh.ExitError); ok {
-		err = &common.BuildError{Inner: err}
+	if exitErr, ok := err.(*ssh.ExitError); ok {
+		err = &common.BuildError{Inner: err, ExitCode: exitErr.ExitCode()}
 	}
 	return err
 }
@@ -85,6 +93,7 @@ func init() {
 
 	featuresUpdater := func(features *common.FeaturesInfo) {
 		features.Variables = true
+		features.Shared = true
 	}
 
 	common.RegisterExecutor("ssh", executors.DefaultExecutorProvider{
@@ -269,6 +269,14 @@ func (s *executor) Prepare(globalConfig *common.Config, config *common.RunnerCon
 	if err != nil {
 		return err
 	}
+
+	err = s.DetectShell(s.sshCommand.CommandAvailable)
+	if err != nil {
+		return err
+	}
+	if s.BuildShell.PassFile {
+		return errors.New("virtualbox doesn't support shells that require script file")
+	}
 	return nil
 }
 
@@ -279,8 +287,8 @@ func (s *executor) Run(cmd common.ExecutorCommand) error {
 		Stdin:       cmd.Script,
 		Abort:       cmd.Abort,
 	})
-	if _, ok := err.(*ssh.ExitError); ok {
-		err = &common.BuildError{Inner: err}
+	if exitErr, ok := err.(*ssh.ExitError); ok {
+		err = &common.BuildError{Inner: err, ExitCode: exitErr.ExitCode()}
 	}
 	return err
 }
@@ -1,5 +1,7 @@
 package helpers
 
+import "os"
+
 const (
 	ANSI_BOLD_BLACK   = "\033[30;1m"
 	ANSI_BOLD_RED     = "\033[31;1m"
@@ -13,3 +15,8 @@ const (
 	ANSI_RESET        = "\033[0;m"
 	ANSI_CLEAR        = "\033[0K"
 )
+
+// NoColor checks if the colors are disabled with the NO_COLOR environment variable
+func NoColor() bool {
+	return os.Getenv("NO_COLOR") != ""
+}
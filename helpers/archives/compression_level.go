@@ -0,0 +1,45 @@
+package archives
+
+import (
+	"compress/flate"
+	"fmt"
+)
+
+// CompressionLevel trades the time of creating the archive for its size
+type CompressionLevel string
+
+const (
+	CompressionFastest CompressionLevel = "fastest"
+	CompressionFast    CompressionLevel = "fast"
+	CompressionDefault CompressionLevel = "default"
+	CompressionSlow    CompressionLevel = "slow"
+	CompressionSlowest CompressionLevel = "slowest"
+)
+
+var compressionLevels = map[CompressionLevel]int{
+	CompressionFastest: flate.BestSpeed,
+	CompressionFast:    3,
+	CompressionDefault: flate.DefaultCompression,
+	CompressionSlow:    7,
+	CompressionSlowest: flate.BestCompression,
+}
+
+// Get returns the level of the deflate compression, the empty level is the default one
+func (l CompressionLevel) Get() (int, error) {
+	if l == "" {
+		return flate.DefaultCompression, nil
+	}
+
+	level, ok := compressionLevels[l]
+	if !ok {
+		return 0, fmt.Errorf("unknown compression level: %s, use one of: fastest, fast, default, slow, slowest", l)
+	}
+	return level, nil
+}
+
+func (o *ArchiveOptions) compressionLevel() (int, error) {
+	if o == nil {
+		return flate.DefaultCompression, nil
+	}
+	return o.CompressionLevel.Get()
+}
@@ -0,0 +1,66 @@
+package archives
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func copyFile(source, destination string, mode os.FileMode) error {
+	in, err := os.Open(fixLongPath(source))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	os.Remove(fixLongPath(destination))
+	out, err := os.OpenFile(fixLongPath(destination), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// copyPath copies the file or the whole directory tree from source to destination
+func copyPath(source, destination string) error {
+	fi, err := os.Stat(fixLongPath(source))
+	if err != nil {
+		return err
+	}
+
+	if !fi.IsDir() {
+		return copyFile(source, destination, fi.Mode().Perm())
+	}
+
+	relative, err := filepath.Rel(source, destination)
+	if err == nil && !strings.HasPrefix(relative, "..") {
+		return errors.New("can't copy directory into itself")
+	}
+
+	return filepath.Walk(source, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relative, err := filepath.Rel(source, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(destination, relative)
+
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(fixLongPath(target), info.Mode().Perm())
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		default:
+			// Nested links and special files are not copied
+			return nil
+		}
+	})
+}
@@ -0,0 +1,8 @@
+// +build !windows
+
+package archives
+
+// fixLongPath is a no-op: there's no MAX_PATH limitation on these platforms
+func fixLongPath(path string) string {
+	return path
+}
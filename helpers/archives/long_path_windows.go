@@ -0,0 +1,32 @@
+package archives
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+const longPathPrefix = `\\?\`
+
+// Windows API refuses to create directories with more than 248 characters
+// and files with more than 260 characters (MAX_PATH), unless the path
+// is passed in the extended-length (\\?\) form
+const maxShortPath = 248
+
+// fixLongPath converts path to an absolute extended-length path when it is
+// too long to be handled by the Windows API
+func fixLongPath(path string) string {
+	if strings.HasPrefix(path, longPathPrefix) {
+		return path
+	}
+
+	absolute, err := filepath.Abs(path)
+	if err != nil || len(absolute) < maxShortPath {
+		return path
+	}
+
+	// UNC paths use a different prefix: \\server\share -> \\?\UNC\server\share
+	if strings.HasPrefix(absolute, `\\`) {
+		return longPathPrefix + `UNC\` + absolute[2:]
+	}
+	return longPathPrefix + absolute
+}
@@ -0,0 +1,34 @@
+package archives
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFixLongPathShort(t *testing.T) {
+	assert.Equal(t, "short.txt", fixLongPath("short.txt"))
+}
+
+func TestFixLongPathAlreadyFixed(t *testing.T) {
+	path := longPathPrefix + `C:\` + strings.Repeat("a", 300)
+	assert.Equal(t, path, fixLongPath(path))
+}
+
+func TestFixLongPathAbsolute(t *testing.T) {
+	path := `C:\` + strings.Repeat(`directory\`, 30) + "file.txt"
+	assert.Equal(t, longPathPrefix+path, fixLongPath(path))
+}
+
+func TestFixLongPathUNC(t *testing.T) {
+	path := `\\server\share\` + strings.Repeat(`directory\`, 30) + "file.txt"
+	assert.Equal(t, longPathPrefix+`UNC\`+path[2:], fixLongPath(path))
+}
+
+func TestFixLongPathRelative(t *testing.T) {
+	path := strings.Repeat("directory/", 30) + "file.txt"
+	fixed := fixLongPath(path)
+	assert.True(t, strings.HasPrefix(fixed, longPathPrefix))
+	assert.True(t, strings.HasSuffix(fixed, `directory\file.txt`))
+}
@@ -0,0 +1,98 @@
+package archives
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var errPathEscapes = errors.New("path escapes the extraction directory")
+
+// isPathInside checks if the relative path stays inside the current directory
+func isPathInside(name string) bool {
+	if filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return false
+	}
+
+	name = filepath.Clean(filepath.FromSlash(name))
+	return name != ".." && !strings.HasPrefix(name, ".."+string(filepath.Separator))
+}
+
+// extractionRoot is the directory to which the archive is extracted, with resolved symlinks
+func extractionRoot() (string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(wd)
+}
+
+func isResolvedPathInside(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && isPathInside(rel)
+}
+
+// isResolvedInside checks if the path, with all the existing symlinks resolved, stays inside root
+func isResolvedInside(root, path string) (bool, error) {
+	// The missing directories would be created, so only the existing ones can be symlinks
+	for {
+		if _, err := os.Lstat(path); err == nil {
+			break
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			break
+		}
+		path = parent
+	}
+
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false, err
+	}
+	if !filepath.IsAbs(resolved) {
+		resolved = filepath.Join(root, resolved)
+	}
+	return isResolvedPathInside(root, resolved), nil
+}
+
+// verifyEntryPath rejects the entries that would be written outside of root,
+// either by their name or through the symlinks extracted before them
+func verifyEntryPath(root, name string) error {
+	if !isPathInside(name) {
+		return errPathEscapes
+	}
+
+	inside, err := isResolvedInside(root, filepath.Clean(filepath.FromSlash(name)))
+	if err != nil {
+		return err
+	}
+	if !inside {
+		return errPathEscapes
+	}
+	return nil
+}
+
+// verifySymlinkTarget rejects the symlinks pointing outside of root
+func verifySymlinkTarget(root, name, target string) error {
+	// The target isn't cleaned, as the symlinks have to be resolved before the ".." elements
+	path := filepath.FromSlash(target)
+	if !filepath.IsAbs(path) {
+		path = filepath.Dir(filepath.FromSlash(name)) + string(filepath.Separator) + path
+		if !isPathInside(path) {
+			return errPathEscapes
+		}
+	} else if !isResolvedPathInside(root, filepath.Clean(path)) {
+		return errPathEscapes
+	}
+
+	inside, err := isResolvedInside(root, path)
+	if err != nil {
+		return err
+	}
+	if !inside {
+		return errPathEscapes
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+// +build !windows
+
+package archives
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPathInside(t *testing.T) {
+	assert.True(t, isPathInside("file"))
+	assert.True(t, isPathInside("dir/../file"))
+	assert.True(t, isPathInside("..file"))
+	assert.False(t, isPathInside(".."))
+	assert.False(t, isPathInside("../file"))
+	assert.False(t, isPathInside("dir/../../file"))
+	assert.False(t, isPathInside("/file"))
+}
+
+func TestExtractZipArchiveRejectsEscapingEntries(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "archive")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	outsideDir := filepath.Join(tempDir, "outside")
+	extractDir := filepath.Join(tempDir, "extract")
+	assert.NoError(t, os.Mkdir(outsideDir, 0755))
+	assert.NoError(t, os.Mkdir(extractDir, 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(outsideDir, "secret"), []byte("secret"), 0644))
+
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	defer os.Chdir(wd)
+	err = os.Chdir(extractDir)
+	assert.NoError(t, err)
+
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	createEntry := func(name string, mode os.FileMode, content string) {
+		fh := &zip.FileHeader{Name: name}
+		fh.SetMode(mode)
+		fw, err := archive.CreateHeader(fh)
+		assert.NoError(t, err)
+		io.WriteString(fw, content)
+	}
+	createEntry("../outside/dotdot", 0644, "test")
+	createEntry(filepath.Join(outsideDir, "absolute"), 0644, "test")
+	createEntry("dir_link", os.ModeSymlink|0777, outsideDir)
+	createEntry("dir_link/through_link", 0644, "test")
+	createEntry("relative_link", os.ModeSymlink|0777, "../outside/secret")
+	createEntry("self_link", os.ModeSymlink|0777, ".")
+	createEntry("parent_link", os.ModeSymlink|0777, "self_link/..")
+	createEntry("inside_link", os.ModeSymlink|0777, "file.txt")
+	createEntry("file.txt", 0644, "test")
+	archive.Close()
+
+	reader, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	err = ExtractZipArchive(reader)
+	assert.NoError(t, err)
+
+	files, err := ioutil.ReadDir(outsideDir)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(files), "nothing should be written outside")
+
+	for _, name := range []string{"dir_link", "relative_link", "parent_link"} {
+		fi, err := os.Lstat(name)
+		assert.True(t, err != nil || fi.Mode()&os.ModeSymlink == 0, name+" shouldn't be a symlink")
+	}
+
+	data, err := ioutil.ReadFile("inside_link")
+	assert.NoError(t, err)
+	assert.Equal(t, "test", string(data))
+}
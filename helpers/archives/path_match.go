@@ -0,0 +1,116 @@
+package archives
+
+import (
+	"path"
+	"strings"
+)
+
+func splitPath(name string) []string {
+	name = strings.Trim(path.Clean("/"+name), "/")
+	if name == "" {
+		return nil
+	}
+	return strings.Split(name, "/")
+}
+
+// matchSegments matches the path components,
+// with prefix it also matches the files below the matched directory
+func matchSegments(patterns, names []string, prefix bool) bool {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			// try to consume any number of directories
+			for i := 0; i <= len(names); i++ {
+				if matchSegments(patterns[1:], names[i:], prefix) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(names) == 0 {
+			return false
+		}
+		if matched, err := path.Match(patterns[0], names[0]); err != nil || !matched {
+			return false
+		}
+		patterns, names = patterns[1:], names[1:]
+	}
+
+	// the pattern can match the parent directory
+	return prefix || len(names) == 0
+}
+
+// MatchPath reports whether the slash-separated name matches the pattern.
+// The pattern uses the path.Match syntax for each path component extended
+// with "**" that matches any number of directories, eg. "dist/**/*.js".
+// A pattern matching a directory matches all files inside of it as well.
+func MatchPath(pattern, name string) bool {
+	patterns := splitPath(pattern)
+	if len(patterns) == 0 {
+		return false
+	}
+	return matchSegments(patterns, splitPath(name), true)
+}
+
+// MatchAnyPath reports whether the name matches at least one of the patterns
+func MatchAnyPath(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if MatchPath(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchExcludePattern(pattern string, names []string, isDir bool) bool {
+	dirOnly := strings.HasSuffix(pattern, "/")
+	pattern = strings.TrimSuffix(pattern, "/")
+
+	// the pattern without slash matches the name in any directory
+	if !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+
+	patterns := splitPath(pattern)
+	if len(patterns) == 0 {
+		return false
+	}
+
+	// the trailing "**" matches everything inside of the directory, but not the directory itself
+	if last := len(patterns) - 1; patterns[last] == "**" {
+		return len(names) > 0 && matchSegments(patterns[:last], names[:len(names)-1], true)
+	}
+
+	if !dirOnly {
+		return matchSegments(patterns, names, true)
+	}
+
+	// the directory pattern matches the directory and the files inside of it
+	if isDir && matchSegments(patterns, names, false) {
+		return true
+	}
+	return len(names) > 1 && matchSegments(patterns, names[:len(names)-1], true)
+}
+
+// IsExcludedPath reports whether the slash-separated name is excluded by one
+// of the patterns using the .gitignore rules: the pattern without slash
+// matches in any directory, trailing slash matches only directories and
+// "!" re-includes the paths excluded by the previous patterns.
+func IsExcludedPath(patterns []string, name string, isDir bool) bool {
+	names := splitPath(name)
+	excluded := false
+
+	for _, pattern := range patterns {
+		negate := strings.HasPrefix(pattern, "!")
+		if negate {
+			pattern = pattern[1:]
+		}
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		if matchExcludePattern(pattern, names, isDir) {
+			excluded = !negate
+		}
+	}
+	return excluded
+}
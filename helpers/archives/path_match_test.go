@@ -0,0 +1,76 @@
+package archives
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatchPath(t *testing.T) {
+	examples := []struct {
+		pattern string
+		name    string
+		matches bool
+	}{
+		{"dist", "dist", true},
+		{"dist", "dist/app.js", true},
+		{"dist/", "dist/js/app.js", true},
+		{"dist", "distribution/app.js", false},
+		{"dist/**", "dist/js/app.js", true},
+		{"dist/**/*.js", "dist/app.js", true},
+		{"dist/**/*.js", "dist/js/lib/app.js", true},
+		{"dist/**/*.js", "dist/js/app.css", false},
+		{"**/*.log", "log.log", true},
+		{"**/*.log", "target/tmp/build.log", true},
+		{"target/tmp/**", "target/tmp/a/b", true},
+		{"target/tmp/**", "target/app", false},
+		{"*.txt", "file.txt", true},
+		{"*.txt", "dir/file.txt", false},
+		{"./dist", "dist/app.js", true},
+		{"", "dist", false},
+	}
+
+	for _, example := range examples {
+		assert.Equal(t, example.matches, MatchPath(example.pattern, example.name),
+			"pattern %q for %q", example.pattern, example.name)
+	}
+}
+
+func TestMatchAnyPath(t *testing.T) {
+	patterns := []string{"dist/**", "*.md"}
+	assert.True(t, MatchAnyPath(patterns, "dist/app.js"))
+	assert.True(t, MatchAnyPath(patterns, "README.md"))
+	assert.False(t, MatchAnyPath(patterns, "src/app.js"))
+	assert.False(t, MatchAnyPath(nil, "src/app.js"))
+}
+
+func TestIsExcludedPath(t *testing.T) {
+	examples := []struct {
+		patterns []string
+		name     string
+		isDir    bool
+		excluded bool
+	}{
+		{[]string{"target/tmp/**"}, "target/tmp/build.o", false, true},
+		{[]string{"target/tmp/**"}, "target/app", false, false},
+		{[]string{"target/tmp/**"}, "target/tmp", true, false},
+		{[]string{"target/tmp/**"}, "target/tmp/cache", true, true},
+		{[]string{"target/tmp/**", "!target/tmp/keep"}, "target/tmp/keep", false, false},
+		{[]string{"**"}, "file", false, true},
+		{[]string{"*.log"}, "build.log", false, true},
+		{[]string{"*.log"}, "target/logs/build.log", false, true},
+		{[]string{"/build.log"}, "target/build.log", false, false},
+		{[]string{"tmp/"}, "tmp", true, true},
+		{[]string{"tmp/"}, "tmp", false, false},
+		{[]string{"tmp/"}, "target/tmp/file", false, true},
+		{[]string{"tmp"}, "target/tmp", false, true},
+		{[]string{"*.log", "!important.log"}, "important.log", false, false},
+		{[]string{"*.log", "!important.log"}, "other.log", false, true},
+		{[]string{"# comment", ""}, "file", false, false},
+	}
+
+	for _, example := range examples {
+		assert.Equal(t, example.excluded, IsExcludedPath(example.patterns, example.name, example.isDir),
+			"patterns %v for %q", example.patterns, example.name)
+	}
+}
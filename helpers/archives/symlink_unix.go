@@ -0,0 +1,7 @@
+// +build !windows
+
+package archives
+
+func isSymlinkNotPermitted(err error) bool {
+	return false
+}
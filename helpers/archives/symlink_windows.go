@@ -0,0 +1,17 @@
+package archives
+
+import (
+	"os"
+	"syscall"
+)
+
+// ERROR_PRIVILEGE_NOT_HELD is returned when the process doesn't have
+// the SeCreateSymbolicLinkPrivilege (non-elevated, non-developer mode)
+const errorPrivilegeNotHeld = syscall.Errno(1314)
+
+func isSymlinkNotPermitted(err error) bool {
+	if linkErr, ok := err.(*os.LinkError); ok {
+		return linkErr.Err == errorPrivilegeNotHeld
+	}
+	return false
+}
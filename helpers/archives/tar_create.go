@@ -0,0 +1,170 @@
+package archives
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+func (o *ArchiveOptions) normalizeTarHeader(th *tar.Header) {
+	if o == nil || !o.Reproducible {
+		return
+	}
+
+	th.ModTime = reproducibleModTime
+	th.AccessTime = time.Time{}
+	th.ChangeTime = time.Time{}
+	th.Uid, th.Gid = 0, 0
+	th.Uname, th.Gname = "", ""
+}
+
+func createTarFileEntry(archive *tar.Writer, th *tar.Header, fileName string) error {
+	file, err := os.Open(fixLongPath(fileName))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	err = archive.WriteHeader(th)
+	if err != nil {
+		return err
+	}
+
+	// The file can't grow over the size stored in the header
+	_, err = io.CopyN(archive, file, th.Size)
+	return err
+}
+
+func createTarEntry(archive *tar.Writer, fileName string, options *ArchiveOptions) error {
+	fi, err := os.Lstat(fixLongPath(fileName))
+	if err != nil {
+		logrus.Warningln("File ignored:", err)
+		return nil
+	}
+
+	var link string
+	if fi.Mode()&os.ModeSymlink != 0 {
+		link, err = os.Readlink(fixLongPath(fileName))
+		if err != nil {
+			return err
+		}
+	}
+
+	th, err := tar.FileInfoHeader(fi, link)
+	if err != nil {
+		return err
+	}
+	th.Name = filepath.ToSlash(fileName)
+	options.normalizeTarHeader(th)
+
+	switch fi.Mode() & os.ModeType {
+	case os.ModeDir:
+		th.Name += "/"
+		return archive.WriteHeader(th)
+
+	case os.ModeSymlink:
+		return archive.WriteHeader(th)
+
+	case os.ModeNamedPipe, os.ModeSocket, os.ModeDevice:
+		// Ignore the files that of these types
+		logrus.Warningln("File ignored:", fileName)
+		return nil
+
+	default:
+		return createTarFileEntry(archive, th, fileName)
+	}
+}
+
+func createTarDataEntry(archive *tar.Writer, name string, data []byte, options *ArchiveOptions) error {
+	th := &tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	}
+	options.normalizeTarHeader(th)
+
+	err := archive.WriteHeader(th)
+	if err != nil {
+		return err
+	}
+
+	_, err = archive.Write(data)
+	return err
+}
+
+// CreateTarGzArchiveWithOptions writes the gzip compressed tar archive,
+// which keeps the owners, permissions and modification times of the files
+func CreateTarGzArchiveWithOptions(w io.Writer, fileNames []string, options *ArchiveOptions) error {
+	level, err := options.compressionLevel()
+	if err != nil {
+		return err
+	}
+
+	compressed, err := gzip.NewWriterLevel(w, level)
+	if err != nil {
+		return err
+	}
+	archive := tar.NewWriter(compressed)
+
+	var entries map[string][]byte
+	if options != nil {
+		entries = options.Entries
+	}
+
+	entryNames := make([]string, 0, len(entries))
+	for name := range entries {
+		entryNames = append(entryNames, name)
+	}
+	sort.Strings(entryNames)
+
+	// The entries are stored first, so they can be read without reading the whole archive
+	for _, name := range entryNames {
+		err := createTarDataEntry(archive, name, entries[name], options)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, fileName := range options.sortedFileNames(fileNames) {
+		err := createTarEntry(archive, fileName, options)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = archive.Close()
+	if err != nil {
+		return err
+	}
+	return compressed.Close()
+}
+
+func CreateTarGzFileWithOptions(fileName string, fileNames []string, options *ArchiveOptions) error {
+	// create directories to store archive
+	os.MkdirAll(filepath.Dir(fileName), 0700)
+
+	tempFile, err := ioutil.TempFile(filepath.Dir(fileName), "archive_")
+	if err != nil {
+		return err
+	}
+	defer tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	logrus.Debugln("Temporary file:", tempFile.Name())
+	err = CreateTarGzArchiveWithOptions(tempFile, fileNames, options)
+	if err != nil {
+		return err
+	}
+	tempFile.Close()
+
+	return os.Rename(tempFile.Name(), fileName)
+}
@@ -0,0 +1,184 @@
+package archives
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/Sirupsen/logrus"
+)
+
+func extractTarDirectoryEntry(th *tar.Header, name string) (err error) {
+	err = os.Mkdir(fixLongPath(name), os.FileMode(th.Mode).Perm())
+
+	// The error that directory does exists is not a error for us
+	if os.IsExist(err) {
+		err = nil
+	}
+	return
+}
+
+func extractTarSymlinkEntry(th *tar.Header, name string) error {
+	// Remove symlink before creating a new one, otherwise we can error that file does exist
+	os.Remove(fixLongPath(name))
+	return os.Symlink(th.Linkname, fixLongPath(name))
+}
+
+func extractTarHardlinkEntry(th *tar.Header, name string) error {
+	os.Remove(fixLongPath(name))
+	return os.Link(fixLongPath(filepath.FromSlash(th.Linkname)), fixLongPath(name))
+}
+
+func extractTarFileEntry(archive io.Reader, th *tar.Header, name string) error {
+	// Remove file before creating a new one, otherwise we can error that file does exist
+	os.Remove(fixLongPath(name))
+	out, err := os.OpenFile(fixLongPath(name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.FileMode(th.Mode).Perm())
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, archive)
+	return err
+}
+
+func extractTarEntry(archive io.Reader, th *tar.Header, name string) (err error) {
+	// Create all parents to extract the file
+	os.MkdirAll(fixLongPath(filepath.Dir(name)), 0777)
+
+	switch th.Typeflag {
+	case tar.TypeDir:
+		err = extractTarDirectoryEntry(th, name)
+
+	case tar.TypeSymlink:
+		err = extractTarSymlinkEntry(th, name)
+
+	case tar.TypeLink:
+		err = extractTarHardlinkEntry(th, name)
+
+	case tar.TypeReg, tar.TypeRegA:
+		err = extractTarFileEntry(archive, th, name)
+
+	default:
+		// Ignore the files that of other types, eg. devices
+		logrus.Warningf("File ignored: %q", th.Name)
+	}
+	return
+}
+
+// verifyTarEntry rejects the entries that would be extracted outside of root
+func verifyTarEntry(root string, th *tar.Header) error {
+	switch th.Typeflag {
+	case tar.TypeSymlink:
+		// The existing symlink is replaced, so only its parent is checked
+		if !isPathInside(th.Name) {
+			return errPathEscapes
+		}
+		if err := verifyEntryPath(root, filepath.Dir(filepath.FromSlash(th.Name))); err != nil {
+			return err
+		}
+		return verifySymlinkTarget(root, th.Name, th.Linkname)
+
+	case tar.TypeLink:
+		if err := verifyEntryPath(root, th.Linkname); err != nil {
+			return err
+		}
+	}
+	return verifyEntryPath(root, th.Name)
+}
+
+// processTarMetadata restores the permissions and modification time of the extracted entry,
+// the owner and the special permission bits are restored only when the metadata is trusted
+func processTarMetadata(th *tar.Header, name string) (err error) {
+	// only root can give the files away to the original owner,
+	// the owner has to be changed first, as it clears the setuid and setgid bits
+	if TrustedMetadata && os.Geteuid() == 0 {
+		err = os.Lchown(fixLongPath(name), th.Uid, th.Gid)
+	}
+	if th.Typeflag == tar.TypeSymlink || th.Typeflag == tar.TypeLink {
+		return
+	}
+
+	mode := os.FileMode(th.Mode).Perm()
+	if th.Mode&04000 != 0 {
+		mode |= os.ModeSetuid
+	}
+	if th.Mode&02000 != 0 {
+		mode |= os.ModeSetgid
+	}
+	if th.Mode&01000 != 0 {
+		mode |= os.ModeSticky
+	}
+	mode = extractedFileMode(mode)
+	if chmodErr := os.Chmod(fixLongPath(name), mode); err == nil {
+		err = chmodErr
+	}
+	if timesErr := os.Chtimes(fixLongPath(name), th.ModTime, th.ModTime); err == nil {
+		err = timesErr
+	}
+	return
+}
+
+// ExtractTarGzArchiveFiltered extracts the files of the gzip compressed tar archive accepted by the filter
+func ExtractTarGzArchiveFiltered(r io.Reader, filter func(name string) bool) error {
+	root, err := extractionRoot()
+	if err != nil {
+		return err
+	}
+
+	compressed, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer compressed.Close()
+
+	tracker := newPathErrorTracker()
+	archive := tar.NewReader(compressed)
+	var extracted []*tar.Header
+
+	for {
+		th, err := archive.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		if filter != nil && !filter(th.Name) {
+			continue
+		}
+		if err := verifyTarEntry(root, th); err != nil {
+			logrus.Warningf("%s: %s, skipping", th.Name, err)
+			continue
+		}
+		extracted = append(extracted, th)
+
+		err = extractTarEntry(archive, th, filepath.Clean(filepath.FromSlash(th.Name)))
+		if tracker.actionable(err) {
+			logrus.Warningf("%s: %s (suppressing repeats)", th.Name, err)
+		}
+	}
+
+	// The directories are processed last, as extracting the files changes their modification times
+	for i := len(extracted) - 1; i >= 0; i-- {
+		th := extracted[i]
+		err := processTarMetadata(th, filepath.Clean(filepath.FromSlash(th.Name)))
+		if tracker.actionable(err) {
+			logrus.Warningf("%s: %s (suppressing repeats)", th.Name, err)
+		}
+	}
+	return nil
+}
+
+// ExtractTarGzFileFiltered extracts only the files accepted by the filter
+func ExtractTarGzFileFiltered(fileName string, filter func(name string) bool) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return ExtractTarGzArchiveFiltered(file, filter)
+}
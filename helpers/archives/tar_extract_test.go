@@ -0,0 +1,160 @@
+// +build !windows
+
+package archives
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTarGzArchiveRoundTrip(t *testing.T) {
+	td, err := ioutil.TempDir("", "tar_create")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(td)
+
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	defer os.Chdir(wd)
+	assert.NoError(t, os.Chdir(td))
+
+	assert.NoError(t, os.Mkdir("dir", 0750))
+	assert.NoError(t, ioutil.WriteFile("dir/script.sh", []byte("#!/bin/sh"), 0755))
+	assert.NoError(t, os.Symlink("script.sh", "dir/link"))
+	modTime := time.Date(2016, time.October, 1, 12, 0, 0, 0, time.UTC)
+	assert.NoError(t, os.Chtimes("dir/script.sh", modTime, modTime))
+
+	var buffer bytes.Buffer
+	err = CreateTarGzArchiveWithOptions(&buffer, []string{"dir", "dir/script.sh", "dir/link"}, &ArchiveOptions{
+		Entries: map[string][]byte{"metadata.json": []byte("{}")},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NoError(t, os.RemoveAll("dir"))
+
+	err = ExtractTarGzArchiveFiltered(bytes.NewReader(buffer.Bytes()), func(name string) bool {
+		return name != "metadata.json"
+	})
+	assert.NoError(t, err)
+
+	fi, err := os.Stat("dir")
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0750), fi.Mode().Perm())
+	}
+	fi, err = os.Stat("dir/script.sh")
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0755), fi.Mode().Perm())
+		assert.True(t, modTime.Equal(fi.ModTime()))
+	}
+	link, err := os.Readlink("dir/link")
+	assert.NoError(t, err)
+	assert.Equal(t, "script.sh", link)
+	_, err = os.Stat("metadata.json")
+	assert.True(t, os.IsNotExist(err), "filtered entry should not be extracted")
+}
+
+func TestExtractTarGzArchiveRejectsEscapingEntries(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "archive")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	outsideDir := filepath.Join(tempDir, "outside")
+	extractDir := filepath.Join(tempDir, "extract")
+	assert.NoError(t, os.Mkdir(outsideDir, 0755))
+	assert.NoError(t, os.Mkdir(extractDir, 0755))
+
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	defer os.Chdir(wd)
+	assert.NoError(t, os.Chdir(extractDir))
+
+	var buffer bytes.Buffer
+	compressed := gzip.NewWriter(&buffer)
+	archive := tar.NewWriter(compressed)
+	createEntry := func(th *tar.Header, content string) {
+		th.Size = int64(len(content))
+		assert.NoError(t, archive.WriteHeader(th))
+		archive.Write([]byte(content))
+	}
+	createEntry(&tar.Header{Name: "../outside/dotdot", Mode: 0644, Typeflag: tar.TypeReg}, "test")
+	createEntry(&tar.Header{Name: filepath.Join(outsideDir, "absolute"), Mode: 0644, Typeflag: tar.TypeReg}, "test")
+	createEntry(&tar.Header{Name: "dir_link", Linkname: outsideDir, Mode: 0777, Typeflag: tar.TypeSymlink}, "")
+	createEntry(&tar.Header{Name: "dir_link/through_link", Mode: 0644, Typeflag: tar.TypeReg}, "test")
+	createEntry(&tar.Header{Name: "hard_link", Linkname: "../outside/hard", Mode: 0644, Typeflag: tar.TypeLink}, "")
+	createEntry(&tar.Header{Name: "file.txt", Mode: 0644, Typeflag: tar.TypeReg}, "test")
+	archive.Close()
+	compressed.Close()
+
+	err = ExtractTarGzArchiveFiltered(bytes.NewReader(buffer.Bytes()), nil)
+	assert.NoError(t, err)
+
+	files, err := ioutil.ReadDir(outsideDir)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(files), "nothing should be written outside")
+
+	fi, err := os.Lstat("dir_link")
+	assert.True(t, err != nil || fi.Mode()&os.ModeSymlink == 0, "dir_link shouldn't be a symlink")
+
+	data, err := ioutil.ReadFile("file.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "test", string(data))
+}
+
+func TestExtractTarGzArchiveMetadata(t *testing.T) {
+	td, err := ioutil.TempDir("", "tar_extract")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(td)
+
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	defer os.Chdir(wd)
+	assert.NoError(t, os.Chdir(td))
+
+	var buffer bytes.Buffer
+	compressed := gzip.NewWriter(&buffer)
+	archive := tar.NewWriter(compressed)
+	assert.NoError(t, archive.WriteHeader(&tar.Header{
+		Name:     "script.sh",
+		Typeflag: tar.TypeReg,
+		Mode:     06755,
+		Uid:      12345,
+		Gid:      12345,
+	}))
+	archive.Close()
+	compressed.Close()
+
+	extract := func() (os.FileInfo, error) {
+		err := ExtractTarGzArchiveFiltered(bytes.NewReader(buffer.Bytes()), nil)
+		assert.NoError(t, err)
+		return os.Stat("script.sh")
+	}
+
+	fi, err := extract()
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0755), fi.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid), "the setuid and setgid bits aren't restored by default")
+		assert.Equal(t, uint32(os.Geteuid()), fi.Sys().(*syscall.Stat_t).Uid, "the owner isn't restored by default")
+	}
+
+	TrustedMetadata = true
+	defer func() { TrustedMetadata = false }()
+
+	fi, err = extract()
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.ModeSetuid|os.ModeSetgid|0755, fi.Mode()&(os.ModePerm|os.ModeSetuid|os.ModeSetgid))
+	}
+}
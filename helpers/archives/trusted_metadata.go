@@ -0,0 +1,19 @@
+package archives
+
+import (
+	"os"
+)
+
+// TrustedMetadata restores the setuid, setgid and sticky bits of the extracted files
+// and the owners of the files extracted from the tar archives.
+// The archives are created by the builds, so by default the helper running as root
+// doesn't plant the setuid binaries of the untrusted artifacts or caches
+var TrustedMetadata = false
+
+// extractedFileMode returns the permissions set on the extracted file
+func extractedFileMode(mode os.FileMode) os.FileMode {
+	if TrustedMetadata {
+		return mode & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	}
+	return mode & os.ModePerm
+}
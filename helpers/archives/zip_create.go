@@ -2,10 +2,13 @@ package archives
 
 import (
 	"archive/zip"
+	"compress/flate"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 )
@@ -16,13 +19,16 @@ func createZipDirectoryEntry(archive *zip.Writer, fh *zip.FileHeader) error {
 	return err
 }
 
-func createZipSymlinkEntry(archive *zip.Writer, fh *zip.FileHeader) error {
-	fw, err := archive.CreateHeader(fh)
+func createZipSymlinkEntry(archive *zip.Writer, fh *zip.FileHeader, options *ArchiveOptions) error {
+	link, err := os.Readlink(fixLongPath(fh.Name))
 	if err != nil {
-		return err
+		// Some reparse points (eg. NTFS junctions) can't be read as symlinks,
+		// so instead of failing we store what the link points to
+		logrus.Warningln("Storing link target instead of link:", err)
+		return createZipLinkTargetEntry(archive, fh, options)
 	}
 
-	link, err := os.Readlink(fh.Name)
+	fw, err := archive.CreateHeader(fh)
 	if err != nil {
 		return err
 	}
@@ -31,6 +37,27 @@ func createZipSymlinkEntry(archive *zip.Writer, fh *zip.FileHeader) error {
 	return err
 }
 
+func createZipLinkTargetEntry(archive *zip.Writer, fh *zip.FileHeader, options *ArchiveOptions) error {
+	fi, err := os.Stat(fixLongPath(fh.Name))
+	if err != nil {
+		logrus.Warningln("File ignored:", err)
+		return nil
+	}
+
+	targetFh, err := zip.FileInfoHeader(fi)
+	if err != nil {
+		return err
+	}
+	targetFh.Name = fh.Name
+	targetFh.Extra = createZipExtra(fh.Name, fi)
+	options.normalizeHeader(targetFh)
+
+	if fi.IsDir() {
+		return createZipDirectoryEntry(archive, targetFh)
+	}
+	return createZipFileEntry(archive, targetFh)
+}
+
 func createZipFileEntry(archive *zip.Writer, fh *zip.FileHeader) error {
 	fh.Method = zip.Deflate
 	fw, err := archive.CreateHeader(fh)
@@ -38,7 +65,7 @@ func createZipFileEntry(archive *zip.Writer, fh *zip.FileHeader) error {
 		return err
 	}
 
-	file, err := os.Open(fh.Name)
+	file, err := os.Open(fixLongPath(fh.Name))
 	if err != nil {
 		return err
 	}
@@ -51,8 +78,8 @@ func createZipFileEntry(archive *zip.Writer, fh *zip.FileHeader) error {
 	return nil
 }
 
-func createZipEntry(archive *zip.Writer, fileName string) error {
-	fi, err := os.Lstat(fileName)
+func createZipEntry(archive *zip.Writer, fileName string, options *ArchiveOptions) error {
+	fi, err := os.Lstat(fixLongPath(fileName))
 	if err != nil {
 		logrus.Warningln("File ignored:", err)
 		return nil
@@ -63,14 +90,15 @@ func createZipEntry(archive *zip.Writer, fileName string) error {
 		return err
 	}
 	fh.Name = fileName
-	fh.Extra = createZipExtra(fi)
+	fh.Extra = createZipExtra(fileName, fi)
+	options.normalizeHeader(fh)
 
 	switch fi.Mode() & os.ModeType {
 	case os.ModeDir:
 		return createZipDirectoryEntry(archive, fh)
 
 	case os.ModeSymlink:
-		return createZipSymlinkEntry(archive, fh)
+		return createZipSymlinkEntry(archive, fh, options)
 
 	case os.ModeNamedPipe, os.ModeSocket, os.ModeDevice:
 		// Ignore the files that of these types
@@ -82,12 +110,98 @@ func createZipEntry(archive *zip.Writer, fileName string) error {
 	}
 }
 
+func createZipDataEntry(archive *zip.Writer, name string, data []byte, options *ArchiveOptions) error {
+	fh := &zip.FileHeader{
+		Name:   name,
+		Method: zip.Deflate,
+	}
+	fh.SetModTime(time.Now())
+	fh.SetMode(0644)
+	options.normalizeHeader(fh)
+
+	fw, err := archive.CreateHeader(fh)
+	if err != nil {
+		return err
+	}
+
+	_, err = fw.Write(data)
+	return err
+}
+
+// ArchiveOptions changes how the archive is created
+type ArchiveOptions struct {
+	// Entries are stored in the archive with the provided content
+	// instead of being read from disk
+	Entries map[string][]byte
+
+	// Reproducible makes archiving of the same content to always produce
+	// identical archive: the files are sorted, the modification times are
+	// normalized and no extra fields (timestamps, owners) are stored
+	Reproducible bool
+
+	// CompressionLevel of the stored files, the default level is used when it's empty
+	CompressionLevel CompressionLevel
+}
+
+// reproducibleModTime is the earliest time that can be stored in zip
+var reproducibleModTime = time.Date(1980, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func (o *ArchiveOptions) normalizeHeader(fh *zip.FileHeader) {
+	if o == nil || !o.Reproducible {
+		return
+	}
+
+	fh.SetModTime(reproducibleModTime)
+	fh.Extra = nil
+}
+
+func (o *ArchiveOptions) sortedFileNames(fileNames []string) []string {
+	if o == nil || !o.Reproducible {
+		return fileNames
+	}
+
+	sorted := append([]string{}, fileNames...)
+	sort.Strings(sorted)
+	return sorted
+}
+
 func CreateZipArchive(w io.Writer, fileNames []string) error {
+	return CreateZipArchiveWithOptions(w, fileNames, nil)
+}
+
+func CreateZipArchiveWithOptions(w io.Writer, fileNames []string, options *ArchiveOptions) error {
+	level, err := options.compressionLevel()
+	if err != nil {
+		return err
+	}
+
 	archive := zip.NewWriter(w)
 	defer archive.Close()
 
-	for _, fileName := range fileNames {
-		err := createZipEntry(archive, fileName)
+	archive.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(out, level)
+	})
+
+	var entries map[string][]byte
+	if options != nil {
+		entries = options.Entries
+	}
+
+	entryNames := make([]string, 0, len(entries))
+	for name := range entries {
+		entryNames = append(entryNames, name)
+	}
+	sort.Strings(entryNames)
+
+	for _, name := range entryNames {
+		err := createZipDataEntry(archive, name, entries[name], options)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, fileName := range options.sortedFileNames(fileNames) {
+		err := createZipEntry(archive, fileName, options)
 		if err != nil {
 			return err
 		}
@@ -97,6 +211,10 @@ func CreateZipArchive(w io.Writer, fileNames []string) error {
 }
 
 func CreateZipFile(fileName string, fileNames []string) error {
+	return CreateZipFileWithOptions(fileName, fileNames, nil)
+}
+
+func CreateZipFileWithOptions(fileName string, fileNames []string, options *ArchiveOptions) error {
 	// create directories to store archive
 	os.MkdirAll(filepath.Dir(fileName), 0700)
 
@@ -108,7 +226,7 @@ func CreateZipFile(fileName string, fileNames []string) error {
 	defer os.Remove(tempFile.Name())
 
 	logrus.Debugln("Temporary file:", tempFile.Name())
-	err = CreateZipArchive(tempFile, fileNames)
+	err = CreateZipArchiveWithOptions(tempFile, fileNames, options)
 	if err != nil {
 		return err
 	}
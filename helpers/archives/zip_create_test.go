@@ -2,10 +2,14 @@ package archives
 
 import (
 	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"syscall"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -82,3 +86,95 @@ func TestZipCreate(t *testing.T) {
 	assert.NotEmpty(t, archive.File[2].Extra)
 	assert.True(t, archive.File[2].Mode().IsDir())
 }
+
+func TestZipCreateReproducible(t *testing.T) {
+	td, err := ioutil.TempDir("", "zip_create_reproducible")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(td)
+
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	defer os.Chdir(wd)
+
+	err = os.Chdir(td)
+	assert.NoError(t, err)
+
+	fileName := createTestFile(t)
+	dirName := createTestDirectory(t)
+	options := &ArchiveOptions{Reproducible: true}
+
+	var first bytes.Buffer
+	err = CreateZipArchiveWithOptions(&first, []string{fileName, dirName}, options)
+	assert.NoError(t, err)
+
+	modTime := time.Now().Add(-time.Hour)
+	os.Chtimes(fileName, modTime, modTime)
+
+	var second bytes.Buffer
+	err = CreateZipArchiveWithOptions(&second, []string{dirName, fileName}, options)
+	assert.NoError(t, err)
+
+	assert.Equal(t, first.Bytes(), second.Bytes())
+
+	archive, err := zip.NewReader(bytes.NewReader(second.Bytes()), int64(second.Len()))
+	if assert.NoError(t, err) && assert.Len(t, archive.File, 2) {
+		assert.Equal(t, "test_directory/", archive.File[0].Name)
+		assert.Equal(t, "test_file.txt", archive.File[1].Name)
+	}
+}
+
+func TestZipCreateManyEntries(t *testing.T) {
+	// the number of entries doesn't fit the classic end of central directory record
+	const count = 70000
+
+	entries := make(map[string][]byte, count)
+	for i := 0; i < count; i++ {
+		entries[fmt.Sprintf("entry-%05d", i)] = nil
+	}
+
+	var buffer bytes.Buffer
+	err := CreateZipArchiveWithOptions(&buffer, nil, &ArchiveOptions{Entries: entries})
+	assert.NoError(t, err)
+
+	archive, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if assert.NoError(t, err) && assert.Len(t, archive.File, count) {
+		assert.Equal(t, "entry-00000", archive.File[0].Name)
+		assert.Equal(t, fmt.Sprintf("entry-%05d", count-1), archive.File[count-1].Name)
+	}
+}
+
+func TestZipCreateCompressionLevel(t *testing.T) {
+	entries := map[string][]byte{
+		"repeated.txt": bytes.Repeat([]byte("compressible content "), 1000),
+	}
+
+	var fastest, slowest bytes.Buffer
+	err := CreateZipArchiveWithOptions(&fastest, nil, &ArchiveOptions{Entries: entries, CompressionLevel: CompressionFastest})
+	assert.NoError(t, err)
+	err = CreateZipArchiveWithOptions(&slowest, nil, &ArchiveOptions{Entries: entries, CompressionLevel: CompressionSlowest})
+	assert.NoError(t, err)
+	assert.True(t, slowest.Len() <= fastest.Len())
+
+	archive, err := zip.NewReader(bytes.NewReader(fastest.Bytes()), int64(fastest.Len()))
+	if assert.NoError(t, err) && assert.Len(t, archive.File, 1) {
+		assert.Equal(t, uint64(len(entries["repeated.txt"])), archive.File[0].UncompressedSize64)
+	}
+
+	err = CreateZipArchiveWithOptions(&bytes.Buffer{}, nil, &ArchiveOptions{CompressionLevel: "best"})
+	assert.Error(t, err, "unknown compression level")
+}
+
+func TestCompressionLevel(t *testing.T) {
+	level, err := CompressionLevel("").Get()
+	assert.NoError(t, err)
+	assert.Equal(t, flate.DefaultCompression, level)
+
+	level, err = CompressionFastest.Get()
+	assert.NoError(t, err)
+	assert.Equal(t, flate.BestSpeed, level)
+
+	_, err = CompressionLevel("9").Get()
+	assert.Error(t, err)
+}
@@ -5,12 +5,14 @@ import (
 	"bytes"
 	"encoding/binary"
 	"io"
+	"math"
 	"os"
 	"time"
 )
 
 const ZipUIDGidFieldType = 0x7875
 const ZipTimestampFieldType = 0x5455
+const ZipXattrFieldType = 0x7861
 
 // ZipExtraField is taken from https://github.com/LuaDist/zip/blob/master/proginfo/extrafld.txt
 type ZipExtraField struct {
@@ -61,18 +63,21 @@ func processZipTimestampField(data []byte, file *zip.FileHeader) error {
 	if (tsField.Flags & 1) == 1 {
 		modTime := time.Unix(int64(tsField.ModTime), 0)
 		acTime := time.Now()
-		return os.Chtimes(file.Name, acTime, modTime)
+		return os.Chtimes(fixLongPath(file.Name), acTime, modTime)
 	}
 
 	return nil
 }
 
-func createZipExtra(fi os.FileInfo) []byte {
+func createZipExtra(fileName string, fi os.FileInfo) []byte {
 	var buffer bytes.Buffer
 	err := createZipUIDGidField(&buffer, fi)
 	if err == nil {
 		err = createZipTimestampField(&buffer, fi)
 	}
+	if err == nil {
+		err = createZipXattrField(&buffer, fileName, fi, math.MaxUint16-buffer.Len())
+	}
 	if err == nil {
 		return buffer.Bytes()
 	}
@@ -86,9 +91,9 @@ func readZipExtraField(r io.Reader) (field ZipExtraField, data []byte, err error
 	}
 
 	data = make([]byte, field.Size)
-	_, err = r.Read(data)
-	if err != nil {
-		return
+	_, err = io.ReadFull(r, data)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
 	}
 	return
 }
@@ -107,11 +112,15 @@ func processZipExtra(file *zip.FileHeader) error {
 			return err
 		}
 
+		// the other fields, like the Zip64 sizes of large files,
+		// are handled by archive/zip itself
 		switch field.Type {
 		case ZipUIDGidFieldType:
 			err = processZipUIDGidField(data, file)
 		case ZipTimestampFieldType:
 			err = processZipTimestampField(data, file)
+		case ZipXattrFieldType:
+			err = processZipXattrField(data, file)
 		}
 		if err != nil {
 			return err
@@ -1,6 +1,7 @@
 package archives
 
 import (
+	"bytes"
 	"io/ioutil"
 	"os"
 	"testing"
@@ -19,7 +20,7 @@ func TestCreateZipExtra(t *testing.T) {
 	fi, _ := testFile.Stat()
 	assert.NotNil(t, fi)
 
-	data := createZipExtra(fi)
+	data := createZipExtra(testFile.Name(), fi)
 	assert.NotEmpty(t, data)
 	assert.Len(t, data, binary.Size(&ZipExtraField{})*2+
 		binary.Size(&ZipUIDGidField{})+
@@ -37,7 +38,7 @@ func TestProcessZipExtra(t *testing.T) {
 
 	zipFile, err := zip.FileInfoHeader(fi)
 	assert.NoError(t, err)
-	zipFile.Extra = createZipExtra(fi)
+	zipFile.Extra = createZipExtra(testFile.Name(), fi)
 
 	err = ioutil.WriteFile(fi.Name(), []byte{}, 0666)
 	defer os.Remove(fi.Name())
@@ -51,3 +52,15 @@ func TestProcessZipExtra(t *testing.T) {
 	assert.Equal(t, fi.Mode(), fi2.Mode())
 	assert.Equal(t, fi.ModTime(), fi2.ModTime())
 }
+
+func TestProcessZipExtraSkipsZip64Field(t *testing.T) {
+	var extra bytes.Buffer
+	binary.Write(&extra, binary.LittleEndian, &ZipExtraField{Type: 0x0001, Size: 16})
+	binary.Write(&extra, binary.LittleEndian, []uint64{5 << 30, 1 << 30})
+
+	err := processZipExtra(&zip.FileHeader{Name: "large_file", Extra: extra.Bytes()})
+	assert.NoError(t, err)
+
+	truncated := &zip.FileHeader{Name: "large_file", Extra: extra.Bytes()[0:10]}
+	assert.Error(t, processZipExtra(truncated))
+}
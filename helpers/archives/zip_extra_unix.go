@@ -35,6 +35,11 @@ func createZipUIDGidField(w io.Writer, fi os.FileInfo) (err error) {
 }
 
 func processZipUIDGidField(data []byte, file *zip.FileHeader) error {
+	// only root can give the files away to the original owner
+	if os.Geteuid() != 0 {
+		return nil
+	}
+
 	var ugField ZipUIDGidField
 	err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &ugField)
 	if err != nil {
@@ -45,5 +50,5 @@ func processZipUIDGidField(data []byte, file *zip.FileHeader) error {
 		return errors.New("uid/gid data not supported")
 	}
 
-	return os.Lchown(file.Name, int(ugField.UID), int(ugField.Gid))
+	return os.Lchown(fixLongPath(file.Name), int(ugField.UID), int(ugField.Gid))
 }
@@ -2,6 +2,7 @@ package archives
 
 import (
 	"archive/zip"
+	"errors"
 	"io"
 	"io/ioutil"
 	"os"
@@ -10,8 +11,12 @@ import (
 	"github.com/Sirupsen/logrus"
 )
 
+var errSymlinkNotPermitted = errors.New("creating symbolic links is not permitted")
+
 func extractZipDirectoryEntry(file *zip.File) (err error) {
-	err = os.Mkdir(file.Name, file.Mode().Perm())
+	// The directory is writable by the owner until all files are extracted into it,
+	// its permissions are set at the end of the extraction
+	err = os.Mkdir(fixLongPath(file.Name), file.Mode().Perm()|0700)
 
 	// The error that directory does exists is not a error for us
 	if os.IsExist(err) {
@@ -20,25 +25,49 @@ func extractZipDirectoryEntry(file *zip.File) (err error) {
 	return
 }
 
-func extractZipSymlinkEntry(file *zip.File) (err error) {
-	var data []byte
+func readZipSymlinkTarget(file *zip.File) (string, error) {
 	in, err := file.Open()
 	if err != nil {
-		return err
+		return "", err
 	}
 	defer in.Close()
 
-	data, err = ioutil.ReadAll(in)
+	data, err := ioutil.ReadAll(in)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func extractZipSymlinkEntry(file *zip.File) (err error) {
+	target, err := readZipSymlinkTarget(file)
 	if err != nil {
 		return err
 	}
 
 	// Remove symlink before creating a new one, otherwise we can error that file does exist
-	os.Remove(file.Name)
-	err = os.Symlink(string(data), file.Name)
+	os.Remove(fixLongPath(file.Name))
+	err = os.Symlink(target, fixLongPath(file.Name))
+	if isSymlinkNotPermitted(err) {
+		return errSymlinkNotPermitted
+	}
 	return
 }
 
+// extractZipSymlinkAsCopy is used when we are not allowed to create symlinks,
+// it has to be called after all other files are extracted
+func extractZipSymlinkAsCopy(file *zip.File) error {
+	target, err := readZipSymlinkTarget(file)
+	if err != nil {
+		return err
+	}
+
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(filepath.Dir(file.Name), target)
+	}
+	return copyPath(target, file.Name)
+}
+
 func extractZipFileEntry(file *zip.File) (err error) {
 	var out *os.File
 	in, err := file.Open()
@@ -47,9 +76,10 @@ func extractZipFileEntry(file *zip.File) (err error) {
 	}
 	defer in.Close()
 
-	// Remove file before creating a new one, otherwise we can error that file does exist
-	os.Remove(file.Name)
-	out, err = os.OpenFile(file.Name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.Mode().Perm())
+	// Remove file before creating a new one, otherwise we can error that file does exist.
+	// The file is writable by the owner until its extended attributes are set
+	os.Remove(fixLongPath(file.Name))
+	out, err = os.OpenFile(fixLongPath(file.Name), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.Mode().Perm()|0600)
 	if err != nil {
 		return err
 	}
@@ -59,9 +89,14 @@ func extractZipFileEntry(file *zip.File) (err error) {
 	return
 }
 
+// zipFilePermissions keeps the setuid, setgid and sticky bits only when the metadata is trusted
+func zipFilePermissions(file *zip.File) os.FileMode {
+	return extractedFileMode(file.Mode())
+}
+
 func extractZipFile(file *zip.File) (err error) {
 	// Create all parents to extract the file
-	os.MkdirAll(filepath.Dir(file.Name), 0777)
+	os.MkdirAll(fixLongPath(filepath.Dir(file.Name)), 0777)
 
 	switch file.Mode() & os.ModeType {
 	case os.ModeDir:
@@ -80,25 +115,77 @@ func extractZipFile(file *zip.File) (err error) {
 	return
 }
 
+// verifyZipEntry rejects the entries that would be extracted outside of root
+func verifyZipEntry(root string, file *zip.File) error {
+	if file.Mode()&os.ModeSymlink == 0 {
+		return verifyEntryPath(root, file.Name)
+	}
+
+	// The existing symlink is replaced, so only its parent is checked
+	if !isPathInside(file.Name) {
+		return errPathEscapes
+	}
+	if err := verifyEntryPath(root, filepath.Dir(file.Name)); err != nil {
+		return err
+	}
+
+	target, err := readZipSymlinkTarget(file)
+	if err != nil {
+		return err
+	}
+	return verifySymlinkTarget(root, file.Name, target)
+}
+
 func ExtractZipArchive(archive *zip.Reader) error {
+	root, err := extractionRoot()
+	if err != nil {
+		return err
+	}
+
 	tracker := newPathErrorTracker()
+	var extracted, linkCopies []*zip.File
 
 	for _, file := range archive.File {
-		if err := extractZipFile(file); tracker.actionable(err) {
+		if err := verifyZipEntry(root, file); err != nil {
+			logrus.Warningf("%s: %s, skipping", file.Name, err)
+			continue
+		}
+		extracted = append(extracted, file)
+
+		err := extractZipFile(file)
+		if err == errSymlinkNotPermitted {
+			linkCopies = append(linkCopies, file)
+		} else if tracker.actionable(err) {
 			logrus.Warningf("%s: %s (suppressing repeats)", file.Name, err)
 		}
 	}
 
-	for _, file := range archive.File {
-		// Update file permissions
-		if err := os.Chmod(file.Name, file.Mode().Perm()); tracker.actionable(err) {
+	if len(linkCopies) > 0 {
+		logrus.Warningln("Symbolic links can't be created, link targets will be copied instead")
+	}
+	for _, file := range linkCopies {
+		// All files are extracted now, so the whole target is verified again
+		if err := verifyZipEntry(root, file); err != nil {
+			logrus.Warningf("%s: %s, skipping", file.Name, err)
+			continue
+		}
+		if err := extractZipSymlinkAsCopy(file); tracker.actionable(err) {
 			logrus.Warningf("%s: %s (suppressing repeats)", file.Name, err)
 		}
+	}
 
-		// Process zip metadata
+	for _, file := range extracted {
+		// Process zip metadata, the owner has to be changed first,
+		// as it clears the setuid and setgid bits. The extended attributes
+		// are set while the file is still writable by the owner
 		if err := processZipExtra(&file.FileHeader); tracker.actionable(err) {
 			logrus.Warningf("%s: %s (suppressing repeats)", file.Name, err)
 		}
+
+		// Update file permissions
+		if err := os.Chmod(fixLongPath(file.Name), zipFilePermissions(file)); tracker.actionable(err) {
+			logrus.Warningf("%s: %s (suppressing repeats)", file.Name, err)
+		}
 	}
 	return nil
 }
@@ -112,3 +199,32 @@ func ExtractZipFile(fileName string) error {
 
 	return ExtractZipArchive(&archive.Reader)
 }
+
+// ExtractZipFileFiltered extracts only the files accepted by the filter
+func ExtractZipFileFiltered(fileName string, filter func(name string) bool) error {
+	archive, err := zip.OpenReader(fileName)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	filtered := &zip.Reader{
+		Comment: archive.Comment,
+	}
+	for _, file := range archive.File {
+		if filter(file.Name) {
+			filtered.File = append(filtered.File, file)
+		}
+	}
+
+	logrus.Debugf("Extracting %d of %d files", len(filtered.File), len(archive.File))
+	return ExtractZipArchive(filtered)
+}
+
+// ExtractZipFileMatching extracts only the files matching one of the
+// patterns, see MatchPath for the syntax of patterns
+func ExtractZipFileMatching(fileName string, patterns []string) error {
+	return ExtractZipFileFiltered(fileName, func(name string) bool {
+		return MatchAnyPath(patterns, name)
+	})
+}
@@ -2,9 +2,11 @@ package archives
 
 import (
 	"archive/zip"
+	"bytes"
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -52,3 +54,135 @@ func TestExtractZipFileNotFound(t *testing.T) {
 	err := ExtractZipFile("non_existing_zip_file.zip")
 	assert.Error(t, err)
 }
+
+func TestExtractZipSymlinkAsCopy(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "archive")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	err = os.Mkdir(filepath.Join(tempDir, "directory"), 0755)
+	assert.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(tempDir, "directory", "file.txt"), []byte("test file"), 0644)
+	assert.NoError(t, err)
+
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	createLink := func(name, target string) {
+		fh := &zip.FileHeader{Name: filepath.Join(tempDir, name)}
+		fh.SetMode(os.ModeSymlink | 0777)
+		fw, err := archive.CreateHeader(fh)
+		assert.NoError(t, err)
+		io.WriteString(fw, target)
+	}
+	createLink("file_link", "directory/file.txt")
+	createLink("directory_link", "directory")
+	archive.Close()
+
+	reader, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, file := range reader.File {
+		err = extractZipSymlinkAsCopy(file)
+		assert.NoError(t, err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(tempDir, "file_link"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test file", string(data))
+
+	data, err = ioutil.ReadFile(filepath.Join(tempDir, "directory_link", "file.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, "test file", string(data))
+}
+
+func TestExtractZipFilePermissions(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "archive")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	defer os.Chdir(wd)
+	err = os.Chdir(tempDir)
+	assert.NoError(t, err)
+
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	fh := &zip.FileHeader{Name: "script.sh"}
+	fh.SetMode(os.ModeSetgid | 0751)
+	_, err = archive.CreateHeader(fh)
+	assert.NoError(t, err)
+	archive.Close()
+
+	reader, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	err = ExtractZipArchive(reader)
+	assert.NoError(t, err)
+
+	fi, err := os.Stat("script.sh")
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0751), fi.Mode()&(os.ModePerm|os.ModeSetgid), "the setgid bit isn't restored by default")
+	}
+
+	TrustedMetadata = true
+	defer func() { TrustedMetadata = false }()
+
+	err = ExtractZipArchive(reader)
+	assert.NoError(t, err)
+
+	fi, err = os.Stat("script.sh")
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.ModeSetgid|0751, fi.Mode()&(os.ModePerm|os.ModeSetgid))
+	}
+}
+
+func TestExtractZipFileIsWritableUntilPermissionsAreSet(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "archive")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	defer os.Chdir(wd)
+	err = os.Chdir(tempDir)
+	assert.NoError(t, err)
+
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	fh := &zip.FileHeader{Name: "read-only.txt"}
+	fh.SetMode(0444)
+	fw, err := archive.CreateHeader(fh)
+	assert.NoError(t, err)
+	io.WriteString(fw, "test file")
+	archive.Close()
+
+	reader, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	err = extractZipFile(reader.File[0])
+	assert.NoError(t, err)
+	fi, err := os.Stat(fh.Name)
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0644), fi.Mode().Perm(), "the owner can set the extended attributes")
+	}
+
+	err = ExtractZipArchive(reader)
+	assert.NoError(t, err)
+	fi, err = os.Stat(fh.Name)
+	if assert.NoError(t, err) {
+		assert.Equal(t, os.FileMode(0444), fi.Mode().Perm())
+	}
+}
@@ -0,0 +1,136 @@
+package archives
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// only the attributes of users are stored, the other namespaces
+// (eg. security labels) are specific to the system that created the archive
+const zipXattrNamespace = "user."
+
+func listXattrs(fileName string) (names []string, err error) {
+	size, err := syscall.Listxattr(fileName, nil)
+	if err != nil || size == 0 {
+		return
+	}
+
+	data := make([]byte, size)
+	size, err = syscall.Listxattr(fileName, data)
+	if err != nil {
+		return
+	}
+
+	for _, name := range strings.Split(string(data[0:size]), "\x00") {
+		if strings.HasPrefix(name, zipXattrNamespace) {
+			names = append(names, name)
+		}
+	}
+	return
+}
+
+func getXattr(fileName, name string) ([]byte, error) {
+	size, err := syscall.Getxattr(fileName, name, nil)
+	if err != nil || size == 0 {
+		return nil, err
+	}
+
+	data := make([]byte, size)
+	size, err = syscall.Getxattr(fileName, name, data)
+	if err != nil {
+		return nil, err
+	}
+	return data[0:size], nil
+}
+
+func writeZipXattr(w io.Writer, name string, value []byte) {
+	binary.Write(w, binary.LittleEndian, uint16(len(name)))
+	io.WriteString(w, name)
+	binary.Write(w, binary.LittleEndian, uint16(len(value)))
+	w.Write(value)
+}
+
+func createZipXattrField(w io.Writer, fileName string, fi os.FileInfo, maxSize int) error {
+	// the attributes of symlinks can't be set by users
+	if fi.Mode()&os.ModeSymlink != 0 {
+		return nil
+	}
+
+	names, err := listXattrs(fixLongPath(fileName))
+	if err != nil || len(names) == 0 {
+		return nil
+	}
+
+	var xattrs bytes.Buffer
+	for _, name := range names {
+		value, err := getXattr(fixLongPath(fileName), name)
+		if err != nil {
+			continue
+		}
+		writeZipXattr(&xattrs, name, value)
+	}
+
+	xattrsFieldType := ZipExtraField{
+		Type: ZipXattrFieldType,
+		Size: uint16(xattrs.Len()),
+	}
+
+	// the attributes have to fit into the extra field of the file
+	if binary.Size(&xattrsFieldType)+xattrs.Len() > maxSize {
+		return nil
+	}
+
+	err = binary.Write(w, binary.LittleEndian, &xattrsFieldType)
+	if err == nil {
+		_, err = w.Write(xattrs.Bytes())
+	}
+	return err
+}
+
+func readZipXattr(r io.Reader) (name string, value []byte, err error) {
+	var size uint16
+	if err = binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return
+	}
+	nameData := make([]byte, size)
+	if _, err = io.ReadFull(r, nameData); err != nil {
+		return
+	}
+	if err = binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return
+	}
+	value = make([]byte, size)
+	if _, err = io.ReadFull(r, value); err != nil {
+		return
+	}
+	return string(nameData), value, nil
+}
+
+func processZipXattrField(data []byte, file *zip.FileHeader) error {
+	if !file.Mode().IsDir() && !file.Mode().IsRegular() {
+		return nil
+	}
+
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		name, value, err := readZipXattr(r)
+		if err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		if !strings.HasPrefix(name, zipXattrNamespace) {
+			continue
+		}
+
+		// the file is extracted as writable by the owner, its permissions are set after the attributes
+		err = syscall.Setxattr(fixLongPath(file.Name), name, value, 0)
+		if err != nil {
+			return &os.PathError{Op: "setxattr", Path: file.Name, Err: err}
+		}
+	}
+	return nil
+}
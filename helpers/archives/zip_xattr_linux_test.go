@@ -0,0 +1,47 @@
+package archives
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestZipXattrs(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "archive")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(tempDir)
+
+	fileName := filepath.Join(tempDir, "file.txt")
+	err = ioutil.WriteFile(fileName, []byte("test file"), 0644)
+	assert.NoError(t, err)
+
+	err = syscall.Setxattr(fileName, "user.checksum", []byte("value"), 0)
+	if err != nil {
+		t.Skip("Extended attributes are not supported:", err)
+	}
+
+	fi, err := os.Stat(fileName)
+	assert.NoError(t, err)
+
+	fh, err := zip.FileInfoHeader(fi)
+	assert.NoError(t, err)
+	fh.Name = fileName
+	fh.Extra = createZipExtra(fileName, fi)
+
+	err = syscall.Removexattr(fileName, "user.checksum")
+	assert.NoError(t, err)
+
+	err = processZipExtra(fh)
+	assert.NoError(t, err)
+
+	value, err := getXattr(fileName, "user.checksum")
+	assert.NoError(t, err)
+	assert.Equal(t, "value", string(value))
+}
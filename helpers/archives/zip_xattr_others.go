@@ -0,0 +1,19 @@
+// +build !linux
+
+package archives
+
+import (
+	"archive/zip"
+	"io"
+	"os"
+)
+
+func createZipXattrField(w io.Writer, fileName string, fi os.FileInfo, maxSize int) error {
+	// TODO: currently not supported
+	return nil
+}
+
+func processZipXattrField(data []byte, file *zip.FileHeader) error {
+	// TODO: currently not supported
+	return nil
+}
@@ -0,0 +1,45 @@
+package helpers
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+)
+
+// systemCertificateFiles are the locations of the CA bundle on the common systems
+var systemCertificateFiles = []string{
+	"/etc/ssl/certs/ca-certificates.crt",                // Debian/Ubuntu/Gentoo etc.
+	"/etc/pki/tls/certs/ca-bundle.crt",                  // Fedora/RHEL 6
+	"/etc/ssl/ca-bundle.pem",                            // OpenSUSE
+	"/etc/pki/tls/cacert.pem",                           // OpenELEC
+	"/etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem", // CentOS/RHEL 7
+	"/etc/ssl/cert.pem",                                 // Alpine, macOS
+}
+
+// NewCertPool returns the pool of the certificates from the PEM data only,
+// the configured CA file replaces the system certificates
+func NewCertPool(data []byte) (pool *x509.CertPool, ok bool) {
+	pool = x509.NewCertPool()
+	ok = pool.AppendCertsFromPEM(data)
+	return
+}
+
+// NewSystemCertPool returns the system certificates extended with the certificates
+// from the PEM data, for the servers which aren't covered by the configured CA file,
+// eg. the object storages
+func NewSystemCertPool(data []byte) (pool *x509.CertPool, ok bool) {
+	pool = systemCertPool()
+	ok = pool.AppendCertsFromPEM(data)
+	return
+}
+
+// SystemCertificates returns the PEM encoded CA bundle of the host,
+// or an empty string if it can't be found
+func SystemCertificates() string {
+	for _, file := range systemCertificateFiles {
+		data, err := ioutil.ReadFile(file)
+		if err == nil && len(data) > 0 {
+			return string(data)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,12 @@
+// +build !go1.7
+
+package helpers
+
+import "crypto/x509"
+
+// systemCertPool reads the CA bundle of the host, as the system pool isn't available before Go 1.7
+func systemCertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM([]byte(SystemCertificates()))
+	return pool
+}
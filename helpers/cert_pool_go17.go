@@ -0,0 +1,13 @@
+// +build go1.7
+
+package helpers
+
+import "crypto/x509"
+
+func systemCertPool() *x509.CertPool {
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		return x509.NewCertPool()
+	}
+	return pool
+}
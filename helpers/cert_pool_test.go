@@ -0,0 +1,42 @@
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testCertificate = `-----BEGIN CERTIFICATE-----
+MIIBhTCCASugAwIBAgIQIRi6zePL6mKjOipn+dNuaTAKBggqhkjOPQQDAjASMRAw
+DgYDVQQKEwdBY21lIENvMB4XDTE3MTAyMDE5NDMwNloXDTE4MTAyMDE5NDMwNlow
+EjEQMA4GA1UEChMHQWNtZSBDbzBZMBMGByqGSM49AgEGCCqGSM49AwEHA0IABD0d
+7VNhbWvZLWPuj/RtHFjvtJBEwOkhbN/BnnE8rnZR8+sbwnc/KhCk3FhnpHZnQz7B
+5aETbbIgmuvewdjvSBSjYzBhMA4GA1UdDwEB/wQEAwICpDATBgNVHSUEDDAKBggr
+BgEFBQcDATAPBgNVHRMBAf8EBTADAQH/MCkGA1UdEQQiMCCCDmxvY2FsaG9zdDo1
+NDUzgg4xMjcuMC4wLjE6NTQ1MzAKBggqhkjOPQQDAgNIADBFAiEA2zpJEPQyz6/l
+Wf86aX6PepsntZv2GYlA5UpabfT2EZICICpJ5h/iI+i341gBmLiAFQOyTDT+/wQc
+6MF9+Yw1Yy0t
+-----END CERTIFICATE-----`
+
+func TestNewCertPool(t *testing.T) {
+	pool, ok := NewCertPool([]byte(testCertificate))
+	assert.True(t, ok)
+	assert.NotNil(t, pool)
+
+	_, ok = NewCertPool([]byte("invalid"))
+	assert.False(t, ok)
+}
+
+func TestNewSystemCertPool(t *testing.T) {
+	custom, ok := NewCertPool([]byte(testCertificate))
+	assert.True(t, ok)
+
+	pool, ok := NewSystemCertPool([]byte(testCertificate))
+	assert.True(t, ok)
+	assert.True(t, len(pool.Subjects()) >= len(custom.Subjects()))
+
+	if SystemCertificates() != "" {
+		assert.True(t, len(pool.Subjects()) > len(custom.Subjects()), "the system certificates are kept")
+	}
+}
+
@@ -0,0 +1,109 @@
+package helpers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+const cloudMetadataTimeout = time.Second
+
+// The metadata services are variables, so they can be replaced in tests
+var ec2MetadataURL = "http://169.254.169.254/latest/meta-data/"
+var ec2MetadataTokenURL = "http://169.254.169.254/latest/api/token"
+var gceMetadataURL = "http://metadata.google.internal/computeMetadata/v1/instance/"
+
+// ec2MetadataTokenTTL is the validity of the IMDSv2 session token in seconds, it's used only while detecting the instance
+const ec2MetadataTokenTTL = "60"
+
+// CloudInstance describes the cloud instance the runner is running on
+type CloudInstance struct {
+	ID   string
+	Zone string
+}
+
+func readCloudMetadata(url string, headers map[string]string) string {
+	return requestCloudMetadata("GET", url, headers)
+}
+
+func requestCloudMetadata(method, url string, headers map[string]string) string {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return ""
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	client := http.Client{Timeout: cloudMetadataTimeout}
+	res, err := client.Do(req)
+	if err != nil {
+		return ""
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return ""
+	}
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// ec2MetadataHeaders returns the headers with the session token of IMDSv2,
+// without the token the metadata is read with IMDSv1
+func ec2MetadataHeaders() map[string]string {
+	token := requestCloudMetadata("PUT", ec2MetadataTokenURL, map[string]string{
+		"X-aws-ec2-metadata-token-ttl-seconds": ec2MetadataTokenTTL,
+	})
+	if token == "" {
+		return nil
+	}
+	return map[string]string{"X-aws-ec2-metadata-token": token}
+}
+
+func detectEC2Instance() *CloudInstance {
+	headers := ec2MetadataHeaders()
+	id := readCloudMetadata(ec2MetadataURL+"instance-id", headers)
+	if id == "" {
+		return nil
+	}
+
+	return &CloudInstance{
+		ID:   id,
+		Zone: readCloudMetadata(ec2MetadataURL+"placement/availability-zone", headers),
+	}
+}
+
+func detectGCEInstance() *CloudInstance {
+	headers := map[string]string{"Metadata-Flavor": "Google"}
+	id := readCloudMetadata(gceMetadataURL+"id", headers)
+	if id == "" {
+		return nil
+	}
+
+	// The zone is returned as projects/<number>/zones/<zone>
+	zone := readCloudMetadata(gceMetadataURL+"zone", headers)
+	if zone != "" {
+		zone = path.Base(zone)
+	}
+
+	return &CloudInstance{
+		ID:   id,
+		Zone: zone,
+	}
+}
+
+// DetectCloudInstance reads the instance from the metadata service of EC2 or GCE,
+// it returns nil when the runner doesn't run on any of them
+func DetectCloudInstance() *CloudInstance {
+	if instance := detectEC2Instance(); instance != nil {
+		return instance
+	}
+	return detectGCEInstance()
+}
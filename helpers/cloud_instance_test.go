@@ -0,0 +1,103 @@
+package helpers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func withMetadataServices(ec2, gce string, f func()) {
+	oldEC2, oldEC2Token, oldGCE := ec2MetadataURL, ec2MetadataTokenURL, gceMetadataURL
+	defer func() {
+		ec2MetadataURL, ec2MetadataTokenURL, gceMetadataURL = oldEC2, oldEC2Token, oldGCE
+	}()
+
+	ec2MetadataURL, ec2MetadataTokenURL, gceMetadataURL = ec2, strings.TrimSuffix(ec2, "meta-data/")+"api/token", gce
+	f()
+}
+
+func TestDetectEC2Instance(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest/meta-data/instance-id":
+			w.Write([]byte("i-1234567890abcdef0\n"))
+		case "/latest/meta-data/placement/availability-zone":
+			w.Write([]byte("us-east-1a"))
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer s.Close()
+
+	withMetadataServices(s.URL+"/latest/meta-data/", s.URL+"/not-found/", func() {
+		assert.Equal(t, &CloudInstance{ID: "i-1234567890abcdef0", Zone: "us-east-1a"}, DetectCloudInstance())
+	})
+}
+
+func TestDetectEC2InstanceWithIMDSv2(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/api/token" {
+			if r.Method != "PUT" || r.Header.Get("X-aws-ec2-metadata-token-ttl-seconds") == "" {
+				w.WriteHeader(400)
+				return
+			}
+			w.Write([]byte("session-token"))
+			return
+		}
+
+		// the instance requires the session token
+		if r.Header.Get("X-aws-ec2-metadata-token") != "session-token" {
+			w.WriteHeader(401)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/latest/meta-data/instance-id":
+			w.Write([]byte("i-1234567890abcdef0"))
+		case "/latest/meta-data/placement/availability-zone":
+			w.Write([]byte("us-east-1a"))
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer s.Close()
+
+	withMetadataServices(s.URL+"/latest/meta-data/", s.URL+"/not-found/", func() {
+		assert.Equal(t, &CloudInstance{ID: "i-1234567890abcdef0", Zone: "us-east-1a"}, DetectCloudInstance())
+	})
+}
+
+func TestDetectGCEInstance(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" {
+			w.WriteHeader(403)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/computeMetadata/v1/instance/id":
+			w.Write([]byte("4567"))
+		case "/computeMetadata/v1/instance/zone":
+			w.Write([]byte("projects/1234/zones/europe-west1-b"))
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer s.Close()
+
+	withMetadataServices(s.URL+"/not-found/", s.URL+"/computeMetadata/v1/instance/", func() {
+		assert.Equal(t, &CloudInstance{ID: "4567", Zone: "europe-west1-b"}, DetectCloudInstance())
+	})
+}
+
+func TestDetectCloudInstanceOutsideOfCloud(t *testing.T) {
+	s := httptest.NewServer(http.NotFoundHandler())
+	defer s.Close()
+
+	withMetadataServices(s.URL+"/", s.URL+"/", func() {
+		assert.Nil(t, DetectCloudInstance())
+	})
+}
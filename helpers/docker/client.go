@@ -6,8 +6,13 @@ type Client interface {
 	InspectImage(name string) (*docker.Image, error)
 	PullImage(opts docker.PullImageOptions, auth docker.AuthConfiguration) error
 	ImportImage(opts docker.ImportImageOptions) error
+	TagImage(name string, opts docker.TagImageOptions) error
+	CommitContainer(opts docker.CommitContainerOptions) (*docker.Image, error)
+	ListImages(opts docker.ListImagesOptions) ([]docker.APIImages, error)
+	RemoveImage(name string) error
 
 	CreateContainer(opts docker.CreateContainerOptions) (*docker.Container, error)
+	CreateContainerExtended(opts docker.CreateContainerOptions, extension HostConfigExtension) (*docker.Container, error)
 	StartContainer(id string, hostConfig *docker.HostConfig) error
 	WaitContainer(id string) (int, error)
 	KillContainer(opts docker.KillContainerOptions) error
@@ -15,6 +20,18 @@ type Client interface {
 	AttachToContainer(opts docker.AttachToContainerOptions) error
 	RemoveContainer(opts docker.RemoveContainerOptions) error
 	Logs(opts docker.LogsOptions) error
+	DownloadFromContainer(id string, opts docker.DownloadFromContainerOptions) error
+	UploadToContainer(id string, opts docker.UploadToContainerOptions) error
+
+	CreateExec(opts docker.CreateExecOptions) (*docker.Exec, error)
+	StartExec(id string, opts docker.StartExecOptions) error
+	InspectExec(id string) (*docker.ExecInspect, error)
+
+	CreateVolume(opts docker.CreateVolumeOptions) (*docker.Volume, error)
+	CreateVolumeWithLabels(opts docker.CreateVolumeOptions, labels map[string]string) (*docker.Volume, error)
+	ListVolumes(opts docker.ListVolumesOptions) ([]docker.Volume, error)
+	RemoveVolume(name string) error
 
 	Info() (*docker.Env, error)
+	Version() (*docker.Env, error)
 }
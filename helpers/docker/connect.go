@@ -9,12 +9,14 @@ import (
 	"time"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/docker/docker/pkg/homedir"
 	"github.com/fsouza/go-dockerclient"
 )
 
 var dockerDialer = &net.Dialer{
 	Timeout:   30 * time.Second,
 	KeepAlive: 30 * time.Second,
+	DualStack: true,
 }
 
 var cache = clientCache{
@@ -22,7 +24,7 @@ var cache = clientCache{
 }
 
 func httpTransportFix(host string, client Client) {
-	dockerClient, ok := client.(*docker.Client)
+	dockerClient, ok := client.(*extendedClient)
 	if !ok || dockerClient == nil {
 		return
 	}
@@ -53,7 +55,7 @@ func New(c DockerCredentials, apiVersion string) (client Client, err error) {
 	if c.Host != "" {
 		// read docker config from config
 		endpoint = c.Host
-		if c.CertPath != "" {
+		if c.CertPath != "" || c.TLSVerify {
 			tlsVerify = true
 			tlsCertPath = c.CertPath
 		}
@@ -64,12 +66,17 @@ func New(c DockerCredentials, apiVersion string) (client Client, err error) {
 		tlsCertPath = os.Getenv("DOCKER_CERT_PATH")
 	}
 
+	if tlsVerify && tlsCertPath == "" {
+		tlsCertPath = filepath.Join(homedir.Get(), ".docker")
+	}
+
 	if client := cache.fromCache(endpoint, apiVersion, tlsVerify, tlsCertPath); client != nil {
 		return client, err
 	}
 
+	var dockerClient *docker.Client
 	if tlsVerify {
-		client, err = docker.NewVersionedTLSClient(
+		dockerClient, err = docker.NewVersionedTLSClient(
 			endpoint,
 			filepath.Join(tlsCertPath, "cert.pem"),
 			filepath.Join(tlsCertPath, "key.pem"),
@@ -81,19 +88,69 @@ func New(c DockerCredentials, apiVersion string) (client Client, err error) {
 			return
 		}
 	} else {
-		client, err = docker.NewVersionedClient(endpoint, apiVersion)
+		dockerClient, err = docker.NewVersionedClient(endpoint, apiVersion)
 		if err != nil {
 			logrus.Errorln("Error while Docker client creation:", err)
 			return
 		}
 	}
 
+	client = &extendedClient{
+		Client:     dockerClient,
+		endpoint:   endpoint,
+		apiVersion: apiVersion,
+	}
 	cache.cache(client, endpoint, apiVersion, tlsVerify, tlsCertPath)
 	return
 }
 
+// negotiateAPIVersion picks the newest API version supported by both the daemon and the runner,
+// the daemons older than minVersion are left to reject the requests with a meaningful error
+func negotiateAPIVersion(daemonVersion, minVersion, maxVersion string) string {
+	daemon, err := docker.NewAPIVersion(daemonVersion)
+	if err != nil {
+		return minVersion
+	}
+	min, err := docker.NewAPIVersion(minVersion)
+	if err != nil || daemon.LessThan(min) {
+		return minVersion
+	}
+	max, err := docker.NewAPIVersion(maxVersion)
+	if err == nil && daemon.GreaterThan(max) {
+		return maxVersion
+	}
+	return daemon.String()
+}
+
+// NewNegotiated creates the client using the API version from the credentials,
+// or the one negotiated with the daemon when it isn't configured
+func NewNegotiated(c DockerCredentials, minVersion, maxVersion string) (Client, error) {
+	if c.APIVersion != "" {
+		return New(c, c.APIVersion)
+	}
+
+	client, err := New(c, minVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := client.Version()
+	if err != nil {
+		logrus.Warningln("Failed to negotiate Docker API version:", err)
+		return client, nil
+	}
+
+	apiVersion := negotiateAPIVersion(version.Get("ApiVersion"), minVersion, maxVersion)
+	if apiVersion == minVersion {
+		return client, nil
+	}
+
+	logrus.Debugln("Using Docker API version", apiVersion)
+	return New(c, apiVersion)
+}
+
 func Close(client Client) {
-	dockerClient, ok := client.(*docker.Client)
+	dockerClient, ok := client.(*extendedClient)
 	if !ok {
 		return
 	}
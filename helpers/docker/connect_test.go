@@ -1,6 +1,9 @@
 package docker_helpers_test
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -32,3 +35,32 @@ func TestNoCacheNonUnixSockets(t *testing.T) {
 
 	assert.NotEqual(t, client1, client2)
 }
+
+func testNegotiatedAPIVersion(t *testing.T, dc docker_helpers.DockerCredentials, daemonVersion string) string {
+	var requestedPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedPath = r.URL.Path
+		fmt.Fprintf(w, `{"ApiVersion":%q}`, daemonVersion)
+	}))
+	defer server.Close()
+
+	dc.Host = server.URL
+	client, err := docker_helpers.NewNegotiated(dc, "1.18", "1.24")
+	require.NoError(t, err)
+
+	_, err = client.Info()
+	require.NoError(t, err)
+	return requestedPath
+}
+
+func TestNegotiateAPIVersion(t *testing.T) {
+	dc := docker_helpers.DockerCredentials{}
+	assert.Equal(t, "/v1.22/info", testNegotiatedAPIVersion(t, dc, "1.22"))
+	assert.Equal(t, "/v1.24/info", testNegotiatedAPIVersion(t, dc, "1.30"))
+	assert.Equal(t, "/v1.18/info", testNegotiatedAPIVersion(t, dc, "1.12"))
+}
+
+func TestConfiguredAPIVersion(t *testing.T) {
+	dc := docker_helpers.DockerCredentials{APIVersion: "1.20"}
+	assert.Equal(t, "/v1.20/info", testNegotiatedAPIVersion(t, dc, "1.22"))
+}
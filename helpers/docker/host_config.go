@@ -0,0 +1,137 @@
+package docker_helpers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// HostConfigExtension has the host options of the newer Docker API, which are missing in docker.HostConfig
+type HostConfigExtension struct {
+	Tmpfs   map[string]string `json:"Tmpfs,omitempty"`
+	Runtime string            `json:"Runtime,omitempty"`
+}
+
+func (e *HostConfigExtension) IsEmpty() bool {
+	return len(e.Tmpfs) == 0 && e.Runtime == ""
+}
+
+// extendedClient sends the requests, which go-dockerclient can't send with all the options
+type extendedClient struct {
+	*docker.Client
+
+	endpoint   string
+	apiVersion string
+}
+
+func (c *extendedClient) requestURL(path string) (*url.URL, *http.Client, error) {
+	u, err := url.Parse(c.endpoint)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if c.apiVersion != "" {
+		path = "/v" + c.apiVersion + path
+	}
+	requestURL, err := url.Parse(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if u.Scheme == "unix" {
+		socketPath := u.Path
+		requestURL.Scheme = "http"
+		requestURL.Host = "docker"
+		return requestURL, &http.Client{
+			Transport: &http.Transport{
+				Dial: func(network, addr string) (net.Conn, error) {
+					return dockerDialer.Dial("unix", socketPath)
+				},
+				DisableKeepAlives: true,
+			},
+		}, nil
+	}
+
+	requestURL.Scheme = "http"
+	if u.Scheme == "https" || c.TLSConfig != nil {
+		requestURL.Scheme = "https"
+	}
+	requestURL.Host = u.Host
+	return requestURL, c.HTTPClient, nil
+}
+
+// post sends the JSON encoded data to the Docker API the same way as docker.Client does
+func (c *extendedClient) post(path string, data interface{}) (*http.Response, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	requestURL, httpClient, err := c.requestURL(path)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", requestURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		if strings.Contains(err.Error(), "connection refused") {
+			return nil, docker.ErrConnectionRefused
+		}
+		return nil, err
+	}
+	return resp, nil
+}
+
+// CreateContainerExtended creates the container with the extension of the host options,
+// the same way as docker.Client.CreateContainer does
+func (c *extendedClient) CreateContainerExtended(opts docker.CreateContainerOptions, extension HostConfigExtension) (*docker.Container, error) {
+	if extension.IsEmpty() {
+		return c.Client.CreateContainer(opts)
+	}
+
+	resp, err := c.post("/containers/create?name="+url.QueryEscape(opts.Name), struct {
+		*docker.Config
+		HostConfig interface{} `json:"HostConfig,omitempty"`
+	}{
+		opts.Config,
+		struct {
+			*docker.HostConfig
+			HostConfigExtension
+		}{opts.HostConfig, extension},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, docker.ErrNoSuchImage
+	case resp.StatusCode == http.StatusConflict:
+		return nil, docker.ErrContainerAlreadyExists
+	case resp.StatusCode/100 != 2:
+		message, _ := ioutil.ReadAll(resp.Body)
+		return nil, &docker.Error{Status: resp.StatusCode, Message: string(message)}
+	}
+
+	var container docker.Container
+	err = json.NewDecoder(resp.Body).Decode(&container)
+	if err != nil {
+		return nil, err
+	}
+
+	container.Name = opts.Name
+	return &container, nil
+}
@@ -0,0 +1,90 @@
+package docker_helpers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/docker"
+)
+
+func TestCreateContainerExtended(t *testing.T) {
+	var requestURL string
+	var request map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestURL = r.URL.String()
+		json.NewDecoder(r.Body).Decode(&request)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"Id":"container-id"}`))
+	}))
+	defer server.Close()
+
+	client, err := docker_helpers.New(docker_helpers.DockerCredentials{Host: server.URL}, "1.25")
+	require.NoError(t, err)
+
+	options := docker.CreateContainerOptions{
+		Name:       "build",
+		Config:     &docker.Config{Image: "alpine"},
+		HostConfig: &docker.HostConfig{Privileged: true},
+	}
+	container, err := client.CreateContainerExtended(options, docker_helpers.HostConfigExtension{
+		Tmpfs:   map[string]string{"/tmp": "rw"},
+		Runtime: "runc",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "container-id", container.ID)
+	assert.Equal(t, "build", container.Name)
+
+	assert.Equal(t, "/v1.25/containers/create?name=build", requestURL)
+	assert.Equal(t, "alpine", request["Image"])
+	hostConfig, ok := request["HostConfig"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, true, hostConfig["Privileged"])
+	assert.Equal(t, map[string]interface{}{"/tmp": "rw"}, hostConfig["Tmpfs"])
+	assert.Equal(t, "runc", hostConfig["Runtime"])
+}
+
+func TestCreateContainerExtendedConflict(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusConflict)
+	}))
+	defer server.Close()
+
+	client, err := docker_helpers.New(docker_helpers.DockerCredentials{Host: server.URL}, "1.25")
+	require.NoError(t, err)
+
+	_, err = client.CreateContainerExtended(docker.CreateContainerOptions{Name: "build"}, docker_helpers.HostConfigExtension{
+		Runtime: "runc",
+	})
+	assert.Equal(t, docker.ErrContainerAlreadyExists, err)
+}
+
+func TestCreateVolumeWithLabels(t *testing.T) {
+	var requestURL string
+	var request map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestURL = r.URL.String()
+		json.NewDecoder(r.Body).Decode(&request)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"Name":"cache"}`))
+	}))
+	defer server.Close()
+
+	client, err := docker_helpers.New(docker_helpers.DockerCredentials{Host: server.URL}, "1.25")
+	require.NoError(t, err)
+
+	volume, err := client.CreateVolumeWithLabels(docker.CreateVolumeOptions{Name: "cache"}, map[string]string{
+		"com.gitlab.gitlab-runner.managed": "true",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "cache", volume.Name)
+
+	assert.Equal(t, "/v1.25/volumes/create", requestURL)
+	assert.Equal(t, "cache", request["Name"])
+	assert.Equal(t, map[string]interface{}{"com.gitlab.gitlab-runner.managed": "true"}, request["Labels"])
+}
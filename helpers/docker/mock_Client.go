@@ -33,6 +33,31 @@ func (m *MockClient) ImportImage(opts docker.ImportImageOptions) error {
 
 	return r0
 }
+func (m *MockClient) TagImage(name string, opts docker.TagImageOptions) error {
+	ret := m.Called(name, opts)
+
+	r0 := ret.Error(0)
+
+	return r0
+}
+func (m *MockClient) ListImages(opts docker.ListImagesOptions) ([]docker.APIImages, error) {
+	ret := m.Called(opts)
+
+	var r0 []docker.APIImages
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]docker.APIImages)
+	}
+	r1 := ret.Error(1)
+
+	return r0, r1
+}
+func (m *MockClient) RemoveImage(name string) error {
+	ret := m.Called(name)
+
+	r0 := ret.Error(0)
+
+	return r0
+}
 func (m *MockClient) CreateContainer(opts docker.CreateContainerOptions) (*docker.Container, error) {
 	ret := m.Called(opts)
 
@@ -44,6 +69,17 @@ func (m *MockClient) CreateContainer(opts docker.CreateContainerOptions) (*docke
 
 	return r0, r1
 }
+func (m *MockClient) CreateContainerExtended(opts docker.CreateContainerOptions, extension HostConfigExtension) (*docker.Container, error) {
+	ret := m.Called(opts, extension)
+
+	var r0 *docker.Container
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*docker.Container)
+	}
+	r1 := ret.Error(1)
+
+	return r0, r1
+}
 func (m *MockClient) StartContainer(id string, hostConfig *docker.HostConfig) error {
 	ret := m.Called(id, hostConfig)
 
@@ -98,6 +134,32 @@ func (m *MockClient) Logs(opts docker.LogsOptions) error {
 
 	return r0
 }
+func (m *MockClient) CommitContainer(opts docker.CommitContainerOptions) (*docker.Image, error) {
+	ret := m.Called(opts)
+
+	var r0 *docker.Image
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*docker.Image)
+	}
+
+	r1 := ret.Error(1)
+
+	return r0, r1
+}
+func (m *MockClient) DownloadFromContainer(id string, opts docker.DownloadFromContainerOptions) error {
+	ret := m.Called(id, opts)
+
+	r0 := ret.Error(0)
+
+	return r0
+}
+func (m *MockClient) UploadToContainer(id string, opts docker.UploadToContainerOptions) error {
+	ret := m.Called(id, opts)
+
+	r0 := ret.Error(0)
+
+	return r0
+}
 func (m *MockClient) Info() (*docker.Env, error) {
 	ret := m.Called()
 
@@ -109,3 +171,83 @@ func (m *MockClient) Info() (*docker.Env, error) {
 
 	return r0, r1
 }
+func (m *MockClient) Version() (*docker.Env, error) {
+	ret := m.Called()
+
+	var r0 *docker.Env
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*docker.Env)
+	}
+	r1 := ret.Error(1)
+
+	return r0, r1
+}
+func (m *MockClient) CreateVolume(opts docker.CreateVolumeOptions) (*docker.Volume, error) {
+	ret := m.Called(opts)
+
+	var r0 *docker.Volume
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*docker.Volume)
+	}
+	r1 := ret.Error(1)
+
+	return r0, r1
+}
+func (m *MockClient) CreateVolumeWithLabels(opts docker.CreateVolumeOptions, labels map[string]string) (*docker.Volume, error) {
+	ret := m.Called(opts, labels)
+
+	var r0 *docker.Volume
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*docker.Volume)
+	}
+	r1 := ret.Error(1)
+
+	return r0, r1
+}
+func (m *MockClient) ListVolumes(opts docker.ListVolumesOptions) ([]docker.Volume, error) {
+	ret := m.Called(opts)
+
+	var r0 []docker.Volume
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]docker.Volume)
+	}
+	r1 := ret.Error(1)
+
+	return r0, r1
+}
+func (m *MockClient) RemoveVolume(name string) error {
+	ret := m.Called(name)
+
+	r0 := ret.Error(0)
+
+	return r0
+}
+func (m *MockClient) CreateExec(opts docker.CreateExecOptions) (*docker.Exec, error) {
+	ret := m.Called(opts)
+
+	var r0 *docker.Exec
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*docker.Exec)
+	}
+	r1 := ret.Error(1)
+
+	return r0, r1
+}
+func (m *MockClient) StartExec(id string, opts docker.StartExecOptions) error {
+	ret := m.Called(id, opts)
+
+	r0 := ret.Error(0)
+
+	return r0
+}
+func (m *MockClient) InspectExec(id string) (*docker.ExecInspect, error) {
+	ret := m.Called(id)
+
+	var r0 *docker.ExecInspect
+	if ret.Get(0) != nil {
+		r0 = ret.Get(0).(*docker.ExecInspect)
+	}
+	r1 := ret.Error(1)
+
+	return r0, r1
+}
@@ -0,0 +1,33 @@
+package docker_helpers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// CreateVolumeWithLabels creates the volume with the labels, which are missing in docker.CreateVolumeOptions,
+// the same way as docker.Client.CreateVolume does
+func (c *extendedClient) CreateVolumeWithLabels(opts docker.CreateVolumeOptions, labels map[string]string) (*docker.Volume, error) {
+	resp, err := c.post("/volumes/create", struct {
+		docker.CreateVolumeOptions
+		Labels map[string]string `json:",omitempty"`
+	}{opts, labels})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		message, _ := ioutil.ReadAll(resp.Body)
+		return nil, &docker.Error{Status: resp.StatusCode, Message: string(message)}
+	}
+
+	var volume docker.Volume
+	err = json.NewDecoder(resp.Body).Decode(&volume)
+	if err != nil {
+		return nil, err
+	}
+	return &volume, nil
+}
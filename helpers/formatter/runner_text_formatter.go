@@ -72,5 +72,7 @@ func (f *RunnerTextFormatter) printColored(b *bytes.Buffer, entry *logrus.Entry,
 }
 
 func SetRunnerFormatter() {
-	logrus.SetFormatter(&RunnerTextFormatter{})
+	logrus.SetFormatter(&RunnerTextFormatter{
+		DisableColors: helpers.NoColor(),
+	})
 }
@@ -0,0 +1,116 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const lockFileRetryInterval = 100 * time.Millisecond
+
+// ErrFileLocked is returned when the lock is already held by other process
+var ErrFileLocked = errors.New("file is locked by another process")
+
+// ErrFileNotLocked is returned when the lock isn't held by any process
+var ErrFileNotLocked = errors.New("file is not locked by any process")
+
+// LockFile holds an exclusive lock that is released by Unlock
+// or when the process exits
+type LockFile struct {
+	file *os.File
+}
+
+// NewLockFile creates the file at path and acquires an exclusive lock on it.
+// It returns ErrFileLocked if the lock is held by other process.
+func NewLockFile(path string) (*LockFile, error) {
+	file, err := openLockedFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// store the PID to make it easier to find the owner of the lock
+	file.Truncate(0)
+	fmt.Fprintln(file, os.Getpid())
+
+	return &LockFile{file: file}, nil
+}
+
+// WaitForLockFile acquires the lock at path like NewLockFile, but it waits up to
+// timeout for other process to release it
+func WaitForLockFile(path string, timeout time.Duration) (*LockFile, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		lock, err := NewLockFile(path)
+		if err != ErrFileLocked || time.Now().After(deadline) {
+			return lock, err
+		}
+		time.Sleep(lockFileRetryInterval)
+	}
+}
+
+// Unlock releases the lock. The file is left in place, as removing it
+// could race with other process that is just acquiring the lock.
+func (l *LockFile) Unlock() error {
+	if l == nil || l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// lockFileOwnerTimeout is how long ReadLockFileOwner waits for the owner to write its PID
+const lockFileOwnerTimeout = 5 * time.Second
+
+// isFileLocked checks if the lock at path is held by other process. Unlike NewLockFile,
+// it doesn't replace the PID of the owner, when the lock isn't held
+func isFileLocked(path string) (bool, error) {
+	file, err := openLockedFile(path)
+	if err == ErrFileLocked {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	return false, file.Close()
+}
+
+// ReadLockFileOwner returns the PID of the process holding the lock at path.
+// It returns ErrFileNotLocked if no process holds the lock. The PID is read before
+// and after checking the lock, so the PID of the process which has just released the lock,
+// or the one of the new owner, which isn't written yet, isn't returned.
+func ReadLockFileOwner(path string) (int, error) {
+	deadline := time.Now().Add(lockFileOwnerTimeout)
+	for {
+		before, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			return 0, ErrFileNotLocked
+		} else if err != nil {
+			return 0, err
+		}
+
+		locked, err := isFileLocked(path)
+		if err != nil {
+			return 0, err
+		} else if !locked {
+			return 0, ErrFileNotLocked
+		}
+
+		after, err := ioutil.ReadFile(path)
+		if err != nil {
+			return 0, err
+		}
+
+		pid, err := strconv.Atoi(strings.TrimSpace(string(after)))
+		if err == nil && string(before) == string(after) {
+			return pid, nil
+		} else if time.Now().After(deadline) {
+			return 0, fmt.Errorf("failed to read the PID of the owner of %s", path)
+		}
+		time.Sleep(lockFileRetryInterval)
+	}
+}
@@ -0,0 +1,112 @@
+// +build !windows
+
+package helpers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLockFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lock-file")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.toml.lock")
+
+	lock, err := NewLockFile(path)
+	require.NoError(t, err)
+
+	_, err = NewLockFile(path)
+	assert.Equal(t, ErrFileLocked, err)
+
+	assert.NoError(t, lock.Unlock())
+	assert.NoError(t, lock.Unlock())
+
+	lock, err = NewLockFile(path)
+	assert.NoError(t, err)
+	lock.Unlock()
+}
+
+func TestWaitForLockFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lock-file")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.toml.lock")
+
+	lock, err := NewLockFile(path)
+	require.NoError(t, err)
+
+	_, err = WaitForLockFile(path, 10*time.Millisecond)
+	assert.Equal(t, ErrFileLocked, err, "the lock isn't released in time")
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		lock.Unlock()
+	}()
+
+	lock, err = WaitForLockFile(path, time.Minute)
+	if assert.NoError(t, err, "the lock is acquired after it's released") {
+		lock.Unlock()
+	}
+}
+
+func TestReadLockFileOwner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lock-file")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.toml.lock")
+
+	_, err = ReadLockFileOwner(path)
+	assert.Equal(t, ErrFileNotLocked, err)
+
+	lock, err := NewLockFile(path)
+	require.NoError(t, err)
+
+	pid, err := ReadLockFileOwner(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.Getpid(), pid)
+
+	lock.Unlock()
+	_, err = ReadLockFileOwner(path)
+	assert.Equal(t, ErrFileNotLocked, err)
+}
+
+func TestReadLockFileOwnerKeepsReleasedLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lock-file")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.toml.lock")
+	require.NoError(t, ioutil.WriteFile(path, []byte("12345\n"), 0600))
+
+	_, err = ReadLockFileOwner(path)
+	assert.Equal(t, ErrFileNotLocked, err)
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "12345\n", string(data), "the released lock isn't taken over")
+}
+
+func TestLockFileDoesntFollowSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lock-file")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	target := filepath.Join(dir, "target")
+	path := filepath.Join(dir, "config.toml.lock")
+	require.NoError(t, os.Symlink(target, path))
+
+	_, err = NewLockFile(path)
+	assert.Error(t, err)
+	_, err = os.Stat(target)
+	assert.True(t, os.IsNotExist(err), "the symlink target isn't created")
+}
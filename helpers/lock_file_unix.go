@@ -0,0 +1,26 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package helpers
+
+import (
+	"os"
+	"syscall"
+)
+
+func openLockedFile(path string) (*os.File, error) {
+	// the symlink isn't followed, so the lock can't be used to create or truncate other file
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|syscall.O_NOFOLLOW, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		file.Close()
+		return nil, ErrFileLocked
+	} else if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
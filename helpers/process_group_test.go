@@ -0,0 +1,42 @@
+// +build !windows
+
+package helpers
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKillProcessGroupKillsOrphanedProcesses(t *testing.T) {
+	// the background process exits only when it's killed, it keeps the output open until then
+	cmd := exec.Command("sh", "-c", "sleep 60 & exit 0")
+	output, writer, err := os.Pipe()
+	require.NoError(t, err)
+	defer output.Close()
+	cmd.Stdout = writer
+
+	SetProcessGroup(cmd)
+	require.NoError(t, StartProcessGroup(cmd))
+	writer.Close()
+	require.NoError(t, cmd.Wait())
+
+	closed := make(chan struct{})
+	go func() {
+		ioutil.ReadAll(output)
+		close(closed)
+	}()
+
+	KillProcessGroup(cmd)
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "the orphaned process wasn't killed")
+	}
+}
@@ -14,6 +14,11 @@ func SetProcessGroup(cmd *exec.Cmd) {
 	}
 }
 
+// StartProcessGroup starts the command, its process group is already created by SetProcessGroup
+func StartProcessGroup(cmd *exec.Cmd) error {
+	return cmd.Start()
+}
+
 func KillProcessGroup(cmd *exec.Cmd) {
 	if cmd == nil {
 		return
@@ -3,16 +3,155 @@ package helpers
 import (
 	"os/exec"
 	"strconv"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const (
+	processSetQuota     = 0x0100
+	createSuspended     = 0x00000004
+	th32csSnapThread    = 0x00000004
+	threadSuspendResume = 0x0002
+)
+
+var (
+	kernel32                     = syscall.NewLazyDLL("kernel32.dll")
+	procCreateJobObject          = kernel32.NewProc("CreateJobObjectW")
+	procAssignProcessToJobObject = kernel32.NewProc("AssignProcessToJobObject")
+	procTerminateJobObject       = kernel32.NewProc("TerminateJobObject")
+	procThread32First            = kernel32.NewProc("Thread32First")
+	procThread32Next             = kernel32.NewProc("Thread32Next")
+	procOpenThread               = kernel32.NewProc("OpenThread")
+	procResumeThread             = kernel32.NewProc("ResumeThread")
 )
 
+// threadEntry32 is the THREADENTRY32 structure of the Tool Help library
+type threadEntry32 struct {
+	Size           uint32
+	Usage          uint32
+	ThreadID       uint32
+	OwnerProcessID uint32
+	BasePri        int32
+	DeltaPri       int32
+	Flags          uint32
+}
+
+// The job objects of the started commands, they contain all processes
+// created by the command, even the ones whose parent already exited
+var jobObjects = make(map[*exec.Cmd]syscall.Handle)
+var jobObjectsLock sync.Mutex
+
+func createJobObject(pid int) (syscall.Handle, error) {
+	job, _, err := procCreateJobObject.Call(0, 0)
+	if job == 0 {
+		return 0, err
+	}
+
+	process, err := syscall.OpenProcess(processSetQuota|syscall.PROCESS_TERMINATE, false, uint32(pid))
+	if err != nil {
+		syscall.CloseHandle(syscall.Handle(job))
+		return 0, err
+	}
+	defer syscall.CloseHandle(process)
+
+	ok, _, err := procAssignProcessToJobObject.Call(job, uintptr(process))
+	if ok == 0 {
+		syscall.CloseHandle(syscall.Handle(job))
+		return 0, err
+	}
+	return syscall.Handle(job), nil
+}
+
+// resumeProcess resumes the threads of the process started with CREATE_SUSPENDED
+func resumeProcess(pid int) error {
+	snapshot, err := syscall.CreateToolhelp32Snapshot(th32csSnapThread, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.CloseHandle(snapshot)
+
+	entry := threadEntry32{}
+	entry.Size = uint32(unsafe.Sizeof(entry))
+
+	ok, _, err := procThread32First.Call(uintptr(snapshot), uintptr(unsafe.Pointer(&entry)))
+	for ; ok != 0; ok, _, err = procThread32Next.Call(uintptr(snapshot), uintptr(unsafe.Pointer(&entry))) {
+		if entry.OwnerProcessID != uint32(pid) {
+			continue
+		}
+
+		thread, _, err := procOpenThread.Call(threadSuspendResume, 0, uintptr(entry.ThreadID))
+		if thread == 0 {
+			return err
+		}
+		result, _, err := procResumeThread.Call(thread)
+		syscall.CloseHandle(syscall.Handle(thread))
+		if int32(result) == -1 {
+			return err
+		}
+	}
+
+	if err != syscall.ERROR_NO_MORE_FILES {
+		return err
+	}
+	return nil
+}
+
+func terminateJobObject(job syscall.Handle) {
+	procTerminateJobObject.Call(uintptr(job), 1)
+	syscall.CloseHandle(job)
+}
+
 func SetProcessGroup(cmd *exec.Cmd) {
 }
 
+// StartProcessGroup starts the command suspended and assigns it to a job object before it runs,
+// so KillProcessGroup terminates all processes created by the command
+func StartProcessGroup(cmd *exec.Cmd) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CreationFlags |= createSuspended
+
+	err := cmd.Start()
+	if err != nil {
+		return err
+	}
+
+	job, err := createJobObject(cmd.Process.Pid)
+	if err != nil {
+		logrus.Warningln("Failed to create the job object, only the process tree will be killed:", err)
+	} else {
+		jobObjectsLock.Lock()
+		jobObjects[cmd] = job
+		jobObjectsLock.Unlock()
+	}
+
+	err = resumeProcess(cmd.Process.Pid)
+	if err != nil {
+		KillProcessGroup(cmd)
+		cmd.Wait()
+		return err
+	}
+	return nil
+}
+
 func KillProcessGroup(cmd *exec.Cmd) {
 	if cmd == nil || cmd.Process == nil {
 		return
 	}
 
+	jobObjectsLock.Lock()
+	job, ok := jobObjects[cmd]
+	delete(jobObjects, cmd)
+	jobObjectsLock.Unlock()
+
+	if ok {
+		terminateJobObject(job)
+	}
+
 	exec.Command("taskkill", "/F", "/T", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
 	cmd.Process.Kill()
 }
@@ -0,0 +1,94 @@
+package helpers
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// ProgressReportInterval is how often the progress is reported, when it doesn't change by 10%
+const ProgressReportInterval = 5 * time.Second
+const progressReportStep = 10
+
+// ProgressReader prints the progress of reading as plain percentage lines.
+// Contrary to the terminal progress bars, these can be followed in the build trace.
+type ProgressReader struct {
+	Reader   io.Reader
+	Output   io.Writer
+	Prefix   string
+	Total    int64
+	Interval time.Duration
+
+	read        int64
+	lastReport  time.Time
+	lastPercent int
+}
+
+// NewProgressReader reports the progress of reading total bytes from reader to os.Stderr
+func NewProgressReader(reader io.Reader, total int64, prefix string) *ProgressReader {
+	return &ProgressReader{
+		Reader:     reader,
+		Output:     os.Stderr,
+		Prefix:     prefix,
+		Total:      total,
+		Interval:   ProgressReportInterval,
+		lastReport: time.Now(),
+	}
+}
+
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func (p *ProgressReader) percent() int {
+	if p.Total <= 0 {
+		return -1
+	}
+	if p.read >= p.Total {
+		return 100
+	}
+	return int(p.read * 100 / p.Total)
+}
+
+func (p *ProgressReader) report(percent int) {
+	if percent < 0 {
+		fmt.Fprintf(p.Output, "%s: %s\n", p.Prefix, formatBytes(p.read))
+	} else {
+		fmt.Fprintf(p.Output, "%s: %d%% (%s of %s)\n", p.Prefix, percent, formatBytes(p.read), formatBytes(p.Total))
+	}
+	p.lastReport = time.Now()
+	p.lastPercent = percent
+}
+
+// BytesRead returns how many bytes were read so far
+func (p *ProgressReader) BytesRead() int64 {
+	return p.read
+}
+
+func (p *ProgressReader) Read(data []byte) (n int, err error) {
+	n, err = p.Reader.Read(data)
+	p.read += int64(n)
+
+	percent := p.percent()
+	switch {
+	case percent == 100 && p.lastPercent != 100:
+		p.report(percent)
+	case percent >= 0 && percent/progressReportStep > p.lastPercent/progressReportStep:
+		p.report(percent)
+	case percent < 0 && err == io.EOF && p.read > 0:
+		p.report(percent)
+	case n > 0 && p.Interval > 0 && time.Since(p.lastReport) >= p.Interval:
+		p.report(percent)
+	}
+	return
+}
@@ -0,0 +1,67 @@
+package helpers
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressReaderReportsPercentage(t *testing.T) {
+	output := &bytes.Buffer{}
+	data := bytes.Repeat([]byte("a"), 2048)
+
+	progress := NewProgressReader(bytes.NewReader(data), int64(len(data)), "Downloading cache.zip")
+	progress.Output = output
+	progress.Interval = 0
+
+	_, err := io.Copy(ioutil.Discard, struct{ io.Reader }{progress})
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	assert.Equal(t, []string{"Downloading cache.zip: 100% (2.0 KiB of 2.0 KiB)"}, lines)
+}
+
+func TestProgressReaderReportsSteps(t *testing.T) {
+	output := &bytes.Buffer{}
+	data := bytes.Repeat([]byte("a"), 100)
+
+	progress := NewProgressReader(bytes.NewReader(data), int64(len(data)), "Uploading")
+	progress.Output = output
+	progress.Interval = 0
+
+	buffer := make([]byte, 25)
+	for {
+		_, err := progress.Read(buffer)
+		if err != nil {
+			break
+		}
+	}
+
+	assert.Equal(t, "Uploading: 25% (25 B of 100 B)\n"+
+		"Uploading: 50% (50 B of 100 B)\n"+
+		"Uploading: 75% (75 B of 100 B)\n"+
+		"Uploading: 100% (100 B of 100 B)\n", output.String())
+}
+
+func TestProgressReaderWithUnknownSize(t *testing.T) {
+	output := &bytes.Buffer{}
+
+	progress := NewProgressReader(strings.NewReader("data"), 0, "Uploading")
+	progress.Output = output
+	progress.Interval = time.Hour
+
+	_, err := io.Copy(ioutil.Discard, struct{ io.Reader }{progress})
+	assert.NoError(t, err)
+	assert.Equal(t, "Uploading: 4 B\n", output.String())
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512 B", formatBytes(512))
+	assert.Equal(t, "1.5 KiB", formatBytes(1536))
+	assert.Equal(t, "3.0 MiB", formatBytes(3*1024*1024))
+}
@@ -0,0 +1,148 @@
+package helpers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The headers of the signed request, the signature is the hex encoded HMAC-SHA256 of the method,
+// the request URI, the timestamp, the expiration time and the hash of the body joined with the new lines
+const RequestTimestampHeader = "X-Gitlab-Runner-Timestamp"
+const RequestExpiresHeader = "X-Gitlab-Runner-Expires"
+const RequestSignatureHeader = "X-Gitlab-Runner-Signature"
+const RequestContentHashHeader = "X-Gitlab-Runner-Content-Sha256"
+
+// UnsignedPayload is the hash of the body of the pre-signed request, which isn't known when it's signed
+const UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// RequestSignatureValidity is the time the request signed just before it's sent is valid
+const RequestSignatureValidity = 5 * time.Minute
+
+// EmptyBodyHash is the hex encoded SHA256 of the request without the body
+var EmptyBodyHash = fmt.Sprintf("%x", sha256.Sum256(nil))
+
+// ParseRequestHeaders converts the headers defined as "Name: value"
+func ParseRequestHeaders(headers []string) (http.Header, error) {
+	result := make(http.Header)
+	for _, header := range headers {
+		parts := strings.SplitN(header, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid header %q, it has to be defined as Name: value", header)
+		}
+		result.Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+	return result, nil
+}
+
+// RequestBodyHash returns the hex encoded SHA256 of the body and the body to send.
+// The seekable body is rewound, the other one is read to the memory, so the whole body is always signed
+func RequestBodyHash(body io.Reader) (string, io.Reader, error) {
+	if body == nil {
+		return EmptyBodyHash, nil, nil
+	}
+
+	seeker, ok := body.(io.Seeker)
+	if !ok {
+		data, err := ioutil.ReadAll(body)
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("%x", sha256.Sum256(data)), bytes.NewReader(data), nil
+	}
+
+	offset, err := seeker.Seek(0, os.SEEK_CUR)
+	if err != nil {
+		return "", nil, err
+	}
+	hash := sha256.New()
+	if _, err = io.Copy(hash, body); err != nil {
+		return "", nil, err
+	}
+	if _, err = seeker.Seek(offset, os.SEEK_SET); err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), body, nil
+}
+
+// SignedRequest is the signature of the single request. The requests of the helpers
+// are pre-signed by the runner, so the signing key isn't passed to the build
+type SignedRequest struct {
+	Method      string
+	RequestURI  string
+	Timestamp   int64
+	Expires     int64
+	ContentHash string
+	Signature   string
+}
+
+// SignRequest signs the request with the key, the signature is valid from now for the validity
+func SignRequest(key, method string, requestURL *url.URL, bodyHash string, now time.Time, validity time.Duration) SignedRequest {
+	request := SignedRequest{
+		Method:      method,
+		RequestURI:  requestURL.RequestURI(),
+		Timestamp:   now.Unix(),
+		Expires:     now.Add(validity).Unix(),
+		ContentHash: bodyHash,
+	}
+
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(strings.Join([]string{
+		request.Method,
+		request.RequestURI,
+		strconv.FormatInt(request.Timestamp, 10),
+		strconv.FormatInt(request.Expires, 10),
+		request.ContentHash,
+	}, "\n")))
+	request.Signature = fmt.Sprintf("%x", mac.Sum(nil))
+	return request
+}
+
+// Key identifies the request, which the signature is used for
+func (r SignedRequest) Key() string {
+	return r.Method + " " + r.RequestURI
+}
+
+// Headers returns the headers of the signed request
+func (r SignedRequest) Headers() http.Header {
+	headers := make(http.Header)
+	headers.Set(RequestTimestampHeader, strconv.FormatInt(r.Timestamp, 10))
+	headers.Set(RequestExpiresHeader, strconv.FormatInt(r.Expires, 10))
+	headers.Set(RequestContentHashHeader, r.ContentHash)
+	headers.Set(RequestSignatureHeader, r.Signature)
+	return headers
+}
+
+// String encodes the pre-signed request passed to the helper, the fields don't contain spaces
+func (r SignedRequest) String() string {
+	return fmt.Sprintf("%s %s %d %d %s %s", r.Method, r.RequestURI, r.Timestamp, r.Expires, r.ContentHash, r.Signature)
+}
+
+// ParseSignedRequest decodes the pre-signed request encoded by String
+func ParseSignedRequest(value string) (request SignedRequest, err error) {
+	fields := strings.Fields(value)
+	if len(fields) != 6 {
+		err = errors.New("invalid request signature")
+		return
+	}
+
+	request.Method = fields[0]
+	request.RequestURI = fields[1]
+	request.ContentHash = fields[4]
+	request.Signature = fields[5]
+	if request.Timestamp, err = strconv.ParseInt(fields[2], 10, 64); err != nil {
+		return
+	}
+	request.Expires, err = strconv.ParseInt(fields[3], 10, 64)
+	return
+}
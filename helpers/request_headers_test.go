@@ -0,0 +1,93 @@
+package helpers
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRequestHeaders(t *testing.T) {
+	headers, err := ParseRequestHeaders([]string{"X-Api-Key: secret:value", "X-Tenant:ci", "X-Tenant: runners"})
+	require.NoError(t, err)
+	assert.Equal(t, http.Header{
+		"X-Api-Key": {"secret:value"},
+		"X-Tenant":  {"ci", "runners"},
+	}, headers)
+
+	_, err = ParseRequestHeaders([]string{"X-Api-Key"})
+	assert.Error(t, err)
+	_, err = ParseRequestHeaders([]string{": value"})
+	assert.Error(t, err)
+}
+
+func TestSignRequest(t *testing.T) {
+	requestURL, _ := url.Parse("https://gitlab.example.com/ci/api/v1/builds/register.json?a=b")
+	now := time.Unix(1500000000, 0)
+
+	signature := func(key, method, bodyHash string, now time.Time, validity time.Duration) string {
+		return SignRequest(key, method, requestURL, bodyHash, now, validity).Signature
+	}
+
+	request := SignRequest("key", "POST", requestURL, "hash", now, time.Minute)
+	headers := request.Headers()
+	assert.Equal(t, "POST /ci/api/v1/builds/register.json?a=b", request.Key())
+	assert.Equal(t, "1500000000", headers.Get(RequestTimestampHeader))
+	assert.Equal(t, "1500000060", headers.Get(RequestExpiresHeader))
+	assert.Equal(t, "hash", headers.Get(RequestContentHashHeader))
+	assert.Len(t, headers.Get(RequestSignatureHeader), 64)
+	assert.Equal(t, headers.Get(RequestSignatureHeader), signature("key", "POST", "hash", now, time.Minute))
+
+	assert.NotEqual(t, request.Signature, signature("other-key", "POST", "hash", now, time.Minute))
+	assert.NotEqual(t, request.Signature, signature("key", "GET", "hash", now, time.Minute))
+	assert.NotEqual(t, request.Signature, signature("key", "POST", "other-hash", now, time.Minute))
+	assert.NotEqual(t, request.Signature, signature("key", "POST", "hash", now.Add(time.Second), time.Minute))
+	assert.NotEqual(t, request.Signature, signature("key", "POST", "hash", now, time.Hour))
+}
+
+func TestSignedRequestString(t *testing.T) {
+	requestURL, _ := url.Parse("https://gitlab.example.com/ci/api/v1/builds/1/artifacts?expire_in=1+day")
+	request := SignRequest("key", "POST", requestURL, UnsignedPayload, time.Unix(1500000000, 0), time.Hour)
+
+	parsed, err := ParseSignedRequest(request.String())
+	require.NoError(t, err)
+	assert.Equal(t, request, parsed)
+	assert.NotContains(t, request.String(), "key ", "the key isn't encoded")
+
+	_, err = ParseSignedRequest("GET /ci/api/v1/builds/1/artifacts")
+	assert.Error(t, err)
+	_, err = ParseSignedRequest("GET /ci/api/v1/builds/1/artifacts now later hash signature")
+	assert.Error(t, err)
+}
+
+func TestRequestBodyHash(t *testing.T) {
+	hash, body, err := RequestBodyHash(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", hash, "the empty body")
+	assert.Equal(t, EmptyBodyHash, hash)
+	assert.Nil(t, body)
+
+	reader := strings.NewReader("body")
+	hash, body, err = RequestBodyHash(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "230d8358dc8e8890b4c58deeb62912ee2f20357ae92a5cc861b98e68fe31acb5", hash)
+	data, _ := ioutil.ReadAll(body)
+	assert.Equal(t, "body", string(data), "the body is rewound")
+
+	pipeReader, pipeWriter := io.Pipe()
+	go func() {
+		pipeWriter.Write([]byte("body"))
+		pipeWriter.Close()
+	}()
+	hash, body, err = RequestBodyHash(pipeReader)
+	require.NoError(t, err)
+	assert.Equal(t, "230d8358dc8e8890b4c58deeb62912ee2f20357ae92a5cc861b98e68fe31acb5", hash, "the stream is signed too")
+	data, _ = ioutil.ReadAll(body)
+	assert.Equal(t, "body", string(data), "the stream is sent after it's hashed")
+}
@@ -0,0 +1,316 @@
+// +build freebsd
+
+package service_helpers
+
+import (
+	"errors"
+	"fmt"
+	"log/syslog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+
+	service "github.com/ayufan/golang-kardianos-service"
+	"github.com/kardianos/osext"
+)
+
+const freebsdRcdDir = "/usr/local/etc/rc.d"
+
+var errNoUserServiceFreeBSD = errors.New("User services are not supported on FreeBSD.")
+
+type freebsdSystem struct{}
+
+func (freebsdSystem) String() string {
+	return "freebsd-rcd"
+}
+
+func (freebsdSystem) Detect() bool {
+	_, err := os.Stat("/etc/rc.subr")
+	return err == nil
+}
+
+func (freebsdSystem) Interactive() bool {
+	return os.Getppid() != 1
+}
+
+func (freebsdSystem) New(i service.Interface, c *service.Config) (service.Service, error) {
+	return &FreeBSDService{
+		i: i,
+		c: c,
+	}, nil
+}
+
+// FreeBSDService controls the runner with rc.d script managed by rc.subr(8)
+type FreeBSDService struct {
+	i service.Interface
+	c *service.Config
+}
+
+// rcName returns the name usable as a rc.subr variable prefix.
+// The rc.conf variables can't contain dashes.
+func (s *FreeBSDService) rcName() string {
+	return strings.Replace(s.c.Name, "-", "_", -1)
+}
+
+func (s *FreeBSDService) rcVar() string {
+	return s.rcName() + "_enable"
+}
+
+func (s *FreeBSDService) scriptPath() (string, error) {
+	if userService, _ := s.c.Option["UserService"].(bool); userService {
+		return "", errNoUserServiceFreeBSD
+	}
+	return freebsdRcdDir + "/" + s.c.Name, nil
+}
+
+func (s *FreeBSDService) execPath() (string, error) {
+	if s.c.Executable != "" {
+		return s.c.Executable, nil
+	}
+	return osext.Executable()
+}
+
+func (s *FreeBSDService) run(command string, arguments ...string) error {
+	out, err := exec.Command(command, arguments...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%q failed: %v, %s", command, err, out)
+	}
+	return nil
+}
+
+func (s *FreeBSDService) isInstalled() bool {
+	scriptPath, err := s.scriptPath()
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(scriptPath)
+	return err == nil
+}
+
+// Run should be called shortly after the program entry point.
+// After Interface.Stop has finished running, Run will stop blocking.
+// After Run stops blocking, the program must exit shortly after.
+func (s *FreeBSDService) Run() (err error) {
+	err = s.i.Start(s)
+	if err != nil {
+		return err
+	}
+
+	if runWait, ok := s.c.Option["RunWait"].(func()); ok {
+		runWait()
+	} else {
+		sigChan := make(chan os.Signal, 3)
+		signal.Notify(sigChan, syscall.SIGTERM, os.Interrupt)
+		<-sigChan
+	}
+
+	return s.i.Stop(s)
+}
+
+// Start signals to the OS service manager the given service should start.
+func (s *FreeBSDService) Start() error {
+	if !s.isInstalled() {
+		return service.ErrServiceIsNotInstalled
+	}
+	return s.run("service", s.c.Name, "start")
+}
+
+// Stop signals to the OS service manager the given service should stop.
+func (s *FreeBSDService) Stop() error {
+	if !s.isInstalled() {
+		return service.ErrServiceIsNotInstalled
+	}
+	return s.run("service", s.c.Name, "stop")
+}
+
+// Restart signals to the OS service manager the given service should stop then start.
+func (s *FreeBSDService) Restart() error {
+	err := s.Stop()
+	if err != nil {
+		return err
+	}
+	time.Sleep(50 * time.Millisecond)
+	return s.Start()
+}
+
+// Install setups up the given service in the OS service manager. This may require
+// greater rights. Will return an error if it is already installed.
+func (s *FreeBSDService) Install() error {
+	scriptPath, err := s.scriptPath()
+	if err != nil {
+		return err
+	}
+	if _, err = os.Stat(scriptPath); err == nil {
+		return fmt.Errorf("Init already exists: %s", scriptPath)
+	}
+
+	path, err := s.execPath()
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(freebsdRcdDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(scriptPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0755)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	err = freebsdRcdTemplate.Execute(f, &struct {
+		*service.Config
+		Path   string
+		RcName string
+		RcVar  string
+	}{
+		Config: s.c,
+		Path:   path,
+		RcName: s.rcName(),
+		RcVar:  s.rcVar(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.run("sysrc", s.rcVar()+"=YES")
+}
+
+// Uninstall removes the given service from the OS service manager. This may require
+// greater rights. Will return an error if the service is not present.
+func (s *FreeBSDService) Uninstall() error {
+	scriptPath, err := s.scriptPath()
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(scriptPath); err != nil {
+		return err
+	}
+
+	// the rc.conf entry may have been removed manually
+	s.run("sysrc", "-x", s.rcVar())
+	return nil
+}
+
+// Status returns nil if the given service is running.
+// Will return an error if the service is not running or is not present.
+func (s *FreeBSDService) Status() error {
+	if !s.isInstalled() {
+		return service.ErrServiceIsNotInstalled
+	}
+
+	out, _ := exec.Command("service", s.c.Name, "onestatus").CombinedOutput()
+	if strings.Contains(string(out), "is running") {
+		return nil
+	}
+	return service.ErrServiceIsNotRunning
+}
+
+// Logger opens and returns a system logger. If the user program is running
+// interactively rather then as a service, the returned logger will write to
+// os.Stderr. If errs is non-nil errors will be sent on errs as well as
+// returned from Logger's functions.
+func (s *FreeBSDService) Logger(errs chan<- error) (service.Logger, error) {
+	if (freebsdSystem{}).Interactive() {
+		return service.ConsoleLogger, nil
+	}
+	return s.SystemLogger(errs)
+}
+
+// SystemLogger opens and returns a system logger. If errs is non-nil errors
+// will be sent on errs as well as returned from Logger's functions.
+func (s *FreeBSDService) SystemLogger(errs chan<- error) (service.Logger, error) {
+	w, err := syslog.New(syslog.LOG_INFO, s.c.Name)
+	if err != nil {
+		return nil, err
+	}
+	return sysLogger{w, errs}, nil
+}
+
+// String displays the name of the service. The display name if present,
+// otherwise the name.
+func (s *FreeBSDService) String() string {
+	if s.c.DisplayName != "" {
+		return s.c.DisplayName
+	}
+	return s.c.Name
+}
+
+type sysLogger struct {
+	*syslog.Writer
+	errs chan<- error
+}
+
+func (s sysLogger) send(err error) error {
+	if err != nil && s.errs != nil {
+		s.errs <- err
+	}
+	return err
+}
+
+func (s sysLogger) Error(v ...interface{}) error {
+	return s.send(s.Writer.Err(fmt.Sprint(v...)))
+}
+func (s sysLogger) Warning(v ...interface{}) error {
+	return s.send(s.Writer.Warning(fmt.Sprint(v...)))
+}
+func (s sysLogger) Info(v ...interface{}) error {
+	return s.send(s.Writer.Info(fmt.Sprint(v...)))
+}
+func (s sysLogger) Errorf(format string, a ...interface{}) error {
+	return s.send(s.Writer.Err(fmt.Sprintf(format, a...)))
+}
+func (s sysLogger) Warningf(format string, a ...interface{}) error {
+	return s.send(s.Writer.Warning(fmt.Sprintf(format, a...)))
+}
+func (s sysLogger) Infof(format string, a ...interface{}) error {
+	return s.send(s.Writer.Info(fmt.Sprintf(format, a...)))
+}
+
+func shellQuote(value string) string {
+	return "'" + strings.Replace(value, "'", `'\''`, -1) + "'"
+}
+
+var freebsdRcdTemplate = template.Must(template.New("rc.d").Funcs(template.FuncMap{
+	"quote": shellQuote,
+}).Parse(freebsdRcdScript))
+
+const freebsdRcdScript = `#!/bin/sh
+# PROVIDE: {{.RcName}}
+# REQUIRE: DAEMON NETWORKING
+# KEYWORD: shutdown
+#
+# {{.Description}}
+#
+# Add the following line to /etc/rc.conf to enable {{.Name}}:
+# {{.RcVar}}="YES"
+
+. /etc/rc.subr
+
+name="{{.RcName}}"
+rcvar="{{.RcVar}}"
+
+load_rc_config $name
+
+: ${ {{- .RcVar}}:="NO"}
+{{- if .WorkingDirectory}}
+: ${ {{- .RcName}}_chdir:={{.WorkingDirectory|quote}}}
+{{- end}}
+
+pidfile="/var/run/${name}.pid"
+procname={{.Path|quote}}
+command="/usr/sbin/daemon"
+command_args="-f -p ${pidfile} ${procname}{{range .Arguments}} {{.|quote}}{{end}}"
+
+run_rc_command "$1"
+`
+
+func init() {
+	service.ChooseSystem(freebsdSystem{})
+}
@@ -14,6 +14,8 @@ func New(i service.Interface, c *service.Config) (service.Service, error) {
 			i: i,
 			c: c,
 		}, nil
+	} else if err != nil {
+		return nil, err
 	}
-	return s, err
+	return withServiceOptions(s, c), nil
 }
@@ -0,0 +1,198 @@
+package service_helpers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"text/template"
+
+	service "github.com/ayufan/golang-kardianos-service"
+)
+
+// systemdDropInName is the file of the unit options unknown to the service library
+const systemdDropInName = "gitlab-runner.conf"
+
+// systemdDropIn is the part of the unit configured by the runner, the rest is installed by the library
+var systemdDropIn = template.Must(template.New("").Parse(`[Service]
+{{if .TypeNotify}}Type=notify
+{{end}}{{if .WatchdogSec}}WatchdogSec={{.WatchdogSec}}
+{{end}}`))
+
+// launchdKeysAnchor is the key of the plist, before which the keys configured by the runner are inserted
+const launchdKeysAnchor = "<key>KeepAlive</key>"
+
+var launchdKeys = template.Must(template.New("").Parse(`{{if .SessionType}}<key>LimitLoadToSessionType</key><string>{{html .SessionType}}</string>
+{{end}}{{if .StandardOutPath}}<key>StandardOutPath</key><string>{{html .StandardOutPath}}</string>
+{{end}}{{if .StandardErrorPath}}<key>StandardErrorPath</key><string>{{html .StandardErrorPath}}</string>
+{{end}}`))
+
+type systemdOptions struct {
+	TypeNotify  bool
+	WatchdogSec string
+}
+
+type launchdOptions struct {
+	SessionType       string
+	StandardOutPath   string
+	StandardErrorPath string
+}
+
+func optionString(c *service.Config, name string) string {
+	value, _ := c.Option[name].(string)
+	return value
+}
+
+func newSystemdOptions(c *service.Config) systemdOptions {
+	typeNotify, _ := c.Option["TypeNotify"].(bool)
+	return systemdOptions{
+		TypeNotify:  typeNotify,
+		WatchdogSec: optionString(c, "WatchdogSec"),
+	}
+}
+
+func newLaunchdOptions(c *service.Config) launchdOptions {
+	return launchdOptions{
+		SessionType:       optionString(c, "SessionType"),
+		StandardOutPath:   optionString(c, "StandardOutPath"),
+		StandardErrorPath: optionString(c, "StandardErrorPath"),
+	}
+}
+
+// renderSystemdDropIn returns nil, when none of the options is set
+func renderSystemdDropIn(options systemdOptions) ([]byte, error) {
+	if options == (systemdOptions{}) {
+		return nil, nil
+	}
+
+	var buffer bytes.Buffer
+	err := systemdDropIn.Execute(&buffer, options)
+	return buffer.Bytes(), err
+}
+
+// insertLaunchdKeys adds the options to the plist installed by the library
+func insertLaunchdKeys(plist []byte, options launchdOptions) ([]byte, error) {
+	if options == (launchdOptions{}) {
+		return plist, nil
+	}
+
+	index := bytes.Index(plist, []byte(launchdKeysAnchor))
+	if index < 0 {
+		return nil, errors.New("unknown format of the launchd configuration")
+	}
+
+	var buffer bytes.Buffer
+	buffer.Write(plist[:index])
+	err := launchdKeys.Execute(&buffer, options)
+	if err != nil {
+		return nil, err
+	}
+	buffer.Write(plist[index:])
+	return buffer.Bytes(), nil
+}
+
+// systemdService installs the unit options as a drop-in, which is removed together with the unit
+type systemdService struct {
+	service.Service
+	c *service.Config
+}
+
+func (s *systemdService) dropInDir() string {
+	return "/etc/systemd/system/" + s.c.Name + ".service.d"
+}
+
+func (s *systemdService) Install() error {
+	err := s.Service.Install()
+	if err != nil {
+		return err
+	}
+
+	data, err := renderSystemdDropIn(newSystemdOptions(s.c))
+	if err != nil || data == nil {
+		return err
+	}
+
+	err = os.MkdirAll(s.dropInDir(), 0755)
+	if err != nil {
+		return err
+	}
+	err = ioutil.WriteFile(filepath.Join(s.dropInDir(), systemdDropInName), data, 0644)
+	if err != nil {
+		return err
+	}
+
+	out, err := exec.Command("systemctl", "daemon-reload").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl daemon-reload failed: %v, %s", err, out)
+	}
+	return nil
+}
+
+func (s *systemdService) Uninstall() error {
+	err := s.Service.Uninstall()
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(s.dropInDir())
+}
+
+// launchdService adds the options to the plist, it's removed by the library on uninstall
+type launchdService struct {
+	service.Service
+	c *service.Config
+}
+
+func (s *launchdService) plistPath() (string, error) {
+	if userService, _ := s.c.Option["UserService"].(bool); !userService {
+		return "/Library/LaunchDaemons/" + s.c.Name + ".plist", nil
+	}
+
+	u, err := user.Current()
+	if err != nil {
+		return "", err
+	}
+	return u.HomeDir + "/Library/LaunchAgents/" + s.c.Name + ".plist", nil
+}
+
+func (s *launchdService) Install() error {
+	err := s.Service.Install()
+	if err != nil {
+		return err
+	}
+
+	path, err := s.plistPath()
+	if err != nil {
+		return err
+	}
+
+	plist, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	plist, err = insertLaunchdKeys(plist, newLaunchdOptions(s.c))
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, plist, 0644)
+}
+
+// withServiceOptions handles the options of the service systems, which the library doesn't support
+func withServiceOptions(s service.Service, c *service.Config) service.Service {
+	system := service.ChosenSystem()
+	if system == nil {
+		return s
+	}
+
+	switch system.String() {
+	case "linux-systemd":
+		return &systemdService{Service: s, c: c}
+	case "darwin-launchd":
+		return &launchdService{Service: s, c: c}
+	}
+	return s
+}
@@ -0,0 +1,49 @@
+package service_helpers
+
+import (
+	"testing"
+
+	service "github.com/ayufan/golang-kardianos-service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderSystemdDropIn(t *testing.T) {
+	data, err := renderSystemdDropIn(newSystemdOptions(&service.Config{
+		Option: service.KeyValue{
+			"TypeNotify":  true,
+			"WatchdogSec": "60",
+		},
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, "[Service]\nType=notify\nWatchdogSec=60\n", string(data))
+
+	data, err = renderSystemdDropIn(newSystemdOptions(&service.Config{}))
+	assert.NoError(t, err)
+	assert.Nil(t, data, "the drop-in isn't installed without options")
+}
+
+func TestInsertLaunchdKeys(t *testing.T) {
+	plist := []byte("<dict>\n<key>SessionCreate</key><false/>\n<key>KeepAlive</key><true/>\n</dict>\n")
+
+	data, err := insertLaunchdKeys(plist, newLaunchdOptions(&service.Config{
+		Option: service.KeyValue{
+			"SessionType":       "Aqua",
+			"StandardOutPath":   "/var/log/runner & co.log",
+			"StandardErrorPath": "/var/log/runner & co.log",
+		},
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "<dict>\n<key>SessionCreate</key><false/>\n"+
+		"<key>LimitLoadToSessionType</key><string>Aqua</string>\n"+
+		"<key>StandardOutPath</key><string>/var/log/runner &amp; co.log</string>\n"+
+		"<key>StandardErrorPath</key><string>/var/log/runner &amp; co.log</string>\n"+
+		"<key>KeepAlive</key><true/>\n</dict>\n", string(data))
+
+	data, err = insertLaunchdKeys(plist, launchdOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, plist, data)
+
+	_, err = insertLaunchdKeys([]byte("<dict/>"), launchdOptions{SessionType: "Aqua"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,132 @@
+package sinks
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+const defaultElasticsearchIndex = "gitlab-ci-builds"
+const elasticsearchTimeout = time.Minute
+
+// Record is the part of the build trace together with the metadata of the build
+type Record struct {
+	BuildID    int       `json:"build_id"`
+	ProjectID  int       `json:"project_id"`
+	Name       string    `json:"name"`
+	Stage      string    `json:"stage"`
+	Ref        string    `json:"ref"`
+	Sha        string    `json:"sha"`
+	Tag        bool      `json:"tag"`
+	Runner     string    `json:"runner"`
+	RunnerName string    `json:"runner_name,omitempty"`
+	Executor   string    `json:"executor"`
+	Status     string    `json:"status"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// Offset is the position of the part in the whole trace
+	Offset    int64  `json:"offset"`
+	Trace     string `json:"trace"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+type Sink interface {
+	Send(record *Record) error
+}
+
+// fileSink appends each record as a single JSON line,
+// so the file can be followed by the other log shippers
+type fileSink struct {
+	path string
+}
+
+// fileSinkLock serializes the writes of concurrent builds to the same file
+var fileSinkLock sync.Mutex
+
+func (s *fileSink) Send(record *Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	fileSinkLock.Lock()
+	defer fileSinkLock.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+type elasticsearchSink struct {
+	url    string
+	index  string
+	client http.Client
+}
+
+func (s *elasticsearchSink) Send(record *Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("%s/%s/build", strings.TrimRight(s.url, "/"), s.index)
+	res, err := s.client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	defer io.Copy(ioutil.Discard, res.Body)
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("Elasticsearch responded with %s", res.Status)
+	}
+	return nil
+}
+
+func NewSink(config *common.LogSinkConfig) (Sink, error) {
+	switch config.Type {
+	case "file":
+		if config.Path == "" {
+			return nil, errors.New("Missing path of the file log sink")
+		}
+		return &fileSink{path: config.Path}, nil
+
+	case "elasticsearch":
+		if config.URL == "" {
+			return nil, errors.New("Missing URL of the elasticsearch log sink")
+		}
+		index := config.Index
+		if index == "" {
+			index = defaultElasticsearchIndex
+		}
+		return &elasticsearchSink{
+			url:   config.URL,
+			index: index,
+			client: http.Client{
+				Timeout: elasticsearchTimeout,
+			},
+		}, nil
+
+	case "cloudwatch":
+		// Shipping the file sink with the CloudWatch Logs agent is the supported way
+		return nil, errors.New("The cloudwatch log sink is not supported, use the file sink with the CloudWatch Logs agent")
+
+	default:
+		return nil, fmt.Errorf("Unsupported log sink type: %q", config.Type)
+	}
+}
@@ -0,0 +1,186 @@
+package sinks
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+// sendTimeout is how long the shutdown waits for the traces still being sent
+const sendTimeout = elasticsearchTimeout
+
+// partSize is the size of the trace part, which is sent without waiting for the flush interval
+const partSize = 64 * 1024
+
+// maxPendingSize limits the trace waiting for the sink, the output is dropped above it
+const maxPendingSize = 16 * partSize
+
+// flushInterval is how often the output written since the last part is sent
+var flushInterval = 5 * time.Second
+
+// pendingTraces are sent in background, so the build isn't finished later because of the sink
+var pendingTraces sync.WaitGroup
+
+// buildTrace mirrors the build trace and streams it to the sink in parts,
+// the last part is sent with the status once the build finishes
+type buildTrace struct {
+	common.BuildTrace
+
+	sink     Sink
+	runner   *common.RunnerConfig
+	record   Record
+	pending  bytes.Buffer
+	offset   int64
+	written  int64
+	dropping bool
+	flush    chan bool
+	finished chan string
+	lock     sync.Mutex
+	once     sync.Once
+}
+
+func (t *buildTrace) Write(p []byte) (n int, err error) {
+	t.lock.Lock()
+	// The slow sink doesn't delay the build, its output is dropped until the pending part is sent
+	if t.dropping || t.pending.Len()+len(p) > maxPendingSize {
+		t.dropping = true
+		t.record.Truncated = true
+	} else {
+		t.pending.Write(p)
+	}
+	t.written += int64(len(p))
+	if t.pending.Len() >= partSize {
+		select {
+		case t.flush <- true:
+		default:
+		}
+	}
+	t.lock.Unlock()
+
+	return t.BuildTrace.Write(p)
+}
+
+func (t *buildTrace) takePart() Record {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	part := t.record
+	part.Offset = t.offset
+	part.Trace = t.pending.String()
+	t.pending.Reset()
+	t.offset = t.written
+	t.dropping = false
+	return part
+}
+
+func (t *buildTrace) sendPart(part *Record) {
+	err := t.sink.Send(part)
+	if err != nil {
+		t.runner.Log().WithError(err).Warningln("Failed to send build trace to the log sink")
+	}
+}
+
+func (t *buildTrace) run() {
+	defer pendingTraces.Done()
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.flush:
+		case <-ticker.C:
+		case status := <-t.finished:
+			part := t.takePart()
+			part.Status = status
+			part.FinishedAt = time.Now()
+			t.sendPart(&part)
+			return
+		}
+
+		if part := t.takePart(); part.Trace != "" {
+			t.sendPart(&part)
+		}
+	}
+}
+
+func (t *buildTrace) send(status string) {
+	t.once.Do(func() {
+		t.finished <- status
+	})
+}
+
+func (t *buildTrace) Success() {
+	t.BuildTrace.Success()
+	t.send(string(common.Success))
+}
+
+func (t *buildTrace) Fail(err error) {
+	t.BuildTrace.Fail(err)
+	if err == nil {
+		t.send(string(common.Success))
+	} else {
+		t.send(string(common.Failed))
+	}
+}
+
+// Wait lets the traces still being sent to finish, it returns false when it timed out
+func Wait() bool {
+	done := make(chan struct{})
+	go func() {
+		pendingTraces.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(sendTimeout):
+		return false
+	}
+}
+
+// NewBuildTrace wraps the trace to be mirrored in the log sink configured for the runner
+func NewBuildTrace(trace common.BuildTrace, runner *common.RunnerConfig, build *common.GetBuildResponse) common.BuildTrace {
+	if runner.LogSink == nil || runner.LogSink.Type == "" {
+		return trace
+	}
+
+	sink, err := NewSink(runner.LogSink)
+	if err != nil {
+		runner.Log().WithError(err).Warningln("Build trace will not be sent to the log sink")
+		return trace
+	}
+
+	return newBuildTrace(trace, sink, runner, Record{
+		BuildID:    build.ID,
+		ProjectID:  build.ProjectID,
+		Name:       build.Name,
+		Stage:      build.Stage,
+		Ref:        build.RefName,
+		Sha:        build.Sha,
+		Tag:        build.Tag,
+		Runner:     runner.ShortDescription(),
+		RunnerName: runner.Name,
+		Executor:   runner.Executor,
+		Status:     string(common.Running),
+		StartedAt:  time.Now(),
+	})
+}
+
+func newBuildTrace(trace common.BuildTrace, sink Sink, runner *common.RunnerConfig, record Record) *buildTrace {
+	t := &buildTrace{
+		BuildTrace: trace,
+		sink:       sink,
+		runner:     runner,
+		record:     record,
+		flush:      make(chan bool, 1),
+		finished:   make(chan string, 1),
+	}
+
+	pendingTraces.Add(1)
+	go t.run()
+	return t
+}
@@ -0,0 +1,220 @@
+package sinks
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+var sinkTestBuild = &common.GetBuildResponse{
+	ID:        10,
+	ProjectID: 20,
+	Name:      "rspec",
+	Stage:     "test",
+	RefName:   "master",
+	Sha:       "sha",
+}
+
+func newSinkTestRunner(config *common.LogSinkConfig) *common.RunnerConfig {
+	return &common.RunnerConfig{
+		Name: "runner",
+		RunnerCredentials: common.RunnerCredentials{
+			Token: "abcdefghijkl",
+		},
+		RunnerSettings: common.RunnerSettings{
+			Executor: "shell",
+			LogSink:  config,
+		},
+	}
+}
+
+func TestBuildTraceWithoutSink(t *testing.T) {
+	trace := &common.Trace{Writer: ioutil.Discard}
+	assert.Equal(t, trace, NewBuildTrace(trace, newSinkTestRunner(nil), sinkTestBuild))
+	assert.Equal(t, trace, NewBuildTrace(trace, newSinkTestRunner(&common.LogSinkConfig{}), sinkTestBuild))
+
+	invalidRunner := newSinkTestRunner(&common.LogSinkConfig{Type: "invalid"})
+	assert.Equal(t, trace, NewBuildTrace(trace, invalidRunner, sinkTestBuild))
+}
+
+func TestNewSinkRequiresDestination(t *testing.T) {
+	_, err := NewSink(&common.LogSinkConfig{Type: "file"})
+	assert.Error(t, err)
+
+	_, err = NewSink(&common.LogSinkConfig{Type: "elasticsearch"})
+	assert.Error(t, err)
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log-sink")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "builds.log")
+	runner := newSinkTestRunner(&common.LogSinkConfig{
+		Type: "file",
+		Path: path,
+	})
+
+	for i := 0; i < 2; i++ {
+		trace := NewBuildTrace(&common.Trace{Writer: ioutil.Discard}, runner, sinkTestBuild)
+		fmt.Fprint(trace, "line 1\n")
+		fmt.Fprint(trace, "line 2\n")
+		trace.Fail(errors.New("failed"))
+		trace.Success()
+	}
+	assert.True(t, Wait())
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record Record
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &record))
+		records = append(records, record)
+	}
+
+	require.Equal(t, 2, len(records))
+	assert.Equal(t, "line 1\nline 2\n", records[0].Trace)
+	assert.Equal(t, "failed", records[0].Status)
+	assert.Equal(t, 10, records[0].BuildID)
+	assert.Equal(t, 20, records[0].ProjectID)
+	assert.Equal(t, "rspec", records[0].Name)
+	assert.Equal(t, "abcdefgh", records[0].Runner)
+	assert.Equal(t, "shell", records[0].Executor)
+}
+
+func TestElasticsearchSink(t *testing.T) {
+	var record Record
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/builds/build", r.URL.Path)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&record))
+		w.WriteHeader(201)
+	}))
+	defer s.Close()
+
+	runner := newSinkTestRunner(&common.LogSinkConfig{
+		Type:  "elasticsearch",
+		URL:   s.URL + "/",
+		Index: "builds",
+	})
+
+	trace := NewBuildTrace(&common.Trace{Writer: ioutil.Discard}, runner, sinkTestBuild)
+	fmt.Fprint(trace, "output")
+	trace.Success()
+	assert.True(t, Wait())
+
+	assert.Equal(t, "output", record.Trace)
+	assert.Equal(t, "success", record.Status)
+	assert.Equal(t, "master", record.Ref)
+}
+
+type blockingSink struct {
+	records chan *Record
+	release chan bool
+}
+
+func (s *blockingSink) Send(record *Record) error {
+	<-s.release
+	s.records <- record
+	return nil
+}
+
+func TestBuildTraceIsSentInBackground(t *testing.T) {
+	sink := &blockingSink{
+		records: make(chan *Record, 1),
+		release: make(chan bool),
+	}
+	trace := newBuildTrace(&common.Trace{Writer: ioutil.Discard}, sink, newSinkTestRunner(nil), Record{})
+
+	// the build isn't blocked by the sink
+	trace.Success()
+	close(sink.release)
+
+	record := <-sink.records
+	assert.Equal(t, "success", record.Status)
+	assert.True(t, Wait())
+}
+
+type recordingSink struct {
+	records chan Record
+}
+
+func (s *recordingSink) Send(record *Record) error {
+	s.records <- *record
+	return nil
+}
+
+func TestBuildTraceIsStreamed(t *testing.T) {
+	sink := &recordingSink{records: make(chan Record, 10)}
+	trace := newBuildTrace(&common.Trace{Writer: ioutil.Discard}, sink, newSinkTestRunner(nil), Record{BuildID: 10, Status: "running"})
+
+	fmt.Fprint(trace, strings.Repeat("a", partSize))
+	part := <-sink.records
+	assert.Equal(t, "running", part.Status, "the part is sent before the build finishes")
+	assert.Equal(t, 10, part.BuildID)
+	assert.Equal(t, int64(0), part.Offset)
+	assert.Len(t, part.Trace, partSize)
+
+	fmt.Fprint(trace, "end")
+	trace.Success()
+	assert.True(t, Wait())
+
+	part = <-sink.records
+	assert.Equal(t, "success", part.Status)
+	assert.Equal(t, int64(partSize), part.Offset)
+	assert.Equal(t, "end", part.Trace)
+	assert.False(t, part.Truncated)
+}
+
+func TestBuildTraceOfSlowSinkIsDropped(t *testing.T) {
+	sink := &blockingSink{
+		records: make(chan *Record, 10),
+		release: make(chan bool),
+	}
+	trace := newBuildTrace(&common.Trace{Writer: ioutil.Discard}, sink, newSinkTestRunner(nil), Record{})
+
+	// the first part is blocked in the sink, the next ones are pending
+	fmt.Fprint(trace, strings.Repeat("a", partSize))
+	for i := 0; i <= maxPendingSize/partSize; i++ {
+		fmt.Fprint(trace, strings.Repeat("b", partSize))
+	}
+	trace.Success()
+	close(sink.release)
+	assert.True(t, Wait())
+	close(sink.records)
+
+	var size int
+	var last *Record
+	for record := range sink.records {
+		size += len(record.Trace)
+		last = record
+	}
+	assert.True(t, size <= partSize+maxPendingSize, "the pending trace is limited")
+	if assert.NotNil(t, last) {
+		assert.Equal(t, "success", last.Status)
+		assert.True(t, last.Truncated)
+	}
+}
+
+func TestCloudWatchSinkIsNotSupported(t *testing.T) {
+	_, err := NewSink(&common.LogSinkConfig{Type: "cloudwatch"})
+	assert.Error(t, err)
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"io"
 	"io/ioutil"
+	"net"
 	"strings"
 	"time"
 
@@ -41,6 +42,14 @@ func (e *ExitError) Error() string {
 	return e.Inner.Error()
 }
 
+// ExitCode returns the exit status of the remote command
+func (e *ExitError) ExitCode() int {
+	if exitErr, ok := e.Inner.(*ssh.ExitError); ok {
+		return exitErr.ExitStatus()
+	}
+	return 0
+}
+
 func (s *Client) getSSHKey(identityFile string) (key ssh.Signer, err error) {
 	buf, err := ioutil.ReadFile(identityFile)
 	if err != nil {
@@ -94,7 +103,7 @@ func (s *Client) Connect() error {
 	var finalError error
 
 	for i := 0; i < connectRetries; i++ {
-		client, err := ssh.Dial("tcp", s.Host+":"+s.Port, config)
+		client, err := ssh.Dial("tcp", net.JoinHostPort(s.Host, s.Port), config)
 		if err == nil {
 			s.client = client
 			return nil
@@ -122,6 +131,20 @@ func (s *Client) Exec(cmd string) error {
 	return err
 }
 
+// CommandAvailable checks if the command is found by the shell of the user on the server
+func (s *Client) CommandAvailable(name string) bool {
+	if s.client == nil {
+		return false
+	}
+
+	session, err := s.client.NewSession()
+	if err != nil {
+		return false
+	}
+	defer session.Close()
+	return session.Run("command -v "+helpers.ShellEscape(name)) == nil
+}
+
 func (s *Command) fullCommand() string {
 	var arguments []string
 	// TODO: This method is compatible only with Bjourne compatible shells
@@ -0,0 +1,63 @@
+package systemd_helpers
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Notify sends the state (eg. READY=1) to the service manager.
+// It returns false if the process was not started by systemd with notification
+// socket, in which case nothing is sent.
+func Notify(state string) (bool, error) {
+	socketAddr := &net.UnixAddr{
+		Name: os.Getenv("NOTIFY_SOCKET"),
+		Net:  "unixgram",
+	}
+	if socketAddr.Name == "" {
+		return false, nil
+	}
+
+	conn, err := net.DialUnix(socketAddr.Net, nil, socketAddr)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(state))
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// WatchdogInterval returns the interval in which the service manager expects
+// to receive WATCHDOG=1 notifications. It returns zero if watchdog is not
+// enabled for this process.
+func WatchdogInterval() (time.Duration, error) {
+	usec := os.Getenv("WATCHDOG_USEC")
+	if usec == "" {
+		return 0, nil
+	}
+
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" {
+		watchdogPid, err := strconv.Atoi(pid)
+		if err != nil {
+			return 0, err
+		}
+		if watchdogPid != os.Getpid() {
+			return 0, nil
+		}
+	}
+
+	interval, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if interval <= 0 {
+		return 0, errors.New("invalid WATCHDOG_USEC value")
+	}
+	return time.Duration(interval) * time.Microsecond, nil
+}
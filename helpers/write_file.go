@@ -0,0 +1,59 @@
+package helpers
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const maxSymlinks = 255
+
+// resolveSymlink follows the symlinks of fileName, so the file they point to is replaced
+// instead of the link, the target doesn't have to exist
+func resolveSymlink(fileName string) (string, error) {
+	for i := 0; i < maxSymlinks; i++ {
+		target, err := os.Readlink(fileName)
+		if err != nil {
+			// not a symlink
+			return fileName, nil
+		}
+
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(fileName), target)
+		}
+		fileName = target
+	}
+	return "", errors.New("too many levels of symbolic links")
+}
+
+// WriteFileAtomically writes the data to a temporary file and renames it to fileName,
+// so the readers never see the partially written file
+func WriteFileAtomically(fileName string, data []byte, perm os.FileMode) error {
+	fileName, err := resolveSymlink(fileName)
+	if err != nil {
+		return err
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(fileName), "."+filepath.Base(fileName))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Chmod(perm)
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), fileName)
+}
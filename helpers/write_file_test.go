@@ -0,0 +1,61 @@
+package helpers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteFileAtomically(t *testing.T) {
+	dir, err := ioutil.TempDir("", "write_file")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	fileName := filepath.Join(dir, "config.toml")
+	assert.NoError(t, ioutil.WriteFile(fileName, []byte("old content"), 0644))
+
+	err = WriteFileAtomically(fileName, []byte("new content"), 0600)
+	assert.NoError(t, err)
+
+	data, err := ioutil.ReadFile(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, "new content", string(data))
+
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	if assert.Len(t, files, 1, "the temporary file is removed") {
+		assert.Equal(t, os.FileMode(0600), files[0].Mode().Perm())
+	}
+}
+
+func TestWriteFileAtomicallyKeepsSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "write_file")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "shared"), 0700))
+	target := filepath.Join(dir, "shared", "config.toml")
+	assert.NoError(t, ioutil.WriteFile(target, []byte("old content"), 0644))
+
+	fileName := filepath.Join(dir, "config.toml")
+	assert.NoError(t, os.Symlink(filepath.Join("shared", "config.toml"), fileName))
+
+	err = WriteFileAtomically(fileName, []byte("new content"), 0600)
+	assert.NoError(t, err)
+
+	info, err := os.Lstat(fileName)
+	if assert.NoError(t, err) {
+		assert.True(t, info.Mode()&os.ModeSymlink != 0, "the symlink is kept")
+	}
+
+	data, err := ioutil.ReadFile(target)
+	assert.NoError(t, err)
+	assert.Equal(t, "new content", string(data))
+}
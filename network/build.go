@@ -8,6 +8,7 @@ import (
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
 	"io"
+	"regexp"
 	"sync"
 	"time"
 )
@@ -16,10 +17,14 @@ var traceUpdateInterval = common.UpdateInterval
 var traceForceSendInterval = common.ForceTraceSentInterval
 var traceFinishRetryInterval = common.UpdateRetryInterval
 
+// tracePatchMaxSize limits the size of the trace patch, the larger output is sent in multiple patches
+var tracePatchMaxSize = 256 * 1024
+
 type tracePatch struct {
-	trace  bytes.Buffer
-	offset int
-	limit  int
+	trace   bytes.Buffer
+	offset  int
+	limit   int
+	maxSize int
 }
 
 func (tp *tracePatch) Patch() []byte {
@@ -34,8 +39,19 @@ func (tp *tracePatch) Limit() int {
 	return tp.limit
 }
 
+// SetNewOffset moves the start of the patch, eg. to the end of the trace stored by the coordinator.
+// The patch can't start past the end of the trace
 func (tp *tracePatch) SetNewOffset(newOffset int) {
+	if newOffset < 0 {
+		newOffset = 0
+	} else if newOffset > tp.trace.Len() {
+		newOffset = tp.trace.Len()
+	}
 	tp.offset = newOffset
+	tp.limit = tp.trace.Len()
+	if tp.maxSize > 0 && tp.limit-tp.offset > tp.maxSize {
+		tp.limit = tp.offset + tp.maxSize
+	}
 }
 
 func (tp *tracePatch) validateRange() bool {
@@ -48,15 +64,17 @@ func (tp *tracePatch) validateRange() bool {
 
 func newTracePatch(trace bytes.Buffer, offset int) (*tracePatch, error) {
 	patch := &tracePatch{
-		trace:  trace,
-		offset: offset,
-		limit:  trace.Len(),
+		trace:   trace,
+		offset:  offset,
+		limit:   trace.Len(),
+		maxSize: tracePatchMaxSize,
 	}
 
 	if !patch.validateRange() {
 		return nil, errors.New("Range is invalid, limit can't be less than offset")
 	}
 
+	patch.SetNewOffset(offset)
 	return patch, nil
 }
 
@@ -80,6 +98,30 @@ type clientBuildTrace struct {
 	sentTrace int
 	sentTime  time.Time
 	sentState common.BuildState
+
+	receivedAt      time.Time
+	scriptStartedAt time.Time
+	finishedAt      time.Time
+
+	coverageRegex *regexp.Regexp
+
+	// outputLimitErr fails the build, when the trace exceeded the output limit
+	outputLimitErr error
+}
+
+func (c *clientBuildTrace) updateInterval() time.Duration {
+	if c.config.UpdateInterval > 0 {
+		return time.Duration(c.config.UpdateInterval) * time.Second
+	}
+	return traceUpdateInterval
+}
+
+// forceSendInterval makes the trace to be sent as a keep-alive, even without new output
+func (c *clientBuildTrace) forceSendInterval() time.Duration {
+	if c.config.ForceUpdateInterval > 0 {
+		return time.Duration(c.config.ForceUpdateInterval) * time.Second
+	}
+	return traceForceSendInterval
 }
 
 func (c *clientBuildTrace) Success() {
@@ -92,11 +134,13 @@ func (c *clientBuildTrace) Fail(err error) {
 		c.lock.Unlock()
 		return
 	}
-	if err == nil {
+	// The build can finish before it's aborted by exceeding the output limit
+	if err == nil && c.outputLimitErr == nil {
 		c.state = common.Success
 	} else {
 		c.state = common.Failed
 	}
+	c.finishedAt = time.Now()
 	c.lock.Unlock()
 
 	c.finish()
@@ -110,6 +154,54 @@ func (c *clientBuildTrace) IsStdout() bool {
 	return false
 }
 
+func (c *clientBuildTrace) ScriptStarted() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.scriptStartedAt.IsZero() {
+		c.scriptStartedAt = time.Now()
+	}
+}
+
+// timings are sent with the final update of the build
+func (c *clientBuildTrace) timings() *common.BuildTimings {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	if c.state == common.Running {
+		return nil
+	}
+
+	// The build that failed before starting its script was only prepared
+	scriptStartedAt := c.scriptStartedAt
+	if scriptStartedAt.IsZero() {
+		scriptStartedAt = c.finishedAt
+	}
+
+	return &common.BuildTimings{
+		PrepareDuration: scriptStartedAt.Sub(c.receivedAt).Seconds(),
+		Duration:        c.finishedAt.Sub(c.receivedAt).Seconds(),
+	}
+}
+
+func (c *clientBuildTrace) SetCoverageRegex(regex *regexp.Regexp) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.coverageRegex = regex
+}
+
+// coverage is extracted from the whole trace and sent with the final update of the build
+func (c *clientBuildTrace) coverage() *float64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	if c.state == common.Running || c.coverageRegex == nil {
+		return nil
+	}
+	return common.ExtractCoverage(c.coverageRegex, c.log.String())
+}
+
 func (c *clientBuildTrace) start() {
 	reader, writer := io.Pipe()
 	c.PipeWriter = writer
@@ -142,9 +234,15 @@ func (c *clientBuildTrace) writeRune(r rune, limit int) (n int, err error) {
 		return
 	}
 
-	output := fmt.Sprintf("\n%sBuild log exceeded limit of %v bytes.%s\n",
+	message := fmt.Sprintf("Build log exceeded limit of %v bytes.", limit)
+	if policy, _ := c.config.OutputLimitPolicy.Get(); policy == common.OutputLimitFail {
+		c.outputLimitErr = fmt.Errorf("build log exceeded limit of %v bytes", limit)
+		message += " The build is failed."
+	}
+
+	output := fmt.Sprintf("\n%s%s%s\n",
 		helpers.ANSI_BOLD_RED,
-		limit,
+		message,
 		helpers.ANSI_RESET,
 	)
 	c.log.WriteString(output)
@@ -209,18 +307,35 @@ func (c *clientBuildTrace) incrementalUpdate() common.UpdateState {
 
 	if c.sentState == state &&
 		c.sentTrace == trace.Len() &&
-		time.Since(c.sentTime) < traceForceSendInterval {
+		time.Since(c.sentTime) < c.forceSendInterval() {
 		return common.UpdateSucceeded
 	}
 
 	if c.sentState != state {
-		c.client.UpdateBuild(c.config, c.id, state, nil)
-		c.sentState = state
+		// the state is sent again with the next update, eg. after the maintenance of the coordinator
+		if c.client.UpdateBuild(c.config, c.id, common.UpdateBuildRequest{
+			State:    state,
+			Timings:  c.timings(),
+			Coverage: c.coverage(),
+		}) == common.UpdateSucceeded {
+			c.sentState = state
+		}
 	}
 
+	// The output is sent in chunks, so the large trace isn't sent in a single request
+	for {
+		update := c.patchTrace(trace)
+		if update != common.UpdateSucceeded || c.sentTrace >= trace.Len() {
+			return update
+		}
+	}
+}
+
+func (c *clientBuildTrace) patchTrace(trace bytes.Buffer) common.UpdateState {
 	tracePatch, err := newTracePatch(trace, c.sentTrace)
 	if err != nil {
 		c.config.Log().Errorln("Error while creating a tracePatch", err.Error())
+		return common.UpdateFailed
 	}
 
 	update := c.client.PatchTrace(c.config, c.buildCredentials, tracePatch)
@@ -232,6 +347,13 @@ func (c *clientBuildTrace) incrementalUpdate() common.UpdateState {
 		update = c.resendPatch(c.buildCredentials.ID, c.config, c.buildCredentials, tracePatch)
 	}
 
+	if update == common.UpdateRangeMissmatch {
+		// The trace of the coordinator can't be patched, eg. its part was lost during the outage,
+		// so the whole trace is sent instead of leaving a gap in it
+		c.config.Log().Warningln(c.id, "Replaying the whole trace...")
+		return c.staleUpdate()
+	}
+
 	if update == common.UpdateSucceeded {
 		c.sentTrace = tracePatch.Limit()
 		c.sentTime = time.Now()
@@ -246,7 +368,6 @@ func (c *clientBuildTrace) resendPatch(id int, config common.RunnerConfig, build
 	update = c.client.PatchTrace(config, buildCredentials, tracePatch)
 	if update == common.UpdateRangeMissmatch {
 		config.Log().Errorln(id, "Appending trace to coordinator...", "failed due to range mismatch")
-		update = common.UpdateFailed
 	}
 
 	return
@@ -260,11 +381,16 @@ func (c *clientBuildTrace) staleUpdate() common.UpdateState {
 
 	if c.sentState == state &&
 		c.sentTrace == len(trace) &&
-		time.Since(c.sentTime) < traceForceSendInterval {
+		time.Since(c.sentTime) < c.forceSendInterval() {
 		return common.UpdateSucceeded
 	}
 
-	upload := c.client.UpdateBuild(c.config, c.id, state, &trace)
+	upload := c.client.UpdateBuild(c.config, c.id, common.UpdateBuildRequest{
+		State:    state,
+		Trace:    &trace,
+		Timings:  c.timings(),
+		Coverage: c.coverage(),
+	})
 	if upload == common.UpdateSucceeded {
 		c.sentTrace = len(trace)
 		c.sentState = state
@@ -274,9 +400,16 @@ func (c *clientBuildTrace) staleUpdate() common.UpdateState {
 	return upload
 }
 
-func (c *clientBuildTrace) abort() bool {
+func (c *clientBuildTrace) getOutputLimitErr() error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.outputLimitErr
+}
+
+// abort sends the reason to the build, the build is canceled unless the reason is an error
+func (c *clientBuildTrace) abort(reason interface{}) bool {
 	select {
-	case c.abortCh <- true:
+	case c.abortCh <- reason:
 		return true
 
 	default:
@@ -287,9 +420,13 @@ func (c *clientBuildTrace) abort() bool {
 func (c *clientBuildTrace) watch() {
 	for {
 		select {
-		case <-time.After(traceUpdateInterval):
+		case <-time.After(c.updateInterval()):
 			state := c.update()
-			if state == common.UpdateAbort && c.abort() {
+			if state == common.UpdateAbort && c.abort(true) {
+				<-c.finished
+				return
+			}
+			if err := c.getOutputLimitErr(); err != nil && c.abort(err) {
 				<-c.finished
 				return
 			}
@@ -308,5 +445,6 @@ func newBuildTrace(client common.Network, config common.RunnerConfig, buildCrede
 		buildCredentials: buildCredentials,
 		id:               buildCredentials.ID,
 		abortCh:          make(chan interface{}),
+		receivedAt:       time.Now(),
 	}
 }
@@ -0,0 +1,51 @@
+package network
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+// coordinatorSchemas reports the builds using the features unknown to the runner once
+// for each coordinator, instead of for every received build
+type coordinatorSchemas struct {
+	reported map[string]string
+	lock     sync.Mutex
+}
+
+// report returns true when the mismatch of the schema wasn't reported yet for the coordinator
+func (c *coordinatorSchemas) report(url string, response *common.GetBuildResponse) bool {
+	if response.IsSchemaSupported() {
+		return false
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	mismatch := fmt.Sprintf("%d %s", response.SchemaVersion, strings.Join(response.UnknownFields, ","))
+	if c.reported[url] == mismatch {
+		return false
+	}
+
+	if c.reported == nil {
+		c.reported = make(map[string]string)
+	}
+	c.reported[url] = mismatch
+	return true
+}
+
+func (n *GitLabClient) checkBuildSchema(config common.RunnerConfig, response *common.GetBuildResponse) {
+	if !n.schemas.report(config.URL, response) {
+		return
+	}
+
+	config.Log().WithFields(logrus.Fields{
+		"schema":    response.SchemaVersion,
+		"supported": common.BuildSchemaVersion,
+		"unknown":   strings.Join(response.UnknownFields, ", "),
+	}).Warningln("Received build uses features not supported by this runner, they are ignored. Update the runner to use them")
+}
@@ -0,0 +1,22 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func TestCoordinatorSchemasReportOnce(t *testing.T) {
+	var schemas coordinatorSchemas
+	supported := &common.GetBuildResponse{SchemaVersion: common.BuildSchemaVersion}
+	unknown := &common.GetBuildResponse{UnknownFields: []string{"triggered_by"}}
+	newer := &common.GetBuildResponse{SchemaVersion: common.BuildSchemaVersion + 1}
+
+	assert.False(t, schemas.report("http://gitlab.example.com/", supported))
+	assert.True(t, schemas.report("http://gitlab.example.com/", unknown))
+	assert.False(t, schemas.report("http://gitlab.example.com/", unknown), "the same mismatch is reported once")
+	assert.True(t, schemas.report("http://other.example.com/", unknown), "each coordinator is reported")
+	assert.True(t, schemas.report("http://gitlab.example.com/", newer), "the changed mismatch is reported again")
+}
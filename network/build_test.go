@@ -1,8 +1,10 @@
 package network
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"regexp"
 	"testing"
 	"time"
 
@@ -20,17 +22,21 @@ var buildOutputLimit = common.RunnerConfig{OutputLimit: 1}
 
 type updateTraceNetwork struct {
 	common.MockNetwork
-	state common.BuildState
-	trace *string
-	count int
+	state    common.BuildState
+	trace    *string
+	timings  *common.BuildTimings
+	coverage *float64
+	count    int
 }
 
-func (m *updateTraceNetwork) UpdateBuild(config common.RunnerConfig, id int, state common.BuildState, trace *string) common.UpdateState {
+func (m *updateTraceNetwork) UpdateBuild(config common.RunnerConfig, id int, request common.UpdateBuildRequest) common.UpdateState {
 	switch id {
 	case successID:
 		m.count++
-		m.state = state
-		m.trace = trace
+		m.state = request.State
+		m.trace = request.Trace
+		m.timings = request.Timings
+		m.coverage = request.Coverage
 		return common.UpdateSucceeded
 
 	case cancelID:
@@ -38,11 +44,11 @@ func (m *updateTraceNetwork) UpdateBuild(config common.RunnerConfig, id int, sta
 		return common.UpdateAbort
 
 	case retryID:
-		if state != common.Running {
+		if request.State != common.Running {
 			m.count++
 			if m.count >= 5 {
-				m.state = state
-				m.trace = trace
+				m.state = request.State
+				m.trace = request.Trace
 				return common.UpdateSucceeded
 			}
 		}
@@ -83,6 +89,70 @@ func TestBuildTraceFailure(t *testing.T) {
 	assert.Equal(t, common.Failed, u.state)
 }
 
+func TestBuildTraceTimings(t *testing.T) {
+	u := &updateTraceNetwork{}
+	buildCredentials := &common.BuildCredentials{
+		ID: successID,
+	}
+	b := newBuildTrace(u, buildConfig, buildCredentials)
+	b.receivedAt = time.Now().Add(-time.Minute)
+	b.start()
+	assert.Nil(t, b.timings(), "the running build has no timings")
+
+	b.ScriptStarted()
+	b.scriptStartedAt = b.receivedAt.Add(20 * time.Second)
+	b.ScriptStarted()
+	b.Success()
+
+	if assert.NotNil(t, u.timings) {
+		assert.Equal(t, 20.0, u.timings.PrepareDuration)
+		assert.InDelta(t, 60.0, u.timings.Duration, 5.0)
+	}
+}
+
+func TestBuildTraceCoverage(t *testing.T) {
+	u := &updateTraceNetwork{}
+	buildCredentials := &common.BuildCredentials{
+		ID: successID,
+	}
+	b := newBuildTrace(u, buildConfig, buildCredentials)
+	b.SetCoverageRegex(regexp.MustCompile(`Coverage: \d+\.\d+%`))
+	b.start()
+	b.log.WriteString("Coverage: 12.5%\nCoverage: 85.25% of lines\n")
+	assert.Nil(t, b.coverage(), "the running build has no coverage")
+	b.Success()
+
+	if assert.NotNil(t, u.coverage) {
+		assert.Equal(t, 85.25, *u.coverage)
+	}
+}
+
+func TestBuildTraceWithoutCoverage(t *testing.T) {
+	u := &updateTraceNetwork{}
+	buildCredentials := &common.BuildCredentials{
+		ID: successID,
+	}
+	b := newBuildTrace(u, buildConfig, buildCredentials)
+	b.start()
+	b.log.WriteString("Coverage: 85.25%\n")
+	b.Success()
+	assert.Nil(t, u.coverage, "the coverage isn't extracted without the regex")
+}
+
+func TestBuildTraceTimingsWithoutScript(t *testing.T) {
+	u := &updateTraceNetwork{}
+	buildCredentials := &common.BuildCredentials{
+		ID: successID,
+	}
+	b := newBuildTrace(u, buildConfig, buildCredentials)
+	b.start()
+	b.Fail(errors.New("prepare failed"))
+
+	if assert.NotNil(t, u.timings) {
+		assert.Equal(t, u.timings.Duration, u.timings.PrepareDuration)
+	}
+}
+
 func TestIgnoreStatusChange(t *testing.T) {
 	u := &updateTraceNetwork{}
 	buildCredentials := &common.BuildCredentials{
@@ -125,6 +195,46 @@ func TestBuildOutputLimit(t *testing.T) {
 	assert.Contains(t, *u.trace, "Build log exceeded limit")
 }
 
+func TestBuildOutputLimitFailsBuild(t *testing.T) {
+	traceUpdateInterval = 0
+
+	u := &updateTraceNetwork{}
+	buildCredentials := &common.BuildCredentials{
+		ID: successID,
+	}
+	config := common.RunnerConfig{OutputLimit: 1, OutputLimitPolicy: common.OutputLimitFail}
+	b := newBuildTrace(u, config, buildCredentials)
+	b.start()
+
+	for i := 0; i < 1000; i++ {
+		fmt.Fprint(b, "abcde")
+	}
+
+	reason := <-b.Aborted()
+	assert.EqualError(t, reason.(error), "build log exceeded limit of 1024 bytes")
+	b.Fail(reason.(error))
+	assert.Equal(t, common.Failed, u.state)
+	assert.Contains(t, *u.trace, "Build log exceeded limit of 1024 bytes. The build is failed.")
+}
+
+func TestBuildOutputLimitFailsFinishedBuild(t *testing.T) {
+	u := &updateTraceNetwork{}
+	buildCredentials := &common.BuildCredentials{
+		ID: successID,
+	}
+	config := common.RunnerConfig{OutputLimit: 1, OutputLimitPolicy: common.OutputLimitFail}
+	b := newBuildTrace(u, config, buildCredentials)
+	b.start()
+
+	for i := 0; i < 1000; i++ {
+		fmt.Fprint(b, "abcde")
+	}
+
+	b.Success()
+	assert.Equal(t, common.Failed, u.state, "the build finished before it was aborted")
+	assert.Contains(t, *u.trace, "Build log exceeded limit of 1024 bytes. The build is failed.")
+}
+
 func TestBuildFinishRetry(t *testing.T) {
 	traceFinishRetryInterval = time.Microsecond
 
@@ -176,3 +286,147 @@ func TestBuildForceSend(t *testing.T) {
 	assert.Equal(t, "test", *u.trace)
 	assert.Equal(t, common.Running, u.state)
 }
+
+func TestBuildTraceUpdateIntervals(t *testing.T) {
+	b := newBuildTrace(&updateTraceNetwork{}, buildConfig, &common.BuildCredentials{})
+	assert.Equal(t, traceUpdateInterval, b.updateInterval())
+	assert.Equal(t, traceForceSendInterval, b.forceSendInterval())
+
+	config := common.RunnerConfig{
+		UpdateInterval:      10,
+		ForceUpdateInterval: 120,
+	}
+	b = newBuildTrace(&updateTraceNetwork{}, config, &common.BuildCredentials{})
+	assert.Equal(t, 10*time.Second, b.updateInterval())
+	assert.Equal(t, 2*time.Minute, b.forceSendInterval())
+}
+
+// patchTraceNetwork keeps the trace like the coordinator, it accepts only the patches continuing it
+type patchTraceNetwork struct {
+	updateTraceNetwork
+	remote      string
+	validRange  bool
+	patchCount  int
+	updateCount int
+}
+
+func (m *patchTraceNetwork) UpdateBuild(config common.RunnerConfig, id int, request common.UpdateBuildRequest) common.UpdateState {
+	m.updateCount++
+	if request.Trace != nil {
+		m.remote = *request.Trace
+	}
+	return common.UpdateSucceeded
+}
+
+func (m *patchTraceNetwork) PatchTrace(config common.RunnerConfig, buildCredentials *common.BuildCredentials, tracePatch common.BuildTracePatch) common.UpdateState {
+	m.patchCount++
+	if tracePatch.Offset() != len(m.remote) {
+		if m.validRange {
+			tracePatch.SetNewOffset(len(m.remote))
+		}
+		return common.UpdateRangeMissmatch
+	}
+	m.remote += string(tracePatch.Patch())
+	return common.UpdateSucceeded
+}
+
+func TestBuildTraceReplaysMissingTail(t *testing.T) {
+	// the coordinator lost the end of the trace sent before the outage
+	u := &patchTraceNetwork{remote: "hello", validRange: true}
+	b := newBuildTrace(u, buildConfig, &common.BuildCredentials{ID: successID})
+	b.log.WriteString("hello world")
+	b.sentTrace = b.log.Len()
+	b.log.WriteString(" again")
+
+	assert.Equal(t, common.UpdateSucceeded, b.incrementalUpdate())
+	assert.Equal(t, "hello world again", u.remote)
+	assert.Equal(t, 2, u.patchCount, "the patch is resent from the offset of the coordinator")
+	assert.Equal(t, 0, u.updateCount)
+	assert.Equal(t, b.log.Len(), b.sentTrace)
+}
+
+func TestBuildTraceReplaysWholeTraceOnRangeMismatch(t *testing.T) {
+	u := &patchTraceNetwork{remote: "hello"}
+	b := newBuildTrace(u, buildConfig, &common.BuildCredentials{ID: successID})
+	b.log.WriteString("hello world")
+	b.sentTrace = b.log.Len()
+	b.log.WriteString(" again")
+
+	assert.Equal(t, common.UpdateSucceeded, b.incrementalUpdate())
+	assert.Equal(t, "hello world again", u.remote, "the whole trace is replayed")
+	assert.Equal(t, 1, u.updateCount)
+	assert.Equal(t, b.log.Len(), b.sentTrace)
+}
+
+func TestTracePatchNewOffset(t *testing.T) {
+	var trace bytes.Buffer
+	trace.WriteString("hello world")
+
+	patch, err := newTracePatch(trace, 6)
+	assert.NoError(t, err)
+	assert.Equal(t, "world", string(patch.Patch()))
+
+	patch.SetNewOffset(100)
+	assert.Equal(t, 11, patch.Offset(), "the patch doesn't start past the trace")
+	assert.Empty(t, patch.Patch())
+
+	patch.SetNewOffset(-1)
+	assert.Equal(t, "hello world", string(patch.Patch()))
+}
+
+func TestBuildTraceSendsPatchesInChunks(t *testing.T) {
+	defer func(size int) { tracePatchMaxSize = size }(tracePatchMaxSize)
+	tracePatchMaxSize = 4
+
+	u := &patchTraceNetwork{}
+	b := newBuildTrace(u, buildConfig, &common.BuildCredentials{ID: successID})
+	b.log.WriteString("hello world again")
+
+	assert.Equal(t, common.UpdateSucceeded, b.incrementalUpdate())
+	assert.Equal(t, "hello world again", u.remote)
+	assert.Equal(t, 5, u.patchCount)
+	assert.Equal(t, b.log.Len(), b.sentTrace)
+}
+
+func TestBuildTraceResumesChunksFromCoordinatorOffset(t *testing.T) {
+	defer func(size int) { tracePatchMaxSize = size }(tracePatchMaxSize)
+	tracePatchMaxSize = 4
+
+	u := &patchTraceNetwork{remote: "hello", validRange: true}
+	b := newBuildTrace(u, buildConfig, &common.BuildCredentials{ID: successID})
+	b.log.WriteString("hello world again")
+	b.sentTrace = 9
+
+	assert.Equal(t, common.UpdateSucceeded, b.incrementalUpdate())
+	assert.Equal(t, "hello world again", u.remote)
+	assert.Equal(t, 0, u.updateCount, "the trace isn't replayed")
+	assert.Equal(t, b.log.Len(), b.sentTrace)
+}
+
+func TestTracePatchMaxSize(t *testing.T) {
+	defer func(size int) { tracePatchMaxSize = size }(tracePatchMaxSize)
+	tracePatchMaxSize = 4
+
+	var trace bytes.Buffer
+	trace.WriteString("hello world")
+
+	patch, err := newTracePatch(trace, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "llo ", string(patch.Patch()))
+	assert.Equal(t, 6, patch.Limit())
+
+	patch.SetNewOffset(9)
+	assert.Equal(t, "ld", string(patch.Patch()))
+	assert.Equal(t, 11, patch.Limit())
+}
+
+func TestParseTraceRangeEnd(t *testing.T) {
+	end, ok := parseTraceRangeEnd("0-1024")
+	assert.True(t, ok)
+	assert.Equal(t, 1024, end)
+
+	for _, remoteRange := range []string{"", "1024", "0-abc", "0-1-2"} {
+		_, ok = parseTraceRangeEnd(remoteRange)
+		assert.False(t, ok, remoteRange)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"github.com/Sirupsen/logrus"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
 	"io"
 	"io/ioutil"
 	"net"
@@ -22,17 +23,31 @@ import (
 	"time"
 )
 
+// The dual stack dialer tries the IPv6 and IPv4 addresses of the host in parallel
+// (Happy Eyeballs), so the coordinator is reached on the IPv6-only hosts too
 var dialer = net.Dialer{
 	Timeout:   30 * time.Second,
 	KeepAlive: 30 * time.Second,
+	DualStack: true,
 }
 
+// remoteResponseTimeout is the time given to the remote server to respond after the request is sent
+const remoteResponseTimeout = 10 * time.Minute
+
 type client struct {
 	http.Client
 	url        *url.URL
 	caFile     string
 	skipVerify bool
 	updateTime time.Time
+	headers    []string
+	signingKey string
+	signatures map[string]helpers.SignedRequest
+
+	// remote sends the requests to the servers, which aren't the coordinator, eg. the object storages
+	remote http.Client
+
+	maintenance coordinatorMaintenance
 }
 
 func (n *client) ensureTLSConfig() {
@@ -48,12 +63,28 @@ func (n *client) ensureTLSConfig() {
 	}
 }
 
+func (n *client) newTransport(tlsConfig *tls.Config) *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		Dial: func(network, addr string) (net.Conn, error) {
+			logrus.Debugln("Dialing:", network, addr, "...")
+			return dialer.Dial(network, addr)
+		},
+		TLSHandshakeTimeout: 10 * time.Second,
+		TLSClientConfig:     tlsConfig,
+	}
+}
+
 func (n *client) createTransport() {
-	// create reference TLS config
+	// create reference TLS config, the remote one trusts the system certificates too
 	tlsConfig := tls.Config{
 		MinVersion:         tls.VersionTLS10,
 		InsecureSkipVerify: n.skipVerify,
 	}
+	remoteTLSConfig := tls.Config{
+		MinVersion:         tls.VersionTLS10,
+		InsecureSkipVerify: n.skipVerify,
+	}
 
 	// load TLS certificate
 	if file := n.caFile; file != "" && !n.skipVerify {
@@ -61,9 +92,9 @@ func (n *client) createTransport() {
 
 		data, err := ioutil.ReadFile(file)
 		if err == nil {
-			pool := x509.NewCertPool()
-			if pool.AppendCertsFromPEM(data) {
+			if pool, ok := helpers.NewCertPool(data); ok {
 				tlsConfig.RootCAs = pool
+				remoteTLSConfig.RootCAs, _ = helpers.NewSystemCertPool(data)
 			} else {
 				logrus.Errorln("Failed to parse PEM in", n.caFile)
 			}
@@ -75,15 +106,11 @@ func (n *client) createTransport() {
 	}
 
 	// create transport
-	n.Transport = &http.Transport{
-		Proxy: http.ProxyFromEnvironment,
-		Dial: func(network, addr string) (net.Conn, error) {
-			logrus.Debugln("Dialing:", network, addr, "...")
-			return dialer.Dial(network, addr)
-		},
-		TLSHandshakeTimeout: 10 * time.Second,
-		TLSClientConfig:     &tlsConfig,
-	}
+	n.Transport = n.newTransport(&tlsConfig)
+
+	remoteTransport := n.newTransport(&remoteTLSConfig)
+	remoteTransport.ResponseHeaderTimeout = remoteResponseTimeout
+	n.remote.Transport = remoteTransport
 }
 
 func (n *client) getCAChain(tls *tls.ConnectionState) (certificates string) {
@@ -132,6 +159,15 @@ func (n *client) do(uri, method string, request io.Reader, requestType string, h
 		return
 	}
 
+	// the whole body is signed, so it's hashed before the request is created
+	var bodyHash string
+	if n.signingKey != "" {
+		bodyHash, request, err = helpers.RequestBodyHash(request)
+		if err != nil {
+			return
+		}
+	}
+
 	req, err := http.NewRequest(method, url.String(), request)
 	if err != nil {
 		err = fmt.Errorf("failed to create NewRequest: %v", err)
@@ -147,6 +183,26 @@ func (n *client) do(uri, method string, request io.Reader, requestType string, h
 		req.Header.Set("User-Agent", common.AppVersion.UserAgent())
 	}
 
+	// the static headers and the signature are used by the API gateway in front of GitLab
+	extraHeaders, err := helpers.ParseRequestHeaders(n.headers)
+	if err != nil {
+		return
+	}
+	if n.signingKey != "" {
+		extraHeaders = mergeHeaders(extraHeaders, helpers.SignRequest(n.signingKey, method, url, bodyHash, time.Now(), helpers.RequestSignatureValidity).Headers())
+	} else if signature, ok := n.signatures[method+" "+url.RequestURI()]; ok {
+		// the helpers don't have the signing key, their requests are pre-signed by the runner
+		extraHeaders = mergeHeaders(extraHeaders, signature.Headers())
+	}
+	for name, values := range extraHeaders {
+		req.Header[name] = values
+	}
+
+	// don't send the requests to the coordinator during its maintenance
+	if until := n.maintenance.until(); !until.IsZero() {
+		return n.maintenance.response(until), nil
+	}
+
 	n.ensureTLSConfig()
 
 	res, err = n.Do(req)
@@ -154,6 +210,7 @@ func (n *client) do(uri, method string, request io.Reader, requestType string, h
 		err = fmt.Errorf("couldn't execute %v against %s: %v", req.Method, req.URL, err)
 		return
 	}
+	n.maintenance.update(n.url.String(), res)
 	return
 }
 
@@ -197,6 +254,24 @@ func (n *client) doJSON(uri, method string, statusCode int, request interface{},
 	return res.StatusCode, res.Status, n.getCAChain(res.TLS)
 }
 
+// doRemote sends the request to the server given by the full URL, without the coordinator headers
+func (n *client) doRemote(req *http.Request) (*http.Response, error) {
+	n.ensureTLSConfig()
+
+	res, err := n.remote.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't execute %v against %s: %v", req.Method, req.URL.Host, err)
+	}
+	return res, nil
+}
+
+func mergeHeaders(headers, other http.Header) http.Header {
+	for name, values := range other {
+		headers[name] = values
+	}
+	return headers
+}
+
 func fixCIURL(url string) string {
 	url = strings.TrimRight(url, "/")
 	if !strings.HasSuffix(url, "/ci") {
@@ -205,6 +280,14 @@ func fixCIURL(url string) string {
 	return url
 }
 
+// getHostName removes the port and the brackets of the IPv6 address from the host
+func getHostName(host string) string {
+	if hostName, _, err := net.SplitHostPort(host); err == nil {
+		return hostName
+	}
+	return strings.Trim(host, "[]")
+}
+
 func newClient(config common.RunnerCredentials) (c *client, err error) {
 	url, err := url.Parse(fixCIURL(config.URL) + "/api/v1/")
 	if err != nil {
@@ -217,13 +300,23 @@ func newClient(config common.RunnerCredentials) (c *client, err error) {
 	}
 
 	c = &client{
-		url:    url,
-		caFile: config.TLSCAFile,
+		url:        url,
+		caFile:     config.TLSCAFile,
+		headers:    config.Headers,
+		signingKey: config.SigningKey,
+		signatures: make(map[string]helpers.SignedRequest),
+	}
+
+	for _, value := range config.RequestSignatures {
+		signature, err := helpers.ParseSignedRequest(value)
+		if err != nil {
+			return nil, err
+		}
+		c.signatures[signature.Key()] = signature
 	}
 
 	if CertificateDirectory != "" && c.caFile == "" {
-		hostAndPort := strings.Split(url.Host, ":")
-		c.caFile = filepath.Join(CertificateDirectory, hostAndPort[0]+".crt")
+		c.caFile = filepath.Join(CertificateDirectory, getHostName(url.Host)+".crt")
 	}
 
 	return
@@ -7,11 +7,15 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	. "gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
+	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -107,6 +111,56 @@ func TestClientDo(t *testing.T) {
 	assert.Equal(t, "value", res.Key, statusText)
 }
 
+func TestClientRequestHeaders(t *testing.T) {
+	var request *http.Request
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request = r
+	}))
+	defer s.Close()
+
+	c, err := newClient(RunnerCredentials{
+		URL:        s.URL,
+		Headers:    []string{"X-Api-Key: secret"},
+		SigningKey: "key",
+	})
+	assert.NoError(t, err)
+
+	statusCode, statusText, _ := c.doJSON("test/ok", "POST", 200, nil, nil)
+	assert.Equal(t, 200, statusCode, statusText)
+	if assert.NotNil(t, request) {
+		assert.Equal(t, "secret", request.Header.Get("X-Api-Key"))
+		assert.NotEmpty(t, request.Header.Get(helpers.RequestTimestampHeader))
+		assert.NotEmpty(t, request.Header.Get(helpers.RequestSignatureHeader))
+	}
+
+	statusCode, statusText, _ = c.doJSON("test/ok", "POST", 200, map[string]string{"key": "value"}, nil)
+	assert.Equal(t, 200, statusCode, statusText)
+	if assert.NotNil(t, request) {
+		bodyHash, _, _ := helpers.RequestBodyHash(strings.NewReader(`{"key":"value"}`))
+		assert.Equal(t, bodyHash, request.Header.Get(helpers.RequestContentHashHeader), "the body is signed")
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte("streamed body"))
+		pw.Close()
+	}()
+	res, err := c.do("test/ok", "POST", pr, "text/plain", nil)
+	if assert.NoError(t, err) {
+		res.Body.Close()
+		bodyHash, _, _ := helpers.RequestBodyHash(strings.NewReader("streamed body"))
+		assert.Equal(t, bodyHash, request.Header.Get(helpers.RequestContentHashHeader), "the streamed body is signed too")
+	}
+
+	c, err = newClient(RunnerCredentials{
+		URL:     s.URL,
+		Headers: []string{"invalid"},
+	})
+	assert.NoError(t, err)
+	statusCode, _, _ = c.doJSON("test/ok", "POST", 200, nil, nil)
+	assert.Equal(t, -1, statusCode, "the invalid header isn't sent")
+}
+
 func TestClientInvalidSSL(t *testing.T) {
 	s := httptest.NewTLSServer(http.HandlerFunc(clientHandler))
 	defer s.Close()
@@ -140,6 +194,44 @@ func TestClientTLSCAFile(t *testing.T) {
 	assert.NotEmpty(t, certificates)
 }
 
+func TestClientDoRemoteTLSCAFile(t *testing.T) {
+	s := httptest.NewTLSServer(http.HandlerFunc(clientHandler))
+	defer s.Close()
+
+	storage := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(200)
+	}))
+	defer storage.Close()
+
+	file, err := ioutil.TempFile("", "cert_")
+	assert.NoError(t, err)
+	file.Close()
+	defer os.Remove(file.Name())
+
+	err = writeTLSCertificate(storage, file.Name())
+	assert.NoError(t, err)
+
+	c, _ := newClient(RunnerCredentials{
+		URL:       s.URL,
+		TLSCAFile: file.Name(),
+	})
+
+	req, err := http.NewRequest("PUT", storage.URL+"/artifacts.zip", nil)
+	assert.NoError(t, err)
+
+	res, err := c.doRemote(req)
+	if assert.NoError(t, err) {
+		res.Body.Close()
+		assert.Equal(t, 200, res.StatusCode)
+	}
+
+	c, _ = newClient(RunnerCredentials{
+		URL: s.URL,
+	})
+	_, err = c.doRemote(req)
+	assert.Error(t, err, "the certificate of the storage should not be trusted")
+}
+
 func TestClientCertificateInPredefinedDirectory(t *testing.T) {
 	s := httptest.NewTLSServer(http.HandlerFunc(clientHandler))
 	defer s.Close()
@@ -160,6 +252,34 @@ func TestClientCertificateInPredefinedDirectory(t *testing.T) {
 	assert.NotEmpty(t, certificates)
 }
 
+func TestGetHostName(t *testing.T) {
+	assert.Equal(t, "gitlab.example.com", getHostName("gitlab.example.com:8443"))
+	assert.Equal(t, "gitlab.example.com", getHostName("gitlab.example.com"))
+	assert.Equal(t, "2001:db8::1", getHostName("[2001:db8::1]:8443"))
+	assert.Equal(t, "2001:db8::1", getHostName("[2001:db8::1]"))
+}
+
+func TestClientIPv6(t *testing.T) {
+	listener, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Skip("IPv6 isn't available:", err)
+	}
+
+	s := httptest.NewUnstartedServer(http.HandlerFunc(clientHandler))
+	s.Listener.Close()
+	s.Listener = listener
+	s.Start()
+	defer s.Close()
+
+	c, err := newClient(RunnerCredentials{
+		URL: s.URL,
+	})
+	assert.NoError(t, err)
+
+	statusCode, statusText, _ := c.doJSON("test/ok", "GET", 200, nil, nil)
+	assert.Equal(t, 200, statusCode, statusText)
+}
+
 func TestUrlFixing(t *testing.T) {
 	assert.Equal(t, "https://gitlab.example.com/ci", fixCIURL("https://gitlab.example.com/ci///"))
 	assert.Equal(t, "https://gitlab.example.com/ci", fixCIURL("https://gitlab.example.com/ci/"))
@@ -0,0 +1,98 @@
+package network
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+const featureTracePatch = "trace-patch"
+const featureArtifactsDirectUpload = "artifacts-direct-upload"
+
+// featureRecheckInterval allows to detect the features of upgraded coordinator
+const featureRecheckInterval = time.Hour
+
+// featureResponseLimit limits the body of the response read to detect the missing endpoint
+const featureResponseLimit = 1024
+
+// isUnsupportedEndpoint checks if the response shows that the coordinator doesn't have the endpoint.
+// The unknown routes are answered by the catch-all route of the API with the error, while
+// the 404 of the missing build or project has the message, so it doesn't disable the feature
+func isUnsupportedEndpoint(response *http.Response) bool {
+	switch response.StatusCode {
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return true
+	case http.StatusNotFound:
+		var body struct {
+			Error string `json:"error"`
+		}
+		err := json.NewDecoder(io.LimitReader(response.Body, featureResponseLimit)).Decode(&body)
+		return err == nil && body.Error != ""
+	default:
+		return false
+	}
+}
+
+type coordinatorFeature struct {
+	available bool
+	checked   time.Time
+}
+
+// coordinatorFeatures caches the features detected for each coordinator,
+// so they are not probed again by every build
+type coordinatorFeatures struct {
+	features map[string]map[string]coordinatorFeature
+	lock     sync.RWMutex
+}
+
+// isAvailable returns false only if the feature was recently detected as not supported
+func (c *coordinatorFeatures) isAvailable(url, feature string) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	detected, ok := c.features[url][feature]
+	return !ok || detected.available || time.Since(detected.checked) > featureRecheckInterval
+}
+
+// detected returns the feature detected within the recheck interval
+func (c *coordinatorFeatures) detected(url, feature string) (available bool, ok bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	detected, ok := c.features[url][feature]
+	if !ok || time.Since(detected.checked) > featureRecheckInterval {
+		return false, false
+	}
+	return detected.available, true
+}
+
+func (c *coordinatorFeatures) set(url, feature string, available bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.features == nil {
+		c.features = make(map[string]map[string]coordinatorFeature)
+	}
+	if c.features[url] == nil {
+		c.features[url] = make(map[string]coordinatorFeature)
+	}
+
+	previous, ok := c.features[url][feature]
+	c.features[url][feature] = coordinatorFeature{
+		available: available,
+		checked:   time.Now(),
+	}
+	if ok && previous.available == available {
+		return
+	}
+
+	logrus.WithFields(logrus.Fields{
+		"url":       url,
+		"feature":   feature,
+		"available": available,
+	}).Infoln("Detected coordinator feature")
+}
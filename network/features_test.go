@@ -0,0 +1,89 @@
+package network
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func TestCoordinatorFeatures(t *testing.T) {
+	var features coordinatorFeatures
+	assert.True(t, features.isAvailable("https://gitlab.com/", featureTracePatch))
+
+	features.set("https://gitlab.com/", featureTracePatch, false)
+	assert.False(t, features.isAvailable("https://gitlab.com/", featureTracePatch))
+	assert.True(t, features.isAvailable("https://gitlab.example.com/", featureTracePatch))
+
+	features.set("https://gitlab.com/", featureTracePatch, true)
+	assert.True(t, features.isAvailable("https://gitlab.com/", featureTracePatch))
+}
+
+func TestCoordinatorFeaturesAreRechecked(t *testing.T) {
+	var features coordinatorFeatures
+	features.set("https://gitlab.com/", featureTracePatch, false)
+
+	detected := features.features["https://gitlab.com/"][featureTracePatch]
+	detected.checked = time.Now().Add(-featureRecheckInterval - time.Minute)
+	features.features["https://gitlab.com/"][featureTracePatch] = detected
+
+	assert.True(t, features.isAvailable("https://gitlab.com/", featureTracePatch))
+}
+
+func testPatchTraceRequests(t *testing.T, handler http.HandlerFunc) int {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		handler(w, r)
+	}))
+	defer server.Close()
+
+	config := RunnerConfig{
+		RunnerCredentials: RunnerCredentials{
+			URL: server.URL,
+		},
+	}
+	buildCredentials := &BuildCredentials{ID: 1, Token: "token"}
+
+	var buffer bytes.Buffer
+	buffer.WriteString("trace")
+	tracePatch, err := newTracePatch(buffer, 0)
+	require.NoError(t, err)
+
+	client := GitLabClient{}
+	assert.Equal(t, UpdateNotFound, client.PatchTrace(config, buildCredentials, tracePatch))
+	assert.Equal(t, UpdateNotFound, client.PatchTrace(config, buildCredentials, tracePatch))
+	return requests
+}
+
+func TestPatchTraceIsNotRetriedWhenNotSupported(t *testing.T) {
+	requests := testPatchTraceRequests(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+		w.Write([]byte(`{"error":"404 Not Found"}`))
+	})
+	assert.Equal(t, 1, requests, "the route of the API is missing")
+
+	requests = testPatchTraceRequests(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(405)
+	})
+	assert.Equal(t, 1, requests, "the method isn't allowed")
+}
+
+func TestPatchTraceIsRetriedWhenBuildIsNotFound(t *testing.T) {
+	requests := testPatchTraceRequests(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+		w.Write([]byte(`{"message":"404 Not found"}`))
+	})
+	assert.Equal(t, 2, requests, "the missing build doesn't disable the trace patching")
+
+	requests = testPatchTraceRequests(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+	})
+	assert.Equal(t, 2, requests)
+}
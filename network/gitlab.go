@@ -2,6 +2,7 @@ package network
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"github.com/Sirupsen/logrus"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
@@ -16,19 +17,22 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 )
 
 const clientError = -100
 
 type GitLabClient struct {
-	clients map[string]*client
+	clients  map[string]*client
+	features coordinatorFeatures
+	schemas  coordinatorSchemas
 }
 
 func (n *GitLabClient) getClient(runner common.RunnerCredentials) (c *client, err error) {
 	if n.clients == nil {
 		n.clients = make(map[string]*client)
 	}
-	key := fmt.Sprintf("%s_%s", runner.URL, runner.TLSCAFile)
+	key := fmt.Sprintf("%s_%s_%q_%s_%q", runner.URL, runner.TLSCAFile, runner.Headers, runner.SigningKey, runner.RequestSignatures)
 	c = n.clients[key]
 	if c == nil {
 		c, err = newClient(runner)
@@ -85,23 +89,33 @@ func (n *GitLabClient) GetBuild(config common.RunnerConfig) (*common.GetBuildRes
 		Token: config.Token,
 	}
 
-	var response common.GetBuildResponse
-	result, statusText, certificates := n.doJSON(config.RunnerCredentials, "POST", "builds/register.json", 201, &request, &response)
+	var data json.RawMessage
+	result, statusText, certificates := n.doJSON(config.RunnerCredentials, "POST", "builds/register.json", 201, &request, &data)
 
 	switch result {
 	case 201:
+		response, err := common.ParseBuildResponse(data)
+		if err != nil {
+			config.Log().WithError(err).Errorln("Checking for builds...", "invalid build")
+			return nil, true
+		}
+		n.checkBuildSchema(config, response)
+
 		config.Log().WithFields(logrus.Fields{
 			"build":    strconv.Itoa(response.ID),
 			"repo_url": response.RepoCleanURL(),
 		}).Println("Checking for builds...", "received")
 		response.TLSCAChain = certificates
-		return &response, true
+		return response, true
 	case 403:
 		config.Log().Errorln("Checking for builds...", "forbidden")
 		return nil, false
 	case 204, 404:
 		config.Log().Debugln("Checking for builds...", "nothing")
 		return nil, true
+	case 503:
+		config.Log().WithField("status", statusText).Debugln("Checking for builds...", "maintenance")
+		return nil, true
 	case clientError:
 		config.Log().WithField("status", statusText).Errorln("Checking for builds...", "error")
 		return nil, false
@@ -111,10 +125,10 @@ func (n *GitLabClient) GetBuild(config common.RunnerConfig) (*common.GetBuildRes
 	}
 }
 
-func (n *GitLabClient) RegisterRunner(runner common.RunnerCredentials, description, tags string) *common.RegisterRunnerResponse {
-	// TODO: pass executor
+func (n *GitLabClient) RegisterRunner(config common.RunnerConfig, description, tags string) *common.RegisterRunnerResponse {
+	runner := config.RunnerCredentials
 	request := common.RegisterRunnerRequest{
-		Info:        n.getRunnerVersion(common.RunnerConfig{}),
+		Info:        n.getRunnerVersion(config),
 		Token:       runner.Token,
 		Description: description,
 		Tags:        tags,
@@ -162,6 +176,40 @@ func (n *GitLabClient) DeleteRunner(runner common.RunnerCredentials) bool {
 	}
 }
 
+// UpdateRunnerDescription changes the description of the runner shown by GitLab. The API of runners
+// doesn't update it, so it's changed with the API of GitLab, which requires the private token of the administrator
+func (n *GitLabClient) UpdateRunnerDescription(runner common.RunnerCredentials, id int, apiToken, description string) bool {
+	body, err := json.Marshal(&common.UpdateRunnerRequest{
+		Description: description,
+	})
+	if err != nil {
+		runner.Log().WithError(err).Errorln("Updating runner description...", "error")
+		return false
+	}
+
+	headers := make(http.Header)
+	headers.Set("PRIVATE-TOKEN", apiToken)
+	res, err := n.doRaw(runner, "PUT", runnerURI(id), bytes.NewReader(body), "application/json", headers)
+	if err != nil {
+		runner.Log().WithError(err).Errorln("Updating runner description...", "error")
+		return false
+	}
+	defer res.Body.Close()
+	defer io.Copy(ioutil.Discard, res.Body)
+
+	switch res.StatusCode {
+	case 200:
+		runner.Log().Println("Updating runner description...", "succeeded")
+		return true
+	case 401, 403:
+		runner.Log().WithField("status", res.Status).Errorln("Updating runner description...", "forbidden (check the api token)")
+		return false
+	default:
+		runner.Log().WithField("status", res.Status).Errorln("Updating runner description...", "failed")
+		return false
+	}
+}
+
 func (n *GitLabClient) VerifyRunner(runner common.RunnerCredentials) bool {
 	request := common.VerifyRunnerRequest{
 		Token: runner.Token,
@@ -187,13 +235,9 @@ func (n *GitLabClient) VerifyRunner(runner common.RunnerCredentials) bool {
 	}
 }
 
-func (n *GitLabClient) UpdateBuild(config common.RunnerConfig, id int, state common.BuildState, trace *string) common.UpdateState {
-	request := common.UpdateBuildRequest{
-		Info:  n.getRunnerVersion(config),
-		Token: config.Token,
-		State: state,
-		Trace: trace,
-	}
+func (n *GitLabClient) UpdateBuild(config common.RunnerConfig, id int, request common.UpdateBuildRequest) common.UpdateState {
+	request.Info = n.getRunnerVersion(config)
+	request.Token = config.Token
 
 	log := config.Log().WithField("build", id)
 
@@ -205,6 +249,10 @@ func (n *GitLabClient) UpdateBuild(config common.RunnerConfig, id int, state com
 	case 404:
 		log.Warningln("Submitting build to coordinator...", "aborted")
 		return common.UpdateAbort
+	case 503:
+		// the build keeps running, the update is sent again after the maintenance
+		log.WithField("status", statusText).Debugln("Submitting build to coordinator...", "maintenance")
+		return common.UpdateFailed
 	case 403:
 		log.WithField("status", statusText).Errorln("Submitting build to coordinator...", "forbidden")
 		return common.UpdateAbort
@@ -220,6 +268,11 @@ func (n *GitLabClient) UpdateBuild(config common.RunnerConfig, id int, state com
 func (n *GitLabClient) PatchTrace(config common.RunnerConfig, buildCredentials *common.BuildCredentials, tracePatch common.BuildTracePatch) common.UpdateState {
 	id := buildCredentials.ID
 
+	// don't probe again the coordinator that doesn't support trace patching
+	if !n.features.isAvailable(config.URL, featureTracePatch) {
+		return common.UpdateNotFound
+	}
+
 	contentRange := fmt.Sprintf("%d-%d", tracePatch.Offset(), tracePatch.Limit())
 	headers := make(http.Header)
 	headers.Set("Content-Range", contentRange)
@@ -252,23 +305,35 @@ func (n *GitLabClient) PatchTrace(config common.RunnerConfig, buildCredentials *
 		return common.UpdateAbort
 	}
 
+	if isUnsupportedEndpoint(response) {
+		log.Warningln("Appending trace to coordinator...", "not supported")
+		n.features.set(config.URL, featureTracePatch, false)
+		return common.UpdateNotFound
+	}
+
 	switch response.StatusCode {
 	case 202:
 		log.Debugln("Appending trace to coordinator...", "ok")
+		n.features.set(config.URL, featureTracePatch, true)
 		return common.UpdateSucceeded
 	case 404:
+		// the full trace is sent by this build, the other builds still append the trace
 		log.Warningln("Appending trace to coordinator...", "not-found")
 		return common.UpdateNotFound
 	case 403:
 		log.Errorln("Appending trace to coordinator...", "forbidden")
 		return common.UpdateAbort
+	case 503:
+		// the trace is kept, it's sent from the same offset after the maintenance
+		log.Debugln("Appending trace to coordinator...", "maintenance")
+		return common.UpdateFailed
 	case 416:
 		log.Warningln("Appending trace to coordinator...", "range mismatch")
 
-		remoteRange := strings.Split(remoteRange, "-")
-		newOffset, _ := strconv.Atoi(remoteRange[1])
-		tracePatch.SetNewOffset(newOffset)
-
+		// the patch is resent from the end of the trace stored by the coordinator
+		if newOffset, ok := parseTraceRangeEnd(remoteRange); ok {
+			tracePatch.SetNewOffset(newOffset)
+		}
 		return common.UpdateRangeMissmatch
 	case clientError:
 		log.Errorln("Appending trace to coordinator...", "error")
@@ -279,6 +344,20 @@ func (n *GitLabClient) PatchTrace(config common.RunnerConfig, buildCredentials *
 	}
 }
 
+// parseTraceRangeEnd returns the end of the trace range reported by the coordinator, eg. 0-1024
+func parseTraceRangeEnd(remoteRange string) (int, bool) {
+	parts := strings.Split(remoteRange, "-")
+	if len(parts) != 2 {
+		return 0, false
+	}
+
+	end, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil || end < 0 {
+		return 0, false
+	}
+	return end, true
+}
+
 func (n *GitLabClient) createArtifactsForm(mpw *multipart.Writer, reader io.Reader, baseName string) error {
 	wr, err := mpw.CreateFormFile("file", baseName)
 	if err != nil {
@@ -309,19 +388,15 @@ func (n *GitLabClient) UploadRawArtifacts(config common.BuildCredentials, reader
 
 	// TODO: Create proper interface for `doRaw` that can use other types than RunnerCredentials
 	mappedConfig := common.RunnerCredentials{
-		URL:       config.URL,
-		Token:     config.Token,
-		TLSCAFile: config.TLSCAFile,
-	}
-
-	query := url.Values{}
-	if expireIn != "" {
-		query.Set("expire_in", expireIn)
+		URL:               config.URL,
+		Token:             config.Token,
+		TLSCAFile:         config.TLSCAFile,
+		RequestSignatures: config.RequestSignatures,
 	}
 
 	headers := make(http.Header)
 	headers.Set("BUILD-TOKEN", config.Token)
-	res, err := n.doRaw(mappedConfig, "POST", fmt.Sprintf("builds/%d/artifacts?%s", config.ID, query.Encode()), pr, mpw.FormDataContentType(), headers)
+	res, err := n.doRaw(mappedConfig, "POST", artifactsUploadURI(config.ID, expireIn), pr, mpw.FormDataContentType(), headers)
 
 	log := logrus.WithFields(logrus.Fields{
 		"id":    config.ID,
@@ -382,23 +457,206 @@ func (n *GitLabClient) UploadArtifacts(config common.BuildCredentials, artifacts
 	return n.UploadRawArtifacts(config, file, baseName, "")
 }
 
+func (n *GitLabClient) AuthorizeArtifacts(config common.BuildCredentials, baseName string) *common.ArtifactsUploadAuthorization {
+	// don't probe again the coordinator that doesn't offer direct uploads
+	if !n.features.isAvailable(config.URL, featureArtifactsDirectUpload) {
+		return nil
+	}
+
+	// TODO: Create proper interface for `doRaw` that can use other types than RunnerCredentials
+	mappedConfig := common.RunnerCredentials{
+		URL:               config.URL,
+		Token:             config.Token,
+		TLSCAFile:         config.TLSCAFile,
+		RequestSignatures: config.RequestSignatures,
+	}
+
+	headers := make(http.Header)
+	headers.Set("BUILD-TOKEN", config.Token)
+	res, err := n.doRaw(mappedConfig, "POST", artifactsAuthorizeURI(config.ID, baseName), nil, "", headers)
+
+	log := logrus.WithFields(logrus.Fields{
+		"id":    config.ID,
+		"token": helpers.ShortenToken(config.Token),
+	})
+
+	if res != nil {
+		log = log.WithField("responseStatus", res.Status)
+	}
+
+	if err != nil {
+		log.WithError(err).Warningln("Authorizing artifacts upload...", "error")
+		return nil
+	}
+	defer res.Body.Close()
+	defer io.Copy(ioutil.Discard, res.Body)
+
+	switch res.StatusCode {
+	case 200:
+		var authorization common.ArtifactsUploadAuthorization
+		err = json.NewDecoder(res.Body).Decode(&authorization)
+		if err != nil {
+			log.WithError(err).Warningln("Authorizing artifacts upload...", "invalid response")
+			return nil
+		}
+		n.features.set(config.URL, featureArtifactsDirectUpload, authorization.RemoteURL != "")
+		if authorization.RemoteURL == "" {
+			return nil
+		}
+		log.Debugln("Authorizing artifacts upload...", "ok")
+		return &authorization
+	case 404, 405, 501:
+		if isUnsupportedEndpoint(res) {
+			n.features.set(config.URL, featureArtifactsDirectUpload, false)
+		}
+		return nil
+	default:
+		log.WithField("status", res.Status).Warningln("Authorizing artifacts upload...", "failed")
+		return nil
+	}
+}
+
+// IsArtifactsDirectUploadSupported detects in the runner if the coordinator offers the direct uploads,
+// it's probed only once in the recheck interval and it's assumed to be supported when it can't be detected
+func (n *GitLabClient) IsArtifactsDirectUploadSupported(config common.BuildCredentials) bool {
+	if available, ok := n.features.detected(config.URL, featureArtifactsDirectUpload); ok {
+		return available
+	}
+
+	n.AuthorizeArtifacts(config, "artifacts.zip")
+	available, ok := n.features.detected(config.URL, featureArtifactsDirectUpload)
+	return available || !ok
+}
+
+func (n *GitLabClient) uploadToRemoteURL(runner common.RunnerCredentials, remoteURL string, reader io.Reader, size int64) (*http.Response, error) {
+	c, err := n.getClient(runner)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("PUT", remoteURL, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/zip")
+	return c.doRemote(req)
+}
+
+func (n *GitLabClient) UploadDirectArtifacts(config common.BuildCredentials, authorization *common.ArtifactsUploadAuthorization, reader io.Reader, size int64, baseName string, expireIn string) common.UploadState {
+	log := logrus.WithFields(logrus.Fields{
+		"id":    config.ID,
+		"token": helpers.ShortenToken(config.Token),
+	})
+
+	// TODO: Create proper interface for `doRaw` that can use other types than RunnerCredentials
+	mappedConfig := common.RunnerCredentials{
+		URL:               config.URL,
+		Token:             config.Token,
+		TLSCAFile:         config.TLSCAFile,
+		RequestSignatures: config.RequestSignatures,
+	}
+
+	// Store the archive, the pre-signed URL doesn't require any other credentials
+	res, err := n.uploadToRemoteURL(mappedConfig, authorization.RemoteURL, reader, size)
+	if err != nil {
+		log.WithError(err).Errorln("Uploading artifacts to object storage...", "error")
+		return common.UploadFailed
+	}
+	io.Copy(ioutil.Discard, res.Body)
+	res.Body.Close()
+
+	switch {
+	case res.StatusCode == 403:
+		log.WithField("status", res.Status).Errorln("Uploading artifacts to object storage...", "forbidden")
+		return common.UploadForbidden
+	case res.StatusCode == 413:
+		log.WithField("status", res.Status).Errorln("Uploading artifacts to object storage...", "too large archive")
+		return common.UploadTooLarge
+	case res.StatusCode/100 != 2:
+		log.WithField("status", res.Status).Warningln("Uploading artifacts to object storage...", "failed")
+		return common.UploadFailed
+	}
+	log.Println("Uploading artifacts to object storage...", "ok")
+
+	form := url.Values{}
+	form.Set("remote_object_id", authorization.RemoteObject)
+	form.Set("filename", baseName)
+	if expireIn != "" {
+		form.Set("expire_in", expireIn)
+	}
+
+	headers := make(http.Header)
+	headers.Set("BUILD-TOKEN", config.Token)
+	res, err = n.doRaw(mappedConfig, "POST", artifactsURI(config.ID), strings.NewReader(form.Encode()), "application/x-www-form-urlencoded", headers)
+	if res != nil {
+		log = log.WithField("responseStatus", res.Status)
+	}
+
+	if err != nil {
+		log.WithError(err).Errorln("Confirming artifacts upload...", "error")
+		return common.UploadFailed
+	}
+	defer res.Body.Close()
+	defer io.Copy(ioutil.Discard, res.Body)
+
+	switch res.StatusCode {
+	case 201:
+		log.Println("Confirming artifacts upload...", "ok")
+		return common.UploadSucceeded
+	case 403:
+		log.WithField("status", res.Status).Errorln("Confirming artifacts upload...", "forbidden")
+		return common.UploadForbidden
+	case 413:
+		log.WithField("status", res.Status).Errorln("Confirming artifacts upload...", "too large archive")
+		return common.UploadTooLarge
+	default:
+		log.WithField("status", res.Status).Warningln("Confirming artifacts upload...", "failed")
+		return common.UploadFailed
+	}
+}
+
 func (n *GitLabClient) DownloadArtifacts(config common.BuildCredentials, artifactsFile string) common.DownloadState {
 	// TODO: Create proper interface for `doRaw` that can use other types than RunnerCredentials
 	mappedConfig := common.RunnerCredentials{
-		URL:       config.URL,
-		Token:     config.Token,
-		TLSCAFile: config.TLSCAFile,
+		URL:               config.URL,
+		Token:             config.Token,
+		TLSCAFile:         config.TLSCAFile,
+		RequestSignatures: config.RequestSignatures,
 	}
 
 	headers := make(http.Header)
 	headers.Set("BUILD-TOKEN", config.Token)
-	res, err := n.doRaw(mappedConfig, "GET", fmt.Sprintf("builds/%d/artifacts", config.ID), nil, "", headers)
+	res, err := n.doRaw(mappedConfig, "GET", artifactsURI(config.ID), nil, "", headers)
 
 	log := logrus.WithFields(logrus.Fields{
 		"id":    config.ID,
 		"token": helpers.ShortenToken(config.Token),
 	})
+	return n.saveArtifacts(res, err, artifactsFile, config.ProgressInterval, log)
+}
+
+func (n *GitLabClient) DownloadProjectArtifacts(config common.ProjectArtifactsCredentials, artifactsFile string) common.DownloadState {
+	mappedConfig := common.RunnerCredentials{
+		URL:               config.URL,
+		Token:             config.Token,
+		TLSCAFile:         config.TLSCAFile,
+		RequestSignatures: config.RequestSignatures,
+	}
+
+	headers := make(http.Header)
+	headers.Set("PRIVATE-TOKEN", config.Token)
+	res, err := n.doRaw(mappedConfig, "GET", projectArtifactsURI(config.Project, config.Ref, config.Job), nil, "", headers)
+
+	log := logrus.WithFields(logrus.Fields{
+		"project": config.Project,
+		"ref":     config.Ref,
+		"job":     config.Job,
+	})
+	return n.saveArtifacts(res, err, artifactsFile, config.ProgressInterval, log)
+}
 
+func (n *GitLabClient) saveArtifacts(res *http.Response, err error, artifactsFile string, progressInterval time.Duration, log *logrus.Entry) common.DownloadState {
 	if res != nil {
 		log = log.WithField("responseStatus", res.Status)
 	}
@@ -415,7 +673,9 @@ func (n *GitLabClient) DownloadArtifacts(config common.BuildCredentials, artifac
 		file, err := os.Create(artifactsFile)
 		if err == nil {
 			defer file.Close()
-			_, err = io.Copy(file, res.Body)
+			progress := helpers.NewProgressReader(res.Body, res.ContentLength, "Downloading artifacts")
+			progress.Interval = progressInterval
+			_, err = io.Copy(file, progress)
 		}
 		if err != nil {
 			file.Close()
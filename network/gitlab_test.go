@@ -9,6 +9,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"runtime"
+	"strings"
 	"testing"
 )
 
@@ -217,21 +219,21 @@ func TestRegisterRunner(t *testing.T) {
 
 	c := GitLabClient{}
 
-	res := c.RegisterRunner(validToken, "test", "tags")
+	res := c.RegisterRunner(RunnerConfig{RunnerCredentials: validToken}, "test", "tags")
 	if assert.NotNil(t, res) {
 		assert.Equal(t, validToken.Token, res.Token)
 	}
 
-	res = c.RegisterRunner(validToken, "invalid description", "tags")
+	res = c.RegisterRunner(RunnerConfig{RunnerCredentials: validToken}, "invalid description", "tags")
 	assert.Nil(t, res)
 
-	res = c.RegisterRunner(invalidToken, "test", "tags")
+	res = c.RegisterRunner(RunnerConfig{RunnerCredentials: invalidToken}, "test", "tags")
 	assert.Nil(t, res)
 
-	res = c.RegisterRunner(otherToken, "test", "tags")
+	res = c.RegisterRunner(RunnerConfig{RunnerCredentials: otherToken}, "test", "tags")
 	assert.Nil(t, res)
 
-	res = c.RegisterRunner(brokenCredentials, "test", "tags")
+	res = c.RegisterRunner(brokenConfig, "test", "tags")
 	assert.Nil(t, res)
 }
 
@@ -383,6 +385,15 @@ func TestUpdateBuild(t *testing.T) {
 
 		switch req["state"].(string) {
 		case "running":
+			assert.Nil(t, req["timings"])
+			assert.Nil(t, req["coverage"])
+			w.WriteHeader(200)
+		case "success":
+			assert.Equal(t, map[string]interface{}{
+				"prepare_duration": 1.5,
+				"duration":         10.0,
+			}, req["timings"])
+			assert.Equal(t, 85.5, req["coverage"])
 			w.WriteHeader(200)
 		case "forbidden":
 			w.WriteHeader(403)
@@ -404,19 +415,28 @@ func TestUpdateBuild(t *testing.T) {
 	trace := "trace"
 	c := GitLabClient{}
 
-	state := c.UpdateBuild(config, 10, "running", &trace)
+	state := c.UpdateBuild(config, 10, UpdateBuildRequest{State: "running", Trace: &trace})
 	assert.Equal(t, UpdateSucceeded, state, "Update should continue when running")
 
-	state = c.UpdateBuild(config, 10, "forbidden", &trace)
+	coverage := 85.5
+	state = c.UpdateBuild(config, 10, UpdateBuildRequest{
+		State:    "success",
+		Trace:    &trace,
+		Timings:  &BuildTimings{PrepareDuration: 1.5, Duration: 10},
+		Coverage: &coverage,
+	})
+	assert.Equal(t, UpdateSucceeded, state, "Update should send the timings")
+
+	state = c.UpdateBuild(config, 10, UpdateBuildRequest{State: "forbidden", Trace: &trace})
 	assert.Equal(t, UpdateAbort, state, "Update should if the state is forbidden")
 
-	state = c.UpdateBuild(config, 10, "other", &trace)
+	state = c.UpdateBuild(config, 10, UpdateBuildRequest{State: "other", Trace: &trace})
 	assert.Equal(t, UpdateFailed, state, "Update should fail for badly formatted request")
 
-	state = c.UpdateBuild(config, 4, "state", &trace)
+	state = c.UpdateBuild(config, 4, UpdateBuildRequest{State: "state", Trace: &trace})
 	assert.Equal(t, UpdateAbort, state, "Update should abort for unknown build")
 
-	state = c.UpdateBuild(brokenConfig, 4, "state", &trace)
+	state = c.UpdateBuild(brokenConfig, 4, UpdateBuildRequest{State: "state", Trace: &trace})
 	assert.Equal(t, UpdateAbort, state)
 }
 
@@ -488,3 +508,288 @@ func TestArtifactsUpload(t *testing.T) {
 	state = c.UploadArtifacts(invalidToken, tempFile.Name())
 	assert.Equal(t, UploadForbidden, state, "Artifacts should be rejected if invalid token")
 }
+
+func TestArtifactsDirectUpload(t *testing.T) {
+	var stored, confirmed string
+
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "PUT", r.Method)
+		assert.Equal(t, int64(len("content")), r.ContentLength)
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		stored = string(body)
+		w.WriteHeader(200)
+	}))
+	defer storage.Close()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("BUILD-TOKEN") != "token" {
+			w.WriteHeader(403)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/ci/api/v1/builds/10/artifacts/authorize":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(200)
+			fmt.Fprintf(w, `{"remote_url":"%s/artifacts.zip","remote_object_id":"object-id"}`, storage.URL)
+		case "/ci/api/v1/builds/10/artifacts":
+			confirmed = r.FormValue("remote_object_id")
+			w.WriteHeader(201)
+		default:
+			w.WriteHeader(404)
+		}
+	}))
+	defer s.Close()
+
+	config := BuildCredentials{
+		ID:    10,
+		URL:   s.URL,
+		Token: "token",
+	}
+
+	c := GitLabClient{}
+
+	authorization := c.AuthorizeArtifacts(config, "artifacts.zip")
+	if assert.NotNil(t, authorization) {
+		assert.Equal(t, storage.URL+"/artifacts.zip", authorization.RemoteURL)
+
+		state := c.UploadDirectArtifacts(config, authorization, strings.NewReader("content"), int64(len("content")), "artifacts.zip", "")
+		assert.Equal(t, UploadSucceeded, state, "Artifacts should be uploaded")
+		assert.Equal(t, "content", stored)
+		assert.Equal(t, "object-id", confirmed)
+	}
+
+	invalidToken := config
+	invalidToken.Token = "invalid-token"
+	assert.Nil(t, c.AuthorizeArtifacts(invalidToken, "artifacts.zip"))
+}
+
+func TestArtifactsDirectUploadNotSupported(t *testing.T) {
+	requests := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(404)
+		fmt.Fprint(w, `{"error":"404 Not Found"}`)
+	}))
+	defer s.Close()
+
+	config := BuildCredentials{
+		ID:    10,
+		URL:   s.URL,
+		Token: "token",
+	}
+
+	c := GitLabClient{}
+	assert.Nil(t, c.AuthorizeArtifacts(config, "artifacts.zip"))
+	assert.Nil(t, c.AuthorizeArtifacts(config, "artifacts.zip"))
+	assert.Equal(t, 1, requests, "the coordinator should not be probed again")
+}
+
+func TestIsArtifactsDirectUploadSupported(t *testing.T) {
+	requests := 0
+	supported := false
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if !supported {
+			w.WriteHeader(405)
+			return
+		}
+		w.WriteHeader(200)
+		fmt.Fprint(w, `{"remote_url":"https://storage/artifacts.zip"}`)
+	}))
+	defer s.Close()
+
+	config := BuildCredentials{
+		ID:    10,
+		URL:   s.URL,
+		Token: "token",
+	}
+
+	c := GitLabClient{}
+	assert.False(t, c.IsArtifactsDirectUploadSupported(config))
+	assert.False(t, c.IsArtifactsDirectUploadSupported(config))
+	assert.Equal(t, 1, requests, "the feature is detected once")
+
+	supported = true
+	c = GitLabClient{}
+	assert.True(t, c.IsArtifactsDirectUploadSupported(config))
+	assert.True(t, c.IsArtifactsDirectUploadSupported(config))
+	assert.Equal(t, 2, requests, "the feature is detected once")
+
+	assert.True(t, c.IsArtifactsDirectUploadSupported(BuildCredentials{ID: 10, URL: "broken", Token: "token"}), "it's assumed to be supported when it can't be detected")
+}
+
+func TestGetBuildDuringMaintenance(t *testing.T) {
+	requests := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(503)
+	}))
+	defer s.Close()
+
+	config := RunnerConfig{
+		RunnerCredentials: RunnerCredentials{
+			URL:   s.URL,
+			Token: "token",
+		},
+	}
+
+	c := GitLabClient{}
+	res, ok := c.GetBuild(config)
+	assert.Nil(t, res)
+	assert.True(t, ok, "the runner is healthy during the maintenance")
+
+	res, ok = c.GetBuild(config)
+	assert.Nil(t, res)
+	assert.True(t, ok)
+
+	trace := "trace"
+	state := c.UpdateBuild(config, 10, UpdateBuildRequest{State: "running", Trace: &trace})
+	assert.Equal(t, UpdateFailed, state, "the build is updated again after the maintenance")
+	assert.Equal(t, 1, requests, "the requests are paused during the maintenance")
+}
+
+func TestRegisterRunnerSendsVersionInfo(t *testing.T) {
+	var request RegisterRunnerRequest
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(201)
+		w.Write([]byte(`{"id":12,"token":"runner-token"}`))
+	}))
+	defer s.Close()
+
+	config := RunnerConfig{
+		RunnerCredentials: RunnerCredentials{
+			URL:   s.URL,
+			Token: "registration-token",
+		},
+		RunnerSettings: RunnerSettings{
+			Executor: "shell",
+		},
+	}
+
+	c := GitLabClient{}
+	res := c.RegisterRunner(config, "test", "tags")
+	if assert.NotNil(t, res) {
+		assert.Equal(t, "runner-token", res.Token)
+		assert.Equal(t, 12, res.ID)
+	}
+	assert.Equal(t, "shell", request.Info.Executor)
+	assert.Equal(t, runtime.GOOS, request.Info.Platform)
+	assert.Equal(t, runtime.GOARCH, request.Info.Architecture)
+	assert.Equal(t, VERSION, request.Info.Version)
+}
+
+func TestUpdateRunnerDescription(t *testing.T) {
+	var request UpdateRunnerRequest
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v3/runners/12" || r.Method != "PUT" {
+			w.WriteHeader(404)
+			return
+		}
+		if r.Header.Get("PRIVATE-TOKEN") != "api-token" {
+			w.WriteHeader(401)
+			return
+		}
+
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		w.WriteHeader(200)
+	}))
+	defer s.Close()
+
+	runner := RunnerCredentials{
+		URL:   s.URL + "/ci",
+		Token: "runner-token",
+	}
+
+	c := GitLabClient{}
+	assert.True(t, c.UpdateRunnerDescription(runner, 12, "api-token", "runner-us-east-1a"))
+	assert.Equal(t, "runner-us-east-1a", request.Description)
+
+	assert.False(t, c.UpdateRunnerDescription(runner, 12, "invalid", "runner-us-east-1a"))
+	assert.False(t, c.UpdateRunnerDescription(runner, 13, "api-token", "runner-us-east-1a"))
+}
+
+func TestGetBuildWithUnknownFields(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(201)
+		w.Write([]byte(`{"id": 10, "schema_version": 1000, "triggered_by": {"id": 1}, "options": {"image": "alpine", "release": {}}}`))
+	}))
+	defer s.Close()
+
+	config := RunnerConfig{
+		RunnerCredentials: RunnerCredentials{
+			URL:   s.URL,
+			Token: "valid",
+		},
+	}
+
+	c := GitLabClient{}
+	res, ok := c.GetBuild(config)
+	assert.True(t, ok)
+	if assert.NotNil(t, res) {
+		assert.Equal(t, 10, res.ID, "the known fields are used")
+		assert.Equal(t, []string{"options.release", "triggered_by"}, res.UnknownFields)
+		assert.Equal(t, 1000, res.SchemaVersion)
+	}
+}
+
+func TestProjectArtifactsDownload(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/api/v3/projects/group%2Fapp/builds/artifacts/master/download" {
+			w.WriteHeader(404)
+			return
+		}
+
+		if r.URL.Query().Get("job") != "build binaries" {
+			w.WriteHeader(404)
+			return
+		}
+
+		if r.Header.Get("PRIVATE-TOKEN") != "private-token" {
+			w.WriteHeader(403)
+			return
+		}
+
+		fmt.Fprint(w, "content")
+	}
+
+	s := httptest.NewServer(http.HandlerFunc(handler))
+	defer s.Close()
+
+	config := ProjectArtifactsCredentials{
+		URL:     s.URL,
+		Token:   "private-token",
+		Project: "group/app",
+		Ref:     "master",
+		Job:     "build binaries",
+	}
+
+	tempFile, err := ioutil.TempFile("", "artifacts")
+	assert.NoError(t, err)
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	c := GitLabClient{}
+
+	state := c.DownloadProjectArtifacts(config, tempFile.Name())
+	assert.Equal(t, DownloadSucceeded, state, "Artifacts should be downloaded")
+
+	data, err := ioutil.ReadFile(tempFile.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, "content", string(data))
+
+	invalidToken := config
+	invalidToken.Token = "invalid-token"
+	state = c.DownloadProjectArtifacts(invalidToken, tempFile.Name())
+	assert.Equal(t, DownloadForbidden, state, "Artifacts should be rejected if invalid token")
+
+	otherJob := config
+	otherJob.Job = "test"
+	state = c.DownloadProjectArtifacts(otherJob, tempFile.Name())
+	assert.Equal(t, DownloadNotFound, state, "Artifacts of other job should be not found")
+}
@@ -0,0 +1,85 @@
+package network
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// maxMaintenancePause limits the pause requested by the coordinator
+const maxMaintenancePause = time.Hour
+
+// coordinatorMaintenance pauses the requests to the coordinator returning
+// 503 Service Unavailable with the Retry-After header during its maintenance
+type coordinatorMaintenance struct {
+	pausedUntil time.Time
+	lock        sync.RWMutex
+}
+
+// parseRetryAfter reads the delay in seconds or the HTTP date of the Retry-After header
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, seconds > 0
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		delay := date.Sub(now)
+		return delay, delay > 0
+	}
+	return 0, false
+}
+
+func (m *coordinatorMaintenance) until() time.Time {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	if time.Now().Before(m.pausedUntil) {
+		return m.pausedUntil
+	}
+	return time.Time{}
+}
+
+func (m *coordinatorMaintenance) update(url string, res *http.Response) {
+	if res.StatusCode != http.StatusServiceUnavailable {
+		return
+	}
+
+	now := time.Now()
+	delay, ok := parseRetryAfter(res.Header.Get("Retry-After"), now)
+	if !ok {
+		return
+	}
+	if delay > maxMaintenancePause {
+		delay = maxMaintenancePause
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.pausedUntil = now.Add(delay)
+	logrus.WithField("url", url).Warningln("The coordinator is in maintenance, the requests are paused until", m.pausedUntil.Format(time.RFC3339))
+}
+
+// response is returned instead of sending the request during the maintenance
+func (m *coordinatorMaintenance) response(until time.Time) *http.Response {
+	header := make(http.Header)
+	header.Set("Retry-After", strconv.Itoa(int(until.Sub(time.Now()).Seconds())+1))
+
+	return &http.Response{
+		Status:     "503 Service Unavailable (paused during maintenance)",
+		StatusCode: http.StatusServiceUnavailable,
+		Header:     header,
+		Body:       ioutil.NopCloser(&bytes.Buffer{}),
+	}
+}
@@ -0,0 +1,50 @@
+package network
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2017, 1, 20, 10, 0, 0, 0, time.UTC)
+
+	delay, ok := parseRetryAfter("120", now)
+	assert.True(t, ok)
+	assert.Equal(t, 2*time.Minute, delay)
+
+	delay, ok = parseRetryAfter("Fri, 20 Jan 2017 10:05:00 GMT", now)
+	assert.True(t, ok)
+	assert.Equal(t, 5*time.Minute, delay)
+
+	_, ok = parseRetryAfter("Fri, 20 Jan 2017 09:55:00 GMT", now)
+	assert.False(t, ok, "the date in the past doesn't pause the requests")
+
+	_, ok = parseRetryAfter("", now)
+	assert.False(t, ok)
+
+	_, ok = parseRetryAfter("invalid", now)
+	assert.False(t, ok)
+}
+
+func TestCoordinatorMaintenance(t *testing.T) {
+	m := coordinatorMaintenance{}
+	assert.True(t, m.until().IsZero())
+
+	m.update("http://gitlab/", &http.Response{StatusCode: 503, Header: http.Header{}})
+	assert.True(t, m.until().IsZero(), "503 without Retry-After doesn't pause the requests")
+
+	res := &http.Response{StatusCode: 503, Header: http.Header{}}
+	res.Header.Set("Retry-After", "60")
+	m.update("http://gitlab/", res)
+	assert.InDelta(t, float64(time.Minute), float64(m.until().Sub(time.Now())), float64(5*time.Second))
+
+	res.Header.Set("Retry-After", "86400")
+	m.update("http://gitlab/", res)
+	assert.InDelta(t, float64(maxMaintenancePause), float64(m.until().Sub(time.Now())), float64(5*time.Second))
+
+	synthetic := m.response(m.until())
+	assert.Equal(t, 503, synthetic.StatusCode)
+}
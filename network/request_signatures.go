@@ -0,0 +1,119 @@
+package network
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
+)
+
+func artifactsURI(id int) string {
+	return fmt.Sprintf("builds/%d/artifacts", id)
+}
+
+func artifactsUploadURI(id int, expireIn string) string {
+	if expireIn == "" {
+		return artifactsURI(id)
+	}
+
+	query := url.Values{}
+	query.Set("expire_in", expireIn)
+	return artifactsURI(id) + "?" + query.Encode()
+}
+
+func artifactsAuthorizeURI(id int, baseName string) string {
+	query := url.Values{}
+	query.Set("filename", baseName)
+	return fmt.Sprintf("builds/%d/artifacts/authorize?%s", id, query.Encode())
+}
+
+// projectArtifactsURI is the URI of the artifacts of other projects,
+// they are served by the API of GitLab, not by the one of runners
+func projectArtifactsURI(project, ref, job string) string {
+	return fmt.Sprintf("../../../api/v3/projects/%s/builds/artifacts/%s/download?job=%s",
+		url.QueryEscape(project), url.QueryEscape(ref), url.QueryEscape(job))
+}
+
+// runnerURI is the URI of the runner in the API of GitLab
+func runnerURI(id int) string {
+	return fmt.Sprintf("../../../api/v3/runners/%d", id)
+}
+
+type requestPresigner struct {
+	runner   common.RunnerCredentials
+	url      *url.URL
+	now      time.Time
+	validity time.Duration
+}
+
+func (p *requestPresigner) presign(method, uri, bodyHash string) (string, error) {
+	requestURL, err := p.url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	return helpers.SignRequest(p.runner.SigningKey, method, requestURL, bodyHash, p.now, p.validity).String(), nil
+}
+
+func newRequestPresigner(runner common.RunnerCredentials, now time.Time, validity time.Duration) (*requestPresigner, error) {
+	c, err := newClient(runner)
+	if err != nil {
+		return nil, err
+	}
+	return &requestPresigner{runner: runner, url: c.url, now: now, validity: validity}, nil
+}
+
+// PresignArtifactsUpload returns the requests of the artifacts-uploader pre-signed with the signing key of the runner.
+// The bodies of the uploads aren't known, when the requests are signed, so they are signed as UNSIGNED-PAYLOAD
+func PresignArtifactsUpload(runner common.RunnerCredentials, id int, baseName, expireIn string, now time.Time, validity time.Duration) (signatures []string, err error) {
+	if runner.SigningKey == "" {
+		return nil, nil
+	}
+
+	presigner, err := newRequestPresigner(runner, now, validity)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, request := range []struct{ uri, bodyHash string }{
+		{artifactsAuthorizeURI(id, baseName), helpers.EmptyBodyHash},
+		{artifactsUploadURI(id, expireIn), helpers.UnsignedPayload},
+		{artifactsURI(id), helpers.UnsignedPayload},
+	} {
+		signature, err := presigner.presign("POST", request.uri, request.bodyHash)
+		if err != nil {
+			return nil, err
+		}
+		signatures = append(signatures, signature)
+	}
+	return
+}
+
+// PresignArtifactsDownload returns the request of the artifacts-downloader pre-signed with the signing key of the runner
+func PresignArtifactsDownload(runner common.RunnerCredentials, id int, now time.Time, validity time.Duration) ([]string, error) {
+	return presignDownload(runner, artifactsURI(id), now, validity)
+}
+
+// PresignProjectArtifactsDownload returns the request of the artifacts-downloader downloading the artifacts
+// of other project pre-signed with the signing key of the runner
+func PresignProjectArtifactsDownload(runner common.RunnerCredentials, project, ref, job string, now time.Time, validity time.Duration) ([]string, error) {
+	return presignDownload(runner, projectArtifactsURI(project, ref, job), now, validity)
+}
+
+func presignDownload(runner common.RunnerCredentials, uri string, now time.Time, validity time.Duration) ([]string, error) {
+	if runner.SigningKey == "" {
+		return nil, nil
+	}
+
+	presigner, err := newRequestPresigner(runner, now, validity)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := presigner.presign("GET", uri, helpers.EmptyBodyHash)
+	if err != nil {
+		return nil, err
+	}
+	return []string{signature}, nil
+}
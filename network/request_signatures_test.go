@@ -0,0 +1,98 @@
+package network
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
+)
+
+func TestPresignArtifactsUpload(t *testing.T) {
+	runner := common.RunnerCredentials{
+		URL:        "https://gitlab.example.com/",
+		SigningKey: "key",
+	}
+	now := time.Unix(1500000000, 0)
+
+	signatures, err := PresignArtifactsUpload(runner, 10, "artifacts.zip", "1 day", now, time.Hour)
+	require.NoError(t, err)
+	if !assert.Len(t, signatures, 3) {
+		return
+	}
+
+	var keys []string
+	for _, signature := range signatures {
+		assert.NotContains(t, signature, "key ", "the signing key isn't passed to the helper")
+		request, err := helpers.ParseSignedRequest(signature)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1500003600), request.Expires)
+		keys = append(keys, request.Key()+" "+request.ContentHash)
+	}
+	assert.Equal(t, []string{
+		"POST /ci/api/v1/builds/10/artifacts/authorize?filename=artifacts.zip " + helpers.EmptyBodyHash,
+		"POST /ci/api/v1/builds/10/artifacts?expire_in=1+day " + helpers.UnsignedPayload,
+		"POST /ci/api/v1/builds/10/artifacts " + helpers.UnsignedPayload,
+	}, keys)
+
+	runner.SigningKey = ""
+	signatures, err = PresignArtifactsUpload(runner, 10, "artifacts.zip", "", now, time.Hour)
+	assert.NoError(t, err)
+	assert.Empty(t, signatures, "the requests aren't signed without the key")
+}
+
+func TestPresignProjectArtifactsDownload(t *testing.T) {
+	runner := common.RunnerCredentials{
+		URL:        "https://gitlab.example.com/ci",
+		SigningKey: "key",
+	}
+
+	signatures, err := PresignProjectArtifactsDownload(runner, "group/project", "master", "build", time.Now(), time.Hour)
+	require.NoError(t, err)
+	if assert.Len(t, signatures, 1) {
+		request, err := helpers.ParseSignedRequest(signatures[0])
+		require.NoError(t, err)
+		assert.Equal(t, "GET /api/v3/projects/group%2Fproject/builds/artifacts/master/download?job=build", request.Key())
+	}
+}
+
+func TestClientUsesPresignedRequest(t *testing.T) {
+	var request *http.Request
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request = r
+		w.WriteHeader(404)
+	}))
+	defer s.Close()
+
+	signatures, err := PresignArtifactsDownload(common.RunnerCredentials{URL: s.URL, SigningKey: "key"}, 10, time.Now(), time.Hour)
+	require.NoError(t, err)
+
+	c := GitLabClient{}
+	state := c.DownloadArtifacts(common.BuildCredentials{
+		ID:                10,
+		URL:               s.URL,
+		Token:             "token",
+		RequestSignatures: signatures,
+	}, "artifacts.zip")
+	assert.Equal(t, common.DownloadNotFound, state)
+
+	if assert.NotNil(t, request) {
+		signed, _ := helpers.ParseSignedRequest(signatures[0])
+		assert.Equal(t, signed.Signature, request.Header.Get(helpers.RequestSignatureHeader))
+		assert.Equal(t, helpers.EmptyBodyHash, request.Header.Get(helpers.RequestContentHashHeader))
+	}
+
+	state = c.DownloadArtifacts(common.BuildCredentials{
+		ID:                11,
+		URL:               s.URL,
+		Token:             "token",
+		RequestSignatures: signatures,
+	}, "artifacts.zip")
+	assert.Equal(t, common.DownloadNotFound, state)
+	assert.Empty(t, request.Header.Get(helpers.RequestSignatureHeader), "the signature is used only for its request")
+}
@@ -1,15 +1,27 @@
 package shells
 
 import (
+	"fmt"
 	"path"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"errors"
+	"github.com/Sirupsen/logrus"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers/archives"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/network"
 )
 
+// defaultArtifactsName is the name of the artifacts archive used by artifacts-uploader
+const defaultArtifactsName = "artifacts"
+
+// presignedRequestValidity is the time the requests of the helpers pre-signed by the runner are valid,
+// the script is generated when its stage starts, so it covers the requests sent during the stage
+const presignedRequestValidity = time.Hour
+
 type AbstractShell struct {
 }
 
@@ -28,7 +40,7 @@ func (b *AbstractShell) writeCdBuildDir(w ShellWriter, info common.ShellScriptIn
 
 func (b *AbstractShell) writeExports(w ShellWriter, info common.ShellScriptInfo) {
 	for _, variable := range info.Build.GetAllVariables() {
-		w.Variable(variable)
+		w.Variable(info.Build.MaskDryRunVariable(variable))
 	}
 }
 
@@ -44,16 +56,53 @@ func (b *AbstractShell) writeTLSCAInfo(w ShellWriter, build *common.Build, key s
 	}
 }
 
+func (b *AbstractShell) writeProxyInfo(w ShellWriter, build *common.Build) {
+	for _, variable := range getProxyVariables(build) {
+		w.Variable(variable)
+	}
+}
+
+// writeCACertificatesInfo exports the certificates trusted by the build,
+// unless the build or the runner `environment` defines its own SSL_CERT_FILE
+func (b *AbstractShell) writeCACertificatesInfo(w ShellWriter, build *common.Build) {
+	if build.CACertificates == "" || build.GetAllVariables().Get("SSL_CERT_FILE") != "" {
+		return
+	}
+
+	w.Variable(common.BuildVariable{
+		Key:      "SSL_CERT_FILE",
+		Value:    build.CACertificates,
+		Public:   true,
+		Internal: true,
+		File:     true,
+	})
+}
+
+func (b *AbstractShell) writeCacheTLSCAInfo(w ShellWriter, build *common.Build) {
+	if caChain := getCacheTLSCAChain(build); caChain != "" {
+		w.Variable(common.BuildVariable{
+			Key:      "CI_CACHE_TLS_CA_FILE",
+			Value:    caChain,
+			Public:   true,
+			Internal: true,
+			File:     true,
+		})
+	}
+}
+
 func (b *AbstractShell) writeCloneCmd(w ShellWriter, build *common.Build, projectDir string) {
+	credentials, _ := getGitCredentials(build)
+
 	w.RmDir(projectDir)
 	if depth := build.GetGitDepth(); depth != "" {
 		w.Notice("Cloning repository for %s with git depth set to %s...", build.RefName, depth)
-		w.Command("git", "clone", build.RepoURL, projectDir, "--depth", depth, "--branch", build.RefName)
+		w.Command("git", credentials.gitArgs("clone", credentials.repoURL, projectDir, "--depth", depth, "--branch", build.RefName)...)
 	} else {
 		w.Notice("Cloning repository...")
-		w.Command("git", "clone", build.RepoURL, projectDir)
+		w.Command("git", credentials.gitArgs("clone", credentials.repoURL, projectDir)...)
 	}
 	w.Cd(projectDir)
+	credentials.writeConfig(w)
 }
 
 func (b *AbstractShell) writeFetchCmd(w ShellWriter, build *common.Build, projectDir string, gitDir string) {
@@ -68,7 +117,10 @@ func (b *AbstractShell) writeFetchCmd(w ShellWriter, build *common.Build, projec
 	w.Cd(projectDir)
 	w.Command("git", "clean", "-ffdx")
 	w.Command("git", "reset", "--hard")
-	w.Command("git", "remote", "set-url", "origin", build.RepoURL)
+	// this also removes the token stored in .git/config by the previous builds
+	credentials, _ := getGitCredentials(build)
+	w.Command("git", "remote", "set-url", "origin", credentials.repoURL)
+	credentials.writeConfig(w)
 	if depth != "" {
 		var refspec string
 		if build.Tag {
@@ -92,15 +144,48 @@ func (b *AbstractShell) writeCheckoutCmd(w ShellWriter, build *common.Build) {
 	w.Command("git", "checkout", "-q", build.Sha)
 }
 
+// validateSyntax checks if the syntax of the script is checked before it's executed,
+// only the scripts containing the commands of the user can have syntax errors
+func (b *AbstractShell) validateSyntax(scriptType common.ShellScriptType, info common.ShellScriptInfo) bool {
+	if !info.Build.Runner.ValidateScripts {
+		return false
+	}
+	return scriptType == common.ShellBuildScript || scriptType == common.ShellAfterScript
+}
+
 func (b *AbstractShell) cacheFile(build *common.Build, userKey string) (key, file string) {
+	return b.cacheFileForRef(build, userKey, build.RefName)
+}
+
+// cacheFallbackFile is the cache of the branch configured for the runner, used when the cache of the build is missing
+func (b *AbstractShell) cacheFallbackFile(build *common.Build, userKey string) (key, file string) {
+	if build.Runner.Cache == nil {
+		return
+	}
+
+	refName := build.Runner.Cache.FallbackRef
+	if refName == "" || build.RefName == refName {
+		return
+	}
+
+	key, file = b.cacheFileForRef(build, userKey, refName)
+	if buildKey, _ := b.cacheFile(build, userKey); key == buildKey {
+		return "", ""
+	}
+	return
+}
+
+func (b *AbstractShell) cacheFileForRef(build *common.Build, userKey, refName string) (key, file string) {
 	if build.CacheDir == "" {
 		return
 	}
 
 	// Deduce cache key
-	key = path.Join(build.Name, build.RefName)
+	key = path.Join(build.Name, refName)
 	if userKey != "" {
-		key = build.GetAllVariables().ExpandValue(userKey)
+		variables := append(common.BuildVariables{}, build.GetAllVariables()...)
+		variables = append(variables, common.BuildVariable{Key: "CI_BUILD_REF_NAME", Value: refName})
+		key = variables.ExpandValue(userKey)
 	}
 
 	// Ignore cache without the key
@@ -108,7 +193,7 @@ func (b *AbstractShell) cacheFile(build *common.Build, userKey string) (key, fil
 		return
 	}
 
-	file = path.Join(build.CacheDir, key, "cache.zip")
+	file = path.Join(build.CacheDir, key, getCacheFormat(build).FileName())
 	file, err := filepath.Rel(build.BuildDir, file)
 	if err != nil {
 		return "", ""
@@ -121,12 +206,60 @@ func (o *archivingOptions) CommandArguments() (args []string) {
 		args = append(args, "--path", path)
 	}
 
+	for _, exclude := range o.Exclude {
+		args = append(args, "--exclude", exclude)
+	}
+
 	if o.Untracked {
 		args = append(args, "--untracked")
 	}
+
+	if o.Reproducible {
+		args = append(args, "--reproducible")
+	}
 	return
 }
 
+// The variables of the build changing how the helpers archive and transfer the files,
+// eg. to find out why archiving takes so long
+const (
+	archiverVerboseVariable          = "ARCHIVER_VERBOSE"
+	archiverCompressionLevelVariable = "ARCHIVER_COMPRESSION_LEVEL"
+	archiverProgressIntervalVariable = "ARCHIVER_PROGRESS_INTERVAL"
+)
+
+// getTransferArguments returns the arguments of the helpers downloading or uploading the files,
+// the invalid interval is ignored, so it doesn't fail the helper
+func getTransferArguments(w ShellWriter, build *common.Build) (args []string) {
+	interval := build.GetAllVariables().Get(archiverProgressIntervalVariable)
+	if interval == "" {
+		return
+	}
+
+	if duration, err := time.ParseDuration(interval); err != nil || duration < 0 {
+		w.Warning("Invalid %s: %s, it has to be a duration, eg. 1s, ignoring", archiverProgressIntervalVariable, interval)
+		return
+	}
+	return []string{"--progress-interval", interval}
+}
+
+// getArchiverArguments returns the arguments of the helpers creating the archives,
+// the unknown compression level is ignored, so the archive is created with the default one
+func getArchiverArguments(w ShellWriter, build *common.Build) (args []string) {
+	variables := build.GetAllVariables()
+	if verbose, _ := strconv.ParseBool(variables.Get(archiverVerboseVariable)); verbose {
+		args = append(args, "--verbose")
+	}
+	if level := variables.Get(archiverCompressionLevelVariable); level != "" {
+		if _, err := archives.CompressionLevel(level).Get(); err != nil {
+			w.Warning("Invalid %s: %s, ignoring", archiverCompressionLevelVariable, err)
+		} else {
+			args = append(args, "--compression-level", level)
+		}
+	}
+	return append(args, getTransferArguments(w, build)...)
+}
+
 func (b *AbstractShell) guardRunnerCommand(w ShellWriter, runnerCommand string, action string, f func()) {
 	if runnerCommand == "" {
 		w.Warning("%s is not supported by this executor.", action)
@@ -160,29 +293,100 @@ func (b *AbstractShell) cacheExtractor(w ShellWriter, options *archivingOptions,
 		"cache-extractor",
 		"--file", cacheFile,
 	}
+	args = append(args, getTransferArguments(w, info.Build)...)
 
 	// Generate cache download address
 	if url := getCacheDownloadURL(info.Build, cacheKey); url != nil {
 		args = append(args, "--url", url.String())
+		args = append(args, getCacheClientArguments(info.Build)...)
+		args = append(args, getCacheRequestArguments(info.Build, "--header", "GET", url)...)
+	}
+
+	// Fall back to the cache of the default branch
+	if options.FallbackEnabled() {
+		if fallbackKey, fallbackFile := b.cacheFallbackFile(info.Build, options.Key); fallbackKey != "" {
+			args = append(args, "--fallback-file", fallbackFile)
+			if url := getCacheDownloadURL(info.Build, fallbackKey); url != nil {
+				args = append(args, "--fallback-url", url.String())
+				args = append(args, getCacheRequestArguments(info.Build, "--fallback-header", "GET", url)...)
+			}
+		}
 	}
 
 	// Execute archive command
 	b.guardRunnerCommand(w, info.RunnerCommand, "Extracting cache", func() {
+		b.writeCacheTLSCAInfo(w, info.Build)
 		w.Notice("Checking cache for %s...", cacheKey)
 		w.Command(info.RunnerCommand, args...)
 	})
 }
 
-func (b *AbstractShell) downloadArtifacts(w ShellWriter, build *common.BuildInfo, info common.ShellScriptInfo) {
+// projectSubdirectory cleans the directory relative to the project for both path separators,
+// as the build can run on the other system than the runner, eg. `..\x` and `C:\x` are outside of it on Windows
+func projectSubdirectory(directory string) (string, bool) {
+	directory = strings.Replace(directory, "\\", "/", -1)
+	if len(directory) >= 2 && directory[1] == ':' {
+		return "", false
+	}
+
+	directory = path.Clean(directory)
+	if path.IsAbs(directory) || directory == ".." || strings.HasPrefix(directory, "../") {
+		return "", false
+	}
+	return directory, true
+}
+
+// extractionArgs returns the arguments of artifacts-downloader limiting the extracted files
+func (b *AbstractShell) extractionArgs(options extractionOptions, info common.ShellScriptInfo) (args []string, err error) {
+	variables := info.Build.GetAllVariables()
+	for _, pattern := range options.Paths {
+		args = append(args, "--path", variables.ExpandValue(pattern))
+	}
+
+	if options.Directory != "" {
+		directory, ok := projectSubdirectory(variables.ExpandValue(options.Directory))
+		if !ok {
+			return nil, fmt.Errorf("the directory %q is outside of the project", options.Directory)
+		}
+		args = append(args, "--directory", directory)
+	}
+	return
+}
+
+// getRequestSignatureArguments returns the arguments of artifacts helpers with their requests to GitLab
+// pre-signed by the runner, the signing key and the static headers aren't passed to the build
+func getRequestSignatureArguments(signatures []string, err error) (args []string) {
+	if err != nil {
+		logrus.Warningln("Failed to sign the requests of the artifacts:", err)
+		return nil
+	}
+
+	for _, signature := range signatures {
+		args = append(args, "--request-signature", signature)
+	}
+	return
+}
+
+func (b *AbstractShell) downloadArtifacts(w ShellWriter, build *common.BuildInfo, options extractionOptions, info common.ShellScriptInfo) {
+	extraction, err := b.extractionArgs(options, info)
+	if err != nil {
+		w.Warning("Artifacts for %s (%d) can't be downloaded: %s, skipping", build.Name, build.ID, err)
+		return
+	}
+
 	args := []string{
 		"artifacts-downloader",
 		"--url",
 		info.Build.Runner.URL,
 		"--token",
-		build.Token,
+		info.Build.MaskDryRunValue(build.Token),
 		"--id",
 		strconv.Itoa(build.ID),
 	}
+	args = append(args, getRequestSignatureArguments(network.PresignArtifactsDownload(
+		info.Build.Runner.RunnerCredentials, build.ID, time.Now(), presignedRequestValidity))...)
+	args = append(args, extraction...)
+	args = append(args, getTransferArguments(w, info.Build)...)
 
 	w.Notice("Downloading artifacts for %s (%d)...", build.Name, build.ID)
 	w.Command(info.RunnerCommand, args...)
@@ -201,20 +405,94 @@ func (b *AbstractShell) buildArtifacts(dependencies *dependencies, info common.S
 	return
 }
 
+// dependencyDefaultRefName is the branch, which artifacts are downloaded when the dependency doesn't specify it
+const dependencyDefaultRefName = "master"
+
+func (b *AbstractShell) downloadProjectArtifacts(w ShellWriter, dependency projectDependency, info common.ShellScriptInfo) {
+	variables := info.Build.GetAllVariables()
+	project := variables.ExpandValue(dependency.Project)
+	job := variables.ExpandValue(dependency.Job)
+
+	ref := variables.ExpandValue(dependency.Ref)
+	if ref == "" {
+		ref = dependencyDefaultRefName
+	}
+
+	// The token of the build can't access other projects. The private token is read
+	// by the helper from the exported variable, so it isn't written to the script
+	tokenVariable, ok := dependency.TokenVariable()
+	if !ok {
+		w.Warning("The token to download artifacts for %s of %s has to be a variable, eg. $PRIVATE_TOKEN, skipping", job, project)
+		return
+	}
+	if variables.Get(tokenVariable) == "" {
+		w.Warning("Missing token to download artifacts for %s of %s, skipping", job, project)
+		return
+	}
+
+	extraction, err := b.extractionArgs(dependency.extractionOptions, info)
+	if err != nil {
+		w.Warning("Artifacts for %s of %s can't be downloaded: %s, skipping", job, project, err)
+		return
+	}
+
+	args := []string{
+		"artifacts-downloader",
+		"--url",
+		info.Build.Runner.URL,
+		"--token-variable",
+		tokenVariable,
+		"--project",
+		project,
+		"--ref",
+		ref,
+		"--job",
+		job,
+	}
+	args = append(args, getRequestSignatureArguments(network.PresignProjectArtifactsDownload(
+		info.Build.Runner.RunnerCredentials, project, ref, job, time.Now(), presignedRequestValidity))...)
+	args = append(args, extraction...)
+	args = append(args, getTransferArguments(w, info.Build)...)
+
+	w.Notice("Downloading artifacts for %s of %s (%s)...", job, project, ref)
+	w.Command(info.RunnerCommand, args...)
+}
+
+func (b *AbstractShell) hasArtifactsToDownload(dependencies *dependencies, info common.ShellScriptInfo) bool {
+	if dependencies != nil && len(dependencies.Projects) > 0 {
+		return true
+	}
+	return len(b.buildArtifacts(dependencies, info)) > 0
+}
+
 func (b *AbstractShell) downloadAllArtifacts(w ShellWriter, dependencies *dependencies, info common.ShellScriptInfo) {
-	otherBuilds := b.buildArtifacts(dependencies, info)
-	if len(otherBuilds) == 0 {
+	if !b.hasArtifactsToDownload(dependencies, info) {
 		return
 	}
 
+	otherBuilds := b.buildArtifacts(dependencies, info)
+
+	var otherProjects []projectDependency
+	if dependencies != nil {
+		otherProjects = dependencies.Projects
+	}
+
 	b.guardRunnerCommand(w, info.RunnerCommand, "Artifacts downloading", func() {
 		for _, otherBuild := range otherBuilds {
-			b.downloadArtifacts(w, &otherBuild, info)
+			b.downloadArtifacts(w, &otherBuild, dependencies.ExtractionFor(otherBuild.Name), info)
+		}
+		for _, otherProject := range otherProjects {
+			b.downloadProjectArtifacts(w, otherProject, info)
 		}
 	})
 }
 
-func (b *AbstractShell) writePrepareScript(w ShellWriter, info common.ShellScriptInfo) (err error) {
+func (b *AbstractShell) writeGetSourcesScript(w ShellWriter, info common.ShellScriptInfo) (err error) {
+	// Start with the empty temporary directory, even if the previous build was interrupted.
+	// It's recreated before the exports, as they write the file variables to it
+	w.RmDir(info.Build.TmpProjectDir())
+	w.MkDir(info.Build.TmpProjectDir())
+
 	b.writeExports(w, info)
 
 	build := info.Build
@@ -223,6 +501,9 @@ func (b *AbstractShell) writePrepareScript(w ShellWriter, info common.ShellScrip
 
 	b.writeTLSCAInfo(w, info.Build, "GIT_SSL_CAINFO")
 	b.writeTLSCAInfo(w, info.Build, "CI_SERVER_TLS_CA_FILE")
+	b.writeProxyInfo(w, info.Build)
+
+	b.writeCommands(w, info.Build.Runner.PreCloneScript)
 
 	w.Command("git", "config", "--global", "fetch.recurseSubmodules", "false")
 	switch info.Build.GetGitStrategy() {
@@ -237,7 +518,10 @@ func (b *AbstractShell) writePrepareScript(w ShellWriter, info common.ShellScrip
 	}
 
 	b.writeCheckoutCmd(w, build)
+	return nil
+}
 
+func (b *AbstractShell) writeRestoreCacheScript(w ShellWriter, info common.ShellScriptInfo) (err error) {
 	// Parse options
 	var options shellOptions
 	err = info.Build.Options.Decode(&options)
@@ -245,31 +529,75 @@ func (b *AbstractShell) writePrepareScript(w ShellWriter, info common.ShellScrip
 		return
 	}
 
+	// The stage without the cache is skipped
+	if options.Cache == nil || len(options.Cache.CommandArguments()) == 0 {
+		return
+	}
+
+	b.writeExports(w, info)
+	b.writeCdBuildDir(w, info)
+	b.writeTLSCAInfo(w, info.Build, "CI_SERVER_TLS_CA_FILE")
+	b.writeProxyInfo(w, info.Build)
+
 	// Try to restore from main cache, if not found cache for master
 	b.cacheExtractor(w, options.Cache, info)
-
-	// Process all artifacts
-	b.downloadAllArtifacts(w, options.Dependencies, info)
 	return nil
 }
 
-func (b *AbstractShell) writeBuildScript(w ShellWriter, info common.ShellScriptInfo) (err error) {
+func (b *AbstractShell) writeDownloadArtifactsScript(w ShellWriter, info common.ShellScriptInfo) (err error) {
+	// Parse options
+	var options shellOptions
+	err = info.Build.Options.Decode(&options)
+	if err != nil {
+		return
+	}
+
+	// The stage without the dependencies is skipped
+	if !b.hasArtifactsToDownload(options.Dependencies, info) {
+		return
+	}
+
 	b.writeExports(w, info)
 	b.writeCdBuildDir(w, info)
+	b.writeTLSCAInfo(w, info.Build, "CI_SERVER_TLS_CA_FILE")
+	b.writeProxyInfo(w, info.Build)
 
-	commands := info.Build.Commands
-	commands = strings.TrimSpace(commands)
-	for _, command := range strings.Split(commands, "\n") {
+	// Process all artifacts
+	b.downloadAllArtifacts(w, options.Dependencies, info)
+	return nil
+}
+
+// writeCommandEntries writes each of the commands as a whole, so the multi-line
+// entry of after_script isn't split into the separate commands
+func (b *AbstractShell) writeCommandEntries(w ShellWriter, commands []string) {
+	for _, command := range commands {
 		command = strings.TrimSpace(command)
 		if command != "" {
 			w.Notice("$ %s", command)
 		} else {
 			w.EmptyLine()
 		}
-		w.Line(command)
+		w.MultilineCommand(command)
 		w.CheckForErrors()
 	}
+}
+
+// writeCommands writes the commands joined by the new lines, like the pre_clone_script
+// or the commands of the build, GitLab sends the entries of before_script and script joined
+func (b *AbstractShell) writeCommands(w ShellWriter, commands string) {
+	commands = strings.TrimSpace(commands)
+	if commands == "" {
+		return
+	}
+
+	b.writeCommandEntries(w, strings.Split(commands, "\n"))
+}
 
+func (b *AbstractShell) writeBuildScript(w ShellWriter, info common.ShellScriptInfo) (err error) {
+	b.writeExports(w, info)
+	b.writeCACertificatesInfo(w, info.Build)
+	b.writeCdBuildDir(w, info)
+	b.writeCommands(w, info.Build.Commands)
 	return nil
 }
 
@@ -287,22 +615,32 @@ func (b *AbstractShell) cacheArchiver(w ShellWriter, options *archivingOptions,
 	args := []string{
 		"cache-archiver",
 		"--file", cacheFile,
+		"--key", cacheKey,
+		"--runner", info.Build.Runner.ShortDescription(),
+	}
+	if format := getCacheFormat(info.Build); format != common.CacheFormatZip {
+		args = append(args, "--format", string(format))
 	}
 
-	// Create list of files to archive
-	archiverArgs := options.CommandArguments()
+	// Create list of files to archive, with the build variables expanded in the paths
+	archiverArgs := options.Expand(info.Build.GetAllVariables().ExpandValue).CommandArguments()
 	if len(archiverArgs) == 0 {
 		// Skip creating archive
 		return
 	}
 	args = append(args, archiverArgs...)
+	args = append(args, getArchiverArguments(w, info.Build)...)
 
 	// Generate cache upload address
 	if url := getCacheUploadURL(info.Build, cacheKey); url != nil {
 		args = append(args, "--url", url.String())
+		args = append(args, getCacheClientArguments(info.Build)...)
+		args = append(args, getCacheRequestArguments(info.Build, "--header", "PUT", url)...)
 	}
 
 	b.guardRunnerCommand(w, info.RunnerCommand, "Creating cache", func() {
+		b.writeCacheTLSCAInfo(w, info.Build)
+
 		// Execute archive command
 		w.Notice("Creating cache %s...", cacheKey)
 		w.Command(info.RunnerCommand, args...)
@@ -322,11 +660,15 @@ func (b *AbstractShell) uploadArtifacts(w ShellWriter, options *archivingOptions
 		"--url",
 		info.Build.Runner.URL,
 		"--token",
-		info.Build.Token,
+		info.Build.MaskDryRunValue(info.Build.Token),
 		"--id",
 		strconv.Itoa(info.Build.ID),
 	}
 
+	// Expand the build variables in the name and paths
+	variables := info.Build.GetAllVariables()
+	options = options.Expand(variables.ExpandValue)
+
 	// Create list of files to archive
 	archiverArgs := options.CommandArguments()
 	if len(archiverArgs) == 0 {
@@ -334,17 +676,29 @@ func (b *AbstractShell) uploadArtifacts(w ShellWriter, options *archivingOptions
 		return
 	}
 	args = append(args, archiverArgs...)
+	args = append(args, getArchiverArguments(w, info.Build)...)
 
 	// Get artifacts:name
+	artifactsName := defaultArtifactsName
 	if name, ok := info.Build.Options.GetString("artifacts", "name"); ok && name != "" {
-		args = append(args, "--name", name)
+		artifactsName = variables.ExpandValue(name)
+		args = append(args, "--name", artifactsName)
 	}
 
 	// Get artifacts:expire_in
-	if expireIn, ok := info.Build.Options.GetString("artifacts", "expire_in"); ok && expireIn != "" {
+	expireIn, _ := info.Build.Options.GetString("artifacts", "expire_in")
+	if expireIn != "" {
 		args = append(args, "--expire-in", expireIn)
 	}
 
+	// The runner detected that the coordinator doesn't offer the direct uploads
+	if info.Build.SkipArtifactsDirectUpload {
+		args = append(args, "--no-direct-upload")
+	}
+
+	args = append(args, getRequestSignatureArguments(network.PresignArtifactsUpload(
+		info.Build.Runner.RunnerCredentials, info.Build.ID, path.Base(artifactsName)+".zip", expireIn, time.Now(), presignedRequestValidity))...)
+
 	b.guardRunnerCommand(w, info.RunnerCommand, "Uploading artifacts", func() {
 		w.Notice("Uploading artifacts...")
 		w.Command(info.RunnerCommand, args...)
@@ -365,20 +719,11 @@ func (b *AbstractShell) writeAfterScript(w ShellWriter, info common.ShellScriptI
 	}
 
 	b.writeExports(w, info)
+	b.writeCACertificatesInfo(w, info.Build)
 	b.writeCdBuildDir(w, info)
 
 	w.Notice("Running after script...")
-
-	for _, command := range shellOptions.AfterScript {
-		command = strings.TrimSpace(command)
-		if command != "" {
-			w.Notice("$ %s", command)
-		} else {
-			w.EmptyLine()
-		}
-		w.Line(command)
-		w.CheckForErrors()
-	}
+	b.writeCommandEntries(w, shellOptions.AfterScript)
 
 	return nil
 }
@@ -394,6 +739,7 @@ func (b *AbstractShell) writeArchiveCacheScript(w ShellWriter, info common.Shell
 	b.writeExports(w, info)
 	b.writeCdBuildDir(w, info)
 	b.writeTLSCAInfo(w, info.Build, "CI_SERVER_TLS_CA_FILE")
+	b.writeProxyInfo(w, info.Build)
 
 	// Find cached files and archive them
 	b.cacheArchiver(w, options.Cache, info)
@@ -411,16 +757,32 @@ func (b *AbstractShell) writeUploadArtifactsScript(w ShellWriter, info common.Sh
 	b.writeExports(w, info)
 	b.writeCdBuildDir(w, info)
 	b.writeTLSCAInfo(w, info.Build, "CI_SERVER_TLS_CA_FILE")
+	b.writeProxyInfo(w, info.Build)
 
 	// Upload artifacts
 	b.uploadArtifacts(w, options.Artifacts, info)
 	return
 }
 
+func (b *AbstractShell) writeCleanupScript(w ShellWriter, info common.ShellScriptInfo) (err error) {
+	w.RmDir(info.Build.TmpProjectDir())
+
+	// the credential helper of the build isn't left in the repository
+	credentials, _ := getGitCredentials(info.Build)
+	credentials.removeConfig(w, info.Build.FullProjectDir())
+	return nil
+}
+
 func (b *AbstractShell) writeScript(w ShellWriter, scriptType common.ShellScriptType, info common.ShellScriptInfo) (err error) {
 	switch scriptType {
-	case common.ShellPrepareScript:
-		return b.writePrepareScript(w, info)
+	case common.ShellGetSources:
+		return b.writeGetSourcesScript(w, info)
+
+	case common.ShellRestoreCache:
+		return b.writeRestoreCacheScript(w, info)
+
+	case common.ShellDownloadArtifacts:
+		return b.writeDownloadArtifactsScript(w, info)
 
 	case common.ShellBuildScript:
 		return b.writeBuildScript(w, info)
@@ -434,6 +796,9 @@ func (b *AbstractShell) writeScript(w ShellWriter, scriptType common.ShellScript
 	case common.ShellUploadArtifacts:
 		return b.writeUploadArtifactsScript(w, info)
 
+	case common.ShellCleanupScript:
+		return b.writeCleanupScript(w, info)
+
 	default:
 		return errors.New("Not supported script type: " + string(scriptType))
 	}
@@ -0,0 +1,607 @@
+package shells
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func newCacheFallbackBuild(refName string) *common.Build {
+	return &common.Build{
+		GetBuildResponse: common.GetBuildResponse{
+			Name:    "test",
+			RefName: refName,
+		},
+		BuildDir: "/builds/project",
+		CacheDir: "/cache/project",
+		Runner: &common.RunnerConfig{
+			RunnerSettings: common.RunnerSettings{
+				Cache: &common.CacheConfig{
+					FallbackRef: "master",
+				},
+			},
+		},
+	}
+}
+
+func TestCacheFallbackFile(t *testing.T) {
+	shell := AbstractShell{}
+
+	key, file := shell.cacheFallbackFile(newCacheFallbackBuild("feature"), "")
+	assert.Equal(t, "test/master", key)
+	assert.Equal(t, "../../cache/project/test/master/cache.zip", file)
+
+	key, _ = shell.cacheFallbackFile(newCacheFallbackBuild("feature"), "$CI_BUILD_REF_NAME-key")
+	assert.Equal(t, "master-key", key)
+
+	key, _ = shell.cacheFallbackFile(newCacheFallbackBuild("master"), "")
+	assert.Empty(t, key, "the default branch has no fallback")
+
+	key, _ = shell.cacheFallbackFile(newCacheFallbackBuild("feature"), "shared-key")
+	assert.Empty(t, key, "the key doesn't depend on the branch")
+
+	build := newCacheFallbackBuild("feature")
+	build.Runner.Cache.FallbackRef = "stable"
+	key, _ = shell.cacheFallbackFile(build, "")
+	assert.Equal(t, "test/stable", key)
+}
+
+func TestCacheFallbackIsDisabledByDefault(t *testing.T) {
+	shell := AbstractShell{}
+
+	build := newCacheFallbackBuild("feature")
+	build.Runner.Cache = nil
+	key, file := shell.cacheFallbackFile(build, "")
+	assert.Empty(t, key)
+	assert.Empty(t, file)
+
+	build.Runner.Cache = &common.CacheConfig{}
+	key, _ = shell.cacheFallbackFile(build, "")
+	assert.Empty(t, key)
+}
+
+func TestArchivingOptionsFallbackEnabled(t *testing.T) {
+	disabled := false
+	assert.True(t, (&archivingOptions{}).FallbackEnabled())
+	assert.False(t, (&archivingOptions{Fallback: &disabled}).FallbackEnabled())
+}
+
+func TestUploadArtifactsExpandsVariables(t *testing.T) {
+	build := &common.Build{
+		GetBuildResponse: common.GetBuildResponse{
+			RefName: "feature",
+			Options: common.BuildOptions{
+				"artifacts": map[string]interface{}{
+					"name": "binaries-$CI_BUILD_REF_NAME",
+				},
+			},
+		},
+		Runner: &common.RunnerConfig{
+			RunnerCredentials: common.RunnerCredentials{URL: "https://gitlab.example.com/ci"},
+		},
+	}
+	options := &archivingOptions{
+		Paths:   []string{"out/$CI_BUILD_REF_NAME"},
+		Exclude: []string{"out/$CI_BUILD_ID/tmp"},
+	}
+
+	w := &BashWriter{}
+	shell := AbstractShell{}
+	shell.uploadArtifacts(w, options, common.ShellScriptInfo{
+		Build:         build,
+		RunnerCommand: "gitlab-runner",
+	})
+
+	script := w.String()
+	assert.True(t, strings.Contains(script, `"--path" "out/feature"`), script)
+	assert.True(t, strings.Contains(script, `"--exclude" "out/0/tmp"`), script)
+	assert.True(t, strings.Contains(script, `"--name" "binaries-feature"`), script)
+	assert.Equal(t, "out/$CI_BUILD_REF_NAME", options.Paths[0], "options are not modified")
+}
+
+func TestCacheArchiverExpandsVariables(t *testing.T) {
+	options := &archivingOptions{
+		Paths: []string{"vendor/$CI_BUILD_REF_NAME"},
+	}
+
+	w := &BashWriter{}
+	shell := AbstractShell{}
+	shell.cacheArchiver(w, options, common.ShellScriptInfo{
+		Build: &common.Build{
+			GetBuildResponse: common.GetBuildResponse{
+				Name:    "test",
+				RefName: "feature",
+			},
+			BuildDir: "/builds/project",
+			CacheDir: "/cache/project",
+			Runner:   &common.RunnerConfig{},
+		},
+		RunnerCommand: "gitlab-runner",
+	})
+
+	script := w.String()
+	assert.True(t, strings.Contains(script, `"--path" "vendor/feature"`), script)
+}
+
+func TestDownloadProjectArtifacts(t *testing.T) {
+	build := &common.Build{
+		GetBuildResponse: common.GetBuildResponse{
+			Variables: common.BuildVariables{
+				{Key: "DEPS_TOKEN", Value: "private-token"},
+			},
+			Options: common.BuildOptions{
+				"dependencies": []interface{}{
+					"build",
+					map[string]interface{}{
+						"project": "group/library",
+						"job":     "package",
+						"token":   "$DEPS_TOKEN",
+					},
+					map[string]interface{}{
+						"project": "group/other",
+						"job":     "package",
+					},
+					map[string]interface{}{
+						"project": "group/literal",
+						"job":     "package",
+						"token":   "private-token",
+					},
+				},
+			},
+		},
+		Runner: &common.RunnerConfig{
+			RunnerCredentials: common.RunnerCredentials{
+				URL: "https://gitlab.example.com/ci",
+			},
+		},
+	}
+
+	var deps dependencies
+	if !assert.NoError(t, build.Options.Decode(&deps, "dependencies")) {
+		return
+	}
+	assert.Equal(t, []string{"build"}, deps.Jobs)
+	assert.Equal(t, 3, len(deps.Projects))
+
+	w := &BashWriter{}
+	shell := AbstractShell{}
+	shell.downloadAllArtifacts(w, &deps, common.ShellScriptInfo{
+		Build:         build,
+		RunnerCommand: "gitlab-runner",
+	})
+
+	script := w.String()
+	assert.True(t, strings.Contains(script, `"--token-variable" "DEPS_TOKEN" "--project" "group/library" "--ref" "master" "--job" "package"`), script)
+	assert.False(t, strings.Contains(script, "private-token"), "the private token isn't written to the script: %s", script)
+	assert.False(t, strings.Contains(script, "group/other"+`"`), "dependency without token is skipped")
+	assert.False(t, strings.Contains(script, "group/literal"+`"`), "dependency with the literal token is skipped")
+}
+
+func TestProjectDependencyTokenVariable(t *testing.T) {
+	for token, expected := range map[string]string{
+		"$PRIVATE_TOKEN":   "PRIVATE_TOKEN",
+		"${PRIVATE_TOKEN}": "PRIVATE_TOKEN",
+		"private-token":    "",
+		"$TOKEN-suffix":    "",
+		"":                 "",
+	} {
+		dependency := projectDependency{Token: token}
+		variable, ok := dependency.TokenVariable()
+		assert.Equal(t, expected != "", ok, token)
+		assert.Equal(t, expected, variable, token)
+	}
+}
+
+func TestDependenciesRequireProjectAndJob(t *testing.T) {
+	options := common.BuildOptions{
+		"dependencies": []interface{}{
+			map[string]interface{}{"project": "group/library"},
+		},
+	}
+
+	var deps dependencies
+	assert.Error(t, options.Decode(&deps, "dependencies"))
+}
+
+func TestDownloadArtifactsExtractionOptions(t *testing.T) {
+	build := &common.Build{
+		GetBuildResponse: common.GetBuildResponse{
+			RefName: "feature",
+			DependsOnBuilds: []common.BuildInfo{
+				{ID: 1, Name: "build", Token: "token", Artifacts: &common.BuildArtifacts{Filename: "artifacts.zip"}},
+				{ID: 2, Name: "docs", Token: "token", Artifacts: &common.BuildArtifacts{Filename: "artifacts.zip"}},
+				{ID: 3, Name: "escape", Token: "token", Artifacts: &common.BuildArtifacts{Filename: "artifacts.zip"}},
+			},
+			Options: common.BuildOptions{
+				"dependencies": []interface{}{
+					map[string]interface{}{
+						"job":       "build",
+						"paths":     []interface{}{"dist/$CI_BUILD_REF_NAME/**"},
+						"directory": "vendor/build",
+					},
+					"docs",
+					map[string]interface{}{
+						"job":       "escape",
+						"directory": "../outside",
+					},
+				},
+			},
+		},
+		Runner: &common.RunnerConfig{
+			RunnerCredentials: common.RunnerCredentials{URL: "https://gitlab.example.com/ci"},
+		},
+	}
+
+	var deps dependencies
+	if !assert.NoError(t, build.Options.Decode(&deps, "dependencies")) {
+		return
+	}
+	assert.Equal(t, []string{"build", "docs", "escape"}, deps.Jobs)
+
+	w := &BashWriter{}
+	shell := AbstractShell{}
+	shell.downloadAllArtifacts(w, &deps, common.ShellScriptInfo{
+		Build:         build,
+		RunnerCommand: "gitlab-runner",
+	})
+
+	script := w.String()
+	assert.True(t, strings.Contains(script, `"--id" "1" "--path" "dist/feature/**" "--directory" "vendor/build"`), script)
+	assert.True(t, strings.Contains(script, `"--id" "2"`+"\n"), script)
+	assert.False(t, strings.Contains(script, `"--id" "3"`), "directory outside of the project is rejected")
+}
+
+func TestProjectSubdirectory(t *testing.T) {
+	for directory, expected := range map[string]string{
+		"vendor/build":  "vendor/build",
+		"vendor\\build": "vendor/build",
+		"./vendor/../x": "x",
+	} {
+		cleaned, ok := projectSubdirectory(directory)
+		assert.True(t, ok, directory)
+		assert.Equal(t, expected, cleaned, directory)
+	}
+
+	for _, directory := range []string{"..", "../x", "..\\x", "vendor\\..\\..\\x", "/x", "\\x", "\\\\server\\share", "C:\\x", "C:x", "c:/x"} {
+		_, ok := projectSubdirectory(directory)
+		assert.False(t, ok, directory)
+	}
+}
+
+func TestCacheArchiverTarGzFormat(t *testing.T) {
+	build := &common.Build{
+		GetBuildResponse: common.GetBuildResponse{
+			Name:    "test",
+			RefName: "feature",
+		},
+		BuildDir: "/builds/project",
+		CacheDir: "/cache/project",
+		Runner: &common.RunnerConfig{
+			RunnerSettings: common.RunnerSettings{
+				Cache: &common.CacheConfig{Format: common.CacheFormatTarGz},
+			},
+		},
+	}
+
+	shell := AbstractShell{}
+	_, file := shell.cacheFile(build, "")
+	assert.Equal(t, "../../cache/project/test/feature/cache.tar.gz", file)
+
+	w := &BashWriter{}
+	shell.cacheArchiver(w, &archivingOptions{Paths: []string{"vendor"}}, common.ShellScriptInfo{
+		Build:         build,
+		RunnerCommand: "gitlab-runner",
+	})
+	assert.True(t, strings.Contains(w.String(), `"--format" "tar.gz"`), w.String())
+
+	build.Runner.Cache.Format = "rar"
+	_, file = shell.cacheFile(build, "")
+	assert.Equal(t, "../../cache/project/test/feature/cache.zip", file, "unsupported format falls back to zip")
+}
+
+func TestBuildScriptExportsCACertificates(t *testing.T) {
+	build := &common.Build{
+		BuildDir: "/builds/project",
+		Runner:   &common.RunnerConfig{},
+	}
+	shell := AbstractShell{}
+	info := common.ShellScriptInfo{Build: build}
+
+	w := &BashWriter{}
+	assert.NoError(t, shell.writeBuildScript(w, info))
+	assert.False(t, strings.Contains(w.String(), "SSL_CERT_FILE"), "no certificates are set by the executor")
+
+	build.CACertificates = "-----BEGIN CERTIFICATE-----"
+	w = &BashWriter{}
+	assert.NoError(t, shell.writeBuildScript(w, info))
+	assert.True(t, strings.Contains(w.String(), "export SSL_CERT_FILE="), w.String())
+
+	build.Variables = common.BuildVariables{{Key: "SSL_CERT_FILE", Value: "/etc/custom.pem"}}
+	w = &BashWriter{}
+	assert.NoError(t, shell.writeBuildScript(w, info))
+	assert.Equal(t, 1, strings.Count(w.String(), "SSL_CERT_FILE"), "the variable of the build takes precedence")
+}
+
+func TestAfterScriptWritesWholeEntries(t *testing.T) {
+	build := &common.Build{
+		GetBuildResponse: common.GetBuildResponse{
+			Commands: "IF EXIST a (\n  echo a\n)\necho b",
+			Options: common.BuildOptions{
+				"after_script": []interface{}{"echo b", "IF EXIST a (\n  echo a\n)"},
+			},
+		},
+		BuildDir: "/builds/project",
+		Runner:   &common.RunnerConfig{},
+	}
+	shell := AbstractShell{}
+	info := common.ShellScriptInfo{Build: build}
+
+	w := &CmdWriter{}
+	assert.NoError(t, shell.writeBuildScript(w, info))
+	assert.Equal(t, 1+4, strings.Count(w.String(), "IF %errorlevel%"), "the joined commands are checked after the cd and each of the lines")
+
+	w = &CmdWriter{}
+	assert.NoError(t, shell.writeAfterScript(w, info))
+	assert.True(t, strings.Contains(w.String(), "IF EXIST a (\r\n  echo a\r\n)\r\nIF %errorlevel%"), w.String())
+	assert.Equal(t, 1+2, strings.Count(w.String(), "IF %errorlevel%"), "the errors are checked after the cd and each of the entries")
+}
+
+func TestDryRunScriptMasksSecrets(t *testing.T) {
+	build := &common.Build{
+		GetBuildResponse: common.GetBuildResponse{
+			Token: "build-token",
+			Variables: common.BuildVariables{
+				{Key: "SHORT", Value: "secret"},
+				{Key: "QUOTED", Value: "it's a \"secret\"\n"},
+				{Key: "PUBLIC", Value: "public-value", Public: true},
+			},
+		},
+		BuildDir: "/builds/project",
+		Runner: &common.RunnerConfig{
+			RunnerCredentials: common.RunnerCredentials{
+				URL: "https://gitlab.example.com/",
+			},
+		},
+		DryRun: true,
+	}
+	shell := AbstractShell{}
+	info := common.ShellScriptInfo{Build: build}
+
+	w := &BashWriter{}
+	assert.NoError(t, shell.writeBuildScript(w, info))
+	shell.uploadArtifacts(w, &archivingOptions{Paths: []string{"out/"}}, info)
+
+	script := w.String()
+	assert.False(t, strings.Contains(script, "secret"), "the secrets are masked before they are escaped: %s", script)
+	assert.False(t, strings.Contains(script, "build-token"), script)
+	assert.Equal(t, 3, strings.Count(script, common.DryRunMask), script)
+	assert.True(t, strings.Contains(script, "public-value"), script)
+
+	build.DryRun = false
+	w = &BashWriter{}
+	assert.NoError(t, shell.writeBuildScript(w, info))
+	assert.True(t, strings.Contains(w.String(), "SHORT=$'secret'"), w.String())
+}
+
+func TestGetSourcesRecreatesTmpDirBeforeExports(t *testing.T) {
+	build := &common.Build{
+		GetBuildResponse: common.GetBuildResponse{
+			Sha:       "1234567890abcdef",
+			Variables: common.BuildVariables{{Key: "KEY_FILE", Value: "secret", File: true}},
+		},
+		BuildDir: "/builds/project",
+		Runner:   &common.RunnerConfig{},
+	}
+	shell := AbstractShell{}
+	info := common.ShellScriptInfo{Build: build}
+
+	w := &BashWriter{TemporaryPath: build.TmpProjectDir()}
+	assert.NoError(t, shell.writeGetSourcesScript(w, info))
+
+	script := w.String()
+	removed := strings.Index(script, "$'rm'")
+	written := strings.Index(script, "printf '%s'")
+	assert.True(t, removed >= 0 && written > removed, "the file variables are written to the recreated directory: %s", script)
+}
+
+func TestArchiverVariables(t *testing.T) {
+	build := &common.Build{
+		GetBuildResponse: common.GetBuildResponse{
+			Name:    "test",
+			RefName: "feature",
+			Variables: common.BuildVariables{
+				{Key: "ARCHIVER_VERBOSE", Value: "true"},
+				{Key: "ARCHIVER_COMPRESSION_LEVEL", Value: "fastest"},
+				{Key: "ARCHIVER_PROGRESS_INTERVAL", Value: "1s"},
+			},
+		},
+		BuildDir: "/builds/project",
+		CacheDir: "/cache/project",
+		Runner: &common.RunnerConfig{
+			RunnerCredentials: common.RunnerCredentials{URL: "https://gitlab.example.com/ci"},
+		},
+	}
+	options := &archivingOptions{Paths: []string{"vendor"}}
+	info := common.ShellScriptInfo{
+		Build:         build,
+		RunnerCommand: "gitlab-runner",
+	}
+	shell := AbstractShell{}
+
+	w := &BashWriter{}
+	shell.cacheArchiver(w, options, info)
+	assert.True(t, strings.Contains(w.String(), `"--verbose" "--compression-level" "fastest" "--progress-interval" "1s"`), w.String())
+
+	w = &BashWriter{}
+	shell.uploadArtifacts(w, options, info)
+	assert.True(t, strings.Contains(w.String(), `"--verbose" "--compression-level" "fastest" "--progress-interval" "1s"`), w.String())
+
+	w = &BashWriter{}
+	shell.cacheExtractor(w, options, info)
+	assert.True(t, strings.Contains(w.String(), `"--progress-interval" "1s"`), w.String())
+	assert.False(t, strings.Contains(w.String(), `"--verbose"`), "the extractor doesn't archive the files")
+}
+
+func TestArchiverInvalidVariablesAreIgnored(t *testing.T) {
+	build := &common.Build{
+		GetBuildResponse: common.GetBuildResponse{
+			ID:    1000,
+			Token: "token",
+			Variables: common.BuildVariables{
+				{Key: "ARCHIVER_COMPRESSION_LEVEL", Value: "best"},
+				{Key: "ARCHIVER_PROGRESS_INTERVAL", Value: "1"},
+			},
+		},
+		Runner: &common.RunnerConfig{
+			RunnerCredentials: common.RunnerCredentials{URL: "https://gitlab.example.com/ci"},
+		},
+	}
+	info := common.ShellScriptInfo{
+		Build:         build,
+		RunnerCommand: "gitlab-runner",
+	}
+	shell := AbstractShell{}
+
+	w := &BashWriter{}
+	shell.uploadArtifacts(w, &archivingOptions{Paths: []string{"vendor"}}, info)
+	assert.False(t, strings.Contains(w.String(), `"--compression-level"`), w.String())
+	assert.False(t, strings.Contains(w.String(), `"--progress-interval"`), w.String())
+	assert.True(t, strings.Contains(w.String(), "Invalid ARCHIVER_COMPRESSION_LEVEL"), w.String())
+	assert.True(t, strings.Contains(w.String(), "Invalid ARCHIVER_PROGRESS_INTERVAL: 1"), w.String())
+}
+
+func TestDownloadArtifactsProgressInterval(t *testing.T) {
+	build := &common.Build{
+		GetBuildResponse: common.GetBuildResponse{
+			Variables: common.BuildVariables{
+				{Key: "ARCHIVER_PROGRESS_INTERVAL", Value: "1s"},
+			},
+		},
+		Runner: &common.RunnerConfig{
+			RunnerCredentials: common.RunnerCredentials{URL: "https://gitlab.example.com/ci"},
+		},
+	}
+	info := common.ShellScriptInfo{
+		Build:         build,
+		RunnerCommand: "gitlab-runner",
+	}
+	shell := AbstractShell{}
+
+	w := &BashWriter{}
+	shell.downloadArtifacts(w, &common.BuildInfo{ID: 10, Name: "build", Token: "token"}, extractionOptions{}, info)
+	assert.True(t, strings.Contains(w.String(), `"--progress-interval" "1s"`), w.String())
+}
+
+func TestArchiverVariablesNotSet(t *testing.T) {
+	w := &BashWriter{}
+	shell := AbstractShell{}
+	shell.cacheArchiver(w, &archivingOptions{Paths: []string{"vendor"}}, common.ShellScriptInfo{
+		Build: &common.Build{
+			GetBuildResponse: common.GetBuildResponse{
+				Name:    "test",
+				RefName: "feature",
+			},
+			BuildDir: "/builds/project",
+			CacheDir: "/cache/project",
+			Runner:   &common.RunnerConfig{},
+		},
+		RunnerCommand: "gitlab-runner",
+	})
+	assert.False(t, strings.Contains(w.String(), `"--verbose"`), w.String())
+	assert.False(t, strings.Contains(w.String(), `"--compression-level"`), w.String())
+	assert.False(t, strings.Contains(w.String(), `"--progress-interval"`), w.String())
+}
+
+func TestArtifactsRequestArguments(t *testing.T) {
+	build := &common.Build{
+		GetBuildResponse: common.GetBuildResponse{
+			ID:    2,
+			Token: "build-token",
+			DependsOnBuilds: []common.BuildInfo{
+				{ID: 1, Name: "build", Token: "token", Artifacts: &common.BuildArtifacts{Filename: "artifacts.zip"}},
+			},
+		},
+		Runner: &common.RunnerConfig{
+			RunnerCredentials: common.RunnerCredentials{
+				URL:        "https://gitlab.example.com/ci",
+				Headers:    []string{"X-Api-Key: secret"},
+				SigningKey: "signing-key",
+			},
+		},
+	}
+	options := &archivingOptions{Paths: []string{"out"}}
+	info := common.ShellScriptInfo{
+		Build:         build,
+		RunnerCommand: "gitlab-runner",
+	}
+	shell := AbstractShell{}
+
+	w := &BashWriter{}
+	shell.uploadArtifacts(w, options, info)
+	assert.Equal(t, 3, strings.Count(w.String(), `"--request-signature" "POST /ci/api/v1/builds/2/artifacts`), w.String())
+	assert.NotContains(t, w.String(), "signing-key", "the signing key isn't passed to the build")
+	assert.NotContains(t, w.String(), "secret", "the static headers aren't passed to the build")
+
+	w = &BashWriter{}
+	shell.downloadAllArtifacts(w, nil, info)
+	assert.Contains(t, w.String(), `"--request-signature" "GET /ci/api/v1/builds/1/artifacts `)
+	assert.NotContains(t, w.String(), "signing-key", "the signing key isn't passed to the build")
+	assert.NotContains(t, w.String(), "secret", "the static headers aren't passed to the build")
+}
+
+func TestUploadArtifactsWithoutDirectUpload(t *testing.T) {
+	build := &common.Build{
+		GetBuildResponse: common.GetBuildResponse{
+			ID:    1,
+			Token: "token",
+		},
+		Runner: &common.RunnerConfig{
+			RunnerCredentials: common.RunnerCredentials{
+				URL: "https://gitlab.example.com/ci",
+			},
+		},
+	}
+	options := &archivingOptions{Paths: []string{"out"}}
+	info := common.ShellScriptInfo{
+		Build:         build,
+		RunnerCommand: "gitlab-runner",
+	}
+	shell := AbstractShell{}
+
+	w := &BashWriter{}
+	shell.uploadArtifacts(w, options, info)
+	assert.NotContains(t, w.String(), "--no-direct-upload")
+
+	build.SkipArtifactsDirectUpload = true
+	w = &BashWriter{}
+	shell.uploadArtifacts(w, options, info)
+	assert.Contains(t, w.String(), `"--no-direct-upload"`, "the helper doesn't probe the direct upload again")
+}
+
+func TestStagesWithoutWorkAreSkipped(t *testing.T) {
+	info := common.ShellScriptInfo{
+		Build: &common.Build{
+			GetBuildResponse: common.GetBuildResponse{
+				Sha: "1234567890abcdef",
+			},
+			BuildDir: "/builds/project",
+			Runner:   &common.RunnerConfig{},
+		},
+		RunnerCommand: "gitlab-runner",
+	}
+
+	for _, shell := range []common.Shell{&BashShell{Shell: "bash"}, &PowerShell{Shell: "powershell"}, &CmdShell{}} {
+		for _, scriptType := range []common.ShellScriptType{common.ShellRestoreCache, common.ShellDownloadArtifacts, common.ShellAfterScript} {
+			script, err := shell.GenerateScript(scriptType, info)
+			assert.NoError(t, err)
+			assert.Empty(t, script, "%s of %s has nothing to execute", scriptType, shell.GetName())
+		}
+
+		script, err := shell.GenerateScript(common.ShellGetSources, info)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, script, shell.GetName())
+	}
+}
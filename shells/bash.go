@@ -39,8 +39,9 @@ type BashShell struct {
 
 type BashWriter struct {
 	bytes.Buffer
-	TemporaryPath string
-	indent        int
+	TemporaryPath  string
+	ValidateSyntax bool
+	indent         int
 }
 
 func (b *BashWriter) Line(text string) {
@@ -60,7 +61,7 @@ func (b *BashWriter) Unindent() {
 
 func (b *BashWriter) Command(command string, arguments ...string) {
 	list := []string{
-		helpers.ShellEscape(command),
+		b.Quote(command),
 	}
 
 	for _, argument := range arguments {
@@ -70,24 +71,38 @@ func (b *BashWriter) Command(command string, arguments ...string) {
 	b.Line(strings.Join(list, " "))
 }
 
+func (b *BashWriter) Quote(text string) string {
+	return helpers.ShellEscape(text)
+}
+
+func (b *BashWriter) MultilineCommand(command string) {
+	b.Line(strings.Replace(command, "\r\n", "\n", -1))
+}
+
+// WriteFile prints the quoted content, so it isn't expanded and it's written byte-exact,
+// without the new line added at the end
+func (b *BashWriter) WriteFile(path string, content string) {
+	b.Line(fmt.Sprintf("printf '%%s' %s > %s", b.Quote(content), b.Quote(path)))
+}
+
 func (b *BashWriter) Variable(variable common.BuildVariable) {
 	if variable.File {
-		variableFile := b.Absolute(path.Join(b.TemporaryPath, variable.Key))
-		b.Line(fmt.Sprintf("mkdir -p %q", helpers.ToSlash(b.TemporaryPath)))
-		b.Line(fmt.Sprintf("echo -n %s > %q", helpers.ShellEscape(variable.Value), variableFile))
-		b.Line(fmt.Sprintf("export %s=%q", helpers.ShellEscape(variable.Key), variableFile))
+		variableFile := path.Join(b.TemporaryPath, variable.Key)
+		b.MkDir(helpers.ToSlash(b.TemporaryPath))
+		b.WriteFile(variableFile, variable.Value)
+		b.Line(fmt.Sprintf("export %s=%q", b.Quote(variable.Key), b.Absolute(variableFile)))
 	} else {
-		b.Line(fmt.Sprintf("export %s=%s", helpers.ShellEscape(variable.Key), helpers.ShellEscape(variable.Value)))
+		b.Line(fmt.Sprintf("export %s=%s", b.Quote(variable.Key), b.Quote(variable.Value)))
 	}
 }
 
 func (b *BashWriter) IfDirectory(path string) {
-	b.Line(fmt.Sprintf("if [[ -d %q ]]; then", path))
+	b.Line(fmt.Sprintf("if [[ -d %s ]]; then", b.Quote(path)))
 	b.Indent()
 }
 
 func (b *BashWriter) IfFile(path string) {
-	b.Line(fmt.Sprintf("if [[ -e %q ]]; then", path))
+	b.Line(fmt.Sprintf("if [[ -e %s ]]; then", b.Quote(path)))
 	b.Indent()
 }
 
@@ -111,6 +126,10 @@ func (b *BashWriter) Cd(path string) {
 	b.Command("cd", path)
 }
 
+func (b *BashWriter) MkDir(path string) {
+	b.Command("mkdir", "-p", path)
+}
+
 func (b *BashWriter) RmDir(path string) {
 	b.Command("rm", "-r", "-f", path)
 }
@@ -128,22 +147,22 @@ func (b *BashWriter) Absolute(dir string) string {
 
 func (b *BashWriter) Print(format string, arguments ...interface{}) {
 	coloredText := helpers.ANSI_RESET + fmt.Sprintf(format, arguments...)
-	b.Line("echo " + helpers.ShellEscape(coloredText))
+	b.Line("echo " + b.Quote(coloredText))
 }
 
 func (b *BashWriter) Notice(format string, arguments ...interface{}) {
 	coloredText := helpers.ANSI_BOLD_GREEN + fmt.Sprintf(format, arguments...) + helpers.ANSI_RESET
-	b.Line("echo " + helpers.ShellEscape(coloredText))
+	b.Line("echo " + b.Quote(coloredText))
 }
 
 func (b *BashWriter) Warning(format string, arguments ...interface{}) {
 	coloredText := helpers.ANSI_YELLOW + fmt.Sprintf(format, arguments...) + helpers.ANSI_RESET
-	b.Line("echo " + helpers.ShellEscape(coloredText))
+	b.Line("echo " + b.Quote(coloredText))
 }
 
 func (b *BashWriter) Error(format string, arguments ...interface{}) {
 	coloredText := helpers.ANSI_BOLD_RED + fmt.Sprintf(format, arguments...) + helpers.ANSI_RESET
-	b.Line("echo " + helpers.ShellEscape(coloredText))
+	b.Line("echo " + b.Quote(coloredText))
 }
 
 func (b *BashWriter) EmptyLine() {
@@ -155,11 +174,23 @@ func (b *BashWriter) Finish() string {
 	w := bufio.NewWriter(&buffer)
 	io.WriteString(w, "set -eo pipefail\n")
 	io.WriteString(w, "set +o noclobber\n")
-	io.WriteString(w, ": | eval "+helpers.ShellEscape(b.String())+"\n")
+	if b.ValidateSyntax {
+		b.writeSyntaxCheck(w)
+	}
+	io.WriteString(w, ": | eval "+b.Quote(b.String())+"\n")
 	w.Flush()
 	return buffer.String()
 }
 
+// writeSyntaxCheck parses the script with the -n of the running shell, which reads the commands without executing them
+func (b *BashWriter) writeSyntaxCheck(w io.Writer) {
+	message := helpers.ANSI_BOLD_RED + "ERROR: The build script has a syntax error, check the script in .gitlab-ci.yml" + helpers.ANSI_RESET
+	io.WriteString(w, "if ! printf '%s\\n' "+b.Quote(b.String())+" | \"${BASH:-sh}\" -n; then\n")
+	io.WriteString(w, "  echo "+b.Quote(message)+"\n")
+	io.WriteString(w, "  exit 1\n")
+	io.WriteString(w, "fi\n")
+}
+
 func (b *BashShell) GetName() string {
 	return b.Shell
 }
@@ -198,10 +229,11 @@ func (b *BashShell) GetConfiguration(info common.ShellScriptInfo) (script *commo
 
 func (b *BashShell) GenerateScript(scriptType common.ShellScriptType, info common.ShellScriptInfo) (script string, err error) {
 	w := &BashWriter{
-		TemporaryPath: info.Build.FullProjectDir() + ".tmp",
+		TemporaryPath:  info.Build.FullProjectDir() + ".tmp",
+		ValidateSyntax: b.validateSyntax(scriptType, info),
 	}
 
-	if scriptType == common.ShellPrepareScript {
+	if scriptType == common.ShellGetSources {
 		if len(info.Build.Hostname) != 0 {
 			w.Line("echo " + strconv.Quote("Running on $(hostname) via "+info.Build.Hostname+"..."))
 		} else {
@@ -210,6 +242,10 @@ func (b *BashShell) GenerateScript(scriptType common.ShellScriptType, info commo
 	}
 
 	err = b.writeScript(w, scriptType, info)
+	if w.Len() == 0 {
+		// Nothing to execute, the stage is skipped
+		return
+	}
 	script = w.Finish()
 	return
 }
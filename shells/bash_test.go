@@ -0,0 +1,117 @@
+package shells
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func runBashSyntaxCheck(t *testing.T, script string) (string, error) {
+	w := &BashWriter{ValidateSyntax: true}
+	w.Line(script)
+
+	cmd := exec.Command("bash")
+	cmd.Stdin = strings.NewReader(w.Finish())
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+func TestBashSyntaxCheck(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not available")
+	}
+
+	output, err := runBashSyntaxCheck(t, "echo first\nif true; then\necho second")
+	assert.Error(t, err)
+	assert.True(t, strings.Contains(output, "syntax error"), output)
+	assert.False(t, strings.Contains(output, "first"), "nothing should be executed: "+output)
+
+	output, err = runBashSyntaxCheck(t, "echo first")
+	assert.NoError(t, err)
+	assert.Equal(t, "first\n", output)
+
+	_, err = runBashSyntaxCheck(t, "")
+	assert.NoError(t, err, "an empty script is valid")
+}
+
+const bashQuoteTestText = "it's \"quoted\" \\ $HOME `date` !\n\ttabbed line\n"
+
+func runBashScript(t *testing.T, w *BashWriter) (string, error) {
+	cmd := exec.Command("bash")
+	cmd.Stdin = strings.NewReader(w.Finish())
+	output, err := cmd.CombinedOutput()
+	return string(output), err
+}
+
+func TestBashQuote(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not available")
+	}
+
+	w := &BashWriter{}
+	w.Line("printf '%s' " + w.Quote(bashQuoteTestText))
+
+	output, err := runBashScript(t, w)
+	assert.NoError(t, err)
+	assert.Equal(t, bashQuoteTestText, output)
+}
+
+func TestBashMultilineCommand(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not available")
+	}
+
+	w := &BashWriter{ValidateSyntax: true}
+	w.IfDirectory("/")
+	w.MultilineCommand("cat <<EOF\r\nfirst\r\nsecond\r\nEOF")
+	w.EndIf()
+
+	output, err := runBashScript(t, w)
+	assert.NoError(t, err)
+	assert.Equal(t, "first\nsecond\n", output, "the carriage returns are removed")
+}
+
+func TestBashWriteFile(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not available")
+	}
+
+	for _, content := range []string{bashQuoteTestText, "no new line at the end", "two new lines\n\n", ""} {
+		w := &BashWriter{ValidateSyntax: true}
+		w.IfDirectory("/")
+		w.WriteFile("test $HOME file", content)
+		w.Line("cat 'test $HOME file'")
+		w.Line("rm -f 'test $HOME file'")
+		w.EndIf()
+
+		output, err := runBashScript(t, w)
+		assert.NoError(t, err)
+		assert.Equal(t, content, output, "the path and the content aren't expanded and the content is written byte-exact")
+	}
+}
+
+func TestBashFileVariable(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not available")
+	}
+
+	dir, err := ioutil.TempDir("", "bash-variable")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	w := &BashWriter{TemporaryPath: filepath.Join(dir, "tmp")}
+	w.Variable(common.BuildVariable{Key: "TEST_FILE", Value: "-----BEGIN KEY-----\nkey", File: true})
+	w.Line(`cat "$TEST_FILE"`)
+
+	output, err := runBashScript(t, w)
+	assert.NoError(t, err)
+	assert.Equal(t, "-----BEGIN KEY-----\nkey", output, "the new line isn't added to the file variable")
+}
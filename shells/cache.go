@@ -4,16 +4,20 @@ import (
 	"bytes"
 	"encoding/xml"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"path"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/minio/minio-go"
 
 	"github.com/Sirupsen/logrus"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
 )
 
 type bucketLocationTripper struct {
@@ -34,15 +38,40 @@ func (b *bucketLocationTripper) CancelRequest(req *http.Request) {
 	// Do nothing
 }
 
+// getCacheObjectName returns the name of the cache object, it's stored under the Path of the cache,
+// so the bucket can be shared with other data
 func getCacheObjectName(build *common.Build, cache *common.CacheConfig, key string) string {
 	if key == "" {
 		return ""
 	}
-	return path.Join("runner", build.Runner.ShortDescription(), "project", strconv.Itoa(build.ProjectID), key)
+	return path.Join(strings.Trim(cache.Path, "/"), "runner", build.Runner.ShortDescription(), "project", strconv.Itoa(build.ProjectID), key)
+}
+
+// getCacheServerAddress allows to specify the server address as URL,
+// the http:// scheme enables the insecure mode
+func getCacheServerAddress(cache *common.CacheConfig) (address string, insecure bool) {
+	address, insecure = cache.ServerAddress, cache.Insecure
+	if strings.HasPrefix(address, "http://") {
+		address, insecure = strings.TrimPrefix(address, "http://"), true
+	} else if strings.HasPrefix(address, "https://") {
+		address, insecure = strings.TrimPrefix(address, "https://"), false
+	}
+	address = strings.TrimSuffix(address, "/")
+
+	// the IPv6 address has to be in brackets and with the port
+	if ip := net.ParseIP(strings.Trim(address, "[]")); ip != nil && ip.To4() == nil {
+		port := "443"
+		if insecure {
+			port = "80"
+		}
+		address = net.JoinHostPort(ip.String(), port)
+	}
+	return
 }
 
 func getCacheStorageClient(cache *common.CacheConfig) (scl *minio.Client, err error) {
-	scl, err = minio.New(cache.ServerAddress, cache.AccessKey, cache.SecretKey, cache.Insecure)
+	address, insecure := getCacheServerAddress(cache)
+	scl, err = minio.New(address, cache.AccessKey, cache.SecretKey, insecure)
 	if err != nil {
 		logrus.Warningln(err)
 		return
@@ -107,6 +136,75 @@ func getS3UploadURL(build *common.Build, key string) (url *url.URL) {
 	return
 }
 
+// getCacheClientArguments returns the arguments of cache helpers used to verify the cache server
+func getCacheClientArguments(build *common.Build) []string {
+	cache := build.Runner.Cache
+	if cache == nil || cache.Type != "s3" {
+		return nil
+	}
+	if cache.TLSSkipVerify {
+		return []string{"--tls-skip-verify"}
+	}
+	return nil
+}
+
+// getCacheRequestArguments returns the arguments of cache helpers adding the signature of the request
+// to the cache URL. The request is pre-signed by the runner, so the signing key isn't passed to the build,
+// the body of the upload isn't known yet, so it's signed as UNSIGNED-PAYLOAD
+func getCacheRequestArguments(build *common.Build, flag, method string, cacheURL *url.URL) (args []string) {
+	cache := build.Runner.Cache
+	if cache == nil || cache.SigningKey == "" {
+		return nil
+	}
+
+	bodyHash := helpers.EmptyBodyHash
+	if method == "PUT" {
+		bodyHash = helpers.UnsignedPayload
+	}
+
+	headers := helpers.SignRequest(cache.SigningKey, method, cacheURL, bodyHash, time.Now(), presignedRequestValidity).Headers()
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		args = append(args, flag, name+": "+headers.Get(name))
+	}
+	return
+}
+
+// getCacheFormat returns the format of the cache archives created by the runner
+func getCacheFormat(build *common.Build) common.CacheFormat {
+	cache := build.Runner.Cache
+	if cache == nil {
+		return common.CacheFormatZip
+	}
+
+	format, err := cache.Format.Get()
+	if err != nil {
+		logrus.Warningln(err)
+		return common.CacheFormatZip
+	}
+	return format
+}
+
+// getCacheTLSCAChain returns the certificates used to verify the cache server
+func getCacheTLSCAChain(build *common.Build) string {
+	cache := build.Runner.Cache
+	if cache == nil || cache.Type != "s3" || cache.TLSCAFile == "" || cache.TLSSkipVerify {
+		return ""
+	}
+
+	data, err := ioutil.ReadFile(cache.TLSCAFile)
+	if err != nil {
+		logrus.Warningln("Failed to load", cache.TLSCAFile, err)
+		return ""
+	}
+	return string(data)
+}
+
 func getCacheUploadURL(build *common.Build, key string) (url *url.URL) {
 	cache := build.Runner.Cache
 	if cache == nil {
@@ -1,12 +1,15 @@
 package shells
 
 import (
+	"net/url"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
 )
 
 var s3Cache = common.CacheConfig{
@@ -44,3 +47,108 @@ func TestS3CacheDownloadURL(t *testing.T) {
 	require.NotNil(t, url)
 	assert.Equal(t, s3Cache.ServerAddress, url.Host)
 }
+
+func TestS3CacheObjectPath(t *testing.T) {
+	assert.Equal(t, "runner/longtoke/project/10/key", getCacheObjectName(s3CacheBuild, &s3Cache, "key"))
+
+	cache := s3Cache
+	cache.Path = "/ci/cache/"
+	assert.Equal(t, "ci/cache/runner/longtoke/project/10/key", getCacheObjectName(s3CacheBuild, &cache, "key"))
+	assert.Empty(t, getCacheObjectName(s3CacheBuild, &cache, ""), "no cache without the key")
+
+	build := *s3CacheBuild
+	build.Runner = &common.RunnerConfig{
+		RunnerCredentials: s3CacheBuild.Runner.RunnerCredentials,
+		RunnerSettings:    common.RunnerSettings{Cache: &cache},
+	}
+	url := getCacheUploadURL(&build, "key")
+	require.NotNil(t, url)
+	assert.Equal(t, "/test/ci/cache/runner/longtoke/project/10/key", url.Path)
+}
+
+func TestS3CacheServerAddress(t *testing.T) {
+	tests := []struct {
+		serverAddress string
+		insecure      bool
+		address       string
+		isInsecure    bool
+	}{
+		{"minio.example.com:9000", false, "minio.example.com:9000", false},
+		{"minio.example.com:9000", true, "minio.example.com:9000", true},
+		{"http://minio.example.com:9000/", false, "minio.example.com:9000", true},
+		{"https://minio.example.com", true, "minio.example.com", false},
+		{"[2001:db8::1]:9000", false, "[2001:db8::1]:9000", false},
+		{"http://[2001:db8::1]/", false, "[2001:db8::1]:80", true},
+		{"2001:db8::1", false, "[2001:db8::1]:443", false},
+	}
+
+	for _, test := range tests {
+		address, insecure := getCacheServerAddress(&common.CacheConfig{
+			ServerAddress: test.serverAddress,
+			Insecure:      test.insecure,
+		})
+		assert.Equal(t, test.address, address, test.serverAddress)
+		assert.Equal(t, test.isInsecure, insecure, test.serverAddress)
+	}
+}
+
+func TestS3CacheCustomEndpointUsesPathStyle(t *testing.T) {
+	cache := s3Cache
+	cache.ServerAddress = "https://minio.example.com:9000"
+
+	build := *s3CacheBuild
+	build.Runner = &common.RunnerConfig{
+		RunnerSettings: common.RunnerSettings{
+			Cache: &cache,
+		},
+	}
+
+	url := getCacheUploadURL(&build, "key")
+	require.NotNil(t, url)
+	assert.Equal(t, "https", url.Scheme)
+	assert.Equal(t, "minio.example.com:9000", url.Host)
+	assert.Contains(t, url.Path, "/"+cache.BucketName+"/")
+}
+
+func TestS3CacheClientArguments(t *testing.T) {
+	cache := s3Cache
+	build := *s3CacheBuild
+	build.Runner = &common.RunnerConfig{
+		RunnerSettings: common.RunnerSettings{
+			Cache: &cache,
+		},
+	}
+	assert.Empty(t, getCacheClientArguments(&build))
+
+	cache.TLSSkipVerify = true
+	assert.Equal(t, []string{"--tls-skip-verify"}, getCacheClientArguments(&build))
+
+	cache.SigningKey = "key"
+	assert.Equal(t, []string{"--tls-skip-verify"}, getCacheClientArguments(&build), "the signing key isn't passed to the build")
+}
+
+func TestCacheRequestArguments(t *testing.T) {
+	cache := s3Cache
+	build := *s3CacheBuild
+	build.Runner = &common.RunnerConfig{
+		RunnerSettings: common.RunnerSettings{
+			Cache: &cache,
+		},
+	}
+	cacheURL, _ := url.Parse("https://minio.example.com/bucket/cache.zip?X-Amz-Signature=abc")
+	assert.Empty(t, getCacheRequestArguments(&build, "--header", "GET", cacheURL))
+
+	cache.SigningKey = "signing-key"
+	args := getCacheRequestArguments(&build, "--fallback-header", "GET", cacheURL)
+	if assert.Len(t, args, 8) {
+		assert.Equal(t, "--fallback-header", args[0])
+		assert.Equal(t, helpers.RequestContentHashHeader+": "+helpers.EmptyBodyHash, args[1])
+		assert.Contains(t, args[3], helpers.RequestExpiresHeader+": ")
+		assert.Contains(t, args[5], helpers.RequestSignatureHeader+": ")
+		assert.Contains(t, args[7], helpers.RequestTimestampHeader+": ")
+	}
+	assert.NotContains(t, strings.Join(args, " "), "signing-key", "the signing key isn't passed to the build")
+
+	args = getCacheRequestArguments(&build, "--header", "PUT", cacheURL)
+	assert.Contains(t, args, helpers.RequestContentHashHeader+": "+helpers.UnsignedPayload, "the body of the upload isn't known")
+}
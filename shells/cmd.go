@@ -2,6 +2,7 @@ package shells
 
 import (
 	"bytes"
+	"encoding/base64"
 	"fmt"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
@@ -21,10 +22,6 @@ type CmdWriter struct {
 	indent        int
 }
 
-func batchQuote(text string) string {
-	return "\"" + batchEscape(text) + "\""
-}
-
 func batchEscape(text string) string {
 	// taken from: http://www.robvanderwoude.com/escapechars.php
 	text = strings.Replace(text, "^", "^^", -1)
@@ -38,6 +35,62 @@ func batchEscape(text string) string {
 	return text
 }
 
+// windowsEscapeArg quotes the argument, as it's split by the programs using the Microsoft C runtime
+func windowsEscapeArg(text string) string {
+	var buffer bytes.Buffer
+	buffer.WriteByte('"')
+	slashes := 0
+	for i := 0; i < len(text); i++ {
+		char := text[i]
+		switch char {
+		case '\\':
+			slashes++
+		case '"':
+			// The backslashes followed by the quote are escaped too
+			buffer.WriteString(strings.Repeat("\\", slashes+1))
+			slashes = 0
+		default:
+			slashes = 0
+		}
+		buffer.WriteByte(char)
+	}
+	buffer.WriteString(strings.Repeat("\\", slashes))
+	buffer.WriteByte('"')
+	return buffer.String()
+}
+
+// batchEscapeText escapes the text, so it's passed literally by cmd. The special characters
+// are escaped only outside of the quotes, as they're seen by cmd. With the delayed expansion,
+// which is done when the line has the !, the carets are removed once more
+func batchEscapeText(text string, delayed bool) string {
+	var buffer bytes.Buffer
+	quoted := false
+	for _, char := range text {
+		switch {
+		case char == '"':
+			quoted = !quoted
+		case char == '%':
+			buffer.WriteByte('%')
+		case char == '!' && quoted:
+			buffer.WriteString("^")
+		case char == '!':
+			buffer.WriteString("^^")
+		case char == '^' && delayed && quoted:
+			buffer.WriteString("^")
+		case char == '^' && delayed:
+			buffer.WriteString("^^^")
+		case !quoted && strings.ContainsRune("^&|<>()", char):
+			buffer.WriteByte('^')
+		}
+		buffer.WriteRune(char)
+	}
+	return buffer.String()
+}
+
+func batchNewLines(text string) []string {
+	return strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n")
+}
+
 func batchEscapeVariable(text string) string {
 	text = strings.Replace(text, "%", "%%", -1)
 	text = batchEscape(text)
@@ -71,36 +124,77 @@ func (b *CmdWriter) checkErrorLevel() {
 
 func (b *CmdWriter) Command(command string, arguments ...string) {
 	list := []string{
-		batchQuote(command),
+		b.Quote(command),
 	}
 
 	for _, argument := range arguments {
-		list = append(list, batchQuote(argument))
+		list = append(list, b.Quote(argument))
 	}
 
 	b.Line(strings.Join(list, " "))
 	b.checkErrorLevel()
 }
 
+// Quote can't pass the new lines directly, so they're inserted by the !nl! variable
+func (b *CmdWriter) Quote(text string) string {
+	lines := batchNewLines(text)
+	delayed := len(lines) > 1 || strings.Contains(text, "!")
+	for i, line := range lines {
+		lines[i] = batchEscapeText(windowsEscapeArg(line), delayed)
+	}
+	return strings.Join(lines, "!nl!")
+}
+
+func (b *CmdWriter) MultilineCommand(command string) {
+	b.Line(strings.Join(batchNewLines(command), "\r\n"))
+}
+
+// batchBase64LineLength keeps the lines echoing the base64 encoded content short
+const batchBase64LineLength = 76
+
+// WriteFile echoes the base64 encoded content to the temporary file decoded by certutil,
+// echo can't write the content without the new line at the end and it converts the new lines to CRLF
+func (b *CmdWriter) WriteFile(path string, content string) {
+	file := b.Quote(helpers.ToBackslash(path))
+	if content == "" {
+		b.Line("type NUL >" + file)
+		return
+	}
+
+	encodedFile := b.Quote(helpers.ToBackslash(path + ".base64"))
+	encoded := base64.StdEncoding.EncodeToString([]byte(content))
+	redirection := ">"
+	for len(encoded) > 0 {
+		length := batchBase64LineLength
+		if length > len(encoded) {
+			length = len(encoded)
+		}
+		b.Line(redirection + encodedFile + " echo(" + encoded[:length])
+		encoded = encoded[length:]
+		redirection = ">>"
+	}
+	b.Line("certutil -f -decode " + encodedFile + " " + file + " 1>NUL")
+	b.Line("del /f /q " + encodedFile + " 2>NUL 1>NUL")
+}
+
 func (b *CmdWriter) Variable(variable common.BuildVariable) {
 	if variable.File {
-		variableFile := b.Absolute(path.Join(b.TemporaryPath, variable.Key))
-		variableFile = helpers.ToBackslash(variableFile)
-		b.Line(fmt.Sprintf("md %q 2>NUL 1>NUL", batchEscape(helpers.ToBackslash(b.TemporaryPath))))
-		b.Line(fmt.Sprintf("echo %s > %s", batchEscapeVariable(variable.Value), batchEscape(variableFile)))
-		b.Line("SET " + batchEscapeVariable(variable.Key) + "=" + batchEscape(variableFile))
+		variableFile := path.Join(b.TemporaryPath, variable.Key)
+		b.MkDir(b.TemporaryPath)
+		b.WriteFile(variableFile, variable.Value)
+		b.Line("SET " + batchEscapeVariable(variable.Key) + "=" + batchEscape(helpers.ToBackslash(b.Absolute(variableFile))))
 	} else {
 		b.Line("SET " + batchEscapeVariable(variable.Key) + "=" + batchEscapeVariable(variable.Value))
 	}
 }
 
 func (b *CmdWriter) IfDirectory(path string) {
-	b.Line("IF EXIST " + batchQuote(helpers.ToBackslash(path)) + " (")
+	b.Line("IF EXIST " + b.Quote(helpers.ToBackslash(path)) + " (")
 	b.Indent()
 }
 
 func (b *CmdWriter) IfFile(path string) {
-	b.Line("IF EXIST " + batchQuote(helpers.ToBackslash(path)) + " (")
+	b.Line("IF EXIST " + b.Quote(helpers.ToBackslash(path)) + " (")
 	b.Indent()
 }
 
@@ -122,16 +216,20 @@ func (b *CmdWriter) EndIf() {
 }
 
 func (b *CmdWriter) Cd(path string) {
-	b.Line("cd /D " + batchQuote(helpers.ToBackslash(path)))
+	b.Line("cd /D " + b.Quote(helpers.ToBackslash(path)))
 	b.checkErrorLevel()
 }
 
+func (b *CmdWriter) MkDir(path string) {
+	b.Line("md " + b.Quote(helpers.ToBackslash(path)) + " 2>NUL 1>NUL")
+}
+
 func (b *CmdWriter) RmDir(path string) {
-	b.Line("rd /s /q " + batchQuote(helpers.ToBackslash(path)) + " 2>NUL 1>NUL")
+	b.Line("rd /s /q " + b.Quote(helpers.ToBackslash(path)) + " 2>NUL 1>NUL")
 }
 
 func (b *CmdWriter) RmFile(path string) {
-	b.Line("rd /s /q " + batchQuote(helpers.ToBackslash(path)) + " 2>NUL 1>NUL")
+	b.Line("rd /s /q " + b.Quote(helpers.ToBackslash(path)) + " 2>NUL 1>NUL")
 }
 
 func (b *CmdWriter) Print(format string, arguments ...interface{}) {
@@ -183,8 +281,9 @@ func (b *CmdShell) GenerateScript(scriptType common.ShellScriptType, info common
 	w.Line("setlocal enableextensions")
 	w.Line("setlocal enableDelayedExpansion")
 	w.Line("set nl=^\r\n\r\n")
+	header := w.Len()
 
-	if scriptType == common.ShellPrepareScript {
+	if scriptType == common.ShellGetSources {
 		if len(info.Build.Hostname) != 0 {
 			w.Line("echo Running on %COMPUTERNAME% via " + batchEscape(info.Build.Hostname) + "...")
 		} else {
@@ -193,6 +292,10 @@ func (b *CmdShell) GenerateScript(scriptType common.ShellScriptType, info common
 	}
 
 	err = b.writeScript(w, scriptType, info)
+	if w.Len() == header {
+		// Nothing to execute, the stage is skipped
+		return
+	}
 	script = w.String()
 	return
 }
@@ -0,0 +1,48 @@
+package shells
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindowsEscapeArg(t *testing.T) {
+	assert.Equal(t, `""`, windowsEscapeArg(""))
+	assert.Equal(t, `"C:\Program Files\\"`, windowsEscapeArg(`C:\Program Files\`), "the trailing backslash doesn't escape the quote")
+	assert.Equal(t, `"say \"hello\""`, windowsEscapeArg(`say "hello"`))
+	assert.Equal(t, `"back\\\"slash"`, windowsEscapeArg(`back\"slash`))
+}
+
+func TestCmdQuote(t *testing.T) {
+	w := &CmdWriter{}
+	assert.Equal(t, `"a & b"`, w.Quote("a & b"), "the special characters are quoted")
+	assert.Equal(t, `"100%%"`, w.Quote("100%"), "the variables aren't expanded")
+	assert.Equal(t, `"hello^!"`, w.Quote("hello!"), "the delayed expansion isn't done")
+	assert.Equal(t, `"^^ and ^!"`, w.Quote("^ and !"), "the carets are escaped with the delayed expansion")
+	assert.Equal(t, `"^"`, w.Quote("^"))
+	assert.Equal(t, `"say \"a ^& b\""`, w.Quote(`say "a & b"`), "the escaped quotes end the quoting of cmd")
+	assert.Equal(t, `"first"!nl!"second"`, w.Quote("first\r\nsecond"))
+}
+
+func TestCmdMultilineCommand(t *testing.T) {
+	w := &CmdWriter{}
+	w.MultilineCommand("IF EXIST a (\n  echo a\r\n)")
+	assert.Equal(t, "IF EXIST a (\r\n  echo a\r\n)\r\n", w.String())
+}
+
+func TestCmdWriteFile(t *testing.T) {
+	w := &CmdWriter{}
+	w.WriteFile("dir/file", "a & b(1)\n\n100% 2")
+	assert.Equal(t, `>"dir\file.base64" echo(YSAmIGIoMSkKCjEwMCUgMg==`+"\r\n"+
+		`certutil -f -decode "dir\file.base64" "dir\file" 1>NUL`+"\r\n"+
+		`del /f /q "dir\file.base64" 2>NUL 1>NUL`+"\r\n", w.String(), "the content is decoded byte-exact")
+
+	w = &CmdWriter{}
+	w.WriteFile("dir/file", strings.Repeat("a", 100))
+	assert.Equal(t, 2, strings.Count(w.String(), "echo("), "the long content is echoed in multiple lines")
+
+	w = &CmdWriter{}
+	w.WriteFile("dir/file", "")
+	assert.Equal(t, `type NUL >"dir\file"`+"\r\n", w.String())
+}
@@ -0,0 +1,89 @@
+package shells
+
+import (
+	"net/url"
+	"path"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+// gitCredentialHelper reads the build token from the build environment,
+// so the token itself is never stored in the git configuration. It doesn't use
+// the shell variables, as they would be expanded in the command arguments.
+// The output is used only by the get operation, the store and erase ignore it.
+const gitCredentialHelper = `!printf password=; printenv CI_BUILD_TOKEN`
+
+type gitCredentials struct {
+	repoURL   string
+	serverURL string
+	username  string
+}
+
+// getGitCredentials strips the build token from the repository URL.
+// The credentials are used by the credential helper scoped to the GitLab server instead.
+func getGitCredentials(build *common.Build) (credentials gitCredentials, ok bool) {
+	credentials.repoURL = build.RepoURL
+
+	u, err := url.Parse(build.RepoURL)
+	if err != nil || u.User == nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return
+	}
+
+	// only the build token is available to the credential helper
+	password, _ := u.User.Password()
+	if build.Token == "" || password != build.Token {
+		return
+	}
+
+	credentials.username = u.User.Username()
+	u.User = nil
+	credentials.repoURL = u.String()
+	credentials.serverURL = (&url.URL{Scheme: u.Scheme, Host: u.Host}).String()
+	return credentials, true
+}
+
+func (c gitCredentials) configKey() string {
+	return "credential." + c.serverURL
+}
+
+// gitArgs configures the credential helper scoped to the GitLab server only for the git command,
+// it's used by the clone, which runs before the repository configuration exists
+func (c gitCredentials) gitArgs(arguments ...string) []string {
+	if c.username == "" {
+		return arguments
+	}
+
+	key := c.configKey()
+	return append([]string{
+		"-c", key + ".username=" + c.username,
+		"-c", key + ".helper=" + gitCredentialHelper,
+	}, arguments...)
+}
+
+// writeConfig stores the credential helper scoped to the GitLab server in the configuration
+// of the repository, so the git commands of the build can authenticate too, eg. git push
+// or git submodule update. It's removed by removeConfig, when the build finishes
+func (c gitCredentials) writeConfig(w ShellWriter) {
+	if c.username == "" {
+		return
+	}
+
+	key := c.configKey()
+	w.Command("git", "config", key+".username", c.username)
+	w.Command("git", "config", key+".helper", gitCredentialHelper)
+}
+
+// removeConfig removes the credential helper from the configuration of the repository
+func (c gitCredentials) removeConfig(w ShellWriter, projectDir string) {
+	if c.username == "" {
+		return
+	}
+
+	key := c.configKey()
+	w.IfDirectory(path.Join(projectDir, ".git"))
+	w.Cd(projectDir)
+	w.IfCmd("git", "config", "--get", key+".helper")
+	w.Command("git", "config", "--remove-section", key)
+	w.EndIf()
+	w.EndIf()
+}
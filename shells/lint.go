@@ -0,0 +1,66 @@
+package shells
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+// archivingServerKeys are handled by GitLab, so they are not a part of archivingOptions
+var archivingServerKeys = map[string]bool{
+	"when":      true,
+	"expire_in": true,
+}
+
+func lintOption(options common.BuildOptions, result interface{}, key string, ignored map[string]bool) error {
+	err := options.Decode(result, key)
+	if err != nil {
+		return fmt.Errorf("%s: %v", key, err)
+	}
+
+	var unknown []string
+	for _, name := range options.UnknownKeys(result, key) {
+		if !ignored[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("%s: unknown keys: %s", key, strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// lintedOptions are the structures from which the scripts of the build are generated
+var lintedOptions = []struct {
+	key     string
+	result  interface{}
+	ignored map[string]bool
+}{
+	{"cache", &archivingOptions{}, nil},
+	{"artifacts", &archivingOptions{}, archivingServerKeys},
+	{"dependencies", &dependencies{}, nil},
+	{"after_script", &[]string{}, nil},
+}
+
+// LintOptions verifies the options of the job using the structures
+// from which the scripts of the build are generated
+func LintOptions(options common.BuildOptions) (errs []error) {
+	for _, option := range lintedOptions {
+		if _, ok := options.Get(option.key); !ok {
+			continue
+		}
+		result := reflect.New(reflect.TypeOf(option.result).Elem()).Interface()
+		if err := lintOption(options, result, option.key, option.ignored); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return
+}
+
+func init() {
+	for _, option := range lintedOptions {
+		common.RegisterBuildOptions(option.key, option.result, option.ignored)
+	}
+}
@@ -0,0 +1,63 @@
+package shells
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v1"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func lintYaml(t *testing.T, data string) []error {
+	options := make(common.BuildOptions)
+	err := yaml.Unmarshal([]byte(data), options)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	assert.NoError(t, options.Sanitize())
+	return LintOptions(options)
+}
+
+func TestLintOptionsValid(t *testing.T) {
+	errs := lintYaml(t, `
+cache:
+  key: "$CI_BUILD_REF_NAME"
+  paths: [vendor/]
+  untracked: true
+artifacts:
+  name: binaries
+  paths: [out/]
+  when: on_failure
+  expire_in: 1 week
+dependencies: [build]
+after_script:
+- echo done
+`)
+	assert.Equal(t, 0, len(errs))
+}
+
+func TestLintOptionsUnknownKeys(t *testing.T) {
+	errs := lintYaml(t, `
+cache:
+  path: [vendor/]
+  key: default
+artifacts:
+  paths: [out/]
+  expire: 1 week
+`)
+	if assert.Equal(t, 2, len(errs)) {
+		messages := []string{errs[0].Error(), errs[1].Error()}
+		assert.Contains(t, messages, "cache: unknown keys: path")
+		assert.Contains(t, messages, "artifacts: unknown keys: expire")
+	}
+}
+
+func TestLintOptionsTypeErrors(t *testing.T) {
+	errs := lintYaml(t, `
+cache:
+  paths: vendor/
+dependencies: build
+`)
+	assert.Equal(t, 2, len(errs))
+}
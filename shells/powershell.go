@@ -2,6 +2,7 @@ package shells
 
 import (
 	"bytes"
+	"encoding/base64"
 	"fmt"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
 	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/helpers"
@@ -12,12 +13,14 @@ import (
 
 type PowerShell struct {
 	AbstractShell
+	Shell string
 }
 
 type PsWriter struct {
 	bytes.Buffer
-	TemporaryPath string
-	indent        int
+	TemporaryPath  string
+	ValidateSyntax bool
+	indent         int
 }
 
 func psQuote(text string) string {
@@ -37,6 +40,21 @@ func psQuote(text string) string {
 	return "\"" + text + "\""
 }
 
+// psSingleQuote returns the literal string, its content isn't expanded. PowerShell takes
+// the typographic single quotes as the quotes too, so they're doubled as well
+func psSingleQuote(text string) string {
+	for _, quote := range []string{"'", "\u2018", "\u2019", "\u201a", "\u201b"} {
+		text = strings.Replace(text, quote, quote+quote, -1)
+	}
+	return "'" + text + "'"
+}
+
+// psNewLines converts the new lines to the ones used by the script
+func psNewLines(text string) string {
+	text = strings.Replace(text, "\r\n", "\n", -1)
+	return strings.Replace(text, "\n", "\r\n", -1)
+}
+
 func psQuoteVariable(text string) string {
 	text = psQuote(text)
 	text = strings.Replace(text, "$", "`$", -1)
@@ -66,24 +84,38 @@ func (b *PsWriter) checkErrorLevel() {
 
 func (b *PsWriter) Command(command string, arguments ...string) {
 	list := []string{
-		psQuote(command),
+		b.Quote(command),
 	}
 
 	for _, argument := range arguments {
-		list = append(list, psQuote(argument))
+		list = append(list, b.Quote(argument))
 	}
 
 	b.Line("& " + strings.Join(list, " "))
 	b.checkErrorLevel()
 }
 
+func (b *PsWriter) Quote(text string) string {
+	return psSingleQuote(psNewLines(text))
+}
+
+func (b *PsWriter) MultilineCommand(command string) {
+	b.Line(psNewLines(command))
+}
+
+// WriteFile writes the base64 encoded bytes, Set-Content would add the new line at the end
+// and the byte order mark. The .NET methods don't use the location of PowerShell, so the path is resolved first
+func (b *PsWriter) WriteFile(path string, content string) {
+	b.Line(fmt.Sprintf("[System.IO.File]::WriteAllBytes($ExecutionContext.SessionState.Path.GetUnresolvedProviderPathFromPSPath(%s), [System.Convert]::FromBase64String(%s))",
+		b.Quote(helpers.ToBackslash(path)), psSingleQuote(base64.StdEncoding.EncodeToString([]byte(content)))))
+}
+
 func (b *PsWriter) Variable(variable common.BuildVariable) {
 	if variable.File {
-		variableFile := b.Absolute(path.Join(b.TemporaryPath, variable.Key))
-		variableFile = helpers.ToBackslash(variableFile)
-		b.Line(fmt.Sprintf("md %s -Force | out-null", psQuote(helpers.ToBackslash(b.TemporaryPath))))
-		b.Line(fmt.Sprintf("Set-Content %s -Value %s -Encoding UTF8 -Force", psQuote(variableFile), psQuoteVariable(variable.Value)))
-		b.Line("$" + variable.Key + "=" + psQuote(variableFile))
+		variableFile := path.Join(b.TemporaryPath, variable.Key)
+		b.MkDir(b.TemporaryPath)
+		b.WriteFile(variableFile, variable.Value)
+		b.Line("$" + variable.Key + "=" + psQuote(helpers.ToBackslash(b.Absolute(variableFile))))
 	} else {
 		b.Line("$" + variable.Key + "=" + psQuoteVariable(variable.Value))
 	}
@@ -92,12 +124,12 @@ func (b *PsWriter) Variable(variable common.BuildVariable) {
 }
 
 func (b *PsWriter) IfDirectory(path string) {
-	b.Line("if(Test-Path " + psQuote(helpers.ToBackslash(path)) + " -PathType Container) {")
+	b.Line("if(Test-Path " + b.Quote(helpers.ToBackslash(path)) + " -PathType Container) {")
 	b.Indent()
 }
 
 func (b *PsWriter) IfFile(path string) {
-	b.Line("if(Test-Path " + psQuote(helpers.ToBackslash(path)) + " -PathType Leaf) {")
+	b.Line("if(Test-Path " + b.Quote(helpers.ToBackslash(path)) + " -PathType Leaf) {")
 	b.Indent()
 }
 
@@ -119,12 +151,16 @@ func (b *PsWriter) EndIf() {
 }
 
 func (b *PsWriter) Cd(path string) {
-	b.Line("cd " + psQuote(helpers.ToBackslash(path)))
+	b.Line("cd " + b.Quote(helpers.ToBackslash(path)))
 	b.checkErrorLevel()
 }
 
+func (b *PsWriter) MkDir(path string) {
+	b.Line("New-Item -ItemType directory -Force -Path " + b.Quote(helpers.ToBackslash(path)) + " | out-null")
+}
+
 func (b *PsWriter) RmDir(path string) {
-	path = psQuote(helpers.ToBackslash(path))
+	path = b.Quote(helpers.ToBackslash(path))
 	b.Line("if( (Get-Command -Name Remove-Item2 -Module NTFSSecurity -ErrorAction SilentlyContinue) -and (Test-Path " + path + " -PathType Container) ) {")
 	b.Indent()
 	b.Line("Remove-Item2 -Force -Recurse " + path)
@@ -138,7 +174,7 @@ func (b *PsWriter) RmDir(path string) {
 }
 
 func (b *PsWriter) RmFile(path string) {
-	path = psQuote(helpers.ToBackslash(path))
+	path = b.Quote(helpers.ToBackslash(path))
 	b.Line("if( (Get-Command -Name Remove-Item2 -Module NTFSSecurity -ErrorAction SilentlyContinue) -and (Test-Path " + path + " -PathType Leaf) ) {")
 	b.Indent()
 	b.Line("Remove-Item2 -Force " + path)
@@ -185,12 +221,12 @@ func (b *PsWriter) Absolute(dir string) string {
 }
 
 func (b *PowerShell) GetName() string {
-	return "powershell"
+	return b.Shell
 }
 
 func (b *PowerShell) GetConfiguration(info common.ShellScriptInfo) (script *common.ShellConfiguration, err error) {
 	script = &common.ShellConfiguration{
-		Command:   "powershell",
+		Command:   b.Shell,
 		Arguments: []string{"-noprofile", "-noninteractive", "-executionpolicy", "Bypass", "-command"},
 		PassFile:  true,
 		Extension: "ps1",
@@ -198,12 +234,35 @@ func (b *PowerShell) GetConfiguration(info common.ShellScriptInfo) (script *comm
 	return
 }
 
+// Finish prepends the syntax check of the script, it uses the parser of PowerShell without executing the script
+func (b *PsWriter) Finish() string {
+	if !b.ValidateSyntax {
+		return b.String()
+	}
+
+	var buffer bytes.Buffer
+	check := &PsWriter{}
+	check.Line("$gitlabRunnerSyntaxErrors = $null")
+	check.Line("[System.Management.Automation.PSParser]::Tokenize(" + psQuoteVariable(b.String()) + ", [ref]$gitlabRunnerSyntaxErrors) | Out-Null")
+	check.Line("if ($gitlabRunnerSyntaxErrors.Count -gt 0) {")
+	check.Indent()
+	check.Line("$gitlabRunnerSyntaxErrors | ForEach-Object { echo (\"Line \" + $_.Token.StartLine + \": \" + $_.Message) }")
+	check.Error("ERROR: The build script has a syntax error, check the script in .gitlab-ci.yml")
+	check.Line("Exit 1")
+	check.Unindent()
+	check.Line("}")
+	buffer.Write(check.Bytes())
+	buffer.Write(b.Bytes())
+	return buffer.String()
+}
+
 func (b *PowerShell) GenerateScript(scriptType common.ShellScriptType, info common.ShellScriptInfo) (script string, err error) {
 	w := &PsWriter{
-		TemporaryPath: info.Build.FullProjectDir() + ".tmp",
+		TemporaryPath:  info.Build.FullProjectDir() + ".tmp",
+		ValidateSyntax: b.validateSyntax(scriptType, info),
 	}
 
-	if scriptType == common.ShellPrepareScript {
+	if scriptType == common.ShellGetSources {
 		if len(info.Build.Hostname) != 0 {
 			w.Line("echo \"Running on $env:computername via " + psQuoteVariable(info.Build.Hostname) + "...\"")
 		} else {
@@ -212,7 +271,11 @@ func (b *PowerShell) GenerateScript(scriptType common.ShellScriptType, info comm
 	}
 
 	err = b.writeScript(w, scriptType, info)
-	script = w.String()
+	if w.Len() == 0 {
+		// Nothing to execute, the stage is skipped
+		return
+	}
+	script = w.Finish()
 	return
 }
 
@@ -221,5 +284,6 @@ func (b *PowerShell) IsDefault() bool {
 }
 
 func init() {
-	common.RegisterShell(&PowerShell{})
+	common.RegisterShell(&PowerShell{Shell: "powershell"})
+	common.RegisterShell(&PowerShell{Shell: "pwsh"})
 }
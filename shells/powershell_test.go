@@ -0,0 +1,28 @@
+package shells
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPsQuote(t *testing.T) {
+	w := &PsWriter{}
+	assert.Equal(t, `'$HOME and "quotes"'`, w.Quote(`$HOME and "quotes"`), "the variables aren't expanded")
+	assert.Equal(t, `'it''s'`, w.Quote("it's"))
+	assert.Equal(t, "'it\u2019\u2019s'", w.Quote("it\u2019s"), "the typographic quotes are escaped")
+	assert.Equal(t, "'first\r\nsecond'", w.Quote("first\nsecond"))
+}
+
+func TestPsMultilineCommand(t *testing.T) {
+	w := &PsWriter{}
+	w.MultilineCommand("if ($true) {\n  echo a\r\n}")
+	assert.Equal(t, "if ($true) {\r\n  echo a\r\n}\r\n", w.String())
+}
+
+func TestPsWriteFile(t *testing.T) {
+	w := &PsWriter{}
+	w.WriteFile("dir/file", "it's $HOME")
+	assert.Equal(t, `[System.IO.File]::WriteAllBytes($ExecutionContext.SessionState.Path.GetUnresolvedProviderPathFromPSPath('dir\file'), `+
+		`[System.Convert]::FromBase64String('aXQncyAkSE9NRQ=='))`+"\r\n", w.String(), "the content is written byte-exact")
+}
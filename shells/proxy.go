@@ -0,0 +1,38 @@
+package shells
+
+import (
+	"os"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+// proxyVariableNames are the variables configuring the proxy of git and the helper commands
+var proxyVariableNames = []string{
+	"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY",
+	"http_proxy", "https_proxy", "no_proxy",
+}
+
+// getProxyVariables returns the proxy settings of the runner, which are not inherited
+// by the helper commands run in the containers or on the remote hosts,
+// the variables defined by the build or the runner `environment` take precedence
+func getProxyVariables(build *common.Build) (variables common.BuildVariables) {
+	defined := make(map[string]bool)
+	for _, variable := range build.GetAllVariables() {
+		defined[variable.Key] = true
+	}
+
+	for _, name := range proxyVariableNames {
+		value := os.Getenv(name)
+		if value == "" || defined[name] {
+			continue
+		}
+
+		variables = append(variables, common.BuildVariable{
+			Key:      name,
+			Value:    value,
+			Public:   true,
+			Internal: true,
+		})
+	}
+	return
+}
@@ -0,0 +1,49 @@
+package shells
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func setTestEnv(name, value string) func() {
+	previous, ok := os.LookupEnv(name)
+	os.Setenv(name, value)
+	return func() {
+		if ok {
+			os.Setenv(name, previous)
+		} else {
+			os.Unsetenv(name)
+		}
+	}
+}
+
+func TestProxyVariablesArePassedToHelpers(t *testing.T) {
+	defer setTestEnv("HTTP_PROXY", "http://proxy.example.com:3128")()
+	defer setTestEnv("NO_PROXY", "localhost")()
+
+	build := &common.Build{
+		BuildDir: "/builds/project",
+		Runner: &common.RunnerConfig{
+			RunnerSettings: common.RunnerSettings{
+				Environment: []string{"NO_PROXY=gitlab.example.com"},
+			},
+		},
+	}
+
+	variables := getProxyVariables(build)
+	assert.Equal(t, "http://proxy.example.com:3128", variables.Get("HTTP_PROXY"))
+	assert.Empty(t, variables.Get("NO_PROXY"), "the runner environment takes precedence")
+
+	w := &BashWriter{}
+	shell := AbstractShell{}
+	assert.NoError(t, shell.writeUploadArtifactsScript(w, common.ShellScriptInfo{
+		Build:         build,
+		RunnerCommand: "gitlab-runner",
+	}))
+	assert.True(t, strings.Contains(w.String(), "export HTTP_PROXY=$'http://proxy.example.com:3128'"), w.String())
+}
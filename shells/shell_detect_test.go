@@ -0,0 +1,43 @@
+package shells
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gitlab.com/gitlab-org/gitlab-ci-multi-runner/common"
+)
+
+func availableShells(names ...string) func(string) bool {
+	return func(shell string) bool {
+		for _, name := range names {
+			if name == shell {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func TestDetectShell(t *testing.T) {
+	defaultShell := common.GetDefaultShell()
+	assert.Equal(t, defaultShell, common.DetectShell(availableShells("sh", "pwsh", defaultShell)), "the default shell is preferred")
+	assert.Equal(t, "pwsh", common.DetectShell(availableShells("pwsh", "cmd")))
+	assert.Empty(t, common.DetectShell(availableShells("zsh")), "the unknown shells aren't used")
+}
+
+func TestDetectShellFallsBackToSh(t *testing.T) {
+	if common.GetDefaultShell() != "bash" {
+		t.Skip("bash is not the default shell")
+	}
+	assert.Equal(t, "sh", common.DetectShell(availableShells("cmd", "sh")))
+}
+
+func TestPowerShellCommand(t *testing.T) {
+	for _, name := range []string{"powershell", "pwsh"} {
+		configuration, err := common.GetShellConfiguration(common.ShellScriptInfo{Shell: name})
+		if assert.NoError(t, err) {
+			assert.Equal(t, name, configuration.Command)
+		}
+	}
+}
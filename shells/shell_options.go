@@ -1,19 +1,131 @@
 package shells
 
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+)
+
 type archivingOptions struct {
-	Untracked bool     `json:"untracked"`
+	Untracked    bool     `json:"untracked"`
+	Paths        []string `json:"paths"`
+	Exclude      []string `json:"exclude"`
+	Name         string   `json:"name"`
+	Key          string   `json:"key"`
+	Reproducible bool     `json:"reproducible"`
+	Fallback     *bool    `json:"fallback"`
+}
+
+// FallbackEnabled checks if the build allows the cache fallback configured for the runner
+func (o *archivingOptions) FallbackEnabled() bool {
+	return o.Fallback == nil || *o.Fallback
+}
+
+// Expand returns a copy of options with the variables expanded in the names and paths
+func (o *archivingOptions) Expand(expand func(string) string) *archivingOptions {
+	expanded := *o
+	expanded.Name = expand(o.Name)
+	expanded.Paths = expandList(o.Paths, expand)
+	expanded.Exclude = expandList(o.Exclude, expand)
+	return &expanded
+}
+
+func expandList(values []string, expand func(string) string) (expanded []string) {
+	for _, value := range values {
+		expanded = append(expanded, expand(value))
+	}
+	return
+}
+
+// extractionOptions select the files extracted from the artifacts of the dependency
+// and the directory, relative to the project, to which they are extracted
+type extractionOptions struct {
 	Paths     []string `json:"paths"`
-	Name      string   `json:"name"`
-	Key       string   `json:"key"`
+	Directory string   `json:"directory"`
+}
+
+// projectDependency is the job of other project, which artifacts are downloaded by the build
+type projectDependency struct {
+	extractionOptions
+	Project string `json:"project"`
+	Job     string `json:"job"`
+	Ref     string `json:"ref"`
+	Token   string `json:"token"`
+}
+
+var tokenVariablePattern = regexp.MustCompile(`^\$(\w+)$|^\$\{(\w+)\}$`)
+
+// TokenVariable returns the name of the variable with the private token, eg. $PRIVATE_TOKEN.
+// The literal tokens aren't accepted, as they would be passed on the command line of the helper
+func (d *projectDependency) TokenVariable() (string, bool) {
+	matches := tokenVariablePattern.FindStringSubmatch(d.Token)
+	if matches == nil {
+		return "", false
+	}
+	return matches[1] + matches[2], true
 }
 
-type dependencies []string
+// dependencies are the names of the jobs of the same project,
+// mixed with the jobs of other projects
+type dependencies struct {
+	Jobs       []string
+	Extraction map[string]extractionOptions
+	Projects   []projectDependency
+}
+
+func (m *dependencies) UnmarshalJSON(data []byte) error {
+	var items []json.RawMessage
+	err := json.Unmarshal(data, &items)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		var name string
+		if json.Unmarshal(item, &name) == nil {
+			m.Jobs = append(m.Jobs, name)
+			continue
+		}
+
+		var project projectDependency
+		err = json.Unmarshal(item, &project)
+		if err != nil {
+			return err
+		}
+		if project.Job == "" {
+			return errors.New("the dependency requires the job")
+		}
+
+		// The job of the same project with the extraction options
+		if project.Project == "" {
+			if project.Ref != "" || project.Token != "" {
+				return errors.New("the dependency on other project requires the project")
+			}
+			if m.Extraction == nil {
+				m.Extraction = make(map[string]extractionOptions)
+			}
+			m.Jobs = append(m.Jobs, project.Job)
+			m.Extraction[project.Job] = project.extractionOptions
+			continue
+		}
+		m.Projects = append(m.Projects, project)
+	}
+	return nil
+}
+
+// ExtractionFor returns the extraction options of the job of the same project
+func (m *dependencies) ExtractionFor(name string) extractionOptions {
+	if m == nil {
+		return extractionOptions{}
+	}
+	return m.Extraction[name]
+}
 
 func (m *dependencies) IsDependent(name string) bool {
 	if m == nil {
 		return true
 	}
-	for _, other := range *m {
+	for _, other := range m.Jobs {
 		if other == name {
 			return true
 		}
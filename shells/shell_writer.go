@@ -8,6 +8,15 @@ type ShellWriter interface {
 	Line(text string)
 	CheckForErrors()
 
+	// Quote returns the text as a single argument, it's passed literally
+	// including the quotes, backslashes and new lines
+	Quote(text string) string
+	// MultilineCommand writes the command of the user, which can span multiple lines
+	MultilineCommand(command string)
+	// WriteFile writes the content to the file without expanding it by the shell,
+	// the bytes are written as they are, without adding the new line at the end
+	WriteFile(path string, content string)
+
 	IfDirectory(path string)
 	IfFile(file string)
 	IfCmd(cmd string, arguments ...string)
@@ -15,6 +24,7 @@ type ShellWriter interface {
 	EndIf()
 
 	Cd(path string)
+	MkDir(path string)
 	RmDir(path string)
 	RmFile(path string)
 	Absolute(path string) string